@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/walk"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	FormatTarGz = "tar.gz"
+	FormatZip   = "zip"
+)
+
+var _ midas.Deployment = (*Deployment)(nil)
+
+// Deployment writes the built site into a single archive file, i.e. to be shipped by the pipeline as an artifact.
+type Deployment struct {
+	site               midas.Site
+	deploymentSettings midas.DeploymentSettings
+	publicPath         string
+	filter             walk.Filter
+
+	path   string
+	format string
+}
+
+func New(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
+	// Get build destination directory (or its deployed subdirectory)
+	publicPath, err := deploymentSettings.DeployPath(site, isDraft)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := deploymentSettings.FileFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := deploymentSettings.Archive
+	if settings.Path == "" {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "archive path is not set")
+	}
+
+	format := settings.Format
+	if format == "" {
+		format = FormatTarGz
+	}
+	if format != FormatTarGz && format != FormatZip {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "archive format %s is not supported", format)
+	}
+
+	path := settings.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(site.RootDir, path)
+	}
+
+	return &Deployment{
+		site:               site,
+		deploymentSettings: deploymentSettings,
+		publicPath:         publicPath,
+		filter:             filter,
+		path:               path,
+		format:             format,
+	}, nil
+}
+
+// Deploy writes built site into the archive file.
+func (d *Deployment) Deploy() error {
+	return d.DeployContext(context.Background())
+}
+
+// DeployContext writes built site into the archive file, aborting when the context is cancelled. The archive is
+// written to a temporary file first, so the previous archive is replaced only by the complete one.
+func (d *Deployment) DeployContext(ctx context.Context) (err error) {
+	manifest := midas.NewDeployManifest(d.deploymentSettings.Target)
+	defer func() {
+		midas.Metrics.SiteDeployed(d.site.SiteName, d.deploymentSettings.Target, manifest.Size(), time.Since(manifest.DeployedAt), err)
+	}()
+
+	// The previous archive isn't replaced with the empty one
+	if err = d.deploymentSettings.CheckOutputPath(d.publicPath); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(d.path)
+	if err = os.MkdirAll(dir, 0775); err != nil {
+		return err
+	}
+
+	output, err := os.CreateTemp(dir, ".midas-archive-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = output.Close()
+		if err != nil {
+			_ = os.Remove(output.Name())
+		}
+	}()
+
+	if err = Write(ctx, output, d.publicPath, d.format, d.filter, manifest); err != nil {
+		return err
+	}
+	if err = output.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(output.Name(), d.path); err != nil {
+		return err
+	}
+
+	return manifest.Write(d.site, d.deploymentSettings)
+}
+
+// entryWriter adds the files to the archive of given format.
+type entryWriter interface {
+	add(rel string, info os.FileInfo, content io.Reader) error
+	Close() error
+}
+
+// Write archives the files of the directory matching the filter into the writer, in the tar.gz or zip format.
+// The paths (relative to the directory, slash separated) and file modes are preserved. The archived files are
+// recorded in the manifest, if it's not nil.
+func Write(ctx context.Context, w io.Writer, dir, format string, filter walk.Filter, manifest *midas.DeployManifest) error {
+	var entries entryWriter
+	switch format {
+	case FormatTarGz:
+		entries = newTarGzWriter(w)
+	case FormatZip:
+		entries = &zipWriter{writer: zip.NewWriter(w)}
+	default:
+		return midas.Errorf(midas.ErrSiteConfig, "archive format %s is not supported", format)
+	}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !filter.Match(rel) {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		// Symlinks are archived as the files they point to
+		if info, err = file.Stat(); err != nil {
+			return err
+		}
+
+		if err = entries.add(rel, info, file); err != nil {
+			return err
+		}
+		if manifest != nil {
+			manifest.Add(rel, info.Size(), midas.FileContentType(path))
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = entries.Close()
+		return err
+	}
+
+	return entries.Close()
+}
+
+type tarGzWriter struct {
+	gzip *gzip.Writer
+	tar  *tar.Writer
+}
+
+func newTarGzWriter(w io.Writer) *tarGzWriter {
+	gzipWriter := gzip.NewWriter(w)
+
+	return &tarGzWriter{gzip: gzipWriter, tar: tar.NewWriter(gzipWriter)}
+}
+
+func (t *tarGzWriter) add(rel string, info os.FileInfo, content io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+
+	if err = t.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(t.tar, content)
+
+	return err
+}
+
+func (t *tarGzWriter) Close() error {
+	err := t.tar.Close()
+	if gzipErr := t.gzip.Close(); err == nil {
+		err = gzipErr
+	}
+
+	return err
+}
+
+type zipWriter struct {
+	writer *zip.Writer
+}
+
+func (z *zipWriter) add(rel string, info os.FileInfo, content io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	header.Method = zip.Deflate
+
+	entry, err := z.writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.writer.Close()
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"github.com/kovansky/midas/walk"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// archivedFile is the archive entry content and mode.
+type archivedFile struct {
+	content string
+	mode    os.FileMode
+}
+
+// writeFiles creates the files (relative path => content) with given modes in the directory.
+func writeFiles(t *testing.T, dir string, files map[string]archivedFile) {
+	t.Helper()
+
+	for path, file := range files {
+		absolute := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(absolute), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(absolute, []byte(file.content), file.mode); err != nil {
+			t.Fatal(err)
+		}
+		// Mode is set explicitly, as WriteFile is affected by umask
+		if err := os.Chmod(absolute, file.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readArchive returns the entries of the tar.gz or zip archive.
+func readArchive(t *testing.T, content []byte, format string) map[string]archivedFile {
+	t.Helper()
+
+	entries := make(map[string]archivedFile)
+
+	switch format {
+	case FormatTarGz:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tarReader := tar.NewReader(gzipReader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(tarReader)
+			entries[header.Name] = archivedFile{string(data), header.FileInfo().Mode()}
+		}
+	case FormatZip:
+		zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range zipReader.File {
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(reader)
+			_ = reader.Close()
+			entries[file.Name] = archivedFile{string(data), file.Mode()}
+		}
+	}
+
+	return entries
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]archivedFile{
+		"index.html":              {"<h1>Home</h1>", 0644},
+		"posts/hello/index.html":  {"<h1>Hello</h1>", 0640},
+		"scripts/deploy.sh":       {"#!/bin/sh", 0755},
+		"css/site.css.map":        {"{}", 0644},
+		"images/originals/a.png":  {"png", 0644},
+		"images/thumbnails/a.png": {"thumb", 0600},
+	})
+	expected := map[string]archivedFile{
+		"index.html":              {"<h1>Home</h1>", 0644},
+		"posts/hello/index.html":  {"<h1>Hello</h1>", 0640},
+		"scripts/deploy.sh":       {"#!/bin/sh", 0755},
+		"images/thumbnails/a.png": {"thumb", 0600},
+	}
+
+	filter, err := walk.NewFilter(nil, []string{"*.map", "images/originals/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatTarGz, FormatZip} {
+		t.Run(format, func(t *testing.T) {
+			var output bytes.Buffer
+			manifest := midas.NewDeployManifest("archive")
+
+			if err := Write(context.Background(), &output, dir, format, filter, manifest); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			entries := readArchive(t, output.Bytes(), format)
+			var names, manifestKeys []string
+			for name := range entries {
+				names = append(names, name)
+			}
+			for _, file := range manifest.Files {
+				manifestKeys = append(manifestKeys, file.Key)
+			}
+			sort.Strings(names)
+			sort.Strings(manifestKeys)
+
+			testing_utils.AssertEquals(t, strings.Join(names, ","), "images/thumbnails/a.png,index.html,posts/hello/index.html,scripts/deploy.sh", "Archived files")
+			testing_utils.AssertEquals(t, strings.Join(manifestKeys, ","), strings.Join(names, ","), "Manifest files")
+			for name, file := range expected {
+				testing_utils.AssertTable(t, map[string][]interface{}{
+					name + " content": {entries[name].content, file.content},
+					name + " mode":    {entries[name].mode, file.mode},
+				})
+			}
+		})
+	}
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		err := Write(context.Background(), io.Discard, dir, "rar", walk.Filter{}, nil)
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := Write(ctx, io.Discard, dir, FormatTarGz, walk.Filter{}, nil)
+		testing_utils.AssertEquals(t, err, context.Canceled, "Error")
+	})
+}
+
+func TestDeployment_Deploy(t *testing.T) {
+	rootDir := t.TempDir()
+	writeFiles(t, filepath.Join(rootDir, "public"), map[string]archivedFile{
+		"index.html": {"<h1>Home</h1>", 0644},
+	})
+	site := midas.Site{SiteName: "test", RootDir: rootDir}
+
+	deployment, err := New(site, midas.DeploymentSettings{
+		Target:  "archive",
+		Archive: midas.ArchiveDeploymentSettings{Path: "dist/site.zip", Format: FormatZip},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = deployment.Deploy()
+	content, readErr := os.ReadFile(filepath.Join(rootDir, "dist", "site.zip"))
+	leftovers, _ := filepath.Glob(filepath.Join(rootDir, "dist", ".midas-archive-*"))
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Deploy error":       {err, nil},
+		"Archive read error": {readErr, nil},
+		"Archived index":     {readArchive(t, content, FormatZip)["index.html"].content, "<h1>Home</h1>"},
+		"Temporary removed":  {len(leftovers), 0},
+	})
+
+	t.Run("Empty output", func(t *testing.T) {
+		if err := os.RemoveAll(filepath.Join(rootDir, "public")); err != nil {
+			t.Fatal(err)
+		}
+
+		err := deployment.Deploy()
+		kept, _ := os.ReadFile(filepath.Join(rootDir, "dist", "site.zip"))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":       {midas.ErrorCode(err), midas.ErrSiteConfig},
+			"Previous archive": {string(kept), string(content)},
+		})
+	})
+
+	for name, settings := range map[string]midas.ArchiveDeploymentSettings{
+		"Missing path":       {},
+		"Unsupported format": {Path: "site.rar", Format: "rar"},
+	} {
+		_, err = New(site, midas.DeploymentSettings{Target: "archive", Archive: settings}, false)
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, name)
+	}
+}
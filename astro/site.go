@@ -34,6 +34,10 @@ func NewSiteService(config midas.Site) (midas.SiteService, error) {
 
 	err := siteService.registry.OpenStorage()
 	if err != nil {
+		if config.Registry.RequireExisting {
+			return nil, midas.Errorf(midas.ErrRegistry, "registry storage can't be opened: %s", err)
+		}
+
 		err = siteService.registry.CreateStorage()
 		if err != nil {
 			return nil, err
@@ -78,6 +82,11 @@ func (s SiteService) BuildSite(_ bool, _ zerolog.Logger) error {
 	return nil
 }
 
+// BuildModel builds the whole site, as Astro doesn't support rendering only a part of it.
+func (s SiteService) BuildModel(_ string, useCache bool, log zerolog.Logger) error {
+	return s.BuildSite(useCache, log)
+}
+
 // ToDo: implement.
 // As for now only build process is needed, the project it is used for gets the data directly from API.
 
@@ -96,3 +105,20 @@ func (s SiteService) DeleteEntry(_ midas.Payload) (string, error) {
 func (s SiteService) UpdateSingle(_ midas.Payload) (string, error) {
 	return "", nil
 }
+
+// ResetRegistry removes all the entries from the registry. As Astro site doesn't create any files, removeFiles
+// has no effect.
+func (s SiteService) ResetRegistry(_ bool) error {
+	entries, err := s.registry.ReadEntries()
+	if err != nil {
+		return err
+	}
+
+	for id := range entries {
+		if err = s.registry.DeleteEntry(id); err != nil {
+			return err
+		}
+	}
+
+	return s.registry.Flush()
+}
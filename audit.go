@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultAuditLogPath = "midas-audit.log"
+
+// AuditRecord is the line of the audit log, recording the content change. Each record holds the hash of the previous
+// one, so the records modified or removed afterwards are detected by VerifyAuditLog.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Site      string    `json:"site"`
+	Operation string    `json:"operation"` // One of Entry* constants or SingleUpdated
+	Model     string    `json:"model"`
+	EntryId   string    `json:"entryId,omitempty"`
+	Path      string    `json:"path"`  // Path of the written (or removed) file
+	Event     string    `json:"event"` // Payload event which caused the change, i.e. Update
+	PrevHash  string    `json:"prevHash"`
+	Hash      string    `json:"hash"`
+}
+
+// auditLog serializes the appends to the audit log file, and caches the hash of its last record.
+type auditLog struct {
+	mu       sync.Mutex
+	lastHash string
+	loaded   bool
+}
+
+var (
+	auditLogsMu sync.Mutex
+	auditLogs   = map[string]*auditLog{}
+)
+
+// AuditLogPath returns the absolute path of the site audit log.
+func (s Site) AuditLogPath() string {
+	path := s.AuditLog.Path
+	if path == "" {
+		path = defaultAuditLogPath
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.RootDir, path)
+	}
+
+	return filepath.Clean(path)
+}
+
+// AppendAuditRecord appends the record to the audit log at the path, chained to the last record of the log. The
+// file is only ever appended to, and synced to the disk before returning. The appends within the process are
+// serialized per file; the file must not be written by other processes.
+//
+// The chain isn't verified before appending, so a modified log doesn't stop the recording (VerifyAuditLog reports
+// it). A torn trailing record, the partial line left by an interrupted append, is moved to the <path>.torn file first.
+func AppendAuditRecord(path string, record AuditRecord) error {
+	auditLogsMu.Lock()
+	log, ok := auditLogs[path]
+	if !ok {
+		log = &auditLog{}
+		auditLogs[path] = log
+	}
+	auditLogsMu.Unlock()
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if !log.loaded {
+		lastHash, err := loadAuditLog(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		log.lastHash, log.loaded = lastHash, true
+	}
+
+	record.Time = record.Time.UTC()
+	record.PrevHash = log.lastHash
+	record.Hash = auditHash(record)
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = file.Write(append(line, '\n'))
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		// The record may be torn, it's quarantined by the next append
+		log.loaded = false
+		return err
+	}
+
+	log.lastHash = record.Hash
+	return nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log at the path, and returns the number of its records. Returns
+// ErrInvalid if any record was modified, removed or reordered. The records truncated from the end of the log can be
+// detected only by comparing the number of records (or the last hash) with the one noted before. The torn trailing
+// record (see AppendAuditRecord) isn't counted, while the whole one missing only the line break is.
+func VerifyAuditLog(path string) (int, error) {
+	lastHash, count := "", 0
+	_, _, err := scanAuditLog(path, func(line []byte) error {
+		if len(line) == 0 {
+			return nil
+		}
+		count++
+
+		var record AuditRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return Errorf(ErrInvalid, "audit log %s record %d is malformed: %s", path, count, err)
+		}
+		if record.PrevHash != lastHash || record.Hash != auditHash(record) {
+			return Errorf(ErrInvalid, "audit log %s record %d doesn't match the hash chain", path, count)
+		}
+
+		lastHash = record.Hash
+		return nil
+	})
+
+	return count, err
+}
+
+// loadAuditLog returns the hash of the last record of the audit log, quarantining the torn trailing record (or
+// terminating the trailing record missing only the line break). The malformed records are skipped.
+func loadAuditLog(path string) (string, error) {
+	lastHash := ""
+	unterminated, torn, err := scanAuditLog(path, func(line []byte) error {
+		var record AuditRecord
+		if json.Unmarshal(line, &record) == nil {
+			lastHash = record.Hash
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case torn:
+		err = quarantineTornRecord(path, unterminated)
+	case unterminated >= 0:
+		err = appendLineBreak(path)
+	}
+
+	return lastHash, err
+}
+
+// scanAuditLog calls the function with each line of the audit log (without the line break). Returns the offset of
+// the trailing line without the line break (-1 if the log ends with one), and whether it's torn: not a whole JSON
+// record. The torn line is skipped.
+func scanAuditLog(path string, fn func(line []byte) error) (int64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return -1, false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) == 0 {
+				return -1, false, nil
+			}
+			if !json.Valid(line) {
+				return offset, true, nil
+			}
+
+			return offset, false, fn(line)
+		}
+		if err != nil {
+			return -1, false, err
+		}
+
+		offset += int64(len(line))
+		if err = fn(bytes.TrimSuffix(line, []byte("\n"))); err != nil {
+			return -1, false, err
+		}
+	}
+}
+
+// appendLineBreak terminates the last line of the audit log.
+func appendLineBreak(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write([]byte("\n"))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// quarantineTornRecord moves the end of the audit log, from the offset on, to the <path>.torn file, so the next
+// record starts on its own line.
+func quarantineTornRecord(path string, offset int64) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	torn, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	quarantine, err := os.OpenFile(path+".torn", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return err
+	}
+	_, err = quarantine.Write(append(torn, '\n'))
+	if err == nil {
+		err = quarantine.Sync()
+	}
+	if closeErr := quarantine.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = file.Truncate(offset); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// auditHash returns the hash of the record content, including the hash of the previous record.
+func auditHash(record AuditRecord) string {
+	record.Hash = ""
+	content, _ := json.Marshal(record)
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
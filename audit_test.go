@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendAuditRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.log")
+
+	for i, operation := range []string{midas.EntryCreated, midas.EntryUpdated, midas.EntryDeleted} {
+		err := midas.AppendAuditRecord(path, midas.AuditRecord{
+			Time:      time.Date(2022, 3, 5, 10, 0, i, 0, time.UTC),
+			Site:      "blog",
+			Operation: operation,
+			Model:     "post",
+			EntryId:   "post:1",
+			Path:      "content/posts/first.html",
+			Event:     "entry." + operation,
+		})
+		testing_utils.AssertEquals(t, err, nil, fmt.Sprintf("Append error of %s", operation))
+	}
+
+	content, _ := os.ReadFile(path)
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	count, err := midas.VerifyAuditLog(path)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Lines":        {len(lines), 3},
+		"Verify error": {err, nil},
+		"Records":      {count, 3},
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := bytes.Replace(content, []byte(`"operation":"delete"`), []byte(`"operation":"update"`), 1)
+		tamperedPath := filepath.Join(t.TempDir(), "audit.log")
+		if err := os.WriteFile(tamperedPath, tampered, 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := midas.VerifyAuditLog(tamperedPath)
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Error code")
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		removedPath := filepath.Join(t.TempDir(), "audit.log")
+		if err := os.WriteFile(removedPath, append(lines[0], append([]byte("\n"), lines[2]...)...), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := midas.VerifyAuditLog(removedPath)
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Error code")
+	})
+
+	t.Run("Torn record", func(t *testing.T) {
+		tornPath := filepath.Join(t.TempDir(), "audit.log")
+		torn := lines[2][:len(lines[2])/2]
+		if err := os.WriteFile(tornPath, append(append(lines[0], '\n'), torn...), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		tornCount, tornErr := midas.VerifyAuditLog(tornPath)
+		appendErr := midas.AppendAuditRecord(tornPath, midas.AuditRecord{Site: "blog", Operation: midas.EntryUpdated})
+		count, err := midas.VerifyAuditLog(tornPath)
+		quarantined, _ := os.ReadFile(tornPath + ".torn")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Torn verify error": {tornErr, nil},
+			"Torn records":      {tornCount, 1},
+			"Append error":      {appendErr, nil},
+			"Verify error":      {err, nil},
+			"Records":           {count, 2},
+			"Quarantined":       {string(quarantined), string(torn) + "\n"},
+		})
+	})
+
+	t.Run("Unterminated record", func(t *testing.T) {
+		unterminatedPath := filepath.Join(t.TempDir(), "audit.log")
+		if err := os.WriteFile(unterminatedPath, bytes.TrimSpace(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		unterminatedCount, unterminatedErr := midas.VerifyAuditLog(unterminatedPath)
+		appendErr := midas.AppendAuditRecord(unterminatedPath, midas.AuditRecord{Site: "blog", Operation: midas.EntryUpdated})
+		count, err := midas.VerifyAuditLog(unterminatedPath)
+		_, quarantineErr := os.Stat(unterminatedPath + ".torn")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Unterminated verify error": {unterminatedErr, nil},
+			"Unterminated records":      {unterminatedCount, 3},
+			"Append error":              {appendErr, nil},
+			"Verify error":              {err, nil},
+			"Records":                   {count, 4},
+			"Quarantined":               {os.IsNotExist(quarantineErr), true},
+		})
+	})
+
+	t.Run("Broken chain", func(t *testing.T) {
+		brokenPath := filepath.Join(t.TempDir(), "audit.log")
+		if err := os.WriteFile(brokenPath, bytes.Replace(content, []byte(`"operation":"create"`), []byte(`"operation":"update"`), 1), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		// The change is recorded, the break is reported by the verification
+		appendErr := midas.AppendAuditRecord(brokenPath, midas.AuditRecord{Site: "blog", Operation: midas.EntryUpdated})
+		appended, _ := os.ReadFile(brokenPath)
+		_, err := midas.VerifyAuditLog(brokenPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Append error": {appendErr, nil},
+			"Records":      {len(bytes.Split(bytes.TrimSpace(appended), []byte("\n"))), 4},
+			"Error code":   {midas.ErrorCode(err), midas.ErrInvalid},
+		})
+	})
+}
+
+func TestAppendAuditRecord_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			err := midas.AppendAuditRecord(path, midas.AuditRecord{Site: "blog", Operation: midas.EntryCreated, EntryId: fmt.Sprint(i)})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	count, err := midas.VerifyAuditLog(path)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Verify error": {err, nil},
+		"Records":      {count, 20},
+	})
+}
+
+func TestSite_AuditLogPath(t *testing.T) {
+	site := midas.Site{RootDir: "/srv/blog"}
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Default":  {site.AuditLogPath(), filepath.Join("/srv/blog", "midas-audit.log")},
+		"Relative": {midas.Site{RootDir: "/srv/blog", AuditLog: midas.AuditLogSettings{Path: "logs/audit.log"}}.AuditLogPath(), filepath.Join("/srv/blog", "logs", "audit.log")},
+		"Absolute": {midas.Site{RootDir: "/srv/blog", AuditLog: midas.AuditLogSettings{Path: "/var/log/midas.log"}}.AuditLogPath(), filepath.Clean("/var/log/midas.log")},
+	})
+}
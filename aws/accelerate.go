@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"strings"
+)
+
+// accelerateOptions returns the S3 client options enabling the Transfer Acceleration, if it's configured. The
+// accelerated endpoint is a subdomain of the bucket, so the bucket names with dots are rejected.
+func accelerateOptions(settings midas.AWSDeploymentSettigs) ([]func(*s3.Options), error) {
+	if !settings.Accelerate {
+		return nil, nil
+	}
+
+	if strings.Contains(settings.BucketName, ".") {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "transfer acceleration can't be used with bucket %s, as its name contains dots", settings.BucketName)
+	}
+
+	return []func(*s3.Options){func(o *s3.Options) {
+		o.UseAccelerate = true
+	}}, nil
+}
+
+// checkAcceleration verifies the bucket has the Transfer Acceleration enabled, if it's configured for the deployment.
+// Otherwise, the uploads would fail with the less clear errors of the accelerated endpoint.
+func (d *Deployment) checkAcceleration(ctx context.Context) error {
+	settings := d.deploymentSettings.AWS
+	if !settings.Accelerate {
+		return nil
+	}
+
+	// The bucket configuration is read from the regular endpoint
+	output, err := d.s3Client.GetBucketAccelerateConfiguration(ctx, &s3.GetBucketAccelerateConfigurationInput{
+		Bucket: aws.String(settings.BucketName),
+	}, func(o *s3.Options) {
+		o.UseAccelerate = false
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return midas.Errorf(midas.ErrSiteConfig, "checking transfer acceleration of bucket %s failed: %s", settings.BucketName, err)
+	}
+
+	if output.Status != s3types.BucketAccelerateStatusEnabled {
+		return midas.Errorf(midas.ErrSiteConfig, "transfer acceleration is not enabled for bucket %s", settings.BucketName)
+	}
+
+	return nil
+}
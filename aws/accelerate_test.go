@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_accelerateOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		settings       midas.AWSDeploymentSettigs
+		wantAccelerate bool
+		wantErr        string
+	}{
+		{"Disabled by default", midas.AWSDeploymentSettigs{BucketName: "bucket"}, false, ""},
+		{"Enabled", midas.AWSDeploymentSettigs{BucketName: "bucket", Accelerate: true}, true, ""},
+		{"Bucket with dots", midas.AWSDeploymentSettigs{BucketName: "www.example.com", Accelerate: true}, false, midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			optFns, err := accelerateOptions(tt.settings)
+
+			var options s3.Options
+			for _, optFn := range optFns {
+				optFn(&options)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":     {midas.ErrorCode(err), tt.wantErr},
+				"Use accelerate": {options.UseAccelerate, tt.wantAccelerate},
+			})
+		})
+	}
+}
+
+func TestNewWithHTTPClient_Accelerate(t *testing.T) {
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	_, err := NewWithHTTPClient(midas.Site{}, midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+		BucketName: "www.example.com",
+		Region:     "eu-central-1",
+		Accelerate: true,
+	}}, false, &recordingClient{})
+
+	testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+}
+
+func TestDeployment_checkAcceleration(t *testing.T) {
+	publicPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(publicPath, "index.html"), []byte("page"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		accelerate  bool
+		client      *fakeS3
+		wantErr     string
+		wantUploads int
+		wantChecks  int
+	}{
+		{"Disabled", false, &fakeS3{}, "", 1, 0},
+		{"Enabled for bucket", true, &fakeS3{accelerate: s3types.BucketAccelerateStatusEnabled}, "", 1, 1},
+		{"Suspended for bucket", true, &fakeS3{accelerate: s3types.BucketAccelerateStatusSuspended}, midas.ErrSiteConfig, 0, 1},
+		{"Never enabled for bucket", true, &fakeS3{}, midas.ErrSiteConfig, 0, 1},
+		{"SDK error", true, &fakeS3{accelerateErr: errors.New("access denied")}, midas.ErrSiteConfig, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDeployment(&fakeCloudfront{}, false)
+			d.deploymentSettings.AWS.BucketName = "bucket"
+			d.deploymentSettings.AWS.Accelerate = tt.accelerate
+			d.publicPath = publicPath
+			d.s3Client = tt.client
+			d.uploader = tt.client
+
+			err := d.DeployContext(context.Background())
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":          {midas.ErrorCode(err), tt.wantErr},
+				"Uploads":             {len(tt.client.uploads), tt.wantUploads},
+				"Acceleration checks": {tt.client.accelerateCalls, tt.wantChecks},
+			})
+		})
+	}
+}
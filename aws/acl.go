@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"errors"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/kovansky/midas"
+)
+
+// aclNotSupportedCode is returned by S3 for the requests with an ACL sent to the buckets with the ACLs disabled.
+const aclNotSupportedCode = "AccessControlListNotSupported"
+
+// objectACL returns the canned ACL set on the uploaded objects, or empty if none is configured or the ACLs are
+// disabled for the bucket (bucket owner enforced object ownership).
+func objectACL(settings midas.AWSDeploymentSettigs) (s3types.ObjectCannedACL, error) {
+	if settings.ACL == "" {
+		return "", nil
+	}
+
+	if settings.ACLDisabled {
+		return "", midas.Errorf(midas.ErrSiteConfig, "acl %s can't be set on the objects of bucket %s, as its acls are disabled", settings.ACL, settings.BucketName)
+	}
+
+	acl := s3types.ObjectCannedACL(settings.ACL)
+	for _, value := range acl.Values() {
+		if acl == value {
+			return acl, nil
+		}
+	}
+
+	return "", midas.Errorf(midas.ErrSiteConfig, "unknown canned acl %s", settings.ACL)
+}
+
+// isACLNotSupported returns true if the upload failed because the bucket has the ACLs disabled.
+func isACLNotSupported(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == aclNotSupportedCode
+}
+
+// uploadError returns the error of the object upload, replacing the one caused by the ACL sent to the bucket with
+// the ACLs disabled with a clearer one.
+func (d *Deployment) uploadError(err error, bucket string) error {
+	if !isACLNotSupported(err) {
+		return err
+	}
+
+	return midas.Errorf(midas.ErrSiteConfig, "bucket %s has the acls disabled (bucket owner enforced object ownership), remove the acl %s or set aclDisabled: %s", bucket, d.deploymentSettings.AWS.ACL, err)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_objectACL(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings midas.AWSDeploymentSettigs
+		wantACL  string
+		wantErr  string
+	}{
+		{"None", midas.AWSDeploymentSettigs{BucketName: "bucket"}, "", ""},
+		{"Canned", midas.AWSDeploymentSettigs{BucketName: "bucket", ACL: "public-read"}, "public-read", ""},
+		{"Unknown", midas.AWSDeploymentSettigs{BucketName: "bucket", ACL: "everyone"}, "", midas.ErrSiteConfig},
+		{"Disabled", midas.AWSDeploymentSettigs{BucketName: "bucket", ACLDisabled: true}, "", ""},
+		{"Requested on disabled", midas.AWSDeploymentSettigs{BucketName: "bucket", ACL: "public-read", ACLDisabled: true}, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := objectACL(tt.settings)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"ACL":        {string(acl), tt.wantACL},
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+			})
+		})
+	}
+}
+
+func TestNewWithHTTPClient_ACL(t *testing.T) {
+	_, err := NewWithHTTPClient(midas.Site{}, midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+		BucketName:  "bucket",
+		Region:      "eu-central-1",
+		ACL:         "public-read",
+		ACLDisabled: true,
+	}}, false, &recordingClient{})
+
+	testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+}
+
+func TestDeployment_DeployContext_ACL(t *testing.T) {
+	publicPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(publicPath, "index.html"), []byte("page"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		acl            string
+		aclDisabled    bool
+		bucketDisabled bool
+		wantACL        string
+		wantErr        string
+		wantUploads    int
+	}{
+		{"No acl", "", false, false, "", "", 1},
+		{"Acl sent", "public-read", false, false, "public-read", "", 1},
+		{"Acls disabled", "", true, true, "", "", 1},
+		{"Acl sent to bucket with acls disabled", "public-read", false, true, "", midas.ErrSiteConfig, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeS3{aclDisabled: tt.bucketDisabled}
+
+			d := newTestDeployment(&fakeCloudfront{}, false)
+			d.deploymentSettings.AWS.BucketName = "bucket"
+			d.deploymentSettings.AWS.ACL = tt.acl
+			d.deploymentSettings.AWS.ACLDisabled = tt.aclDisabled
+			d.publicPath = publicPath
+			d.s3Client = client
+			d.uploader = client
+
+			err := d.DeployContext(context.Background())
+
+			var acl string
+			if input, ok := client.inputs["index.html"]; ok {
+				acl = string(input.ACL)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Uploads":    {len(client.uploads), tt.wantUploads},
+				"ACL":        {acl, tt.wantACL},
+			})
+		})
+	}
+}
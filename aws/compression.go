@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"bytes"
+	"github.com/andybalholm/brotli"
+	"io"
+)
+
+// brotliSuffix is appended to the key of the object to get the key of its Brotli compressed variant.
+const brotliSuffix = ".br"
+
+// compressibleTypes are the content types which are worth compressing. Images (other than SVG), videos and archives
+// are already compressed.
+var compressibleTypes = map[string]bool{
+	"text/html":              true,
+	"text/css":               true,
+	"text/xml":               true,
+	"application/javascript": true,
+	"image/svg+xml":          true,
+}
+
+// brotliCompress returns the Brotli compressed content of the file, or nil if the compressed content isn't smaller
+// than the original. The file is rewound, so it can be uploaded as is.
+func brotliCompress(file io.ReadSeeker) ([]byte, error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var compressed bytes.Buffer
+	writer := brotli.NewWriterLevel(&compressed, brotli.BestCompression)
+	if _, err = writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	if compressed.Len() >= len(content) {
+		return nil, nil
+	}
+
+	return compressed.Bytes(), nil
+}
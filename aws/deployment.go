@@ -7,6 +7,7 @@
 package aws
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,84 +15,225 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
-	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/minify"
 	"github.com/kovansky/midas/walk"
+	"io"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
 
 var _ midas.Deployment = (*Deployment)(nil)
+var _ midas.FullDeployment = (*Deployment)(nil)
+
+// s3Client is the part of the S3 API used by the deployment.
+type s3Client interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	GetBucketAccelerateConfiguration(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error)
+}
+
+// uploader uploads the files to the S3 bucket.
+type uploader interface {
+	Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error)
+}
 
 type Deployment struct {
 	site               midas.Site
 	deploymentSettings midas.DeploymentSettings
 	publicPath         string
+	filter             walk.Filter
+	routes             []route
 
 	awsConfig aws.Config
-	s3Client  *s3.Client
-	cfClient  *cloudfront.Client
+	s3Client  s3Client
+	uploader  uploader
+	cfClient  cloudfrontClient
+
+	backoff      time.Duration // Initial delay between retries of throttled CloudFront calls
+	pollInterval time.Duration // Delay between checks of the invalidation status
+
+	deleteProgress func(done, total int) // Receives the progress of deleting the objects. Logged if nil
 }
 
 func New(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
-	// Get build destination directory
-	var publicPath = filepath.Join(site.RootDir, "public")
-
-	if !isDraft && site.OutputSettings.Build != "" {
-		if filepath.IsAbs(site.OutputSettings.Build) {
-			publicPath = site.OutputSettings.Build
-		} else {
-			publicPath = filepath.Join(site.RootDir, site.OutputSettings.Build)
-		}
-	} else if isDraft && site.OutputSettings.Draft != "" {
-		if filepath.IsAbs(site.OutputSettings.Draft) {
-			publicPath = site.OutputSettings.Draft
-		} else {
-			publicPath = filepath.Join(site.RootDir, site.OutputSettings.Draft)
-		}
+	httpClient, err := newHTTPClient(deploymentSettings.AWS.HTTP)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pass untyped nil, so the SDK default client is used
+	if httpClient == nil {
+		return NewWithHTTPClient(site, deploymentSettings, isDraft, nil)
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.Background(),
+	return NewWithHTTPClient(site, deploymentSettings, isDraft, httpClient)
+}
+
+// NewWithHTTPClient creates the deployment which sends the AWS requests with given client. The SDK default client is
+// used if the client is nil.
+func NewWithHTTPClient(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft bool, httpClient aws.HTTPClient) (midas.Deployment, error) {
+	// Get build destination directory (or its deployed subdirectory)
+	publicPath, err := deploymentSettings.DeployPath(site, isDraft)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := deploymentSettings.FileFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	// The prefix is evaluated once, so all the objects of the deployment share it
+	now := time.Now()
+	if deploymentSettings.AWS.S3Prefix, err = evaluatePrefix(deploymentSettings.AWS.S3Prefix, deploymentSettings.AWS, site, now); err != nil {
+		return nil, err
+	}
+
+	for _, warning := range ValidatePrefix(deploymentSettings.AWS.S3Prefix) {
+		log.Printf("aws deployment of %s: %s\n", site.SiteName, warning)
+	}
+
+	if _, err = extraFiles(deploymentSettings.AWS); err != nil {
+		return nil, err
+	}
+
+	if _, err = objectACL(deploymentSettings.AWS); err != nil {
+		return nil, err
+	}
+
+	if deploymentSettings.AWS.Release.Enabled && normalizePrefix(deploymentSettings.AWS.S3Prefix) == "" {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "blue/green release of %s requires the s3 prefix", site.SiteName)
+	}
+
+	routes, err := newRoutes(deploymentSettings.AWS, site, now)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []func(*config.LoadOptions) error{
 		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(deploymentSettings.AWS.AccessKey, deploymentSettings.AWS.SecretKey, "")),
-		config.WithRegion(deploymentSettings.AWS.Region))
+		config.WithRegion(deploymentSettings.AWS.Region),
+	}
+	if httpClient != nil {
+		options = append(options, config.WithHTTPClient(httpClient))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), options...)
 	if err != nil {
 		return nil, err
 	}
 
-	s3Client := s3.NewFromConfig(cfg)
+	s3Options, err := accelerateOptions(deploymentSettings.AWS)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Client := s3.NewFromConfig(cfg, s3Options...)
 	cfClient := cloudfront.NewFromConfig(cfg)
 
-	return &Deployment{site: site, deploymentSettings: deploymentSettings, publicPath: publicPath, s3Client: s3Client, cfClient: cfClient}, nil
+	return &Deployment{
+		site:               site,
+		deploymentSettings: deploymentSettings,
+		publicPath:         publicPath,
+		filter:             filter,
+		routes:             routes,
+		awsConfig:          cfg,
+		s3Client:           s3Client,
+		uploader:           manager.NewUploader(s3Client),
+		cfClient:           cfClient,
+		backoff:            invalidationBackoff,
+		pollInterval:       invalidationPollInterval,
+	}, nil
 }
 
 // Deploy uploads built site to the AWS S3 bucket.
 func (d *Deployment) Deploy() error {
-	walker, err := d.retrieveFiles()
+	return d.DeployContext(context.Background())
+}
+
+// DeployContext uploads built site to the AWS S3 bucket, aborting when the context is cancelled.
+func (d *Deployment) DeployContext(ctx context.Context) error {
+	return d.deploy(ctx, false)
+}
+
+// DeployFull uploads built site to the AWS S3 bucket like DeployContext. The CloudFront invalidation in progress
+// isn't reused, as it may have started before the upload, so a new one is always created.
+func (d *Deployment) DeployFull(ctx context.Context) error {
+	return d.deploy(ctx, true)
+}
+
+// deploy uploads built site to the AWS S3 bucket. All the files are uploaded first, and the previously deployed
+// objects which weren't uploaded again are deleted afterwards, so the site is served during the whole deployment.
+func (d *Deployment) deploy(ctx context.Context, full bool) (err error) {
+	manifest := midas.NewDeployManifest(d.deploymentSettings.Target)
+	defer func() {
+		midas.Metrics.SiteDeployed(d.site.SiteName, d.deploymentSettings.Target, manifest.Size(), time.Since(manifest.DeployedAt), err)
+	}()
+
+	// Stops the walker, if the deployment returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Guards the live site against the empty build output
+	if err = d.deploymentSettings.CheckOutputPath(d.publicPath); err != nil {
+		return err
+	}
+
+	if err = d.checkAcceleration(ctx); err != nil {
+		return err
+	}
+
+	owner, err := d.acquireLock(ctx)
+	if err != nil {
+		return err
+	}
+	// Released also when the deployment is cancelled; the lock expires if it fails
+	defer func() {
+		if unlockErr := d.releaseLock(context.Background(), owner); unlockErr != nil {
+			log.Printf("aws deployment of %s: releasing lock %s failed: %s\n", d.site.SiteName, d.lockKey(), unlockErr)
+		}
+	}()
+
+	extras, err := extraFiles(d.deploymentSettings.AWS)
 	if err != nil {
 		return err
 	}
 
-	var currentObjects []string
-	if currentObjects, err = d.listObjects(); err != nil {
+	if err = d.checkFreshPrefix(ctx); err != nil {
 		return err
 	}
 
-	_ = d.deleteObjects(currentObjects)
+	walker, walkErr := d.retrieveFiles(ctx)
+
+	sentKeys := make(map[string]bool) // Keys of the uploaded objects
+	var uploaded []uploadedObject     // Objects sampled for the verification
+	fileErrors := d.deploymentSettings.NewFileErrors()
 
 	// Upload each file to the S3 bucket.
-	uploader := manager.NewUploader(d.s3Client)
 	for path := range walker {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
 		err = func() error {
 			rel, err := filepath.Rel(d.publicPath, path)
 			if err != nil {
 				return err
 			}
 
+			// Replaced by the extra file
+			if _, ok := extras[filepath.ToSlash(rel)]; ok {
+				return nil
+			}
+
 			file, err := os.Open(path)
 			if err != nil {
 				return err
@@ -100,180 +242,287 @@ func (d *Deployment) Deploy() error {
 				_ = file.Close()
 			}()
 
-			if err = d.uploadFile(uploader, file, rel); err != nil {
+			sent, objects, err := d.uploadFile(ctx, file, rel)
+			if err != nil {
 				return err
 			}
+			uploaded = append(uploaded, objects...)
 
+			recordSent(sent, sentKeys, manifest)
 			return nil
 		}()
-		if err != nil {
+		if err = fileErrors.Add(path, err); err != nil {
 			return err
 		}
 	}
 
-	err = d.invalidateCloudfront()
-	if err != nil {
+	// The walk is stopped on cancellation, so the files may be missing
+	if err = ctx.Err(); err != nil {
 		return err
 	}
 
-	return nil
-}
+	// As well as on the walk failure, which would delete the objects of the missing files
+	if err = <-walkErr; err != nil {
+		return err
+	}
 
-// uploadFile uploads a file to the S3 bucket.
-func (d *Deployment) uploadFile(uploader *manager.Uploader, file *os.File, rel string) error {
-	fileKey := rel
-	if d.deploymentSettings.AWS.S3Prefix != "" {
-		fileKey = fmt.Sprintf("%s/%s", d.deploymentSettings.AWS.S3Prefix, rel)
+	// The partially uploaded site isn't released nor invalidated, and its orphans aren't deleted
+	if err = fileErrors.Err(); err != nil {
+		return err
 	}
 
-	fileKey = strings.ReplaceAll(fileKey, "\\", "/")
+	// The extra files replace the walked ones of the same path
+	extraObjects, err := d.uploadExtraFiles(ctx, extras, manifest, sentKeys)
+	if err != nil {
+		return err
+	}
+	uploaded = append(uploaded, extraObjects...)
 
-	contentType := getFileContentType(file.Name())
-	cacheControl := getFileCacheControl(file.Name())
+	if err = d.verifyObjects(ctx, uploaded); err != nil {
+		return err
+	}
 
-	_, err := uploader.Upload(context.Background(), &s3.PutObjectInput{
-		Bucket:       aws.String(d.deploymentSettings.AWS.BucketName),
-		Key:          aws.String(fileKey),
-		Body:         file,
-		ContentType:  aws.String(contentType),
-		CacheControl: aws.String(cacheControl),
-	})
+	if err = d.deleteOrphanedObjects(ctx, sentKeys); err != nil {
+		return err
+	}
+
+	if d.deploymentSettings.AWS.Release.Enabled {
+		if _, err = d.Swap(ctx, d.deploymentSettings.AWS.S3Prefix); err != nil {
+			return err
+		}
+	}
+
+	err = d.invalidateCloudfront(ctx, !full)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return manifest.Write(d.site, d.deploymentSettings)
 }
 
-// listObjects retrieves a list of objects in the S3 bucket.
-func (d *Deployment) listObjects() ([]string, error) {
-	var objects []string
+// deleteOrphanedObjects deletes the previously deployed objects (from all the destinations) which weren't uploaded by
+// the deployment (sent keys). Failed deletes are logged, without failing the deployment, as the objects are only stale.
+func (d *Deployment) deleteOrphanedObjects(ctx context.Context, sentKeys map[string]bool) error {
+	var buckets []string
+	orphans := make(map[string][]string) // [bucket] => keys
 
-	output, err := d.s3Client.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(d.deploymentSettings.AWS.BucketName),
-	})
-	if err != nil {
-		return nil, err
+	for _, dest := range d.destinations() {
+		keys, err := d.listObjects(ctx, dest)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := orphans[dest.bucket]; !ok {
+			buckets = append(buckets, dest.bucket)
+		}
+		for _, key := range keys {
+			if !sentKeys[d.objectID(dest.bucket, key)] {
+				orphans[dest.bucket] = append(orphans[dest.bucket], key)
+			}
+		}
 	}
 
-	for _, obj := range output.Contents {
-		objects = append(objects, aws.ToString(obj.Key))
+	for _, bucket := range buckets {
+		report := d.deleteObjects(ctx, bucket, orphans[bucket])
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, failure := range report.Failures {
+			log.Printf("aws deployment of %s: deleting %s failed: %s %s\n", d.site.SiteName, failure.Key, failure.Code, failure.Message)
+		}
 	}
 
-	return objects, nil
+	return nil
 }
 
-// deleteObjects deletes objects from the S3 bucket.
-func (d *Deployment) deleteObjects(objects []string) error {
-	var identifiers []s3types.ObjectIdentifier
-	for key := range objects {
-		identifiers = append(identifiers, s3types.ObjectIdentifier{
-			Key: aws.String(objects[key]),
-		})
+// recordSent adds the sent objects to the sent keys, and to the manifest.
+func recordSent(sent []midas.ManifestFile, sentKeys map[string]bool, manifest *midas.DeployManifest) {
+	for _, object := range sent {
+		sentKeys[object.Key] = true
+		manifest.Add(object.Key, object.Size, object.ContentType)
 	}
+}
 
-	_, err := d.s3Client.DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
-		Bucket: aws.String(d.deploymentSettings.AWS.BucketName),
-		Delete: &s3types.Delete{
-			Objects: identifiers,
-		},
-	})
-
+// uploadFile uploads a file to the S3 bucket and returns the sent objects (the file, followed by its Brotli variant
+// if uploaded), with their ids (see objectID), along with the size and content type of the uploaded content.
+// The uploaded objects to verify are returned as well, if the file is sampled for the verification.
+func (d *Deployment) uploadFile(ctx context.Context, file *os.File, rel string) ([]midas.ManifestFile, []uploadedObject, error) {
+	contentType, err := d.deploymentSettings.ContentType(file, file.Name())
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	return nil
+	return d.uploadContent(ctx, file, file.Name(), contentType, rel)
 }
 
-// invalidateCloudfront invalidates the HTML files in the Cloudfront distribution.
-func (d *Deployment) invalidateCloudfront() error {
-	paths := []string{"/*"}
-
-	if d.deploymentSettings.AWS.CloudfrontDistribution != "" {
-		_, err := d.cfClient.CreateInvalidation(context.Background(), &cloudfront.CreateInvalidationInput{
-			DistributionId: aws.String(d.deploymentSettings.AWS.CloudfrontDistribution),
-			InvalidationBatch: &cftypes.InvalidationBatch{
-				CallerReference: aws.String(fmt.Sprintf("MIDAS-%s", strconv.FormatInt(time.Now().Unix(), 10))),
-				Paths: &cftypes.Paths{
-					Quantity: aws.Int32(int32(len(paths))),
-					Items:    paths,
-				},
-			},
-		})
+// uploadContent uploads the content of the file with given name (which determines the cache control) as uploadFile.
+func (d *Deployment) uploadContent(ctx context.Context, content io.ReadSeeker, name, contentType, rel string) ([]midas.ManifestFile, []uploadedObject, error) {
+	dest := d.destination(rel, contentType)
+	fileKey := dest.key(rel)
+
+	cacheControl := midas.ContentCacheControl(name, contentType)
+
+	acl, err := objectACL(d.deploymentSettings.AWS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	input := &s3.PutObjectInput{
+		ACL:          acl,
+		Bucket:       aws.String(dest.bucket),
+		Key:          aws.String(fileKey),
+		ContentType:  aws.String(contentType),
+		CacheControl: aws.String(cacheControl),
+	}
+	if contentDisposition := d.contentDisposition(rel); contentDisposition != "" {
+		input.ContentDisposition = aws.String(contentDisposition)
+	}
+	d.applyExpiration(input, rel, time.Now())
+
+	body, err := d.uploadBody(content, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+	variant, err := d.brotliVariant(body, contentType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The verification samples the file along with its variant
+	sample := d.sampleForVerification()
+
+	inputs := []*s3.PutObjectInput{input}
+	bodies := []io.ReadSeeker{body}
+	if variant != nil {
+		// The object stays uncompressed for the clients without Brotli support, the variant is served to the others
+		// (i.e. by the edge function checking Accept-Encoding)
+		variantInput := *input
+		variantInput.Key = aws.String(fileKey + brotliSuffix)
+		variantInput.ContentEncoding = aws.String("br")
 
+		inputs = append(inputs, &variantInput)
+		bodies = append(bodies, bytes.NewReader(variant))
+	}
+
+	var (
+		sent    []midas.ManifestFile
+		objects []uploadedObject
+	)
+	for i, input := range inputs {
+		object, uploaded, err := d.putObject(ctx, input, bodies[i], sample)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+
+		sent = append(sent, object)
+		if uploaded != nil {
+			objects = append(objects, *uploaded)
 		}
 	}
 
-	return nil
+	return sent, objects, nil
 }
 
-// retrieveFiles walks the public directory and returns a channel of files to be uploaded.
-func (d *Deployment) retrieveFiles() (walk.FileWalk, error) {
-	walker := make(walk.FileWalk)
+// putObject uploads the body with the input headers and returns the sent object, along with the uploaded object to
+// verify, if sampled.
+func (d *Deployment) putObject(ctx context.Context, input *s3.PutObjectInput, body io.ReadSeeker, sample bool) (midas.ManifestFile, *uploadedObject, error) {
+	input.Body = body
+	bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
 
-	// Gather the files to upload by walking the path recursively.
-	go func() {
-		defer close(walker)
-		if err := filepath.Walk(d.publicPath, walker.Walk); err != nil {
-			panic(err)
+	sent := midas.ManifestFile{Key: d.objectID(bucket, key), ContentType: aws.ToString(input.ContentType)}
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return midas.ManifestFile{}, nil, err
+	}
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return midas.ManifestFile{}, nil, err
+	}
+	sent.Size = size
+
+	var object *uploadedObject
+	if sample {
+		size, checksum, err := contentChecksum(body)
+		if err != nil {
+			return midas.ManifestFile{}, nil, err
 		}
-	}()
 
-	return walker, nil
-}
+		object = &uploadedObject{bucket: bucket, key: key, size: size, md5: checksum}
+	}
 
-// getFileCacheControl returns the max-age value for the file based on it's type.
-func getFileCacheControl(fileName string) string {
-	halfYear := int64(60 * 60 * 24 * 182)
-
-	switch {
-	case strings.HasSuffix(fileName, ".html"):
-		return "no-cache, no-store"
-	case strings.HasSuffix(fileName, ".js"), strings.HasSuffix(fileName, ".css"),
-		strings.HasSuffix(fileName, ".svg"), strings.HasSuffix(fileName, ".png"),
-		strings.HasSuffix(fileName, ".jpg"), strings.HasSuffix(fileName, ".jpeg"),
-		strings.HasSuffix(fileName, ".gif"):
-		return fmt.Sprintf("public, max-age=%d", halfYear)
-	default:
-		return fmt.Sprintf("public, max-age=%d", halfYear)
+	if _, err = d.uploader.Upload(ctx, input); err != nil {
+		return midas.ManifestFile{}, nil, d.uploadError(err, bucket)
 	}
+
+	return sent, object, nil
 }
 
-// getFileContentType returns the content type of the file based on the extension.
-func getFileContentType(fileName string) string {
-	typeByExtension := map[string]string{
-		".html": "text/html",
-		".css":  "text/css",
-		".xml":  "text/xml",
+// uploadBody returns the content uploaded for the file, minified if enabled for the content type.
+func (d *Deployment) uploadBody(file io.ReadSeeker, contentType string) (io.ReadSeeker, error) {
+	body, _, err := minify.Content(file, contentType, d.deploymentSettings.Minify)
 
-		".js":  "application/javascript",
-		".pdf": "application/pdf",
+	return body, err
+}
 
-		".png":  "image/png",
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".gif":  "image/gif",
-		".svg":  "image/svg+xml",
-		".webp": "image/webp",
+// brotliVariant returns the Brotli compressed variant of the content, or nil if the compression isn't enabled for
+// the content type, or doesn't make it smaller. The content is rewound.
+func (d *Deployment) brotliVariant(content io.ReadSeeker, contentType string) ([]byte, error) {
+	if !d.deploymentSettings.AWS.Brotli || !compressibleTypes[contentType] {
+		return nil, nil
+	}
 
-		".webm": "video/webm",
-		".mp4":  "video/mp4",
-		".ogv":  "video/ogg",
-		".avi":  "video/x-msvideo",
+	return brotliCompress(content)
+}
 
-		".ogg":  "audio/ogg",
-		".mp3":  "audio/mpeg",
-		".mpeg": "audio/mpeg",
-	}
+// objectKey returns the key of the object for the file path relative to the public directory, in the primary
+// destination.
+func (d *Deployment) objectKey(rel string) string {
+	return d.primaryDestination().key(rel)
+}
 
-	extension := filepath.Ext(fileName)
+// contentDisposition returns the Content-Disposition for the file (path relative to the public directory), if it is
+// configured as an attachment. Empty string means the default (inline) behavior.
+func (d *Deployment) contentDisposition(rel string) string {
+	rel = filepath.ToSlash(rel)
+	attachments := d.deploymentSettings.AWS.Attachments
 
-	if contentType, ok := typeByExtension[extension]; ok {
-		return contentType
-	} else {
-		return "application/octet-stream"
+	isAttachment := false
+	for _, extension := range attachments.Extensions {
+		if strings.EqualFold(path.Ext(rel), "."+strings.TrimPrefix(extension, ".")) {
+			isAttachment = true
+		}
 	}
+	for _, dir := range attachments.Dirs {
+		dir = strings.Trim(filepath.ToSlash(dir), "/")
+		if dir != "" && strings.HasPrefix(rel, dir+"/") {
+			isAttachment = true
+		}
+	}
+
+	if !isAttachment {
+		return ""
+	}
+
+	return fmt.Sprintf("attachment; filename=%q", path.Base(rel))
+}
+
+// retrieveFiles walks the public directory and returns a channel of files to be uploaded, along with the channel
+// receiving the walk error (ErrInternal, or nil if the walk succeeded or was cancelled) once the files channel is
+// closed.
+func (d *Deployment) retrieveFiles(ctx context.Context) (walk.FileWalk, <-chan error) {
+	walker := make(walk.FileWalk)
+	walkErr := make(chan error, 1)
+
+	// Gather the files to upload by walking the path recursively, until the context is cancelled.
+	go func() {
+		defer close(walker)
+
+		err := filepath.Walk(d.publicPath, walker.WalkFiltered(ctx, d.publicPath, d.filter))
+		if err != nil && ctx.Err() == nil {
+			walkErr <- midas.Errorf(midas.ErrInternal, "walking %s failed: %s", d.publicPath, err)
+			return
+		}
+		walkErr <- nil
+	}()
+
+	return walker, walkErr
 }
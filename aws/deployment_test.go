@@ -0,0 +1,636 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployment_contentDisposition(t *testing.T) {
+	d := &Deployment{deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+		Attachments: midas.AttachmentSettings{
+			Extensions: []string{".pdf", "zip"},
+			Dirs:       []string{"/downloads/"},
+		},
+	}}}
+
+	tests := []struct {
+		rel      string
+		expected string
+	}{
+		{"index.html", ""},
+		{"posts/hello/index.html", ""},
+		{"files/report.pdf", `attachment; filename="report.pdf"`},
+		{"files/REPORT.PDF", `attachment; filename="REPORT.PDF"`},
+		{"archive.zip", `attachment; filename="archive.zip"`},
+		{"downloads/logo.png", `attachment; filename="logo.png"`},
+		{"downloads-list/logo.png", ""},
+		{"img/pdf.png", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			testing_utils.AssertEquals(t, d.contentDisposition(tt.rel), tt.expected, "Content-Disposition")
+		})
+	}
+
+	t.Run("Not configured", func(t *testing.T) {
+		d := &Deployment{}
+		testing_utils.AssertEquals(t, d.contentDisposition("files/report.pdf"), "", "Content-Disposition")
+	})
+}
+
+// recordingClient records the requests instead of sending them.
+type recordingClient struct {
+	requests []*http.Request
+}
+
+func (c *recordingClient) Do(request *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, request)
+
+	return nil, errors.New("request recorded")
+}
+
+func TestNewWithHTTPClient(t *testing.T) {
+	// The CA bundle from the environment requires the default transport
+	t.Setenv("AWS_CA_BUNDLE", "")
+	client := &recordingClient{}
+
+	deployment, err := NewWithHTTPClient(midas.Site{}, midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+		BucketName: "bucket",
+		Region:     "eu-central-1",
+	}}, false, client)
+	if err != nil {
+		t.Fatalf("NewWithHTTPClient() error = %v", err)
+	}
+
+	testing_utils.AssertEquals(t, deployment.(*Deployment).awsConfig.HTTPClient, aws.HTTPClient(client), "HTTP client")
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		client, err := newHTTPClient(midas.AWSHTTPSettings{})
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":  {err, nil},
+			"Client": {client == nil, true},
+		})
+	})
+
+	t.Run("proxy and timeout", func(t *testing.T) {
+		client, err := newHTTPClient(midas.AWSHTTPSettings{ProxyUrl: "http://proxy.local:3128", Timeout: 30})
+		if err != nil {
+			t.Fatalf("newHTTPClient() error = %v", err)
+		}
+
+		request, _ := http.NewRequest(http.MethodGet, "https://bucket.s3.amazonaws.com/", nil)
+		proxyUrl, err := client.Transport.(*http.Transport).Proxy(request)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Proxy":   {proxyUrl.String(), "http://proxy.local:3128"},
+			"Timeout": {client.Timeout, 30 * time.Second},
+		})
+	})
+
+	t.Run("invalid proxy", func(t *testing.T) {
+		_, err := newHTTPClient(midas.AWSHTTPSettings{ProxyUrl: "proxy.local:3128"})
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+
+	t.Run("missing ca bundle", func(t *testing.T) {
+		_, err := newHTTPClient(midas.AWSHTTPSettings{CABundle: "/nonexistent/ca.pem"})
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
+
+// fakeS3 records the S3 calls; the uploader cancels the deployment after given number of uploads.
+type fakeS3 struct {
+	cancel      context.CancelFunc
+	cancelAfter int
+
+	failing     map[string]bool // Keys whose upload fails
+	uploads     []string
+	buckets     map[string]string // [key] => bucket of the stored object
+	aclDisabled bool              // Rejects the uploads with an ACL, like the buckets with the ACLs disabled
+	deleteCalls int
+	deleted     []string // Keys of the deleted objects
+	uploadsLeft int      // Number of uploads when the objects were deleted
+	bodies      map[string][]byte
+	encodings   map[string]string
+	inputs      map[string]*s3.PutObjectInput
+
+	heads     map[string]*s3.HeadObjectOutput // Overrides the metadata of the uploaded objects
+	headCalls int
+
+	accelerate      s3types.BucketAccelerateStatus
+	accelerateErr   error
+	accelerateCalls int
+}
+
+// ListObjectsV2 lists the stored objects of the bucket under the prefix, on a single page.
+func (f *fakeS3) ListObjectsV2(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range f.bodies {
+		if f.buckets[key] == aws.ToString(input.Bucket) && strings.HasPrefix(key, aws.ToString(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, s3types.Object{Key: aws.String(key), Size: int64(len(f.bodies[key]))})
+	}
+
+	return output, nil
+}
+
+func (f *fakeS3) DeleteObjects(_ context.Context, input *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.deleteCalls++
+	f.uploadsLeft = len(f.uploads)
+	for _, object := range input.Delete.Objects {
+		f.deleted = append(f.deleted, aws.ToString(object.Key))
+		delete(f.bodies, aws.ToString(object.Key))
+		delete(f.buckets, aws.ToString(object.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (f *fakeS3) HeadObject(_ context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.headCalls++
+
+	key := aws.ToString(input.Key)
+	if head, ok := f.heads[key]; ok {
+		return head, nil
+	}
+
+	body, ok := f.bodies[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	checksum := md5.Sum(body)
+	return &s3.HeadObjectOutput{ContentLength: int64(len(body)), ETag: aws.String(`"` + hex.EncodeToString(checksum[:]) + `"`)}, nil
+}
+
+func (f *fakeS3) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.bodies[aws.ToString(input.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func (f *fakeS3) GetBucketAccelerateConfiguration(_ context.Context, _ *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error) {
+	f.accelerateCalls++
+
+	var options s3.Options
+	for _, optFn := range optFns {
+		optFn(&options)
+	}
+	if options.UseAccelerate {
+		return nil, errors.New("accelerated endpoint used")
+	}
+	if f.accelerateErr != nil {
+		return nil, f.accelerateErr
+	}
+
+	return &s3.GetBucketAccelerateConfigurationOutput{Status: f.accelerate}, nil
+}
+
+func (f *fakeS3) Upload(ctx context.Context, input *s3.PutObjectInput, _ ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.failing[aws.ToString(input.Key)] {
+		return nil, fmt.Errorf("upload of %s failed", aws.ToString(input.Key))
+	}
+	if f.aclDisabled && input.ACL != "" {
+		return nil, &smithy.GenericAPIError{Code: aclNotSupportedCode, Message: "The bucket does not allow ACLs"}
+	}
+
+	body, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.bodies == nil {
+		f.bodies = map[string][]byte{}
+	}
+	if f.inputs == nil {
+		f.encodings, f.inputs = map[string]string{}, map[string]*s3.PutObjectInput{}
+		f.buckets = map[string]string{}
+	}
+	f.buckets[aws.ToString(input.Key)] = aws.ToString(input.Bucket)
+	f.inputs[aws.ToString(input.Key)] = input
+	f.bodies[aws.ToString(input.Key)] = body
+	f.encodings[aws.ToString(input.Key)] = aws.ToString(input.ContentEncoding)
+
+	f.uploads = append(f.uploads, aws.ToString(input.Key))
+	if len(f.uploads) == f.cancelAfter {
+		f.cancel()
+	}
+
+	return &manager.UploadOutput{}, nil
+}
+
+func TestDeployment_DeployContext(t *testing.T) {
+	publicPath := t.TempDir()
+	for i := 0; i < 10; i++ {
+		if err := os.WriteFile(filepath.Join(publicPath, fmt.Sprintf("page-%d.html", i)), []byte("page"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newDeployment := func(client *fakeS3, cf *fakeCloudfront) *Deployment {
+		d := newTestDeployment(cf, false)
+		d.publicPath = publicPath
+		d.s3Client = client
+		d.uploader = client
+
+		return d
+	}
+
+	t.Run("cancelled mid-deploy", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		client := &fakeS3{cancel: cancel, cancelAfter: 3}
+		cf := &fakeCloudfront{}
+
+		err := newDeployment(client, cf).DeployContext(ctx)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":              {errors.Is(err, context.Canceled), true},
+			"Uploads":            {len(client.uploads), 3},
+			"Invalidation calls": {cf.listCalls + len(cf.createCalls), 0},
+		})
+	})
+
+	t.Run("cancelled before deploy", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		client := &fakeS3{cancel: cancel}
+
+		err := newDeployment(client, &fakeCloudfront{}).DeployContext(ctx)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {errors.Is(err, context.Canceled), true},
+			"Uploads": {len(client.uploads), 0},
+		})
+	})
+
+	t.Run("not cancelled", func(t *testing.T) {
+		client := &fakeS3{cancel: func() {}}
+		cf := &fakeCloudfront{}
+
+		err := newDeployment(client, cf).DeployContext(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"Uploads":      {len(client.uploads), 10},
+			"Create calls": {len(cf.createCalls), 1},
+		})
+	})
+}
+
+func TestDeployment_DeployContext_Orphans(t *testing.T) {
+	publicPath := t.TempDir()
+	for _, name := range []string{"index.html", "about.html"} {
+		if err := os.WriteFile(filepath.Join(publicPath, name), []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// deployFrom deploys the site built in the directory to the bucket holding the previous deployment
+	deployFrom := func(publicPath string, failing map[string]bool) (*fakeS3, error) {
+		client := &fakeS3{cancel: func() {}, failing: failing}
+		client.bodies = map[string][]byte{"index.html": []byte("old"), "removed.html": []byte("removed")}
+		client.buckets = map[string]string{"index.html": "bucket", "removed.html": "bucket"}
+		client.encodings, client.inputs = map[string]string{}, map[string]*s3.PutObjectInput{}
+
+		d := newTestDeployment(&fakeCloudfront{}, false)
+		d.deploymentSettings.AWS.BucketName = "bucket"
+		d.publicPath = publicPath
+		d.s3Client = client
+		d.uploader = client
+
+		return client, d.DeployContext(context.Background())
+	}
+	deploy := func(failing map[string]bool) (*fakeS3, error) {
+		return deployFrom(publicPath, failing)
+	}
+
+	t.Run("Deleted after upload", func(t *testing.T) {
+		client, err := deploy(nil)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Deleted":        {strings.Join(client.deleted, ","), "removed.html"},
+			"Uploads before": {client.uploadsLeft, 2},
+			"Index":          {string(client.bodies["index.html"]), "index.html"},
+		})
+	})
+
+	t.Run("Kept on failed upload", func(t *testing.T) {
+		client, err := deploy(map[string]bool{"index.html": true})
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err != nil, true},
+			"Delete calls": {client.deleteCalls, 0},
+		})
+	})
+
+	t.Run("Empty output", func(t *testing.T) {
+		client, err := deployFrom(t.TempDir(), nil)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":   {midas.ErrorCode(err), midas.ErrSiteConfig},
+			"Uploads":      {len(client.uploads), 0},
+			"Delete calls": {client.deleteCalls, 0},
+			"Index":        {string(client.bodies["index.html"]), "old"},
+		})
+	})
+
+	t.Run("Walk error", func(t *testing.T) {
+		d := newTestDeployment(&fakeCloudfront{}, false)
+		d.publicPath = filepath.Join(t.TempDir(), "missing")
+
+		walker, walkErr := d.retrieveFiles(context.Background())
+		for range walker {
+		}
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(<-walkErr), midas.ErrInternal, "Walk error code")
+	})
+}
+
+func TestDeployment_DeployContext_CollectErrors(t *testing.T) {
+	publicPath := t.TempDir()
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(filepath.Join(publicPath, fmt.Sprintf("page-%d.html", i)), []byte("page"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deploy := func(collect bool) (*fakeS3, *fakeCloudfront, error) {
+		client := &fakeS3{cancel: func() {}, failing: map[string]bool{"page-1.html": true, "page-3.html": true}}
+		cf := &fakeCloudfront{}
+
+		d := newTestDeployment(cf, false)
+		d.deploymentSettings.CollectErrors = collect
+		d.publicPath = publicPath
+		d.s3Client = client
+		d.uploader = client
+
+		return client, cf, d.DeployContext(context.Background())
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		client, cf, err := deploy(false)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":              {fmt.Sprint(err), "upload of page-1.html failed"},
+			"Uploads":            {strings.Join(client.uploads, ","), "page-0.html"},
+			"Invalidation calls": {cf.listCalls + len(cf.createCalls), 0},
+		})
+	})
+
+	t.Run("collected", func(t *testing.T) {
+		client, cf, err := deploy(true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {fmt.Sprint(err), fmt.Sprintf("deployment of 2 files failed:\n%s: upload of page-1.html failed\n%s: upload of page-3.html failed",
+				filepath.Join(publicPath, "page-1.html"), filepath.Join(publicPath, "page-3.html"))},
+			"Uploads":            {strings.Join(client.uploads, ","), "page-0.html,page-2.html,page-4.html"},
+			"Invalidation calls": {cf.listCalls + len(cf.createCalls), 0},
+		})
+	})
+}
+
+func TestDeployment_Brotli(t *testing.T) {
+	page := bytes.Repeat([]byte("<p>Lorem ipsum dolor sit amet</p>\n"), 100)
+	files := map[string][]byte{
+		"index.html": page,
+		"tiny.css":   []byte("a"),
+		"image.png":  page,
+	}
+
+	publicPath := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(publicPath, name), content, 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deploy := func(enabled bool) *fakeS3 {
+		client := &fakeS3{cancel: func() {}}
+
+		d := newTestDeployment(&fakeCloudfront{}, false)
+		d.publicPath = publicPath
+		d.deploymentSettings.AWS.Brotli = enabled
+		d.s3Client = client
+		d.uploader = client
+
+		if err := d.DeployContext(context.Background()); err != nil {
+			t.Fatalf("error deploying: %s", err)
+		}
+
+		return client
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		client := deploy(true)
+
+		decoded, err := io.ReadAll(brotli.NewReader(bytes.NewReader(client.bodies["index.html.br"])))
+		_, tinyVariant := client.bodies["tiny.css.br"]
+		_, imageVariant := client.bodies["image.png.br"]
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Decode error":         {err, nil},
+			"HTML encoding":        {client.encodings["index.html"], ""},
+			"HTML body":            {bytes.Equal(client.bodies["index.html"], page), true},
+			"Variant encoding":     {client.encodings["index.html.br"], "br"},
+			"Variant type":         {aws.ToString(client.inputs["index.html.br"].ContentType), "text/html"},
+			"Variant smaller":      {len(client.bodies["index.html.br"]) < len(page), true},
+			"Variant decoded":      {bytes.Equal(decoded, page), true},
+			"Not smaller encoding": {client.encodings["tiny.css"], ""},
+			"Not smaller variant":  {tinyVariant, false},
+			"Image variant":        {imageVariant, false},
+			"Image body":           {bytes.Equal(client.bodies["image.png"], page), true},
+		})
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client := deploy(false)
+		_, variant := client.bodies["index.html.br"]
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"HTML encoding": {client.encodings["index.html"], ""},
+			"HTML body":     {bytes.Equal(client.bodies["index.html"], page), true},
+			"Variant":       {variant, false},
+		})
+	})
+}
+
+func TestDeployment_Minify(t *testing.T) {
+	page := "<!DOCTYPE html>\n<html>\n  <body>\n    <!-- navigation -->\n    <p>Hello,   <em>world</em></p>\n  </body>\n</html>\n"
+	style := "/* theme */\nbody {\n  color: red;\n  margin: 0 auto;\n}\n"
+	image := []byte("\x89PNG\r\n\x1a\n  <!-- -->  \n")
+
+	publicPath := t.TempDir()
+	files := map[string][]byte{"index.html": []byte(page), "style.css": []byte(style), "image.png": image}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(publicPath, name), content, 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := &fakeS3{cancel: func() {}}
+
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.publicPath = publicPath
+	d.deploymentSettings.Minify = []string{"html", "css"}
+	d.deploymentSettings.ManifestPath = filepath.Join(t.TempDir(), "deploy-manifest.json")
+	d.s3Client = client
+	d.uploader = client
+
+	if err := d.DeployContext(context.Background()); err != nil {
+		t.Fatalf("error deploying: %s", err)
+	}
+
+	local, err := os.ReadFile(filepath.Join(publicPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := midas.ReadDeployManifest(d.site, d.deploymentSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The manifest records the uploaded content, not the local file
+	recorded := map[string]int64{}
+	for _, file := range manifest.Files {
+		recorded[file.Key] = file.Size
+	}
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"HTML body":     {string(client.bodies["index.html"]), "<!DOCTYPE html>\n<html>\n<body>\n<!-- navigation -->\n<p>Hello, <em>world</em></p>\n</body>\n</html>\n"},
+		"CSS body":      {string(client.bodies["style.css"]), "body{color: red;margin: 0 auto}"},
+		"Image body":    {bytes.Equal(client.bodies["image.png"], image), true},
+		"Local file":    {string(local), page},
+		"HTML recorded": {recorded["index.html"], int64(len(client.bodies["index.html"]))},
+		"CSS recorded":  {recorded["style.css"], int64(len(client.bodies["style.css"]))},
+	})
+}
+
+func TestDeployment_ExtensionlessFiles(t *testing.T) {
+	publicPath := t.TempDir()
+	files := map[string]string{
+		"about": "<!DOCTYPE html><html><body><p>About</p></body></html>",
+		"data":  "\x00\x01\x02",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(publicPath, name), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := &fakeS3{cancel: func() {}}
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.publicPath = publicPath
+	d.s3Client = client
+	d.uploader = client
+
+	err := d.DeployContext(context.Background())
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":              {err, nil},
+		"HTML type":          {aws.ToString(client.inputs["about"].ContentType), "text/html"},
+		"HTML cache control": {aws.ToString(client.inputs["about"].CacheControl), "no-cache, no-store"},
+		"HTML body":          {string(client.bodies["about"]), files["about"]},
+		"Binary type":        {aws.ToString(client.inputs["data"].ContentType), "application/octet-stream"},
+	})
+}
+
+// deployMetrics records the reported deployments.
+type deployMetrics struct {
+	midas.NopMetrics
+
+	bytes []int64
+	errs  []error
+}
+
+func (m *deployMetrics) SiteDeployed(_, _ string, bytes int64, _ time.Duration, err error) {
+	m.bytes = append(m.bytes, bytes)
+	m.errs = append(m.errs, err)
+}
+
+func TestDeployment_Metrics(t *testing.T) {
+	publicPath := t.TempDir()
+	for name, content := range map[string]string{"index.html": "home", "css/site.css": "body {}"} {
+		path := filepath.Join(publicPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metrics := &deployMetrics{}
+	previous := midas.Metrics
+	midas.Metrics = metrics
+	t.Cleanup(func() {
+		midas.Metrics = previous
+	})
+
+	client := &fakeS3{cancel: func() {}}
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.publicPath = publicPath
+	d.s3Client = client
+	d.uploader = client
+
+	err := d.DeployContext(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelledErr := d.DeployContext(ctx)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":           {err, nil},
+		"Deployments":     {len(metrics.bytes), 2},
+		"Bytes":           {metrics.bytes[0], int64(len("home") + len("body {}"))},
+		"Reported error":  {metrics.errs[0], nil},
+		"Cancelled error": {errors.Is(metrics.errs[1], context.Canceled) && errors.Is(cancelledErr, context.Canceled), true},
+	})
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Drift is the difference between the local build and the objects deployed to the S3 bucket. All lists hold
+// the (sorted) object keys. Objects routed to other buckets than the deployment one are listed as s3://bucket/key.
+type Drift struct {
+	RemoteOnly []string // Objects without the local file
+	LocalOnly  []string // Files not deployed
+	Differing  []string // Objects whose size or ETag doesn't match the local file
+}
+
+// Empty returns true if the deployed objects match the local build.
+func (d Drift) Empty() bool {
+	return len(d.RemoteOnly) == 0 && len(d.LocalOnly) == 0 && len(d.Differing) == 0
+}
+
+// Drift compares the local build (the deployed files) with the objects under the prefix in the S3 bucket, by the key,
+// size and ETag. Nothing is uploaded or removed. ETags of multipart uploads aren't the MD5 of the content, so only
+// the size of such objects is compared.
+func (d *Deployment) Drift(ctx context.Context) (Drift, error) {
+	var drift Drift
+
+	remote := make(map[string]s3types.Object)
+	for _, dest := range d.destinations() {
+		objects, err := d.remoteObjects(ctx, dest)
+		if err != nil {
+			return drift, err
+		}
+
+		for key, object := range objects {
+			remote[d.objectID(dest.bucket, key)] = object
+		}
+	}
+
+	// Stops the walker, if the comparison returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	walker, walkErr := d.retrieveFiles(ctx)
+
+	extras, err := extraFiles(d.deploymentSettings.AWS)
+	if err != nil {
+		return drift, err
+	}
+
+	for path := range walker {
+		rel, err := filepath.Rel(d.publicPath, path)
+		if err != nil {
+			return drift, err
+		}
+
+		// Replaced by the extra file
+		if _, ok := extras[filepath.ToSlash(rel)]; ok {
+			continue
+		}
+
+		if err = d.compareFile(&drift, remote, path, rel); err != nil {
+			return drift, err
+		}
+	}
+
+	if err = ctx.Err(); err != nil {
+		return drift, err
+	}
+	if err = <-walkErr; err != nil {
+		return drift, err
+	}
+
+	// The extra files are deployed as well, so they aren't stale
+	for rel, content := range extras {
+		if err = d.compareContent(&drift, remote, strings.NewReader(content), extraContentType(rel), rel); err != nil {
+			return drift, err
+		}
+	}
+
+	for key := range remote {
+		drift.RemoteOnly = append(drift.RemoteOnly, key)
+	}
+
+	sort.Strings(drift.RemoteOnly)
+	sort.Strings(drift.LocalOnly)
+	sort.Strings(drift.Differing)
+
+	return drift, nil
+}
+
+// compareFile compares the content uploaded for the file with the remote objects.
+func (d *Deployment) compareFile(drift *Drift, remote map[string]s3types.Object, path, rel string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	contentType, err := d.deploymentSettings.ContentType(file, file.Name())
+	if err != nil {
+		return err
+	}
+
+	return d.compareContent(drift, remote, file, contentType, rel)
+}
+
+// compareContent compares the content uploaded for the file of given content type (and its Brotli variant, if
+// uploaded) with the remote objects, by the size and ETag. The compared objects are removed from the remote objects.
+func (d *Deployment) compareContent(drift *Drift, remote map[string]s3types.Object, content io.ReadSeeker, contentType, rel string) error {
+	body, err := d.uploadBody(content, contentType)
+	if err != nil {
+		return err
+	}
+	variant, err := d.brotliVariant(body, contentType)
+	if err != nil {
+		return err
+	}
+
+	dest := d.destination(rel, contentType)
+	key := dest.key(rel)
+	keys := []string{d.objectID(dest.bucket, key)}
+	bodies := []io.ReadSeeker{body}
+	if variant != nil {
+		keys = append(keys, d.objectID(dest.bucket, key+brotliSuffix))
+		bodies = append(bodies, bytes.NewReader(variant))
+	}
+
+	for i, key := range keys {
+		object, deployed := remote[key]
+		delete(remote, key)
+
+		if !deployed {
+			drift.LocalOnly = append(drift.LocalOnly, key)
+			continue
+		}
+
+		matches, err := matchesBody(bodies[i], object)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			drift.Differing = append(drift.Differing, key)
+		}
+	}
+
+	return nil
+}
+
+// matchesBody returns true if the uploaded body matches the object size and ETag.
+func matchesBody(body io.ReadSeeker, object s3types.Object) (bool, error) {
+	size, checksum, err := contentChecksum(body)
+	if err != nil {
+		return false, err
+	}
+
+	if size != object.Size {
+		return false, nil
+	}
+
+	etag := strings.Trim(aws.ToString(object.ETag), `"`)
+	return strings.Contains(etag, "-") || etag == checksum, nil
+}
+
+// remoteObjects retrieves all the objects under the prefix in the destination bucket, indexed by the key.
+func (d *Deployment) remoteObjects(ctx context.Context, dest destination) (map[string]s3types.Object, error) {
+	objects := make(map[string]s3types.Object)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(dest.bucket),
+	}
+	if dest.prefix != "" {
+		input.Prefix = aws.String(dest.prefix + "/")
+	}
+
+	for {
+		output, err := d.s3Client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range output.Contents {
+			// The lock isn't deployed, so it's neither deleted nor reported as drift
+			if d.deploymentSettings.AWS.Lock.Enabled && dest.bucket == d.deploymentSettings.AWS.BucketName && aws.ToString(object.Key) == d.lockKey() {
+				continue
+			}
+
+			objects[aws.ToString(object.Key)] = object
+		}
+
+		if !output.IsTruncated {
+			return objects, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
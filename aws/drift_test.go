@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeBucket lists the known objects, in pages of pageSize objects. Modifications are rejected.
+type fakeBucket struct {
+	objects  []s3types.Object
+	pageSize int
+
+	prefixes  []string
+	listCalls int
+}
+
+func (f *fakeBucket) ListObjectsV2(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.listCalls++
+	f.prefixes = append(f.prefixes, aws.ToString(input.Prefix))
+
+	start := 0
+	if input.ContinuationToken != nil {
+		_, _ = fmt.Sscan(aws.ToString(input.ContinuationToken), &start)
+	}
+
+	end := start + f.pageSize
+	if end >= len(f.objects) {
+		return &s3.ListObjectsV2Output{Contents: f.objects[start:]}, nil
+	}
+
+	return &s3.ListObjectsV2Output{
+		Contents:              f.objects[start:end],
+		IsTruncated:           true,
+		NextContinuationToken: aws.String(fmt.Sprint(end)),
+	}, nil
+}
+
+func (f *fakeBucket) DeleteObjects(_ context.Context, _ *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return nil, errors.New("bucket is read-only")
+}
+
+func (f *fakeBucket) HeadObject(_ context.Context, _ *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("not found")
+}
+
+func (f *fakeBucket) GetObject(_ context.Context, _ *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return nil, &s3types.NoSuchKey{}
+}
+
+func (f *fakeBucket) GetBucketAccelerateConfiguration(_ context.Context, _ *s3.GetBucketAccelerateConfigurationInput, _ ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error) {
+	return nil, errors.New("access denied")
+}
+
+// object returns the object with the content, as uploaded in one part.
+func object(key, content string) s3types.Object {
+	checksum := md5.Sum([]byte(content))
+	return s3types.Object{Key: aws.String(key), Size: int64(len(content)), ETag: aws.String(`"` + hex.EncodeToString(checksum[:]) + `"`)}
+}
+
+func TestDeployment_Drift(t *testing.T) {
+	publicPath := t.TempDir()
+	files := map[string]string{
+		"index.html":      "<p>Home</p>",
+		"about.html":      "<p>About</p>",
+		"css/style.css":   "body { color: red; }",
+		"img/large.png":   strings.Repeat("png", 100),
+		"posts/new.html":  "<p>New post</p>",
+		"posts/edit.html": "<p>Edited</p>",
+		"drafts/x.html":   "excluded",
+	}
+	for name, content := range files {
+		path := filepath.Join(publicPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bucket := &fakeBucket{pageSize: 2, objects: []s3types.Object{
+		object("site/index.html", "<p>Home</p>"),
+		object("site/about.html", "<p>About us</p>"),                                                 // Different size
+		object("site/css/style.css", "body { color: blue; }"[1:]),                                    // Same size, different ETag
+		{Key: aws.String("site/img/large.png"), Size: 300, ETag: aws.String(`"0123456789abcdef-2"`)}, // Multipart
+		object("site/posts/edit.html", "<p>Edited</p>"),
+		object("site/posts/removed.html", "<p>Removed</p>"),
+		object("site/old.css", ""),
+	}}
+
+	filter, err := midas.DeploymentSettings{Exclude: []string{"drafts/**"}}.FileFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.deploymentSettings.AWS.S3Prefix = "/site/"
+	d.publicPath = publicPath
+	d.filter = filter
+	d.s3Client = bucket
+
+	drift, err := d.Drift(context.Background())
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":       {err, nil},
+		"Remote only": {strings.Join(drift.RemoteOnly, ","), "site/old.css,site/posts/removed.html"},
+		"Local only":  {strings.Join(drift.LocalOnly, ","), "site/posts/new.html"},
+		"Differing":   {strings.Join(drift.Differing, ","), "site/about.html,site/css/style.css"},
+		"Empty":       {drift.Empty(), false},
+		"List calls":  {bucket.listCalls, 4},
+		"Prefix":      {bucket.prefixes[0], "site/"},
+	})
+
+	t.Run("In sync", func(t *testing.T) {
+		var objects []s3types.Object
+		for name, content := range files {
+			if !strings.HasPrefix(name, "drafts/") {
+				objects = append(objects, object("site/"+name, content))
+			}
+		}
+		d.s3Client = &fakeBucket{pageSize: 100, objects: objects}
+
+		drift, err := d.Drift(context.Background())
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {err, nil},
+			"Empty": {drift.Empty(), true},
+		})
+	})
+
+	t.Run("Brotli", func(t *testing.T) {
+		content := strings.Repeat("<p>Compressible</p>\n", 50)
+		brotliPath := t.TempDir()
+		if err := os.WriteFile(filepath.Join(brotliPath, "index.html"), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		client := &fakeS3{cancel: func() {}}
+		d := newTestDeployment(&fakeCloudfront{}, false)
+		d.deploymentSettings.AWS.Brotli = true
+		d.publicPath = brotliPath
+		d.uploader = client
+
+		file, _ := os.Open(filepath.Join(brotliPath, "index.html"))
+		defer func() {
+			_ = file.Close()
+		}()
+		if _, _, err := d.uploadFile(context.Background(), file, "index.html"); err != nil {
+			t.Fatal(err)
+		}
+
+		d.s3Client = &fakeBucket{pageSize: 100, objects: []s3types.Object{
+			object("index.html", string(client.bodies["index.html"])),
+			object("index.html.br", string(client.bodies["index.html.br"])),
+		}}
+
+		drift, err := d.Drift(context.Background())
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":      {err, nil},
+			"Compressed": {len(client.bodies["index.html.br"]) < len(content), true},
+			"Empty":      {drift.Empty(), true},
+		})
+
+		d.s3Client = &fakeBucket{pageSize: 100, objects: []s3types.Object{object("index.html", content)}}
+
+		drift, err = d.Drift(context.Background())
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":           {err, nil},
+			"Variant missing": {drift.LocalOnly, []string{"index.html.br"}},
+		})
+	})
+}
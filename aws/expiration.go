@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// applyExpiration sets the expiration tag and Expires header of the uploaded object, if the file (path relative to
+// the deployed directory) is under the configured expiration prefix.
+func (d *Deployment) applyExpiration(input *s3.PutObjectInput, rel string, now time.Time) {
+	settings := d.deploymentSettings.AWS.Expiration
+	if settings.Tag == "" && settings.Days <= 0 {
+		return
+	}
+
+	prefix := strings.Trim(filepath.ToSlash(settings.Prefix), "/")
+	if rel = strings.ReplaceAll(rel, "\\", "/"); prefix != "" && rel != prefix && !strings.HasPrefix(rel, prefix+"/") {
+		return
+	}
+
+	if settings.Tag != "" {
+		key, value, _ := strings.Cut(settings.Tag, "=")
+		input.Tagging = aws.String(url.Values{key: []string{value}}.Encode())
+	}
+
+	if settings.Days > 0 {
+		input.Expires = aws.Time(now.AddDate(0, 0, settings.Days))
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeployment_applyExpiration(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.AddDate(0, 0, 7)
+
+	tests := []struct {
+		name     string
+		settings midas.AWSExpirationSettings
+		rel      string
+		tagging  string
+		expires  *time.Time
+	}{
+		{"Not configured", midas.AWSExpirationSettings{}, "preview/index.html", "", nil},
+		{"Tag everywhere", midas.AWSExpirationSettings{Tag: "expire=true"}, "index.html", "expire=true", nil},
+		{"Tag escaped", midas.AWSExpirationSettings{Tag: "midas expire=in 7 days"}, "index.html", "midas+expire=in+7+days", nil},
+		{"Days", midas.AWSExpirationSettings{Days: 7}, "index.html", "", &expires},
+		{"Under prefix", midas.AWSExpirationSettings{Tag: "expire=true", Days: 7, Prefix: "/preview/"}, "preview/post/index.html", "expire=true", &expires},
+		{"Outside prefix", midas.AWSExpirationSettings{Tag: "expire=true", Days: 7, Prefix: "preview"}, "posts/index.html", "", nil},
+		{"Prefix is not a name prefix", midas.AWSExpirationSettings{Tag: "expire=true", Prefix: "preview"}, "previews/index.html", "", nil},
+		{"Windows separators", midas.AWSExpirationSettings{Tag: "expire=true", Prefix: "preview"}, `preview\index.html`, "expire=true", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Deployment{deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{Expiration: tt.settings}}}
+			input := &s3.PutObjectInput{}
+
+			d.applyExpiration(input, tt.rel, now)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Tagging":     {aws.ToString(input.Tagging), tt.tagging},
+				"Has expires": {input.Expires != nil, tt.expires != nil},
+			})
+			if tt.expires != nil {
+				testing_utils.AssertEquals(t, input.Expires.Equal(*tt.expires), true, "Expires")
+			}
+		})
+	}
+}
+
+func TestDeployment_Expiration(t *testing.T) {
+	publicPath := t.TempDir()
+	for _, rel := range []string{"index.html", "preview/index.html", "preview/post/index.html"} {
+		path := filepath.Join(publicPath, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := &fakeS3{cancel: func() {}}
+
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.publicPath = publicPath
+	d.deploymentSettings.AWS.Expiration = midas.AWSExpirationSettings{Tag: "expire=preview", Days: 3, Prefix: "preview"}
+	d.s3Client = client
+	d.uploader = client
+
+	before := time.Now()
+	err := d.DeployContext(context.Background())
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":              {err, nil},
+		"Root tagging":       {client.inputs["index.html"].Tagging == nil, true},
+		"Root expires":       {client.inputs["index.html"].Expires == nil, true},
+		"Preview tagging":    {aws.ToString(client.inputs["preview/index.html"].Tagging), "expire=preview"},
+		"Nested tagging":     {aws.ToString(client.inputs["preview/post/index.html"].Tagging), "expire=preview"},
+		"Preview expires":    {client.inputs["preview/index.html"].Expires != nil, true},
+		"Expires after days": {!client.inputs["preview/index.html"].Expires.Before(before.AddDate(0, 0, 3)), true},
+	})
+}
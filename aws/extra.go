@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/kovansky/midas"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// extraFiles returns the configured extra files, keyed by the slash separated path relative to the deployed
+// directory. Returns ErrSiteConfig if any of the paths doesn't point to a file in the deployed directory.
+func extraFiles(settings midas.AWSDeploymentSettigs) (map[string]string, error) {
+	files := make(map[string]string, len(settings.ExtraFiles))
+	for name, content := range settings.ExtraFiles {
+		// Leading slash is accepted, as the paths are relative to the deployed directory either way
+		rel := strings.TrimLeft(path.Clean(filepath.ToSlash(name)), "/")
+		if rel == "" || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "extra file %s must be relative to the deployed directory", name)
+		}
+
+		files[rel] = content
+	}
+
+	return files, nil
+}
+
+// extraContentType returns the content type of the extra file. The files of unknown type (i.e. _headers) are
+// served as plain text, as their content is configured as text.
+func extraContentType(rel string) string {
+	if contentType := midas.FileContentType(rel); contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	return "text/plain"
+}
+
+// uploadExtraFiles uploads the extra files (in the order of the paths), adding them to the sent keys and the manifest.
+// Returns the uploaded objects sampled for the verification.
+func (d *Deployment) uploadExtraFiles(ctx context.Context, files map[string]string, manifest *midas.DeployManifest, sentKeys map[string]bool) ([]uploadedObject, error) {
+	paths := make([]string, 0, len(files))
+	for rel := range files {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	var uploaded []uploadedObject
+	for _, rel := range paths {
+		content := files[rel]
+		contentType := extraContentType(rel)
+
+		sent, objects, err := d.uploadContent(ctx, strings.NewReader(content), rel, contentType, rel)
+		if err != nil {
+			return nil, err
+		}
+		uploaded = append(uploaded, objects...)
+
+		recordSent(sent, sentKeys, manifest)
+	}
+
+	return uploaded, nil
+}
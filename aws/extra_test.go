@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_extraFiles(t *testing.T) {
+	files, err := extraFiles(midas.AWSDeploymentSettigs{ExtraFiles: map[string]string{
+		"robots.txt":     "User-agent: *",
+		"/.well-known/x": "x",
+		"a/../_headers":  "/*",
+	}})
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":         {err, nil},
+		"Count":         {len(files), 3},
+		"Plain":         {files["robots.txt"], "User-agent: *"},
+		"Leading slash": {files[".well-known/x"], "x"},
+		"Cleaned":       {files["_headers"], "/*"},
+	})
+
+	for _, name := range []string{"", ".", "/", "..", "../robots.txt", "a/../../robots.txt"} {
+		_, err := extraFiles(midas.AWSDeploymentSettigs{ExtraFiles: map[string]string{name: "content"}})
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code of "+name)
+	}
+}
+
+func TestDeployment_ExtraFiles(t *testing.T) {
+	publicPath := t.TempDir()
+	for name, content := range map[string]string{"index.html": "<p>Home</p>", "robots.txt": "built"} {
+		if err := os.WriteFile(filepath.Join(publicPath, name), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extras := map[string]string{
+		"robots.txt":         "User-agent: *\nDisallow: /drafts/",
+		"_headers":           "/*\n  X-Frame-Options: DENY",
+		"/.well-known/x.xml": "<x/>",
+	}
+
+	newDeployment := func() *Deployment {
+		d := newTestDeployment(&fakeCloudfront{}, false)
+		d.deploymentSettings.AWS.S3Prefix = "site"
+		d.deploymentSettings.AWS.ExtraFiles = extras
+		d.publicPath = publicPath
+
+		return d
+	}
+
+	t.Run("Deploy", func(t *testing.T) {
+		client := &fakeS3{cancel: func() {}}
+		d := newDeployment()
+		d.s3Client = client
+		d.uploader = client
+
+		err := d.DeployContext(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":           {err, nil},
+			"Uploads":         {strings.Join(client.uploads, ","), "site/index.html,site/.well-known/x.xml,site/_headers,site/robots.txt"},
+			"Replaced body":   {string(client.bodies["site/robots.txt"]), extras["robots.txt"]},
+			"Robots type":     {aws.ToString(client.inputs["site/robots.txt"].ContentType), "text/plain"},
+			"Headers type":    {aws.ToString(client.inputs["site/_headers"].ContentType), "text/plain"},
+			"XML type":        {aws.ToString(client.inputs["site/.well-known/x.xml"].ContentType), "text/xml"},
+			"Headers body":    {string(client.bodies["site/_headers"]), extras["_headers"]},
+			"HTML still sent": {string(client.bodies["site/index.html"]), "<p>Home</p>"},
+		})
+	})
+
+	t.Run("Drift", func(t *testing.T) {
+		d := newDeployment()
+		d.s3Client = &fakeBucket{pageSize: 100, objects: []s3types.Object{
+			object("site/index.html", "<p>Home</p>"),
+			object("site/robots.txt", extras["robots.txt"]),
+			object("site/_headers", "/*"),
+		}}
+
+		drift, err := d.Drift(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":       {err, nil},
+			"Remote only": {len(drift.RemoteOnly), 0},
+			"Local only":  {strings.Join(drift.LocalOnly, ","), "site/.well-known/x.xml"},
+			"Differing":   {strings.Join(drift.Differing, ","), "site/_headers"},
+		})
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewWithHTTPClient(midas.Site{}, midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+			ExtraFiles: map[string]string{"../robots.txt": "User-agent: *"},
+		}}, false, nil)
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
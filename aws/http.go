@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/kovansky/midas"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// newHTTPClient creates the HTTP client for the AWS requests from the settings. Returns nil if no setting is provided,
+// so the SDK default client is used.
+func newHTTPClient(settings midas.AWSHTTPSettings) (*http.Client, error) {
+	if settings.ProxyUrl == "" && settings.Timeout == 0 && settings.CABundle == "" {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if settings.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(settings.ProxyUrl)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "invalid aws proxy url %s", settings.ProxyUrl)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if settings.CABundle != "" {
+		bundle, err := os.ReadFile(settings.CABundle)
+		if err != nil {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "cannot read aws ca bundle: %s", err)
+		}
+
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(bundle) {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "aws ca bundle %s contains no certificates", settings.CABundle)
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(settings.Timeout) * time.Second,
+	}, nil
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/aws/smithy-go"
+	"github.com/kovansky/midas"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	invalidationAttempts     = 5                // Maximum number of attempts of the throttled CloudFront call
+	invalidationBackoff      = time.Second      // Initial delay between the attempts, doubled after each one
+	invalidationPollInterval = 20 * time.Second // Delay between checks of the invalidation status
+	invalidationTimeout      = 15 * time.Minute // Maximum time of waiting for the invalidation to complete
+
+	invalidationInProgress = "InProgress"
+	invalidationCompleted  = "Completed"
+)
+
+// throttlingCodes are the CloudFront error codes which are worth retrying.
+var throttlingCodes = []string{"Throttling", "ThrottlingException", "TooManyRequestsException", "TooManyInvalidationsInProgress"}
+
+// cloudfrontClient is the part of the CloudFront API used by the deployment.
+type cloudfrontClient interface {
+	CreateInvalidation(ctx context.Context, params *cloudfront.CreateInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.CreateInvalidationOutput, error)
+	GetInvalidation(ctx context.Context, params *cloudfront.GetInvalidationInput, optFns ...func(*cloudfront.Options)) (*cloudfront.GetInvalidationOutput, error)
+	ListInvalidations(ctx context.Context, params *cloudfront.ListInvalidationsInput, optFns ...func(*cloudfront.Options)) (*cloudfront.ListInvalidationsOutput, error)
+}
+
+// invalidateCloudfront invalidates all the files in the Cloudfront distribution. If reuse is true and an invalidation
+// of the same paths is already in progress, it is reused instead of creating a new one.
+func (d *Deployment) invalidateCloudfront(ctx context.Context, reuse bool) error {
+	if d.deploymentSettings.AWS.CloudfrontDistribution == "" {
+		return nil
+	}
+
+	paths := []string{"/*"}
+
+	var invalidationId string
+	if reuse {
+		var err error
+		if invalidationId, err = d.inProgressInvalidation(ctx, paths); err != nil {
+			return err
+		}
+	}
+
+	if invalidationId == "" {
+		// Caller reference is the same for all the attempts, so CloudFront doesn't create duplicates on retry
+		callerReference := invalidationCallerReference(paths, time.Now())
+
+		err := d.retry(ctx, func() error {
+			output, err := d.cfClient.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+				DistributionId: aws.String(d.deploymentSettings.AWS.CloudfrontDistribution),
+				InvalidationBatch: &cftypes.InvalidationBatch{
+					CallerReference: aws.String(callerReference),
+					Paths: &cftypes.Paths{
+						Quantity: aws.Int32(int32(len(paths))),
+						Items:    paths,
+					},
+				},
+			})
+			if err != nil {
+				return err
+			}
+
+			if output.Invalidation != nil {
+				invalidationId = aws.ToString(output.Invalidation.Id)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.deploymentSettings.AWS.WaitForInvalidation && invalidationId != "" {
+		return d.waitForInvalidation(ctx, invalidationId)
+	}
+
+	return nil
+}
+
+// inProgressInvalidation returns the id of the invalidation of the same paths which is in progress, or empty string
+// if there is none. All the pages of the invalidations list are checked.
+func (d *Deployment) inProgressInvalidation(ctx context.Context, paths []string) (string, error) {
+	var marker *string
+
+	for {
+		var list *cloudfront.ListInvalidationsOutput
+		err := d.retry(ctx, func() (err error) {
+			list, err = d.cfClient.ListInvalidations(ctx, &cloudfront.ListInvalidationsInput{
+				DistributionId: aws.String(d.deploymentSettings.AWS.CloudfrontDistribution),
+				Marker:         marker,
+			})
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if list.InvalidationList == nil {
+			return "", nil
+		}
+
+		for _, summary := range list.InvalidationList.Items {
+			if aws.ToString(summary.Status) != invalidationInProgress {
+				continue
+			}
+
+			invalidation, err := d.getInvalidation(ctx, aws.ToString(summary.Id))
+			if err != nil {
+				return "", err
+			}
+
+			if invalidation.InvalidationBatch != nil && invalidation.InvalidationBatch.Paths != nil &&
+				samePaths(invalidation.InvalidationBatch.Paths.Items, paths) {
+				return aws.ToString(invalidation.Id), nil
+			}
+		}
+
+		if !aws.ToBool(list.InvalidationList.IsTruncated) || aws.ToString(list.InvalidationList.NextMarker) == "" {
+			return "", nil
+		}
+		marker = list.InvalidationList.NextMarker
+	}
+}
+
+// waitForInvalidation polls the invalidation status until it is completed or the context is cancelled.
+func (d *Deployment) waitForInvalidation(ctx context.Context, invalidationId string) error {
+	deadline := time.Now().Add(invalidationTimeout)
+
+	for {
+		invalidation, err := d.getInvalidation(ctx, invalidationId)
+		if err != nil {
+			return err
+		}
+
+		if aws.ToString(invalidation.Status) == invalidationCompleted {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return midas.Errorf(midas.ErrInternal, "invalidation %s did not complete in %s", invalidationId, invalidationTimeout)
+		}
+
+		if err = sleep(ctx, d.pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// getInvalidation retrieves the invalidation with given id.
+func (d *Deployment) getInvalidation(ctx context.Context, invalidationId string) (*cftypes.Invalidation, error) {
+	var output *cloudfront.GetInvalidationOutput
+	err := d.retry(ctx, func() (err error) {
+		output, err = d.cfClient.GetInvalidation(ctx, &cloudfront.GetInvalidationInput{
+			DistributionId: aws.String(d.deploymentSettings.AWS.CloudfrontDistribution),
+			Id:             aws.String(invalidationId),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if output.Invalidation == nil {
+		return nil, midas.Errorf(midas.ErrInternal, "invalidation %s not returned", invalidationId)
+	}
+
+	return output.Invalidation, nil
+}
+
+// retry runs the operation until it succeeds, fails with other error than throttling, the attempts run out or
+// the context is cancelled. The delay between attempts doubles after each one.
+func (d *Deployment) retry(ctx context.Context, operation func() error) error {
+	delay := d.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil || !isThrottling(err) || attempt == invalidationAttempts {
+			return err
+		}
+
+		if err = sleep(ctx, delay); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// sleep waits for the duration, or returns the context error if it's cancelled earlier.
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isThrottling returns true if the error is caused by CloudFront throttling the requests.
+func isThrottling(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	for _, code := range throttlingCodes {
+		if apiErr.ErrorCode() == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// invalidationCallerReference generates the caller reference unique for the paths and the deployment time.
+func invalidationCallerReference(paths []string, deployedAt time.Time) string {
+	sum := sha256.Sum256([]byte(strings.Join(sortedPaths(paths), "\n")))
+
+	return fmt.Sprintf("MIDAS-%d-%x", deployedAt.Unix(), sum[:8])
+}
+
+// samePaths returns true if both slices contain the same paths, regardless of the order.
+func samePaths(paths, otherPaths []string) bool {
+	if len(paths) != len(otherPaths) {
+		return false
+	}
+
+	sorted, otherSorted := sortedPaths(paths), sortedPaths(otherPaths)
+	for i := range sorted {
+		if sorted[i] != otherSorted[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortedPaths returns the sorted copy of the paths.
+func sortedPaths(paths []string) []string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	return sorted
+}
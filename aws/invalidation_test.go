@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/aws/smithy-go"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeCloudfront throttles the first calls of each kind and then succeeds.
+type fakeCloudfront struct {
+	throttles int // Number of throttled calls before success (per call kind)
+
+	createCalls []*cloudfront.CreateInvalidationInput
+	getCalls    int
+	listCalls   int
+
+	inProgress map[string][]string // [invalidation id] => paths
+	statuses   []string            // Statuses returned by consecutive GetInvalidation calls of created invalidation
+	pageSize   int                 // Number of listed invalidations per page, all on one page if zero
+}
+
+var throttlingErr = &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}
+
+func (f *fakeCloudfront) CreateInvalidation(_ context.Context, params *cloudfront.CreateInvalidationInput, _ ...func(*cloudfront.Options)) (*cloudfront.CreateInvalidationOutput, error) {
+	f.createCalls = append(f.createCalls, params)
+	if len(f.createCalls) <= f.throttles {
+		return nil, throttlingErr
+	}
+
+	return &cloudfront.CreateInvalidationOutput{
+		Invalidation: &cftypes.Invalidation{Id: aws.String("created"), Status: aws.String(invalidationInProgress)},
+	}, nil
+}
+
+func (f *fakeCloudfront) GetInvalidation(_ context.Context, params *cloudfront.GetInvalidationInput, _ ...func(*cloudfront.Options)) (*cloudfront.GetInvalidationOutput, error) {
+	id := aws.ToString(params.Id)
+
+	if paths, ok := f.inProgress[id]; ok {
+		return &cloudfront.GetInvalidationOutput{Invalidation: &cftypes.Invalidation{
+			Id:     aws.String(id),
+			Status: aws.String(invalidationInProgress),
+			InvalidationBatch: &cftypes.InvalidationBatch{
+				Paths: &cftypes.Paths{Quantity: aws.Int32(int32(len(paths))), Items: paths},
+			},
+		}}, nil
+	}
+
+	status := invalidationCompleted
+	if f.getCalls < len(f.statuses) {
+		status = f.statuses[f.getCalls]
+	}
+	f.getCalls++
+
+	return &cloudfront.GetInvalidationOutput{Invalidation: &cftypes.Invalidation{Id: aws.String(id), Status: aws.String(status)}}, nil
+}
+
+func (f *fakeCloudfront) ListInvalidations(_ context.Context, params *cloudfront.ListInvalidationsInput, _ ...func(*cloudfront.Options)) (*cloudfront.ListInvalidationsOutput, error) {
+	f.listCalls++
+	if f.listCalls <= f.throttles {
+		return nil, throttlingErr
+	}
+
+	ids := make([]string, 0, len(f.inProgress))
+	for id := range f.inProgress {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// The marker is the index of the first listed invalidation
+	start, _ := strconv.Atoi(aws.ToString(params.Marker))
+	end := len(ids)
+	if f.pageSize > 0 && start+f.pageSize < end {
+		end = start + f.pageSize
+	}
+
+	var items []cftypes.InvalidationSummary
+	for _, id := range ids[start:end] {
+		items = append(items, cftypes.InvalidationSummary{Id: aws.String(id), Status: aws.String(invalidationInProgress)})
+	}
+
+	list := &cftypes.InvalidationList{Items: items, IsTruncated: aws.Bool(end < len(ids))}
+	if end < len(ids) {
+		list.NextMarker = aws.String(strconv.Itoa(end))
+	}
+
+	return &cloudfront.ListInvalidationsOutput{InvalidationList: list}, nil
+}
+
+func newTestDeployment(client cloudfrontClient, wait bool) *Deployment {
+	return &Deployment{
+		deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+			CloudfrontDistribution: "E3SABCD1234",
+			WaitForInvalidation:    wait,
+		}},
+		cfClient:     client,
+		backoff:      time.Millisecond,
+		pollInterval: time.Millisecond,
+	}
+}
+
+func TestDeployment_invalidateCloudfront(t *testing.T) {
+	t.Run("throttled then succeeds", func(t *testing.T) {
+		client := &fakeCloudfront{throttles: 2}
+
+		err := newTestDeployment(client, false).invalidateCloudfront(context.Background(), true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"Create calls": {len(client.createCalls), 3},
+			"List calls":   {client.listCalls, 3},
+		})
+
+		reference := aws.ToString(client.createCalls[0].InvalidationBatch.CallerReference)
+		for _, call := range client.createCalls {
+			testing_utils.AssertEquals(t, aws.ToString(call.InvalidationBatch.CallerReference), reference, "Caller reference")
+		}
+	})
+
+	t.Run("attempts run out", func(t *testing.T) {
+		client := &fakeCloudfront{throttles: invalidationAttempts}
+
+		err := newTestDeployment(client, false).invalidateCloudfront(context.Background(), true)
+
+		var apiErr smithy.APIError
+		testing_utils.AssertEquals(t, errors.As(err, &apiErr), true, "Throttling error returned")
+		testing_utils.AssertEquals(t, client.listCalls, invalidationAttempts, "List calls")
+		testing_utils.AssertEquals(t, len(client.createCalls), 0, "Create calls")
+	})
+
+	t.Run("in progress invalidation reused", func(t *testing.T) {
+		client := &fakeCloudfront{inProgress: map[string][]string{
+			"other":   {"/posts/*"},
+			"pending": {"/*"},
+		}}
+
+		err := newTestDeployment(client, false).invalidateCloudfront(context.Background(), true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"Create calls": {len(client.createCalls), 0},
+		})
+	})
+
+	t.Run("in progress invalidation on next page reused", func(t *testing.T) {
+		client := &fakeCloudfront{pageSize: 1, inProgress: map[string][]string{
+			"a-other":   {"/posts/*"},
+			"b-other":   {"/pages/*"},
+			"c-pending": {"/*"},
+		}}
+
+		err := newTestDeployment(client, false).invalidateCloudfront(context.Background(), true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"List calls":   {client.listCalls, 3},
+			"Create calls": {len(client.createCalls), 0},
+		})
+	})
+
+	t.Run("in progress invalidation not reused", func(t *testing.T) {
+		client := &fakeCloudfront{inProgress: map[string][]string{
+			"pending": {"/*"},
+		}}
+
+		err := newTestDeployment(client, false).invalidateCloudfront(context.Background(), false)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"List calls":   {client.listCalls, 0},
+			"Create calls": {len(client.createCalls), 1},
+		})
+	})
+
+	t.Run("waits for completion", func(t *testing.T) {
+		client := &fakeCloudfront{statuses: []string{invalidationInProgress, invalidationInProgress, invalidationCompleted}}
+
+		err := newTestDeployment(client, true).invalidateCloudfront(context.Background(), true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"Create calls": {len(client.createCalls), 1},
+			"Get calls":    {client.getCalls, 3},
+		})
+	})
+
+	t.Run("no distribution", func(t *testing.T) {
+		client := &fakeCloudfront{}
+		deployment := newTestDeployment(client, false)
+		deployment.deploymentSettings.AWS.CloudfrontDistribution = ""
+
+		err := deployment.invalidateCloudfront(context.Background(), true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":      {err, nil},
+			"List calls": {client.listCalls, 0},
+		})
+	})
+}
+
+func TestInvalidationCallerReference(t *testing.T) {
+	deployedAt := time.Unix(1650000000, 0)
+
+	testing_utils.AssertEquals(t,
+		invalidationCallerReference([]string{"/a", "/b"}, deployedAt),
+		invalidationCallerReference([]string{"/b", "/a"}, deployedAt),
+		"Same paths in different order")
+
+	if invalidationCallerReference([]string{"/a"}, deployedAt) == invalidationCallerReference([]string{"/b"}, deployedAt) {
+		t.Errorf("Caller reference: expected different references for different paths")
+	}
+}
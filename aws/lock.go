@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"os"
+	"time"
+)
+
+const (
+	defaultLockKey = "midas.lock"
+	defaultLockTTL = time.Hour
+)
+
+// deployLock is the content of the lock object held by the deployment in progress.
+type deployLock struct {
+	Owner      string    `json:"owner"`
+	Site       string    `json:"site"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// lockKey returns the key of the lock object. It's kept outside the deployed prefix, so it isn't deleted with the
+// previously deployed objects.
+func (d *Deployment) lockKey() string {
+	settings := d.deploymentSettings.AWS
+	if key := normalizePrefix(settings.Lock.Key); key != "" {
+		return key
+	}
+
+	// Each blue/green deployment has a fresh prefix, but they all swap the same pointer
+	if settings.Release.Enabled {
+		return d.pointerKey() + ".lock"
+	}
+
+	if prefix := normalizePrefix(settings.S3Prefix); prefix != "" {
+		return prefix + ".lock"
+	}
+
+	return defaultLockKey
+}
+
+// lockTTL returns the duration after which the lock expires, if it isn't released.
+func (d *Deployment) lockTTL() time.Duration {
+	if ttl := d.deploymentSettings.AWS.Lock.TTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+
+	return defaultLockTTL
+}
+
+// acquireLock writes the lock object, unless another deployment holds the unexpired lock (then ErrLocked is
+// returned). The lock is read back after the write, so the deployment which lost the race of the concurrent writes
+// backs off. Returns the owner of the acquired lock, or empty if the lock isn't enabled.
+func (d *Deployment) acquireLock(ctx context.Context) (string, error) {
+	settings := d.deploymentSettings.AWS.Lock
+	if !settings.Enabled {
+		return "", nil
+	}
+
+	now := time.Now().UTC()
+
+	current, err := d.readLock(ctx)
+	if err != nil {
+		return "", err
+	}
+	if current != nil && current.ExpiresAt.After(now) && !settings.Force {
+		return "", midas.Errorf(midas.ErrLocked, "deployment of %s is locked by %s (%s) until %s", d.site.SiteName, current.Owner, current.Site, current.ExpiresAt.Format(time.RFC3339))
+	}
+
+	owner, err := lockOwner()
+	if err != nil {
+		return "", err
+	}
+
+	lock := deployLock{Owner: owner, Site: d.site.SiteName, AcquiredAt: now, ExpiresAt: now.Add(d.lockTTL())}
+	if err = d.writeLock(ctx, lock); err != nil {
+		return "", err
+	}
+
+	current, err = d.readLock(ctx)
+	if err != nil {
+		return "", err
+	}
+	if current == nil || current.Owner != owner {
+		return "", midas.Errorf(midas.ErrLocked, "deployment of %s is locked by a concurrent deployment", d.site.SiteName)
+	}
+
+	return owner, nil
+}
+
+// releaseLock deletes the lock object, if it's still held by the owner. The lock taken over (i.e. forced) by
+// another deployment is kept.
+func (d *Deployment) releaseLock(ctx context.Context, owner string) error {
+	if owner == "" {
+		return nil
+	}
+
+	current, err := d.readLock(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Owner != owner {
+		return nil
+	}
+
+	return d.ForceUnlock(ctx)
+}
+
+// ForceUnlock deletes the lock object regardless of its owner, i.e. to recover from the deployment which crashed
+// before releasing it. The deployment holding the lock isn't stopped.
+func (d *Deployment) ForceUnlock(ctx context.Context) error {
+	output, err := d.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(d.deploymentSettings.AWS.BucketName),
+		Delete: &s3types.Delete{Objects: []s3types.ObjectIdentifier{{Key: aws.String(d.lockKey())}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(output.Errors) > 0 {
+		return fmt.Errorf("deleting lock %s failed: %s", d.lockKey(), aws.ToString(output.Errors[0].Message))
+	}
+
+	return nil
+}
+
+// readLock reads the lock object. Returns nil if there is no lock.
+func (d *Deployment) readLock(ctx context.Context) (*deployLock, error) {
+	output, err := d.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.deploymentSettings.AWS.BucketName),
+		Key:    aws.String(d.lockKey()),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	defer func() {
+		_ = output.Body.Close()
+	}()
+
+	var lock deployLock
+	if err = json.NewDecoder(output.Body).Decode(&lock); err != nil {
+		return nil, midas.Errorf(midas.ErrInternal, "deployment lock %s is malformed: %s", d.lockKey(), err)
+	}
+
+	return &lock, nil
+}
+
+// writeLock uploads the lock object.
+func (d *Deployment) writeLock(ctx context.Context, lock deployLock) error {
+	content, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(d.deploymentSettings.AWS.BucketName),
+		Key:          aws.String(d.lockKey()),
+		ContentType:  aws.String("application/json"),
+		CacheControl: aws.String("no-cache, no-store"),
+		Body:         bytes.NewReader(content),
+	})
+
+	return err
+}
+
+// lockOwner returns the identifier of the lock owner, unique for each deployment.
+func lockOwner() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err = rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix)), nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeployment_lockKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings midas.AWSDeploymentSettigs
+		want     string
+	}{
+		{"Default", midas.AWSDeploymentSettigs{}, "midas.lock"},
+		{"Next to the prefix", midas.AWSDeploymentSettigs{S3Prefix: "/sites/blog/"}, "sites/blog.lock"},
+		{"Release pointer", midas.AWSDeploymentSettigs{S3Prefix: "releases/1", Release: midas.AWSReleaseSettings{Enabled: true}}, "release.json.lock"},
+		{"Configured", midas.AWSDeploymentSettigs{S3Prefix: "blog", Lock: midas.AWSLockSettings{Key: "/locks/blog"}}, "locks/blog"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Deployment{deploymentSettings: midas.DeploymentSettings{AWS: tt.settings}}
+
+			testing_utils.AssertEquals(t, d.lockKey(), tt.want, "Lock key")
+		})
+	}
+}
+
+func TestDeployment_DeployContext_Lock(t *testing.T) {
+	publicPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(publicPath, "index.html"), []byte("page"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	heldLock := func(expiresAt time.Time) []byte {
+		content, _ := json.Marshal(deployLock{Owner: "other-1-abcd", Site: "blog", AcquiredAt: expiresAt.Add(-time.Hour), ExpiresAt: expiresAt})
+		return content
+	}
+
+	tests := []struct {
+		name        string
+		held        []byte
+		force       bool
+		wantErr     string
+		wantPage    bool
+		wantLockOut bool // The lock is released (or never taken) after the deployment
+	}{
+		{"Free", nil, false, "", true, true},
+		{"Held by another deployment", heldLock(time.Now().Add(time.Hour)), false, midas.ErrLocked, false, false},
+		{"Expired", heldLock(time.Now().Add(-time.Minute)), false, "", true, true},
+		{"Forced", heldLock(time.Now().Add(time.Hour)), true, "", true, true},
+		{"Malformed", []byte("{"), false, midas.ErrInternal, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeS3{}
+			if tt.held != nil {
+				client.bodies = map[string][]byte{"midas.lock": tt.held}
+			}
+
+			d := newTestDeployment(&fakeCloudfront{}, false)
+			d.deploymentSettings.AWS.BucketName = "bucket"
+			d.deploymentSettings.AWS.Lock = midas.AWSLockSettings{Enabled: true, Force: tt.force}
+			d.publicPath = publicPath
+			d.s3Client = client
+			d.uploader = client
+
+			err := d.DeployContext(context.Background())
+
+			_, page := client.bodies["index.html"]
+			_, locked := client.bodies["midas.lock"]
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Page":       {page, tt.wantPage},
+				"Lock out":   {!locked, tt.wantLockOut},
+			})
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		client := &fakeS3{bodies: map[string][]byte{"midas.lock": heldLock(time.Now().Add(time.Hour))}}
+
+		d := newTestDeployment(&fakeCloudfront{}, false)
+		d.publicPath = publicPath
+		d.s3Client = client
+		d.uploader = client
+
+		err := d.DeployContext(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Uploads": {len(client.uploads), 1},
+		})
+	})
+}
+
+func TestDeployment_releaseLock(t *testing.T) {
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.deploymentSettings.AWS.Lock.Enabled = true
+
+	t.Run("Taken over", func(t *testing.T) {
+		client := &fakeS3{}
+		d.s3Client, d.uploader = client, client
+
+		owner, err := d.acquireLock(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Another deployment forces the lock
+		d.deploymentSettings.AWS.Lock.Force = true
+		if _, err = d.acquireLock(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		d.deploymentSettings.AWS.Lock.Force = false
+
+		err = d.releaseLock(context.Background(), owner)
+		lock, _ := d.readLock(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":        {err, nil},
+			"Lock kept":    {lock != nil, true},
+			"Delete calls": {client.deleteCalls, 0},
+		})
+	})
+
+	t.Run("Force unlock", func(t *testing.T) {
+		client := &fakeS3{}
+		d.s3Client, d.uploader = client, client
+
+		if _, err := d.acquireLock(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		err := d.ForceUnlock(context.Background())
+		lock, _ := d.readLock(context.Background())
+		_, lockedErr := d.acquireLock(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Lock removed":   {lock == nil, true},
+			"Acquired again": {lockedErr, nil},
+		})
+	})
+}
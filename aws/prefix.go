@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// prefixData is the data available in the S3 prefix template.
+type prefixData struct {
+	Date      time.Time // Deployment start, in UTC
+	Timestamp int64     // Deployment start, as Unix time
+	Version   string    // Configured s3PrefixVersion, i.e. the site commit
+	Site      string    // Site name
+}
+
+// evaluatePrefix executes the S3 prefix as a template, so each deployment can be uploaded under its own prefix
+// (e.g. releases/{{ .Timestamp }}). Prefixes without actions are returned unchanged.
+func evaluatePrefix(prefix string, settings midas.AWSDeploymentSettigs, site midas.Site, now time.Time) (string, error) {
+	if !strings.Contains(prefix, "{{") {
+		return prefix, nil
+	}
+
+	tmpl, err := template.New("s3Prefix").Parse(prefix)
+	if err != nil {
+		return "", midas.Errorf(midas.ErrSiteConfig, "s3 prefix template is invalid: %s", err)
+	}
+
+	now = now.UTC()
+	data := prefixData{Date: now, Timestamp: now.Unix(), Version: settings.S3PrefixVersion, Site: site.SiteName}
+
+	var output strings.Builder
+	if err = tmpl.Execute(&output, data); err != nil {
+		return "", midas.Errorf(midas.ErrSiteConfig, "s3 prefix template can't be executed: %s", err)
+	}
+
+	return output.String(), nil
+}
+
+// normalizePrefix removes the leading, trailing and repeated slashes from the S3 prefix. Backslashes are treated as
+// separators. Returns empty string if the prefix has no segments.
+func normalizePrefix(prefix string) string {
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(prefix, "\\", "/"), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// ValidatePrefix returns warnings about the S3 prefix which is likely misconfigured. The prefix still works, as it is
+// normalized before use, but the resulting keys may differ from the configured value.
+func ValidatePrefix(prefix string) []string {
+	var warnings []string
+
+	if prefix == "" {
+		return warnings
+	}
+
+	if strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+		warnings = append(warnings, fmt.Sprintf("s3 prefix %q has leading or trailing slash, which is removed", prefix))
+	}
+	if strings.Contains(prefix, "//") {
+		warnings = append(warnings, fmt.Sprintf("s3 prefix %q contains repeated slashes, which are collapsed", prefix))
+	}
+	if strings.Contains(prefix, "\\") {
+		warnings = append(warnings, fmt.Sprintf("s3 prefix %q contains backslashes, which are replaced with slashes", prefix))
+	}
+	if strings.TrimSpace(prefix) != prefix {
+		warnings = append(warnings, fmt.Sprintf("s3 prefix %q has surrounding whitespace", prefix))
+	}
+
+	for _, segment := range strings.Split(normalizePrefix(prefix), "/") {
+		if segment == "." || segment == ".." {
+			warnings = append(warnings, fmt.Sprintf("s3 prefix %q contains relative segment %q, which is kept literally in keys", prefix, segment))
+			break
+		}
+	}
+
+	if normalizePrefix(prefix) == "" {
+		warnings = append(warnings, fmt.Sprintf("s3 prefix %q has no segments, files are uploaded to the bucket root", prefix))
+	}
+
+	return warnings
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployment_objectKey(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		rel      string
+		expected string
+	}{
+		{"", "index.html", "index.html"},
+		{"", "posts/hello/index.html", "posts/hello/index.html"},
+		{"mysite", "index.html", "mysite/index.html"},
+		{"/mysite", "index.html", "mysite/index.html"},
+		{"mysite/", "index.html", "mysite/index.html"},
+		{"/mysite/", "posts/index.html", "mysite/posts/index.html"},
+		{"my//site", "index.html", "my/site/index.html"},
+		{"//my///site//", "index.html", "my/site/index.html"},
+		{"my\\site", "posts\\index.html", "my/site/posts/index.html"},
+		{"/", "index.html", "index.html"},
+		{"//", "index.html", "index.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix+"|"+tt.rel, func(t *testing.T) {
+			d := &Deployment{deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{S3Prefix: tt.prefix}}}
+
+			testing_utils.AssertEquals(t, d.objectKey(tt.rel), tt.expected, "Object key")
+		})
+	}
+}
+
+func TestValidatePrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		warnings int
+	}{
+		{"", 0},
+		{"mysite", 0},
+		{"my/site", 0},
+		{"/mysite", 1},
+		{"mysite/", 1},
+		{"my//site", 1},
+		{"/my//site/", 2},
+		{"my\\site", 1},
+		{" mysite", 1},
+		{"my/../site", 1},
+		{"/", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			testing_utils.AssertEquals(t, len(ValidatePrefix(tt.prefix)), tt.warnings, "Warnings")
+		})
+	}
+}
+
+func TestEvaluatePrefix(t *testing.T) {
+	now := time.Date(2022, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	site := midas.Site{SiteName: "blog"}
+	settings := midas.AWSDeploymentSettigs{S3PrefixVersion: "a1b2c3d"}
+
+	tests := []struct {
+		prefix   string
+		expected string
+		err      string
+	}{
+		{"", "", ""},
+		{"mysite", "mysite", ""},
+		{"/my//site/", "/my//site/", ""},
+		{"releases/{{ .Timestamp }}", "releases/1646366767", ""},
+		{`releases/{{ .Date.Format "20060102-150405" }}`, "releases/20220304-040607", ""},
+		{"{{ .Site }}/{{ .Version }}", "blog/a1b2c3d", ""},
+		{"releases/{{ .Commit }}", "", midas.ErrSiteConfig},
+		{"releases/{{ .Timestamp", "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			prefix, err := evaluatePrefix(tt.prefix, settings, site, now)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Prefix":     {prefix, tt.expected},
+				"Error code": {midas.ErrorCode(err), tt.err},
+			})
+		})
+	}
+}
+
+func TestDeployment_subtreeKeys(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, path := range []string{"public/index.html", "public/blog/index.html", "public/blog/posts/hello.html"} {
+		absolute := filepath.Join(rootDir, path)
+		if err := os.MkdirAll(filepath.Dir(absolute), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(absolute, []byte("content"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		subdir   string
+		prefix   string
+		expected []string
+	}{
+		{"Bucket root", "", "", []string{"blog/index.html", "blog/posts/hello.html", "index.html"}},
+		{"Prefix", "", "site", []string{"site/blog/index.html", "site/blog/posts/hello.html", "site/index.html"}},
+		{"Subtree to root", "blog", "", []string{"index.html", "posts/hello.html"}},
+		{"Subtree to prefix", "blog", "section", []string{"section/index.html", "section/posts/hello.html"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := midas.DeploymentSettings{Subdir: tt.subdir, AWS: midas.AWSDeploymentSettigs{S3Prefix: tt.prefix}}
+
+			publicPath, err := settings.DeployPath(midas.Site{RootDir: rootDir}, false)
+			if err != nil {
+				t.Fatalf("DeployPath() error = %v", err)
+			}
+			d := &Deployment{deploymentSettings: settings, publicPath: publicPath}
+
+			walker, _ := d.retrieveFiles(context.Background())
+			var keys []string
+			for path := range walker {
+				rel, _ := filepath.Rel(d.publicPath, path)
+				keys = append(keys, d.objectKey(rel))
+			}
+			sort.Strings(keys)
+
+			testing_utils.AssertEquals(t, strings.Join(keys, ","), strings.Join(tt.expected, ","), "Keys")
+		})
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"log"
+	"sort"
+	"sync"
+)
+
+const (
+	deleteBatchSize      = 1000 // Maximum number of keys of the single DeleteObjects request
+	defaultDeleteWorkers = 4
+)
+
+// DeleteFailure is the object which couldn't be deleted from the bucket.
+type DeleteFailure struct {
+	Key     string
+	Code    string // S3 error code, empty if the whole request failed
+	Message string
+}
+
+// DeleteReport aggregates the results of deleting the objects from the bucket.
+type DeleteReport struct {
+	Deleted  int
+	Failures []DeleteFailure // Sorted by the key
+}
+
+// listObjects retrieves a (sorted) list of objects in the destination bucket, under its prefix if set.
+func (d *Deployment) listObjects(ctx context.Context, dest destination) ([]string, error) {
+	objects, err := d.remoteObjects(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// deleteObjects deletes objects from the S3 bucket, in batches of up to 1000 keys sent by the concurrent workers.
+// The progress is reported after each batch. Failed keys don't stop the deletion, they are collected in the report
+// instead. The remaining batches aren't sent once the context is cancelled.
+func (d *Deployment) deleteObjects(ctx context.Context, bucket string, keys []string) DeleteReport {
+	var report DeleteReport
+
+	workers := d.deploymentSettings.AWS.DeleteWorkers
+	if workers < 1 {
+		workers = defaultDeleteWorkers
+	}
+
+	progress := d.deleteProgress
+	if progress == nil {
+		progress = d.logDeleteProgress
+	}
+
+	batches := make(chan []string)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for w := 0; w < workers && w*deleteBatchSize < len(keys); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for batch := range batches {
+				failures := d.deleteBatch(ctx, bucket, batch)
+
+				mu.Lock()
+				report.Deleted += len(batch) - len(failures)
+				report.Failures = append(report.Failures, failures...)
+				progress(report.Deleted+len(report.Failures), len(keys))
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for start := 0; start < len(keys) && ctx.Err() == nil; start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		select {
+		case batches <- keys[start:end]:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	sort.Slice(report.Failures, func(i, j int) bool {
+		return report.Failures[i].Key < report.Failures[j].Key
+	})
+
+	return report
+}
+
+// deleteBatch deletes the objects with single DeleteObjects request, returning the keys which failed. If the whole
+// request fails, all the keys are failed with its error.
+func (d *Deployment) deleteBatch(ctx context.Context, bucket string, keys []string) []DeleteFailure {
+	identifiers := make([]s3types.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		identifiers[i] = s3types.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	// Quiet mode makes the response list only the failed keys
+	output, err := d.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3types.Delete{
+			Objects: identifiers,
+			Quiet:   true,
+		},
+	})
+	if err != nil {
+		failures := make([]DeleteFailure, len(keys))
+		for i, key := range keys {
+			failures[i] = DeleteFailure{Key: key, Message: err.Error()}
+		}
+
+		return failures
+	}
+
+	failures := make([]DeleteFailure, 0, len(output.Errors))
+	for _, deleteError := range output.Errors {
+		failures = append(failures, DeleteFailure{
+			Key:     aws.ToString(deleteError.Key),
+			Code:    aws.ToString(deleteError.Code),
+			Message: aws.ToString(deleteError.Message),
+		})
+	}
+
+	return failures
+}
+
+// logDeleteProgress logs the number of processed (deleted or failed) objects.
+func (d *Deployment) logDeleteProgress(done, total int) {
+	log.Printf("aws deployment of %s: deleted %d of %d objects\n", d.site.SiteName, done, total)
+}
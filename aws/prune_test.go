@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDeleter counts the DeleteObjects batches. Keys with the failing suffix are reported as failed, and the batches
+// containing the rejected key fail as a whole.
+type fakeDeleter struct {
+	fakeBucket
+
+	failingSuffix string
+	rejectedKey   string
+
+	mu         sync.Mutex
+	batchSizes []int
+	deleted    []string
+	quiet      bool
+	active     int
+	maxActive  int
+}
+
+func (f *fakeDeleter) DeleteObjects(_ context.Context, input *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.mu.Lock()
+	f.batchSizes = append(f.batchSizes, len(input.Delete.Objects))
+	f.quiet = input.Delete.Quiet
+	f.active++
+	if f.active > f.maxActive {
+		f.maxActive = f.active
+	}
+	f.mu.Unlock()
+
+	// Lets the other workers start their batches
+	time.Sleep(5 * time.Millisecond)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active--
+
+	output := &s3.DeleteObjectsOutput{}
+	for _, identifier := range input.Delete.Objects {
+		key := aws.ToString(identifier.Key)
+		if f.rejectedKey != "" && key == f.rejectedKey {
+			return nil, errors.New("service unavailable")
+		}
+	}
+	for _, identifier := range input.Delete.Objects {
+		key := aws.ToString(identifier.Key)
+		if f.failingSuffix != "" && strings.HasSuffix(key, f.failingSuffix) {
+			output.Errors = append(output.Errors, s3types.Error{Key: identifier.Key, Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")})
+		} else {
+			f.deleted = append(f.deleted, key)
+		}
+	}
+
+	return output, nil
+}
+
+func TestDeployment_deleteObjects(t *testing.T) {
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("site/page-%04d.html", i)
+	}
+
+	newDeployment := func(client *fakeDeleter, workers int) (*Deployment, *[][2]int) {
+		var progress [][2]int
+
+		d := &Deployment{
+			deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{BucketName: "bucket", DeleteWorkers: workers}},
+			s3Client:           client,
+			deleteProgress: func(done, total int) {
+				progress = append(progress, [2]int{done, total})
+			},
+		}
+
+		return d, &progress
+	}
+
+	t.Run("Batches", func(t *testing.T) {
+		client := &fakeDeleter{}
+		d, progress := newDeployment(client, 3)
+
+		report := d.deleteObjects(context.Background(), "bucket", keys)
+
+		sizes := append([]int{}, client.batchSizes...)
+		sort.Ints(sizes)
+		sort.Strings(client.deleted)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Deleted":        {report.Deleted, 2500},
+			"Failures":       {len(report.Failures), 0},
+			"Batch sizes":    {fmt.Sprint(sizes), "[500 1000 1000]"},
+			"Deleted keys":   {strings.Join(client.deleted, ","), strings.Join(keys, ",")},
+			"Quiet":          {client.quiet, true},
+			"Concurrent":     {client.maxActive > 1 && client.maxActive <= 3, true},
+			"Progress":       {len(*progress), 3},
+			"Final progress": {(*progress)[2], [2]int{2500, 2500}},
+		})
+	})
+
+	t.Run("Default workers", func(t *testing.T) {
+		client := &fakeDeleter{}
+		d, _ := newDeployment(client, 0)
+
+		report := d.deleteObjects(context.Background(), "bucket", append(append(append([]string{}, keys...), keys...), keys...))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Deleted":    {report.Deleted, 7500},
+			"Batches":    {len(client.batchSizes), 8},
+			"Concurrent": {client.maxActive > 1 && client.maxActive <= defaultDeleteWorkers, true},
+		})
+	})
+
+	t.Run("Failed keys", func(t *testing.T) {
+		client := &fakeDeleter{failingSuffix: "-0013.html"}
+		d, progress := newDeployment(client, 2)
+
+		report := d.deleteObjects(context.Background(), "bucket", keys)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Deleted":        {report.Deleted, 2499},
+			"Failures":       {fmt.Sprint(report.Failures), "[{site/page-0013.html AccessDenied Access Denied}]"},
+			"Final progress": {(*progress)[len(*progress)-1], [2]int{2500, 2500}},
+		})
+	})
+
+	t.Run("Failed batch", func(t *testing.T) {
+		client := &fakeDeleter{rejectedKey: "site/page-2100.html"}
+		d, _ := newDeployment(client, 2)
+
+		report := d.deleteObjects(context.Background(), "bucket", keys)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Deleted":       {report.Deleted, 2000},
+			"Failures":      {len(report.Failures), 500},
+			"First failure": {report.Failures[0], DeleteFailure{Key: "site/page-2000.html", Message: "service unavailable"}},
+		})
+	})
+
+	t.Run("Nothing to delete", func(t *testing.T) {
+		client := &fakeDeleter{}
+		d, progress := newDeployment(client, 2)
+
+		report := d.deleteObjects(context.Background(), "bucket", nil)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Deleted":  {report.Deleted, 0},
+			"Batches":  {len(client.batchSizes), 0},
+			"Progress": {len(*progress), 0},
+		})
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		client := &fakeDeleter{}
+		d, _ := newDeployment(client, 2)
+
+		report := d.deleteObjects(ctx, "bucket", keys)
+
+		testing_utils.AssertEquals(t, report.Deleted+len(report.Failures) < len(keys), true, "Stopped")
+	})
+}
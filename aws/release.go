@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kovansky/midas"
+	"time"
+)
+
+const defaultPointerKey = "release.json"
+
+// Release is the content of the pointer object of the blue/green deployments. The site is served from the live
+// prefix, i.e. by the edge function or the proxy reading the pointer.
+type Release struct {
+	Prefix     string    `json:"prefix"`             // Live prefix
+	Previous   string    `json:"previous,omitempty"` // Prefix which was live before, restored by the rollback
+	ReleasedAt time.Time `json:"releasedAt"`
+}
+
+// pointerKey returns the key of the pointer object.
+func (d *Deployment) pointerKey() string {
+	if key := normalizePrefix(d.deploymentSettings.AWS.Release.PointerKey); key != "" {
+		return key
+	}
+
+	return defaultPointerKey
+}
+
+// CurrentRelease reads the pointer object. Returns the empty release if nothing was released yet.
+func (d *Deployment) CurrentRelease(ctx context.Context) (Release, error) {
+	var release Release
+
+	output, err := d.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.deploymentSettings.AWS.BucketName),
+		Key:    aws.String(d.pointerKey()),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return release, nil
+		}
+
+		return release, err
+	}
+	defer func() {
+		_ = output.Body.Close()
+	}()
+
+	if err = json.NewDecoder(output.Body).Decode(&release); err != nil {
+		return release, midas.Errorf(midas.ErrInternal, "release pointer %s is malformed: %s", d.pointerKey(), err)
+	}
+
+	return release, nil
+}
+
+// Swap points the release to the prefix, so it's served instead of the live one (which becomes the previous
+// release). The objects aren't copied, so the swap takes effect at once.
+func (d *Deployment) Swap(ctx context.Context, prefix string) (Release, error) {
+	prefix = normalizePrefix(prefix)
+	if prefix == "" {
+		return Release{}, midas.Errorf(midas.ErrInvalid, "release prefix can't be empty")
+	}
+
+	current, err := d.CurrentRelease(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	release := Release{Prefix: prefix, Previous: current.Previous, ReleasedAt: time.Now().UTC()}
+	if current.Prefix != prefix {
+		release.Previous = current.Prefix
+	}
+
+	return release, d.writeRelease(ctx, release)
+}
+
+// Rollback points the release back to the previous prefix. The rolled back prefix becomes the previous one, so
+// the rollback can be reverted the same way. Returns ErrNotFound if there is no previous release.
+func (d *Deployment) Rollback(ctx context.Context) (Release, error) {
+	current, err := d.CurrentRelease(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	if current.Previous == "" {
+		return Release{}, midas.Errorf(midas.ErrNotFound, "no previous release to roll back to")
+	}
+
+	release := Release{Prefix: current.Previous, Previous: current.Prefix, ReleasedAt: time.Now().UTC()}
+
+	return release, d.writeRelease(ctx, release)
+}
+
+// writeRelease uploads the pointer object. The pointer isn't cached, so the swap is visible immediately.
+func (d *Deployment) writeRelease(ctx context.Context, release Release) error {
+	content, err := json.Marshal(release)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(d.deploymentSettings.AWS.BucketName),
+		Key:          aws.String(d.pointerKey()),
+		ContentType:  aws.String("application/json"),
+		CacheControl: aws.String("no-cache, no-store"),
+		Body:         bytes.NewReader(content),
+	})
+
+	return err
+}
+
+// checkFreshPrefix returns ErrSiteConfig if the blue/green deployment would be uploaded under the live prefix,
+// as it would replace the live objects before the swap. The pointer doesn't switch the route prefixes, so each
+// of them must be fresh as well, holding no objects yet.
+func (d *Deployment) checkFreshPrefix(ctx context.Context) error {
+	if !d.deploymentSettings.AWS.Release.Enabled {
+		return nil
+	}
+
+	current, err := d.CurrentRelease(ctx)
+	if err != nil {
+		return err
+	}
+
+	primary := d.primaryDestination()
+	if primary.prefix == current.Prefix {
+		return midas.Errorf(midas.ErrSiteConfig, "prefix %s is live; blue/green deployments need a fresh prefix (i.e. releases/{{ .Timestamp }})", primary.prefix)
+	}
+
+	for _, dest := range d.destinations()[1:] {
+		input := &s3.ListObjectsV2Input{Bucket: aws.String(dest.bucket), MaxKeys: 1}
+		if dest.prefix != "" {
+			input.Prefix = aws.String(dest.prefix + "/")
+		}
+		output, err := d.s3Client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return err
+		}
+		if len(output.Contents) > 0 {
+			return midas.Errorf(midas.ErrSiteConfig, "route destination %s is in use; blue/green deployments need fresh route prefixes (i.e. media/{{ .Timestamp }})", dest)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReleaseDeployment(client *fakeS3, prefix string) *Deployment {
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.deploymentSettings.AWS.S3Prefix = prefix
+	d.deploymentSettings.AWS.Release = midas.AWSReleaseSettings{Enabled: true}
+	d.s3Client = client
+	d.uploader = client
+
+	return d
+}
+
+func TestDeployment_Swap(t *testing.T) {
+	client := &fakeS3{cancel: func() {}}
+	d := newReleaseDeployment(client, "")
+	ctx := context.Background()
+
+	initial, initialErr := d.CurrentRelease(ctx)
+	first, firstErr := d.Swap(ctx, "/releases/1/")
+	second, secondErr := d.Swap(ctx, "releases/2")
+	repeated, repeatedErr := d.Swap(ctx, "releases/2")
+	current, currentErr := d.CurrentRelease(ctx)
+	_, emptyErr := d.Swap(ctx, "/")
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Initial error":     {initialErr, nil},
+		"Initial prefix":    {initial.Prefix, ""},
+		"First error":       {firstErr, nil},
+		"First prefix":      {first.Prefix, "releases/1"},
+		"First previous":    {first.Previous, ""},
+		"Second error":      {secondErr, nil},
+		"Second prefix":     {second.Prefix, "releases/2"},
+		"Second previous":   {second.Previous, "releases/1"},
+		"Repeated error":    {repeatedErr, nil},
+		"Repeated previous": {repeated.Previous, "releases/1"},
+		"Current error":     {currentErr, nil},
+		"Current prefix":    {current.Prefix, "releases/2"},
+		"Current previous":  {current.Previous, "releases/1"},
+		"Empty prefix":      {midas.ErrorCode(emptyErr), midas.ErrInvalid},
+		"Pointer type":      {aws.ToString(client.inputs["release.json"].ContentType), "application/json"},
+		"Pointer caching":   {aws.ToString(client.inputs["release.json"].CacheControl), "no-cache, no-store"},
+		"Only pointer":      {strings.Join(client.uploads, ","), "release.json,release.json,release.json"},
+	})
+
+	t.Run("Custom pointer key", func(t *testing.T) {
+		client := &fakeS3{cancel: func() {}}
+		d := newReleaseDeployment(client, "")
+		d.deploymentSettings.AWS.Release.PointerKey = "/site/current.json"
+
+		_, err := d.Swap(ctx, "releases/1")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Uploads": {strings.Join(client.uploads, ","), "site/current.json"},
+		})
+	})
+
+	t.Run("Malformed pointer", func(t *testing.T) {
+		client := &fakeS3{cancel: func() {}, bodies: map[string][]byte{"release.json": []byte("releases/1")}}
+
+		_, err := newReleaseDeployment(client, "").Swap(ctx, "releases/2")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code": {midas.ErrorCode(err), midas.ErrInternal},
+			"Uploads":    {len(client.uploads), 0},
+		})
+	})
+}
+
+func TestDeployment_Rollback(t *testing.T) {
+	client := &fakeS3{cancel: func() {}}
+	d := newReleaseDeployment(client, "")
+	ctx := context.Background()
+
+	_, noReleaseErr := d.Rollback(ctx)
+	_, _ = d.Swap(ctx, "releases/1")
+	_, noPreviousErr := d.Rollback(ctx)
+	_, _ = d.Swap(ctx, "releases/2")
+	rolledBack, rolledBackErr := d.Rollback(ctx)
+	reverted, revertedErr := d.Rollback(ctx)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"No release":         {midas.ErrorCode(noReleaseErr), midas.ErrNotFound},
+		"No previous":        {midas.ErrorCode(noPreviousErr), midas.ErrNotFound},
+		"Rolled back error":  {rolledBackErr, nil},
+		"Rolled back prefix": {rolledBack.Prefix, "releases/1"},
+		"Rolled back from":   {rolledBack.Previous, "releases/2"},
+		"Reverted error":     {revertedErr, nil},
+		"Reverted prefix":    {reverted.Prefix, "releases/2"},
+		"Reverted previous":  {reverted.Previous, "releases/1"},
+		"Pointer uploads":    {len(client.uploads), 4},
+		"Released at":        {rolledBack.ReleasedAt.Location().String(), "UTC"},
+	})
+}
+
+func TestDeployment_DeployContext_Release(t *testing.T) {
+	publicPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(publicPath, "index.html"), []byte("<p>Home</p>"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeS3{cancel: func() {}}
+	for _, prefix := range []string{"releases/1", "releases/2"} {
+		d := newReleaseDeployment(client, prefix)
+		d.publicPath = publicPath
+
+		if err := d.DeployContext(context.Background()); err != nil {
+			t.Fatalf("error deploying %s: %s", prefix, err)
+		}
+	}
+
+	current, err := newReleaseDeployment(client, "").CurrentRelease(context.Background())
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":    {err, nil},
+		"Uploads":  {strings.Join(client.uploads, ","), "releases/1/index.html,release.json,releases/2/index.html,release.json"},
+		"Live":     {current.Prefix, "releases/2"},
+		"Previous": {current.Previous, "releases/1"},
+	})
+
+	t.Run("Live prefix", func(t *testing.T) {
+		uploads := len(client.uploads)
+
+		d := newReleaseDeployment(client, "/releases/2")
+		d.publicPath = publicPath
+		err := d.DeployContext(context.Background())
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":   {midas.ErrorCode(err), midas.ErrSiteConfig},
+			"Uploads":      {len(client.uploads), uploads},
+			"Delete calls": {client.deleteCalls, 0},
+		})
+	})
+
+	t.Run("Route prefix", func(t *testing.T) {
+		routedPath := t.TempDir()
+		for _, name := range []string{"index.html", "style.css"} {
+			if err := os.WriteFile(filepath.Join(routedPath, name), []byte(name), 0664); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		deploy := func(prefix, routePrefix string) error {
+			d := newReleaseDeployment(client, prefix)
+			d.deploymentSettings.AWS.Routes = []midas.AWSRouteSettings{{Patterns: []string{"*.css"}, S3Prefix: routePrefix}}
+			d.publicPath = routedPath
+
+			routes, err := newRoutes(d.deploymentSettings.AWS, midas.Site{}, time.Now())
+			if err != nil {
+				return err
+			}
+			d.routes = routes
+
+			return d.DeployContext(context.Background())
+		}
+
+		freshErr := deploy("releases/3", "assets/3")
+		uploads := len(client.uploads)
+		_, routed := client.bodies["assets/3/style.css"]
+		usedErr := deploy("releases/4", "assets/3")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Fresh error": {freshErr, nil},
+			"Fresh route": {routed, true},
+			"Used error":  {midas.ErrorCode(usedErr), midas.ErrSiteConfig},
+			"Uploads":     {len(client.uploads), uploads},
+		})
+	})
+
+	t.Run("Without prefix", func(t *testing.T) {
+		_, err := NewWithHTTPClient(midas.Site{}, midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+			Release: midas.AWSReleaseSettings{Enabled: true},
+		}}, false, nil)
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/walk"
+	"strings"
+	"time"
+)
+
+// destination is the bucket and (normalized) prefix the objects are uploaded to.
+type destination struct {
+	bucket string
+	prefix string
+}
+
+// key returns the key of the object for the file path relative to the deployed directory.
+func (dest destination) key(rel string) string {
+	fileKey := strings.TrimLeft(strings.ReplaceAll(rel, "\\", "/"), "/")
+	if dest.prefix != "" {
+		fileKey = fmt.Sprintf("%s/%s", dest.prefix, fileKey)
+	}
+
+	return fileKey
+}
+
+// overlaps returns true if the destinations share the bucket and the prefix of one holds the objects of the other,
+// so the orphans removed from one of them would include the objects of the other. Same destinations don't overlap.
+func (dest destination) overlaps(other destination) bool {
+	if dest.bucket != other.bucket || dest.prefix == other.prefix {
+		return false
+	}
+	if dest.prefix == "" || other.prefix == "" {
+		return true
+	}
+
+	return strings.HasPrefix(dest.prefix+"/", other.prefix+"/") || strings.HasPrefix(other.prefix+"/", dest.prefix+"/")
+}
+
+func (dest destination) String() string {
+	return fmt.Sprintf("%s/%s", dest.bucket, dest.prefix)
+}
+
+// route uploads the files matching the filter and content types to its destination.
+type route struct {
+	filter       walk.Filter
+	contentTypes []string
+	destination  destination
+}
+
+// matches returns true if the file (path relative to the deployed directory) of given content type is routed.
+func (r route) matches(rel, contentType string) bool {
+	if !r.filter.Match(rel) {
+		return false
+	}
+	if len(r.contentTypes) == 0 {
+		return true
+	}
+
+	for _, pattern := range r.contentTypes {
+		if pattern == contentType {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRoutes validates the configured routes and evaluates their prefixes. Routes without a bucket upload to the
+// deployment bucket. The route destinations can't overlap each other, nor the deployment prefix (the evaluated one).
+func newRoutes(settings midas.AWSDeploymentSettigs, site midas.Site, now time.Time) ([]route, error) {
+	routes := make([]route, 0, len(settings.Routes))
+	destinations := []destination{{bucket: settings.BucketName, prefix: normalizePrefix(settings.S3Prefix)}}
+
+	for i, routeSettings := range settings.Routes {
+		if len(routeSettings.Patterns) == 0 && len(routeSettings.ContentTypes) == 0 {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "aws route %d has neither patterns nor content types", i)
+		}
+
+		filter, err := walk.NewFilter(routeSettings.Patterns, nil)
+		if err != nil {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "aws route %d %s", i, err)
+		}
+
+		prefix, err := evaluatePrefix(routeSettings.S3Prefix, settings, site, now)
+		if err != nil {
+			return nil, err
+		}
+
+		bucket := routeSettings.BucketName
+		if bucket == "" {
+			bucket = settings.BucketName
+		}
+
+		dest := destination{bucket: bucket, prefix: normalizePrefix(prefix)}
+		for _, other := range destinations {
+			if dest.overlaps(other) {
+				return nil, midas.Errorf(midas.ErrSiteConfig, "aws route %d destination %s overlaps %s", i, dest, other)
+			}
+		}
+		destinations = append(destinations, dest)
+
+		routes = append(routes, route{
+			filter:       filter,
+			contentTypes: routeSettings.ContentTypes,
+			destination:  dest,
+		})
+	}
+
+	return routes, nil
+}
+
+// primaryDestination returns the deployment bucket and prefix.
+func (d *Deployment) primaryDestination() destination {
+	return destination{
+		bucket: d.deploymentSettings.AWS.BucketName,
+		prefix: normalizePrefix(d.deploymentSettings.AWS.S3Prefix),
+	}
+}
+
+// destination returns the destination of the file (path relative to the deployed directory) of given content type:
+// the one of the first matching route, or the primary destination.
+func (d *Deployment) destination(rel, contentType string) destination {
+	for _, r := range d.routes {
+		if r.matches(rel, contentType) {
+			return r.destination
+		}
+	}
+
+	return d.primaryDestination()
+}
+
+// objectID returns the id of the object in the bucket, as listed in the Drift and the manifest: the URL of
+// the objects outside of the deployment bucket, the key otherwise.
+func (d *Deployment) objectID(bucket, key string) string {
+	if bucket == d.deploymentSettings.AWS.BucketName {
+		return key
+	}
+
+	return fmt.Sprintf("s3://%s/%s", bucket, key)
+}
+
+// destinations returns the primary destination, followed by the distinct destinations of the routes.
+func (d *Deployment) destinations() []destination {
+	destinations := []destination{d.primaryDestination()}
+
+	for _, r := range d.routes {
+		known := false
+		for _, dest := range destinations {
+			if dest == r.destination {
+				known = true
+			}
+		}
+
+		if !known {
+			destinations = append(destinations, r.destination)
+		}
+	}
+
+	return destinations
+}
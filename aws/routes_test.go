@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRoutes(t *testing.T) {
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		routes   []midas.AWSRouteSettings
+		want     string
+		wantCode string
+	}{
+		{"None", nil, "", ""},
+		{"Default bucket", []midas.AWSRouteSettings{{Patterns: []string{"images/**"}, S3Prefix: "/media/"}}, "site-bucket:media", ""},
+		{"Templated prefix", []midas.AWSRouteSettings{{ContentTypes: []string{"image/*"}, BucketName: "media-bucket", S3Prefix: "{{ .Site }}/{{ .Timestamp }}"}}, fmt.Sprintf("media-bucket:test/%d", now.Unix()), ""},
+		{"Matching everything", []midas.AWSRouteSettings{{BucketName: "media-bucket"}}, "", midas.ErrSiteConfig},
+		{"Invalid pattern", []midas.AWSRouteSettings{{Patterns: []string{"images/["}}}, "", midas.ErrSiteConfig},
+		{"Invalid template", []midas.AWSRouteSettings{{Patterns: []string{"*.png"}, S3Prefix: "{{ .Missing"}}, "", midas.ErrSiteConfig},
+		{"Deployment prefix", []midas.AWSRouteSettings{{Patterns: []string{"*.png"}}}, "", midas.ErrSiteConfig},
+		{"Inside deployment prefix", []midas.AWSRouteSettings{{Patterns: []string{"*.png"}, S3Prefix: "www/media"}}, "", midas.ErrSiteConfig},
+		{"Sibling prefix", []midas.AWSRouteSettings{{Patterns: []string{"*.png"}, S3Prefix: "www-media"}}, "site-bucket:www-media", ""},
+		{"Containing route prefix", []midas.AWSRouteSettings{
+			{Patterns: []string{"*.png"}, BucketName: "media-bucket", S3Prefix: "media/images"},
+			{Patterns: []string{"*.pdf"}, BucketName: "media-bucket", S3Prefix: "media"},
+		}, "", midas.ErrSiteConfig},
+		{"Whole bucket route", []midas.AWSRouteSettings{
+			{Patterns: []string{"*.png"}, BucketName: "media-bucket", S3Prefix: "images"},
+			{Patterns: []string{"*.pdf"}, BucketName: "media-bucket"},
+		}, "", midas.ErrSiteConfig},
+		{"Shared route destination", []midas.AWSRouteSettings{
+			{Patterns: []string{"*.png"}, BucketName: "media-bucket", S3Prefix: "media"},
+			{Patterns: []string{"*.pdf"}, BucketName: "media-bucket", S3Prefix: "/media/"},
+		}, "media-bucket:media,media-bucket:media", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := newRoutes(midas.AWSDeploymentSettigs{BucketName: "site-bucket", S3Prefix: "www", Routes: tt.routes}, midas.Site{SiteName: "test"}, now)
+
+			var destinations []string
+			for _, r := range routes {
+				destinations = append(destinations, r.destination.bucket+":"+r.destination.prefix)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":   {midas.ErrorCode(err), tt.wantCode},
+				"Destinations": {strings.Join(destinations, ","), tt.want},
+			})
+		})
+	}
+}
+
+func TestDeployment_destination(t *testing.T) {
+	routes, err := newRoutes(midas.AWSDeploymentSettigs{BucketName: "site-bucket", S3Prefix: "/www/", Routes: []midas.AWSRouteSettings{
+		{Patterns: []string{"downloads/**"}, ContentTypes: []string{"application/pdf"}, BucketName: "files-bucket"},
+		{ContentTypes: []string{"image/*", "video/mp4"}, BucketName: "media-bucket", S3Prefix: "site"},
+		{Patterns: []string{"*.css", "*.js"}, S3Prefix: "assets"},
+	}}, midas.Site{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Deployment{
+		deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{BucketName: "site-bucket", S3Prefix: "/www/"}},
+		routes:             routes,
+	}
+
+	tests := []struct {
+		rel         string
+		contentType string
+		want        string
+	}{
+		{"index.html", "text/html", "site-bucket/www/index.html"},
+		{"downloads/guide.pdf", "application/pdf", "files-bucket/downloads/guide.pdf"},
+		{"downloads/cover.png", "image/png", "media-bucket/site/downloads/cover.png"},
+		{"guide.pdf", "application/pdf", "site-bucket/www/guide.pdf"},
+		{"images/photo.jpg", "image/jpeg", "media-bucket/site/images/photo.jpg"},
+		{"intro.mp4", "video/mp4", "media-bucket/site/intro.mp4"},
+		{"intro.webm", "video/webm", "site-bucket/www/intro.webm"},
+		{"css/style.css", "text/css", "site-bucket/assets/css/style.css"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			dest := d.destination(tt.rel, tt.contentType)
+			testing_utils.AssertEquals(t, dest.bucket+"/"+dest.key(tt.rel), tt.want, "Destination")
+		})
+	}
+
+	var destinations []string
+	for _, dest := range d.destinations() {
+		destinations = append(destinations, dest.bucket+":"+dest.prefix)
+	}
+	testing_utils.AssertEquals(t, strings.Join(destinations, ","), "site-bucket:www,files-bucket:,media-bucket:site,site-bucket:assets", "Destinations")
+}
+
+func TestDeployment_DeployContext_Routes(t *testing.T) {
+	publicPath := t.TempDir()
+	for _, name := range []string{"index.html", "css/style.css", "images/photo.png"} {
+		path := filepath.Join(publicPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := midas.AWSDeploymentSettigs{
+		BucketName: "site-bucket",
+		S3Prefix:   "www",
+		ExtraFiles: map[string]string{"images/robots.txt": "User-agent: *"},
+		Routes:     []midas.AWSRouteSettings{{Patterns: []string{"images/**"}, BucketName: "media-bucket"}},
+	}
+	routes, err := newRoutes(settings, midas.Site{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeS3{cancel: func() {}}
+	client.bodies = map[string][]byte{"images/removed.png": []byte("removed"), "images/photo.png": []byte("old")}
+	client.buckets = map[string]string{"images/removed.png": "media-bucket", "images/photo.png": "media-bucket"}
+	client.encodings, client.inputs = map[string]string{}, map[string]*s3.PutObjectInput{}
+
+	d := newTestDeployment(&fakeCloudfront{}, false)
+	d.deploymentSettings.AWS.BucketName = settings.BucketName
+	d.deploymentSettings.AWS.S3Prefix = settings.S3Prefix
+	d.deploymentSettings.AWS.ExtraFiles = settings.ExtraFiles
+	d.deploymentSettings.AWS.Verify.Enabled = true
+	d.routes = routes
+	d.publicPath = publicPath
+	d.s3Client = client
+	d.uploader = client
+
+	err = d.DeployContext(context.Background())
+
+	var uploads []string
+	for key, bucket := range client.buckets {
+		uploads = append(uploads, bucket+"/"+key)
+	}
+	sort.Strings(uploads)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":      {err, nil},
+		"Uploads":    {strings.Join(uploads, ","), "media-bucket/images/photo.png,media-bucket/images/robots.txt,site-bucket/www/css/style.css,site-bucket/www/index.html"},
+		"Head calls": {client.headCalls, 4},
+		"Deleted":    {strings.Join(client.deleted, ","), "images/removed.png"},
+	})
+}
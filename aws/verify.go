@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kovansky/midas"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+// uploadedObject is the object uploaded to the S3 bucket, with the size and MD5 checksum of the uploaded content.
+type uploadedObject struct {
+	bucket string
+	key    string
+	size   int64
+	md5    string
+}
+
+// sampleForVerification returns true if the uploaded file should be verified after the deployment.
+func (d *Deployment) sampleForVerification() bool {
+	settings := d.deploymentSettings.AWS.Verify
+	if !settings.Enabled {
+		return false
+	}
+
+	if settings.SampleRate <= 0 || settings.SampleRate >= 1 {
+		return true
+	}
+
+	return rand.Float64() < settings.SampleRate
+}
+
+// verifyObjects checks the size and ETag of the uploaded objects in the S3 bucket against the local content.
+// All mismatches are reported in the returned error.
+func (d *Deployment) verifyObjects(ctx context.Context, objects []uploadedObject) error {
+	var mismatches []string
+
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		output, err := d.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(object.bucket),
+			Key:    aws.String(object.key),
+		})
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %s", object.key, err))
+			continue
+		}
+
+		if output.ContentLength != object.size {
+			mismatches = append(mismatches, fmt.Sprintf("%s: size %d, expected %d", object.key, output.ContentLength, object.size))
+			continue
+		}
+
+		// ETag of the multipart upload isn't the MD5 of the content, so only the size can be checked
+		etag := strings.Trim(aws.ToString(output.ETag), `"`)
+		if !strings.Contains(etag, "-") && etag != object.md5 {
+			mismatches = append(mismatches, fmt.Sprintf("%s: ETag %s, expected %s", object.key, etag, object.md5))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return midas.Errorf(midas.ErrInternal, "deployment verification failed for %d of %d objects: %s",
+			len(mismatches), len(objects), strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+// contentChecksum returns the size and hex encoded MD5 checksum of the content. The content is rewound afterwards,
+// so it can be uploaded.
+func contentChecksum(content io.ReadSeeker) (int64, string, error) {
+	hash := md5.New()
+	size, err := io.Copy(hash, content)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeployment_Verify(t *testing.T) {
+	publicPath := t.TempDir()
+	files := map[string]string{
+		"index.html": strings.Repeat("<p>Home</p>\n", 50),
+		"style.css":  "body { color: red; }",
+		"logo.png":   "png",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(publicPath, name), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deploy := func(client *fakeS3, settings midas.AWSVerifySettings, brotli bool) (*fakeCloudfront, error) {
+		cf := &fakeCloudfront{}
+
+		d := newTestDeployment(cf, false)
+		d.publicPath = publicPath
+		d.deploymentSettings.AWS.Verify = settings
+		d.deploymentSettings.AWS.Brotli = brotli
+		d.s3Client = client
+		d.uploader = client
+
+		return cf, d.DeployContext(context.Background())
+	}
+
+	enabled := midas.AWSVerifySettings{Enabled: true}
+
+	tests := []struct {
+		name       string
+		heads      map[string]*s3.HeadObjectOutput
+		mismatches []string
+	}{
+		{"Matching", nil, nil},
+		{"Size mismatch", map[string]*s3.HeadObjectOutput{
+			"style.css": {ContentLength: 3, ETag: aws.String(`"abc"`)},
+		}, []string{"style.css: size 3, expected 20"}},
+		{"ETag mismatch", map[string]*s3.HeadObjectOutput{
+			"logo.png": {ContentLength: 3, ETag: aws.String(`"0123456789abcdef0123456789abcdef"`)},
+		}, []string{"logo.png: ETag 0123456789abcdef0123456789abcdef"}},
+		{"Multipart ETag", map[string]*s3.HeadObjectOutput{
+			"logo.png": {ContentLength: 3, ETag: aws.String(`"0123456789abcdef0123456789abcdef-2"`)},
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeS3{cancel: func() {}, heads: tt.heads}
+
+			cf, err := deploy(client, enabled, false)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Head calls": {client.headCalls, 3},
+				"Failed":     {err != nil, len(tt.mismatches) > 0},
+			})
+
+			if len(tt.mismatches) == 0 {
+				testing_utils.AssertEquals(t, len(cf.createCalls), 1, "Invalidation")
+				return
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":   {midas.ErrorCode(err), midas.ErrInternal},
+				"Invalidation": {len(cf.createCalls), 0},
+			})
+			for _, mismatch := range tt.mismatches {
+				testing_utils.AssertEquals(t, strings.Contains(err.Error(), mismatch), true, mismatch)
+			}
+		})
+	}
+
+	t.Run("Compressed objects", func(t *testing.T) {
+		client := &fakeS3{cancel: func() {}}
+
+		_, err := deploy(client, enabled, true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":      {err, nil},
+			"Compressed": {client.encodings["index.html"], "br"},
+		})
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		client := &fakeS3{cancel: func() {}}
+
+		_, err := deploy(client, midas.AWSVerifySettings{SampleRate: 1}, false)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":      {err, nil},
+			"Head calls": {client.headCalls, 0},
+		})
+	})
+}
+
+func TestDeployment_sampleForVerification(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		min, max   int
+	}{
+		{"All by default", 0, 1000, 1000},
+		{"All", 1, 1000, 1000},
+		{"Half", 0.5, 350, 650},
+		{"Few", 0.01, 0, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Deployment{deploymentSettings: midas.DeploymentSettings{AWS: midas.AWSDeploymentSettigs{
+				Verify: midas.AWSVerifySettings{Enabled: true, SampleRate: tt.sampleRate},
+			}}}
+
+			sampled := 0
+			for i := 0; i < 1000; i++ {
+				if d.sampleForVerification() {
+					sampled++
+				}
+			}
+
+			testing_utils.AssertEquals(t, sampled >= tt.min && sampled <= tt.max, true, "Sampled count")
+		})
+	}
+}
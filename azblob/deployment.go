@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package azblob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/minify"
+	"github.com/kovansky/midas/walk"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ midas.Deployment = (*Deployment)(nil)
+
+type Deployment struct {
+	site               midas.Site
+	deploymentSettings midas.DeploymentSettings
+	publicPath         string
+	filter             walk.Filter
+
+	containerClient containerClient
+}
+
+// containerClient is the part of the container API used by the deployment.
+type containerClient interface {
+	UploadFile(ctx context.Context, blobName string, file *os.File, options azblob.UploadOption) error
+	UploadBuffer(ctx context.Context, blobName string, buffer []byte, options azblob.UploadOption) error
+	// ListBlobs returns the names of all the blobs under the prefix.
+	ListBlobs(ctx context.Context, prefix string) ([]string, error)
+	DeleteBlob(ctx context.Context, blobName string) error
+}
+
+func New(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
+	// Get build destination directory (or its deployed subdirectory)
+	publicPath, err := deploymentSettings.DeployPath(site, isDraft)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := deploymentSettings.FileFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	containerClient, err := newContainerClient(deploymentSettings.AzureBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Deployment{site: site, deploymentSettings: deploymentSettings, publicPath: publicPath, filter: filter, containerClient: sdkContainerClient{containerClient}}, nil
+}
+
+// newContainerClient authenticates to the storage account, using the connection string if provided
+// or the account name and key otherwise.
+func newContainerClient(settings midas.AzureBlobDeploymentSettings) (*azblob.ContainerClient, error) {
+	if settings.Container == "" {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "azure blob container is not set")
+	}
+
+	if settings.ConnectionString != "" {
+		containerClient, err := azblob.NewContainerClientFromConnectionString(settings.ConnectionString, settings.Container, nil)
+		if err != nil {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "azure blob authentication failed: %s", err)
+		}
+
+		return containerClient, nil
+	}
+
+	if settings.AccountName == "" || settings.AccountKey == "" {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "azure blob requires either connection string or account name and key")
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(settings.AccountName, settings.AccountKey)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "azure blob authentication failed: %s", err)
+	}
+
+	serviceUrl := fmt.Sprintf("https://%s.blob.core.windows.net/", settings.AccountName)
+	serviceClient, err := azblob.NewServiceClientWithSharedKey(serviceUrl, credential, nil)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "azure blob authentication failed: %s", err)
+	}
+
+	containerClient, err := serviceClient.NewContainerClient(settings.Container)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "azure blob authentication failed: %s", err)
+	}
+
+	return containerClient, nil
+}
+
+// authErrorCodes are the codes of the storage errors returned for the rejected credentials (i.e. the wrong account key
+// or SAS).
+var authErrorCodes = map[azblob.StorageErrorCode]bool{
+	azblob.StorageErrorCodeAuthenticationFailed:              true,
+	azblob.StorageErrorCodeAuthorizationFailure:              true,
+	azblob.StorageErrorCodeAuthorizationPermissionMismatch:   true,
+	azblob.StorageErrorCodeAuthorizationProtocolMismatch:     true,
+	azblob.StorageErrorCodeAuthorizationResourceTypeMismatch: true,
+	azblob.StorageErrorCodeAuthorizationServiceMismatch:      true,
+	azblob.StorageErrorCodeAuthorizationSourceIPMismatch:     true,
+	azblob.StorageErrorCodeInsufficientAccountPermissions:    true,
+	azblob.StorageErrorCodeInvalidAuthenticationInfo:         true,
+	azblob.StorageErrorCodeNoAuthenticationInformation:       true,
+}
+
+// storageError returns ErrSiteConfig for the error of the request rejected due to the credentials, which are only
+// checked by the storage on the request, or the error itself otherwise.
+func storageError(err error) error {
+	var storageErr *azblob.StorageError
+	if errors.As(err, &storageErr) && authErrorCodes[storageErr.ErrorCode] {
+		return midas.Errorf(midas.ErrSiteConfig, "azure blob authentication failed: %s", storageErr.ErrorCode)
+	}
+
+	// The list pager returns the response error as is
+	var responseErr *azcore.ResponseError
+	if errors.As(err, &responseErr) && (responseErr.StatusCode == http.StatusUnauthorized || responseErr.StatusCode == http.StatusForbidden) {
+		return midas.Errorf(midas.ErrSiteConfig, "azure blob authentication failed: %s", responseErr.ErrorCode)
+	}
+
+	return err
+}
+
+// Deploy uploads built site to the Azure Blob Storage container and removes the orphaned blobs.
+func (d *Deployment) Deploy() error {
+	return d.DeployContext(context.Background())
+}
+
+// DeployContext uploads built site to the Azure Blob Storage container and removes the orphaned blobs, aborting
+// when the context is cancelled. Orphans are not removed if the deployment is cancelled.
+func (d *Deployment) DeployContext(ctx context.Context) (err error) {
+	manifest := midas.NewDeployManifest(d.deploymentSettings.Target)
+	defer func() {
+		midas.Metrics.SiteDeployed(d.site.SiteName, d.deploymentSettings.Target, manifest.Size(), time.Since(manifest.DeployedAt), err)
+	}()
+
+	// Stops the walker, if the deployment returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Guards the live site against the empty build output
+	if err = d.deploymentSettings.CheckOutputPath(d.publicPath); err != nil {
+		return err
+	}
+
+	walker, walkErr := d.retrieveFiles(ctx)
+
+	uploaded := make(map[string]bool)
+	fileErrors := d.deploymentSettings.NewFileErrors()
+
+	// Upload each file to the container.
+	for path := range walker {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := func() error {
+			rel, err := filepath.Rel(d.publicPath, path)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = file.Close()
+			}()
+
+			blobName, err := d.uploadFile(ctx, file, rel, manifest)
+			if err != nil {
+				return err
+			}
+
+			uploaded[blobName] = true
+
+			return nil
+		}()
+		if err = fileErrors.Add(path, err); err != nil {
+			return err
+		}
+	}
+
+	// The walk is stopped on cancellation, so pruning would remove the blobs which were not uploaded yet
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// As well as on the walk failure
+	if err := <-walkErr; err != nil {
+		return err
+	}
+
+	// Pruning would also remove the previous versions of the failed files
+	if err := fileErrors.Err(); err != nil {
+		return err
+	}
+
+	if err := d.prune(ctx, uploaded); err != nil {
+		return err
+	}
+
+	return manifest.Write(d.site, d.deploymentSettings)
+}
+
+// uploadFile uploads a file to the container and returns the name of the blob. The uploaded content is recorded in
+// the manifest.
+func (d *Deployment) uploadFile(ctx context.Context, file *os.File, rel string, manifest *midas.DeployManifest) (string, error) {
+	blobName := d.blobName(rel)
+
+	contentType, err := d.deploymentSettings.ContentType(file, file.Name())
+	if err != nil {
+		return "", err
+	}
+	cacheControl := midas.ContentCacheControl(file.Name(), contentType)
+
+	options := azblob.UploadOption{
+		HTTPHeaders: &azblob.BlobHTTPHeaders{
+			BlobContentType:  &contentType,
+			BlobCacheControl: &cacheControl,
+		},
+	}
+
+	content, minified, err := minify.Content(file, contentType, d.deploymentSettings.Minify)
+	if err != nil {
+		return "", err
+	}
+
+	if minified {
+		var buffer []byte
+		if buffer, err = io.ReadAll(content); err != nil {
+			return "", err
+		}
+		err = d.containerClient.UploadBuffer(ctx, blobName, buffer, options)
+	} else {
+		err = d.containerClient.UploadFile(ctx, blobName, file, options)
+	}
+	if err != nil {
+		return "", storageError(err)
+	}
+
+	return blobName, manifest.AddContent(blobName, content, contentType)
+}
+
+// prune deletes the blobs under the prefix which were not uploaded in the current deployment.
+func (d *Deployment) prune(ctx context.Context, uploaded map[string]bool) error {
+	blobs, err := d.listBlobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, blobName := range blobs {
+		if uploaded[blobName] {
+			continue
+		}
+
+		if err = d.containerClient.DeleteBlob(ctx, blobName); err != nil {
+			return storageError(err)
+		}
+	}
+
+	return nil
+}
+
+// listBlobs retrieves a list of blobs under the prefix in the container.
+func (d *Deployment) listBlobs(ctx context.Context) ([]string, error) {
+	prefix := d.prefix()
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	blobs, err := d.containerClient.ListBlobs(ctx, prefix)
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	return blobs, nil
+}
+
+// blobName returns the name of the blob for the file path relative to the public directory.
+func (d *Deployment) blobName(rel string) string {
+	blobName := strings.ReplaceAll(rel, "\\", "/")
+	if prefix := d.prefix(); prefix != "" {
+		blobName = fmt.Sprintf("%s/%s", prefix, blobName)
+	}
+
+	return blobName
+}
+
+// prefix returns the configured blob prefix without surrounding slashes.
+func (d *Deployment) prefix() string {
+	return strings.Trim(d.deploymentSettings.AzureBlob.Prefix, "/")
+}
+
+// retrieveFiles walks the public directory and returns a channel of files to be uploaded, along with the channel
+// receiving the walk error (ErrInternal, or nil if the walk succeeded or was cancelled) once the files channel is
+// closed.
+func (d *Deployment) retrieveFiles(ctx context.Context) (walk.FileWalk, <-chan error) {
+	walker := make(walk.FileWalk)
+	walkErr := make(chan error, 1)
+
+	// Gather the files to upload by walking the path recursively, until the context is cancelled.
+	go func() {
+		defer close(walker)
+
+		err := filepath.Walk(d.publicPath, walker.WalkFiltered(ctx, d.publicPath, d.filter))
+		if err != nil && ctx.Err() == nil {
+			walkErr <- midas.Errorf(midas.ErrInternal, "walking %s failed: %s", d.publicPath, err)
+			return
+		}
+		walkErr <- nil
+	}()
+
+	return walker, walkErr
+}
+
+// sdkContainerClient is the containerClient of the Azure SDK.
+type sdkContainerClient struct {
+	client *azblob.ContainerClient
+}
+
+func (c sdkContainerClient) UploadFile(ctx context.Context, blobName string, file *os.File, options azblob.UploadOption) error {
+	blobClient, err := c.client.NewBlockBlobClient(blobName)
+	if err != nil {
+		return err
+	}
+
+	_, err = blobClient.UploadFile(ctx, file, options)
+	return err
+}
+
+func (c sdkContainerClient) UploadBuffer(ctx context.Context, blobName string, buffer []byte, options azblob.UploadOption) error {
+	blobClient, err := c.client.NewBlockBlobClient(blobName)
+	if err != nil {
+		return err
+	}
+
+	_, err = blobClient.UploadBuffer(ctx, buffer, options)
+	return err
+}
+
+func (c sdkContainerClient) ListBlobs(ctx context.Context, prefix string) ([]string, error) {
+	var blobs []string
+
+	options := &azblob.ContainerListBlobsFlatOptions{}
+	if prefix != "" {
+		options.Prefix = &prefix
+	}
+
+	pager := c.client.ListBlobsFlat(options)
+	for pager.NextPage(ctx) {
+		response := pager.PageResponse()
+		if response.Segment == nil {
+			continue
+		}
+
+		for _, blob := range response.Segment.BlobItems {
+			if blob.Name != nil {
+				blobs = append(blobs, *blob.Name)
+			}
+		}
+	}
+
+	if err := pager.Err(); err != nil {
+		return nil, err
+	}
+
+	return blobs, nil
+}
+
+func (c sdkContainerClient) DeleteBlob(ctx context.Context, blobName string) error {
+	blobClient, err := c.client.NewBlobClient(blobName)
+	if err != nil {
+		return err
+	}
+
+	_, err = blobClient.Delete(ctx, nil)
+	return err
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package azblob
+
+import (
+	"context"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeContainer keeps the blobs in memory and records the calls.
+type fakeContainer struct {
+	blobs        map[string][]byte
+	contentTypes map[string]string
+	uploads      []string
+	deleted      []string
+	listPrefix   string
+	listCalls    int
+
+	uploadErr error // Error of every upload
+	listErr   error
+}
+
+func (f *fakeContainer) UploadFile(_ context.Context, blobName string, file *os.File, options azblob.UploadOption) error {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	return f.upload(blobName, content, options)
+}
+
+func (f *fakeContainer) UploadBuffer(_ context.Context, blobName string, buffer []byte, options azblob.UploadOption) error {
+	return f.upload(blobName, buffer, options)
+}
+
+func (f *fakeContainer) upload(blobName string, content []byte, options azblob.UploadOption) error {
+	if f.uploadErr != nil {
+		return f.uploadErr
+	}
+
+	if f.blobs == nil {
+		f.blobs = map[string][]byte{}
+	}
+	if f.contentTypes == nil {
+		f.contentTypes = map[string]string{}
+	}
+	f.blobs[blobName] = content
+	f.contentTypes[blobName] = *options.HTTPHeaders.BlobContentType
+
+	f.uploads = append(f.uploads, blobName)
+
+	return nil
+}
+
+func (f *fakeContainer) ListBlobs(_ context.Context, prefix string) ([]string, error) {
+	f.listCalls++
+	f.listPrefix = prefix
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	var blobs []string
+	for name := range f.blobs {
+		if strings.HasPrefix(name, prefix) {
+			blobs = append(blobs, name)
+		}
+	}
+	sort.Strings(blobs)
+
+	return blobs, nil
+}
+
+func (f *fakeContainer) DeleteBlob(_ context.Context, blobName string) error {
+	f.deleted = append(f.deleted, blobName)
+	delete(f.blobs, blobName)
+
+	return nil
+}
+
+// newTestPublic writes the built site to the temporary public directory.
+func newTestPublic(t *testing.T) string {
+	t.Helper()
+
+	publicPath := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":       "<h1>Home</h1>",
+		"posts/first.html": "<h1>First</h1>",
+		"style.css":        "body { color: red; }",
+	} {
+		path := filepath.Join(publicPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return publicPath
+}
+
+func newTestDeployment(publicPath, prefix string, client *fakeContainer) *Deployment {
+	return &Deployment{
+		deploymentSettings: midas.DeploymentSettings{AzureBlob: midas.AzureBlobDeploymentSettings{Container: "web", Prefix: prefix}},
+		publicPath:         publicPath,
+		containerClient:    client,
+	}
+}
+
+func TestDeployment_blobName(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		rel    string
+		want   string
+	}{
+		{"No prefix", "", "index.html", "index.html"},
+		{"Nested", "", filepath.Join("posts", "first.html"), "posts/first.html"},
+		{"Prefix", "site", "index.html", "site/index.html"},
+		{"Prefix with slashes", "/site/v1/", filepath.Join("posts", "first.html"), "site/v1/posts/first.html"},
+		{"Windows separators", "site", `posts\first.html`, "site/posts/first.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDeployment("", tt.prefix, &fakeContainer{})
+			testing_utils.AssertEquals(t, d.blobName(tt.rel), tt.want, "Blob name")
+		})
+	}
+}
+
+func TestDeployment_Deploy(t *testing.T) {
+	publicPath := newTestPublic(t)
+
+	existing := func() map[string][]byte {
+		return map[string][]byte{"site/index.html": []byte("old"), "site/removed.html": []byte("old"), "other/kept.html": []byte("other")}
+	}
+
+	tests := []struct {
+		name        string
+		prefix      string
+		wantUploads string
+		wantPrefix  string
+		wantDeleted string
+	}{
+		{"Prefix", "site", "site/index.html,site/posts/first.html,site/style.css", "site/", "site/removed.html"},
+		{"Prefix with slashes", "/site/", "site/index.html,site/posts/first.html,site/style.css", "site/", "site/removed.html"},
+		{"No prefix", "", "index.html,posts/first.html,style.css", "", "other/kept.html,site/index.html,site/removed.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeContainer{blobs: existing()}
+
+			err := newTestDeployment(publicPath, tt.prefix, client).Deploy()
+
+			sort.Strings(client.uploads)
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":        {err, nil},
+				"Uploads":      {strings.Join(client.uploads, ","), tt.wantUploads},
+				"List prefix":  {client.listPrefix, tt.wantPrefix},
+				"Deleted":      {strings.Join(client.deleted, ","), tt.wantDeleted},
+				"Content":      {string(client.blobs[tt.wantPrefix+"posts/first.html"]), "<h1>First</h1>"},
+				"Content type": {strings.HasPrefix(client.contentTypes[tt.wantPrefix+"style.css"], "text/css"), true},
+			})
+		})
+	}
+}
+
+func TestDeployment_Deploy_WalkFailed(t *testing.T) {
+	client := &fakeContainer{blobs: map[string][]byte{"site/removed.html": []byte("old")}}
+
+	d := newTestDeployment(filepath.Join(t.TempDir(), "missing"), "site", client)
+	// The missing output reaches the walk
+	d.deploymentSettings.AllowEmpty = true
+
+	err := d.Deploy()
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":      {midas.ErrorCode(err) == midas.ErrInternal && strings.Contains(err.Error(), "walking"), true},
+		"List calls": {client.listCalls, 0},
+		"Deleted":    {len(client.deleted), 0},
+	})
+}
+
+func TestDeployment_Deploy_EmptyOutput(t *testing.T) {
+	client := &fakeContainer{blobs: map[string][]byte{"site/index.html": []byte("live")}}
+
+	err := newTestDeployment(t.TempDir(), "site", client).Deploy()
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error code": {midas.ErrorCode(err), midas.ErrSiteConfig},
+		"Uploads":    {len(client.uploads), 0},
+		"List calls": {client.listCalls, 0},
+		"Live kept":  {string(client.blobs["site/index.html"]), "live"},
+	})
+}
+
+func TestDeployment_Deploy_AuthErrors(t *testing.T) {
+	publicPath := newTestPublic(t)
+
+	tests := []struct {
+		name      string
+		uploadErr error
+		listErr   error
+		wantErr   string
+	}{
+		{"Upload authentication failed", &azblob.StorageError{ErrorCode: azblob.StorageErrorCodeAuthenticationFailed}, nil, midas.ErrSiteConfig},
+		{"Upload not authorized", &azblob.StorageError{ErrorCode: azblob.StorageErrorCodeAuthorizationPermissionMismatch}, nil, midas.ErrSiteConfig},
+		{"Upload failed", &azblob.StorageError{ErrorCode: azblob.StorageErrorCodeServerBusy}, nil, midas.ErrInternal},
+		{"List forbidden", nil, &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthenticationFailed"}, midas.ErrSiteConfig},
+		{"List unauthorized", nil, &azcore.ResponseError{StatusCode: http.StatusUnauthorized}, midas.ErrSiteConfig},
+		{"List failed", nil, &azcore.ResponseError{StatusCode: http.StatusInternalServerError}, midas.ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeContainer{uploadErr: tt.uploadErr, listErr: tt.listErr}
+
+			err := newTestDeployment(publicPath, "site", client).Deploy()
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantErr, "Error code")
+		})
+	}
+}
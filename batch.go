@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas
+
+import "sync"
+
+// BatchResult is the result of creating a single entry of the batch.
+type BatchResult struct {
+	Index int    // Index of the payload in the batch
+	Path  string // Path of the created entry
+	Err   error
+}
+
+// BatchReport aggregates the results of creating the entries of the batch.
+type BatchReport struct {
+	Results   []BatchResult
+	Succeeded int
+	Failed    int
+}
+
+// Err returns an error summarizing the failed entries, or nil if all of them succeeded.
+func (r BatchReport) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+
+	return Errorf(ErrInvalid, "%d of %d entries failed", r.Failed, len(r.Results))
+}
+
+// CreateEntries creates the entry for each of the payloads (i.e. from Strapi export), using up to given number of
+// workers concurrently (less than two means sequentially). Failure of one entry doesn't abort the batch, the errors
+// are collected in the report instead, in the order of payloads. The site service must be safe for concurrent use.
+func CreateEntries(site SiteService, payloads []Payload, workers int) BatchReport {
+	report := BatchReport{Results: make([]BatchResult, len(payloads))}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers && w < len(payloads); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				report.Results[i] = createBatchEntry(site, i, payloads[i])
+			}
+		}()
+	}
+
+	for i := range payloads {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Err != nil {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+
+	return report
+}
+
+// createBatchEntry creates a single entry, turning a panic (i.e. on malformed payload) into an error.
+func createBatchEntry(site SiteService, index int, payload Payload) (result BatchResult) {
+	result.Index = index
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result.Err = Errorf(ErrInvalid, "entry %d is malformed: %v", index, recovered)
+		}
+	}()
+
+	result.Path, result.Err = site.CreateEntry(payload)
+
+	return result
+}
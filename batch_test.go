@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/mock"
+	"github.com/kovansky/midas/strapi"
+	"github.com/kovansky/midas/testing_utils"
+	"testing"
+)
+
+func TestCreateEntries(t *testing.T) {
+	site := mock.NewSiteService()
+	site.CreateEntryFn = func(payload midas.Payload) (string, error) {
+		title := payload.Entry()["Title"].(string)
+		if title == "" {
+			return "", midas.Errorf(midas.ErrInvalid, "title is empty")
+		}
+
+		return title + ".html", nil
+	}
+
+	var payloads []midas.Payload
+	for _, entry := range []string{`{"Title": "first"}`, `{"Title": ""}`, `{"Title": 3}`, `{"Title": "last"}`} {
+		payload, err := strapi.ParsePayload([]byte(`{"event": "entry.create", "model": "post", "entry": ` + entry + `}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	report := midas.CreateEntries(site, payloads, 1)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Results":        {len(report.Results), 4},
+		"Succeeded":      {report.Succeeded, 2},
+		"Failed":         {report.Failed, 2},
+		"First path":     {report.Results[0].Path, "first.html"},
+		"First error":    {report.Results[0].Err, nil},
+		"Failed error":   {midas.ErrorCode(report.Results[1].Err), midas.ErrInvalid},
+		"Panicked error": {midas.ErrorCode(report.Results[2].Err), midas.ErrInvalid},
+		"Last index":     {report.Results[3].Index, 3},
+		"Last path":      {report.Results[3].Path, "last.html"},
+		"Report error":   {midas.ErrorMessage(report.Err()), "2 of 4 entries failed"},
+	})
+
+	t.Run("All succeeded", func(t *testing.T) {
+		report := midas.CreateEntries(site, payloads[:1], 4)
+		testing_utils.AssertEquals(t, report.Err(), nil, "Report error")
+	})
+}
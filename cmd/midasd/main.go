@@ -12,8 +12,10 @@ import (
 	"flag"
 	"fmt"
 	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/archive"
 	"github.com/kovansky/midas/astro"
 	"github.com/kovansky/midas/aws"
+	"github.com/kovansky/midas/azblob"
 	"github.com/kovansky/midas/bluemonday"
 	"github.com/kovansky/midas/concurrent"
 	"github.com/kovansky/midas/http"
@@ -106,6 +108,18 @@ func readConfig(filename string) (midas.Config, error) {
 		return config, err
 	}
 
+	for apiKey, site := range config.Sites {
+		if !site.Discover.Enabled {
+			continue
+		}
+
+		discovered, err := midas.DiscoverModels(site)
+		if err != nil {
+			return config, err
+		}
+		config.Sites[apiKey] = discovered
+	}
+
 	return config, nil
 }
 
@@ -190,8 +204,9 @@ func (m *Main) Run(_ context.Context) (err error) {
 	m.HTTPServer.Config = m.Config
 
 	m.HTTPServer.SiteServices = map[string]func(site midas.Site) (midas.SiteService, error){
+		// The site services are shared by the requests, so the webhooks of different entries proceed in parallel
 		"hugo": func(site midas.Site) (midas.SiteService, error) {
-			return hugo.NewSiteService(site)
+			return hugo.NewSiteService(site, hugo.WithEntryLocking())
 		},
 		"astro": func(site midas.Site) (midas.SiteService, error) {
 			return astro.NewSiteService(site)
@@ -214,6 +229,12 @@ func (m *Main) Run(_ context.Context) (err error) {
 		"sftp": func(site midas.Site, settings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
 			return sftp.New(site, settings, isDraft)
 		},
+		"azblob": func(site midas.Site, settings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
+			return azblob.New(site, settings, isDraft)
+		},
+		"archive": func(site midas.Site, settings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
+			return archive.New(site, settings, isDraft)
+		},
 	}
 
 	midas.Sanitizer = bluemonday.NewSanitizerService()
@@ -8,24 +8,28 @@ package concurrent
 
 import (
 	"github.com/kovansky/midas"
+	"sync"
 )
 
+// List is safe for concurrent use by multiple goroutines.
 type List struct {
+	mu        sync.Mutex
 	processes map[string]*midas.Concurrent
 }
 
 func NewList() *List {
-	return &List{make(map[string]*midas.Concurrent)}
+	return &List{processes: make(map[string]*midas.Concurrent)}
 }
 
 // Add a new element to the list.
 // If a process for the Site is already in the list, try to kill the process, remove it and add the new one
 func (l *List) Add(concurrent midas.Concurrent) error {
-	if l.Has(concurrent.Site().SiteName) == true {
-		err := l.SafelyRemove(concurrent.Site().SiteName)
-		if err != nil {
-			return err
-		}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if process, ok := l.processes[concurrent.Site().SiteName]; ok {
+		(*process).Stop()
+		delete(l.processes, concurrent.Site().SiteName)
 	}
 	l.processes[concurrent.Site().SiteName] = &concurrent
 	return nil
@@ -33,30 +37,42 @@ func (l *List) Add(concurrent midas.Concurrent) error {
 
 // Has return true if the Site with the provided name has a running process.
 func (l *List) Has(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	_, ok := l.processes[name]
 	return ok
 }
 
 // SafelyRemove tries to kill the process for the provided Site and then removes it from the list
 func (l *List) SafelyRemove(name string) error {
-	process, err := l.Get(name)
-	if err != nil {
-		return err
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	process, ok := l.processes[name]
+	if !ok {
+		return midas.Errorf(midas.ErrProcessNotFound, "process for %s not found", name)
 	}
 	(*process).Stop()
-	l.Remove(name)
+	delete(l.processes, name)
 	return nil
 }
 
 // Remove the process for the given Site from the list without killing it (i.e. if we know it already ended).
 func (l *List) Remove(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	delete(l.processes, name)
 }
 
 // Get the process for the Site with provided name.
 func (l *List) Get(name string) (*midas.Concurrent, error) {
-	if l.Has(name) {
-		return l.processes[name], nil
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if process, ok := l.processes[name]; ok {
+		return process, nil
 	}
 
 	return nil, midas.Errorf(midas.ErrProcessNotFound, "process for %s not found", name)
@@ -11,4 +11,17 @@ type Config struct {
 	Addr         string          `json:"addr"`
 	RollbarToken string          `json:"rollbarToken"`
 	Sites        map[string]Site `json:"sites"` // [api key] => site
+	// Routers share one API key between multiple sites: the requests authenticated with the router key are
+	// dispatched to the routed site.
+	Routers map[string]RouterSettings `json:"routers,omitempty"` // [api key] => router
+	// ShutdownTimeout is the time (in seconds) the server waits on shutdown for the in-flight operations to finish,
+	// before cancelling them. Default: 30
+	ShutdownTimeout int `json:"shutdownTimeout,omitempty"`
+}
+
+type RouterSettings struct {
+	// Sites maps the site identifiers, sent in the X-Midas-Site header, to the API keys of the sites.
+	Sites map[string]string `json:"sites,omitempty"`
+	// Models maps the payload models to the API keys of the sites, for the requests without the site header.
+	Models map[string]string `json:"models,omitempty"`
 }
@@ -6,15 +6,70 @@
 
 package midas
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas/walk"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 type Deployment interface {
 	Deploy() error
+	// DeployContext deploys the site, aborting when the context is cancelled.
+	DeployContext(ctx context.Context) error
+}
+
+// FullDeployment is implemented by the deployments which skip the work they consider done (i.e. the unchanged
+// files), so the target which looks wrong can be redeployed from scratch.
+type FullDeployment interface {
+	// DeployFull deploys the site like DeployContext, but uploads all the files, removes the orphaned ones and
+	// invalidates all the cached paths, regardless of the target state.
+	DeployFull(ctx context.Context) error
 }
 
 type DeploymentSettings struct {
-	Enabled bool                   `json:"enabled,default=false"`
-	Target  string                 `json:"target"` // Can be: AWS, SFTP
-	AWS     AWSDeploymentSettigs   `json:"aws,omitempty"`
-	SFTP    SFTPDeploymentSettings `json:"sftp,omitempty"`
+	Enabled   bool                        `json:"enabled,default=false"`
+	Target    string                      `json:"target"` // Can be: AWS, SFTP, AzBlob, Archive
+	AWS       AWSDeploymentSettigs        `json:"aws,omitempty"`
+	SFTP      SFTPDeploymentSettings      `json:"sftp,omitempty"`
+	AzureBlob AzureBlobDeploymentSettings `json:"azblob,omitempty"`
+	Archive   ArchiveDeploymentSettings   `json:"archive,omitempty"`
+
+	// ManifestPath is the path (relative to the site root) where the JSON manifest of uploaded files is written
+	// after the deployment. Manifest is not written if empty.
+	ManifestPath string `json:"manifestPath,omitempty"`
+	// Subdir is the directory (relative to the public directory) deployed instead of the whole public directory.
+	// Its content is mapped to the target root (or prefix).
+	Subdir string `json:"subdir,omitempty"`
+	// Include and Exclude are the glob patterns selecting the deployed files (see walk.Filter for the syntax and
+	// precedence).
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// MinFiles is the minimum number of the deployed files (1 if not set). Deployment of fewer files is aborted, so
+	// the empty output of a misconfigured build doesn't wipe the live site.
+	MinFiles int `json:"minFiles,omitempty"`
+	// AllowEmpty disables the MinFiles check.
+	AllowEmpty bool `json:"allowEmpty,omitempty"`
+	// ExtensionlessContentType is the content type of the files without extension. If empty, the content is sniffed:
+	// the files which look like HTML are text/html, others application/octet-stream.
+	ExtensionlessContentType string `json:"extensionlessContentType,omitempty"`
+	// SkipUnchanged skips the deployment if neither the deployed files nor the settings changed since the last
+	// deployment, compared by the hash recorded in the manifest (so the ManifestPath is required).
+	SkipUnchanged bool `json:"skipUnchanged,omitempty"`
+	// CollectErrors makes the deployment attempt all the files, even if some of them fail, and return the errors of
+	// all the failed files. The deployment stops at the first failed file by default.
+	CollectErrors bool `json:"collectErrors,omitempty"`
+	// ContentTypes override the content types of the files by the extension (i.e. ".webmanifest"), which may be
+	// compound (i.e. ".amp.html"). The longest matching extension is used.
+	ContentTypes map[string]string `json:"contentTypes,omitempty"`
+	// Minify lists the content types minified in memory when uploaded: "html", "css" and "js". The files in the public
+	// directory are kept as built.
+	Minify []string `json:"minify,omitempty"`
 }
 
 type AWSDeploymentSettigs struct {
@@ -24,6 +79,87 @@ type AWSDeploymentSettigs struct {
 	SecretKey              string `json:"secretKey"`
 	S3Prefix               string `json:"s3Prefix"`
 	CloudfrontDistribution string `json:"cloudfrontDistribution,omitempty"`
+	// WaitForInvalidation makes the deployment wait until the CloudFront invalidation is completed.
+	WaitForInvalidation bool `json:"waitForInvalidation,omitempty"`
+	// Attachments are served with Content-Disposition: attachment (downloaded instead of displayed inline).
+	Attachments AttachmentSettings `json:"attachments,omitempty"`
+	// HTTP configures the client used for the AWS requests, i.e. to deploy from behind a proxy.
+	HTTP AWSHTTPSettings `json:"http,omitempty"`
+	// Brotli uploads the Brotli compressed variant of the text files (with the .br suffix and Content-Encoding: br)
+	// next to the uncompressed objects, if it makes them smaller.
+	Brotli bool `json:"brotli,omitempty"`
+	// Verify checks the uploaded objects against the local files after the deployment.
+	Verify AWSVerifySettings `json:"verify,omitempty"`
+	// Expiration marks the uploaded objects to expire, i.e. for the draft previews.
+	Expiration AWSExpirationSettings `json:"expiration,omitempty"`
+	// S3PrefixVersion is the version (i.e. commit) available in the S3Prefix template as .Version.
+	S3PrefixVersion string `json:"s3PrefixVersion,omitempty"`
+	// Accelerate uploads through the S3 Transfer Acceleration endpoint. It must be enabled for the bucket.
+	Accelerate bool `json:"accelerate,omitempty"`
+	// DeleteWorkers is the number of concurrent requests deleting the orphaned objects after the upload. Default: 4
+	DeleteWorkers int `json:"deleteWorkers,omitempty"`
+	// ExtraFiles are uploaded along with the built files (path relative to the deployed directory => content), i.e.
+	// robots.txt. They replace the built files of the same path.
+	ExtraFiles map[string]string `json:"extraFiles,omitempty"`
+	// Release enables the blue/green deployments: each one is uploaded under a fresh (templated) prefix, which
+	// replaces the live one only after the upload is completed.
+	Release AWSReleaseSettings `json:"release,omitempty"`
+	// Routes upload the matching files to other buckets or prefixes, i.e. the media to a separate bucket. The first
+	// matching route is used; files matching none are uploaded to the BucketName under the S3Prefix.
+	Routes []AWSRouteSettings `json:"routes,omitempty"`
+	// ACL is the canned ACL set on the uploaded objects, i.e. "public-read". None by default.
+	ACL string `json:"acl,omitempty"`
+	// ACLDisabled marks the bucket as having the ACLs disabled (bucket owner enforced object ownership), so no ACL
+	// is sent with the uploads.
+	ACLDisabled bool `json:"aclDisabled,omitempty"`
+	// Lock prevents the concurrent deployments to the same destination with a lock object in the bucket.
+	Lock AWSLockSettings `json:"lock,omitempty"`
+}
+
+type AWSLockSettings struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Key of the lock object. Default: <s3Prefix>.lock, the release pointer key with .lock for the blue/green
+	// deployments, or midas.lock without the prefix
+	Key string `json:"key,omitempty"`
+	TTL int    `json:"ttl,omitempty"` // Seconds after which the lock of a crashed deployment expires. Default: 3600
+	// Force takes over the lock held by another deployment, i.e. to recover from a stuck one before it expires.
+	Force bool `json:"force,omitempty"`
+}
+
+// AWSRouteSettings match the files by the patterns and content types. Both must match, if set.
+type AWSRouteSettings struct {
+	Patterns     []string `json:"patterns,omitempty"`     // Like the deployment Include patterns, i.e. "images/**"
+	ContentTypes []string `json:"contentTypes,omitempty"` // i.e. "text/css", "image/*"
+	BucketName   string   `json:"bucketName,omitempty"`   // Default: the deployment bucket
+	S3Prefix     string   `json:"s3Prefix,omitempty"`     // Template, like the deployment S3Prefix
+}
+
+type AWSExpirationSettings struct {
+	Tag    string `json:"tag,omitempty"`    // Object tag (key=value) matched by the bucket lifecycle rule
+	Days   int    `json:"days,omitempty"`   // Sets the Expires header to given number of days after the upload
+	Prefix string `json:"prefix,omitempty"` // Applies only to the files under the path (relative to the deployed directory)
+}
+
+type AWSVerifySettings struct {
+	Enabled    bool    `json:"enabled,omitempty"`
+	SampleRate float64 `json:"sampleRate,omitempty"` // Fraction (0-1] of the uploaded objects checked. All if 0
+}
+
+type AWSReleaseSettings struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// PointerKey is the key of the JSON object pointing to the live prefix. Default: release.json
+	PointerKey string `json:"pointerKey,omitempty"`
+}
+
+type AWSHTTPSettings struct {
+	ProxyUrl string `json:"proxyUrl,omitempty"`
+	Timeout  int    `json:"timeout,omitempty"`  // Per-request timeout in seconds. No timeout if 0
+	CABundle string `json:"caBundle,omitempty"` // Path to the PEM file with additional trusted certificates
+}
+
+type AttachmentSettings struct {
+	Extensions []string `json:"extensions,omitempty"` // i.e. ".pdf", ".zip"
+	Dirs       []string `json:"dirs,omitempty"`       // Relative to the public directory, i.e. "downloads"
 }
 
 type SFTPDeploymentSettings struct {
@@ -36,3 +172,255 @@ type SFTPDeploymentSettings struct {
 	KeyPassphrase string `json:"keyPassphrase,omitempty"`
 	Path          string `json:"path"`
 }
+
+type AzureBlobDeploymentSettings struct {
+	AccountName      string `json:"accountName,omitempty"`
+	AccountKey       string `json:"accountKey,omitempty"`
+	ConnectionString string `json:"connectionString,omitempty"`
+	Container        string `json:"container"`
+	Prefix           string `json:"prefix,omitempty"`
+}
+
+type ArchiveDeploymentSettings struct {
+	Path   string `json:"path"`             // Archive file, absolute or relative to the site root directory
+	Format string `json:"format,omitempty"` // Can be: tar.gz (default), zip
+}
+
+// DeployPath returns the directory to deploy: the site public directory, or its subdirectory if configured.
+// The subdirectory must exist within the public directory.
+func (s DeploymentSettings) DeployPath(site Site, isDraft bool) (string, error) {
+	publicPath := site.PublicPath(isDraft)
+	if s.Subdir == "" {
+		return publicPath, nil
+	}
+
+	if filepath.IsAbs(s.Subdir) {
+		return "", Errorf(ErrSiteConfig, "deployment subdir %s must be relative to the public directory", s.Subdir)
+	}
+
+	deployPath := filepath.Join(publicPath, s.Subdir)
+	if rel, err := filepath.Rel(publicPath, deployPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", Errorf(ErrSiteConfig, "deployment subdir %s is outside of the public directory", s.Subdir)
+	}
+
+	if info, err := os.Stat(deployPath); err != nil || !info.IsDir() {
+		return "", Errorf(ErrSiteConfig, "deployment subdir %s does not exist in the public directory", s.Subdir)
+	}
+
+	return deployPath, nil
+}
+
+// FileFilter returns the filter of the deployed files, built from the include and exclude patterns.
+func (s DeploymentSettings) FileFilter() (walk.Filter, error) {
+	filter, err := walk.NewFilter(s.Include, s.Exclude)
+	if err != nil {
+		return walk.Filter{}, Errorf(ErrSiteConfig, "deployment %s", err)
+	}
+
+	return filter, nil
+}
+
+// CheckOutput returns ErrSiteConfig if the directory to deploy holds fewer files (matching the filter) than
+// the MinFiles, unless AllowEmpty is set.
+func (s DeploymentSettings) CheckOutput(site Site, isDraft bool) error {
+	if s.AllowEmpty {
+		return nil
+	}
+
+	deployPath, err := s.DeployPath(site, isDraft)
+	if err != nil {
+		return err
+	}
+
+	return s.CheckOutputPath(deployPath)
+}
+
+// CheckOutputPath works as CheckOutput for the resolved deploy path. The deployments run it before they touch
+// the destination, so the empty build doesn't wipe the live site.
+func (s DeploymentSettings) CheckOutputPath(deployPath string) error {
+	if s.AllowEmpty {
+		return nil
+	}
+
+	filter, err := s.FileFilter()
+	if err != nil {
+		return err
+	}
+
+	minFiles := s.MinFiles
+	if minFiles < 1 {
+		minFiles = 1
+	}
+
+	files := 0
+	// Missing directory holds no files
+	_ = filepath.Walk(deployPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		if rel, err := filepath.Rel(deployPath, path); err == nil && filter.Match(filepath.ToSlash(rel)) {
+			files++
+		}
+
+		return nil
+	})
+
+	if files < minFiles {
+		return Errorf(ErrSiteConfig, "build output %s holds %d files, fewer than %d required to deploy", deployPath, files, minFiles)
+	}
+
+	return nil
+}
+
+// FileErrors collects the errors of the deployed files, as configured with the CollectErrors.
+type FileErrors struct {
+	collect bool
+	errs    []error
+}
+
+// NewFileErrors creates the collector of the deployed files errors.
+func (s DeploymentSettings) NewFileErrors() *FileErrors {
+	return &FileErrors{collect: s.CollectErrors}
+}
+
+// Add records the error of the file (nil if it succeeded). Returns the error the deployment has to stop with: the
+// file error, unless the errors are collected.
+func (e *FileErrors) Add(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if !e.collect {
+		return err
+	}
+
+	e.errs = append(e.errs, fmt.Errorf("%s: %w", path, err))
+	return nil
+}
+
+// Err returns the error joining the errors of all the failed files, or nil if none failed.
+func (e *FileErrors) Err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("deployment of %d files failed:\n%w", len(e.errs), JoinErrors(e.errs...))
+}
+
+// ContentType returns the content type of the file like FileContentType. The content type of the file without
+// extension is the ExtensionlessContentType, or sniffed from the content if not set. The file is rewound after
+// sniffing.
+func (s DeploymentSettings) ContentType(file io.ReadSeeker, fileName string) (string, error) {
+	if contentType, ok := s.configuredContentType(fileName); ok {
+		return contentType, nil
+	}
+	if filepath.Ext(fileName) != "" {
+		return FileContentType(fileName), nil
+	}
+	if s.ExtensionlessContentType != "" {
+		return s.ExtensionlessContentType, nil
+	}
+
+	// DetectContentType considers at most 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(http.DetectContentType(head[:n]), "text/html") {
+		return "text/html", nil
+	}
+
+	return "application/octet-stream", nil
+}
+
+// configuredContentType returns the content type configured for the longest matching (case-insensitive) extension of
+// the file, if any.
+func (s DeploymentSettings) configuredContentType(fileName string) (string, bool) {
+	name := strings.ToLower(filepath.Base(fileName))
+
+	contentType, longest := "", 0
+	for extension, configured := range s.ContentTypes {
+		extension = "." + strings.TrimPrefix(strings.ToLower(extension), ".")
+		// The extension can't be the whole name, i.e. .htaccess has no extension
+		if len(extension) > longest && len(name) > len(extension) && strings.HasSuffix(name, extension) {
+			contentType, longest = configured, len(extension)
+		}
+	}
+
+	return contentType, longest > 0
+}
+
+// ContentCacheControl returns the Cache-Control value for the file like FileCacheControl, caching the text/html
+// content (i.e. the extensionless HTML files) as the HTML files.
+func ContentCacheControl(fileName, contentType string) string {
+	if contentType == "text/html" {
+		return FileCacheControl(".html")
+	}
+
+	return FileCacheControl(fileName)
+}
+
+// FileCacheControl returns the Cache-Control value for the file based on it's type.
+func FileCacheControl(fileName string) string {
+	halfYear := int64(60 * 60 * 24 * 182)
+
+	switch {
+	case strings.HasSuffix(fileName, ".html"):
+		return "no-cache, no-store"
+	case strings.HasSuffix(fileName, ".js"), strings.HasSuffix(fileName, ".css"),
+		strings.HasSuffix(fileName, ".svg"), strings.HasSuffix(fileName, ".png"),
+		strings.HasSuffix(fileName, ".jpg"), strings.HasSuffix(fileName, ".jpeg"),
+		strings.HasSuffix(fileName, ".gif"):
+		return fmt.Sprintf("public, max-age=%d", halfYear)
+	default:
+		return fmt.Sprintf("public, max-age=%d", halfYear)
+	}
+}
+
+// FileContentType returns the content type of the file based on the extension.
+func FileContentType(fileName string) string {
+	typeByExtension := map[string]string{
+		".html": "text/html",
+		".css":  "text/css",
+		".xml":  "text/xml",
+		".txt":  "text/plain",
+
+		".js":          "application/javascript",
+		".pdf":         "application/pdf",
+		".json":        "application/json",
+		".webmanifest": "application/manifest+json",
+		".rss":         "application/rss+xml",
+
+		".png":  "image/png",
+		".jpg":  "image/jpeg",
+		".jpeg": "image/jpeg",
+		".gif":  "image/gif",
+		".svg":  "image/svg+xml",
+		".webp": "image/webp",
+
+		".webm": "video/webm",
+		".mp4":  "video/mp4",
+		".ogv":  "video/ogg",
+		".avi":  "video/x-msvideo",
+
+		".ogg":  "audio/ogg",
+		".mp3":  "audio/mpeg",
+		".mpeg": "audio/mpeg",
+	}
+
+	extension := filepath.Ext(fileName)
+
+	if contentType, ok := typeByExtension[extension]; ok {
+		return contentType
+	} else {
+		return "application/octet-stream"
+	}
+}
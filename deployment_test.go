@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeploymentSettings_DeployPath(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, "public", "blog", "posts"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootDir, "public", "index.html"), []byte("index"), 0664); err != nil {
+		t.Fatal(err)
+	}
+	site := midas.Site{RootDir: rootDir}
+
+	tests := []struct {
+		name     string
+		subdir   string
+		expected string
+		wantErr  string
+	}{
+		{"Whole public", "", filepath.Join(rootDir, "public"), ""},
+		{"Subdir", "blog", filepath.Join(rootDir, "public", "blog"), ""},
+		{"Nested subdir", "blog/posts/", filepath.Join(rootDir, "public", "blog", "posts"), ""},
+		{"Cleaned subdir", "blog/../blog", filepath.Join(rootDir, "public", "blog"), ""},
+		{"Missing", "shop", "", midas.ErrSiteConfig},
+		{"File", "index.html", "", midas.ErrSiteConfig},
+		{"Outside", "../archetypes", "", midas.ErrSiteConfig},
+		{"Absolute", filepath.Join(rootDir, "public", "blog"), "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployPath, err := midas.DeploymentSettings{Subdir: tt.subdir}.DeployPath(site, false)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":  {midas.ErrorCode(err), tt.wantErr},
+				"Deploy path": {deployPath, tt.expected},
+			})
+		})
+	}
+}
+
+func TestDeploymentSettings_CheckOutput(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, "public", "blog"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "app.js.map", filepath.Join("blog", "post.html")} {
+		if err := os.WriteFile(filepath.Join(rootDir, "public", name), []byte("content"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	site := midas.Site{RootDir: rootDir}
+
+	tests := []struct {
+		name     string
+		settings midas.DeploymentSettings
+		site     midas.Site
+		wantErr  string
+	}{
+		{"Default minimum", midas.DeploymentSettings{}, site, ""},
+		{"Minimum met", midas.DeploymentSettings{MinFiles: 3}, site, ""},
+		{"Below minimum", midas.DeploymentSettings{MinFiles: 4}, site, midas.ErrSiteConfig},
+		{"Filtered files not counted", midas.DeploymentSettings{MinFiles: 3, Exclude: []string{"*.map"}}, site, midas.ErrSiteConfig},
+		{"Subdir", midas.DeploymentSettings{MinFiles: 2, Subdir: "blog"}, site, midas.ErrSiteConfig},
+		{"Empty output", midas.DeploymentSettings{}, midas.Site{RootDir: t.TempDir()}, midas.ErrSiteConfig},
+		{"Empty output allowed", midas.DeploymentSettings{AllowEmpty: true}, midas.Site{RootDir: t.TempDir()}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.CheckOutput(tt.site, false)
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantErr, "Error code")
+		})
+	}
+}
+
+func TestDeploymentSettings_FileFilter(t *testing.T) {
+	filter, err := midas.DeploymentSettings{Include: []string{"blog/**"}, Exclude: []string{"*.map"}}.FileFilter()
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":    {err, nil},
+		"Included": {filter.Match("blog/index.html"), true},
+		"Excluded": {filter.Match("blog/app.js.map"), false},
+	})
+
+	_, err = midas.DeploymentSettings{Exclude: []string{"[a-"}}.FileFilter()
+
+	testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Invalid pattern")
+}
+
+func TestDeploymentSettings_ContentType(t *testing.T) {
+	page := "<!DOCTYPE html>\n<html><body><p>About</p></body></html>"
+
+	tests := []struct {
+		name          string
+		extensionless string
+		fileName      string
+		content       string
+		expected      string
+	}{
+		{"Extension", "", "about.html", "plain text", "text/html"},
+		{"Unknown extension", "", "about.bin", page, "application/octet-stream"},
+		{"Extensionless HTML", "", "public/about", page, "text/html"},
+		{"Extensionless HTML fragment", "", "public/about", "  <p>About</p>", "text/html"},
+		{"Extensionless text", "", "public/LICENSE", "Released under GNU GPLv3", "application/octet-stream"},
+		{"Extensionless binary", "", "public/data", "\x00\x01\x02", "application/octet-stream"},
+		{"Extensionless empty", "", "public/empty", "", "application/octet-stream"},
+		{"Configured", "text/plain", "public/about", page, "text/plain"},
+		{"Configured with extension", "text/plain", "about.css", page, "text/css"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := strings.NewReader(tt.content)
+			contentType, err := midas.DeploymentSettings{ExtensionlessContentType: tt.extensionless}.ContentType(file, tt.fileName)
+			content, _ := io.ReadAll(file)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":        {err, nil},
+				"Content type": {contentType, tt.expected},
+				"Rewound":      {string(content), tt.content},
+			})
+		})
+	}
+}
+
+func TestDeploymentSettings_ContentType_HugoOutputs(t *testing.T) {
+	settings := midas.DeploymentSettings{ContentTypes: map[string]string{
+		".amp.html":  "text/html; charset=utf-8",
+		"HTML":       "text/html; charset=iso-8859-2",
+		".calendar":  "text/calendar",
+		".ics":       "text/calendar",
+		".feed.json": "application/feed+json",
+	}}
+
+	tests := []struct {
+		fileName string
+		expected string
+	}{
+		{"public/index.json", "application/json"},
+		{"public/manifest.webmanifest", "application/manifest+json"},
+		{"public/robots.txt", "text/plain"},
+		{"public/posts/index.rss", "application/rss+xml"},
+		{"public/index.xml", "text/xml"},
+		{"public/posts/first/index.amp.html", "text/html; charset=utf-8"},
+		{"public/posts/first/INDEX.AMP.HTML", "text/html; charset=utf-8"},
+		{"public/posts/first/index.html", "text/html; charset=iso-8859-2"},
+		{"public/events.ics", "text/calendar"},
+		{"public/feed.json", "application/json"},
+		{"public/index.feed.json", "application/feed+json"},
+		{"public/.calendar", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			contentType, err := settings.ContentType(strings.NewReader(""), tt.fileName)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":        {err, nil},
+				"Content type": {contentType, tt.expected},
+			})
+		})
+	}
+}
+
+func TestContentCacheControl(t *testing.T) {
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Extensionless HTML":  {midas.ContentCacheControl("about", "text/html"), "no-cache, no-store"},
+		"Extensionless other": {midas.ContentCacheControl("data", "application/octet-stream"), midas.FileCacheControl("data")},
+		"HTML":                {midas.ContentCacheControl("index.html", "text/html"), "no-cache, no-store"},
+		"Image":               {midas.ContentCacheControl("logo.png", "image/png"), midas.FileCacheControl("logo.png")},
+	})
+}
+
+func TestFileErrors(t *testing.T) {
+	failure := os.ErrPermission
+
+	t.Run("Fail fast", func(t *testing.T) {
+		fileErrors := midas.DeploymentSettings{}.NewFileErrors()
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Succeeded": {fileErrors.Add("index.html", nil), nil},
+			"Failed":    {fileErrors.Add("about.html", failure), failure},
+			"Err":       {fileErrors.Err(), nil},
+		})
+	})
+
+	t.Run("Collected", func(t *testing.T) {
+		fileErrors := midas.DeploymentSettings{CollectErrors: true}.NewFileErrors()
+
+		added := []error{
+			fileErrors.Add("index.html", nil),
+			fileErrors.Add("about.html", failure),
+			fileErrors.Add("posts/first.html", midas.Errorf(midas.ErrInvalid, "too large")),
+		}
+
+		err := fileErrors.Err()
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Added":      {fmt.Sprint(added), fmt.Sprint([]error{nil, nil, nil})},
+			"Message":    {strings.Contains(err.Error(), "deployment of 2 files failed"), true},
+			"First file": {strings.Contains(err.Error(), "about.html: "+failure.Error()), true},
+			"Other file": {strings.Contains(err.Error(), "posts/first.html: "), true},
+			"Is":         {errors.Is(err, failure), true},
+			"Error code": {midas.ErrorCode(err), midas.ErrInvalid},
+		})
+	})
+}
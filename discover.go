@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultArchetypesDir = "archetypes"
+	defaultContentDir    = "content"
+)
+
+// DiscoverSettings configures generating the models from the conventional site layout,
+// where archetype archetypes/<model>.md writes the entries to content/<model>/.
+type DiscoverSettings struct {
+	Enabled       bool   `json:"enabled,omitempty"`
+	ArchetypesDir string `json:"archetypesDir,omitempty"` // Relative to the site root. Default: archetypes
+	ContentDir    string `json:"contentDir,omitempty"`    // Relative to the site root. Default: content
+}
+
+// DiscoverModels returns a copy of the site with collection types generated for each archetype file found in the
+// archetypes directory (except default.md). Models configured explicitly (as collection or single type) are never
+// overridden, so the generated ones can be customized by configuring them.
+func DiscoverModels(site Site) (Site, error) {
+	archetypesDir := site.Discover.ArchetypesDir
+	if archetypesDir == "" {
+		archetypesDir = defaultArchetypesDir
+	}
+	contentDir := site.Discover.ContentDir
+	if contentDir == "" {
+		contentDir = defaultContentDir
+	}
+
+	absArchetypesDir := archetypesDir
+	if !filepath.IsAbs(absArchetypesDir) {
+		absArchetypesDir = filepath.Join(site.RootDir, absArchetypesDir)
+	}
+
+	files, err := os.ReadDir(absArchetypesDir)
+	if err != nil {
+		return site, Errorf(ErrSiteConfig, "archetypes directory %s can not be read: %s", archetypesDir, err)
+	}
+
+	collectionTypes := make(map[string]ModelSettings, len(site.CollectionTypes))
+	for name, model := range site.CollectionTypes {
+		collectionTypes[name] = model
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".md" {
+			continue
+		}
+
+		name := strings.TrimSuffix(file.Name(), ".md")
+		if name == "default" {
+			continue
+		}
+
+		if _, ok := collectionTypes[name]; ok {
+			continue
+		}
+		if _, ok := site.SingleTypes[name]; ok {
+			continue
+		}
+
+		collectionTypes[name] = ModelSettings{
+			ArchetypePath: filepath.Join(archetypesDir, file.Name()),
+			OutputDir:     filepath.Join(contentDir, name),
+		}
+	}
+
+	site.CollectionTypes = collectionTypes
+
+	return site, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscoverModels(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, path := range []string{
+		"archetypes/default.md",
+		"archetypes/post.md",
+		"archetypes/event.md",
+		"archetypes/homepage.md",
+		"archetypes/notes.txt",
+		"archetypes/bundle/index.md",
+		"layouts/post.md",
+	} {
+		path = filepath.Join(rootDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("---\n---\n"), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	site := midas.Site{
+		RootDir:  rootDir,
+		Discover: midas.DiscoverSettings{Enabled: true},
+		CollectionTypes: map[string]midas.ModelSettings{
+			"event": {ArchetypePath: "archetypes/event.md", OutputDir: "content/calendar"},
+		},
+		SingleTypes: map[string]midas.ModelSettings{
+			"homepage": {OutputDir: "data/cms"},
+		},
+	}
+
+	discovered, err := midas.DiscoverModels(site)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":            {err, nil},
+		"Collection types": {len(discovered.CollectionTypes), 2},
+		"Single types":     {len(discovered.SingleTypes), 1},
+		"Post archetype":   {discovered.CollectionTypes["post"].ArchetypePath, filepath.Join("archetypes", "post.md")},
+		"Post output":      {discovered.CollectionTypes["post"].OutputDir, filepath.Join("content", "post")},
+		"Explicit output":  {discovered.CollectionTypes["event"].OutputDir, "content/calendar"},
+		"Original config":  {len(site.CollectionTypes), 1},
+	})
+
+	t.Run("custom directories", func(t *testing.T) {
+		site := midas.Site{
+			RootDir:  rootDir,
+			Discover: midas.DiscoverSettings{Enabled: true, ArchetypesDir: "layouts", ContentDir: "pages"},
+		}
+
+		discovered, err := midas.DiscoverModels(site)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Post archetype": {discovered.CollectionTypes["post"].ArchetypePath, filepath.Join("layouts", "post.md")},
+			"Post output":    {discovered.CollectionTypes["post"].OutputDir, filepath.Join("pages", "post")},
+		})
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		site := midas.Site{
+			RootDir:  rootDir,
+			Discover: midas.DiscoverSettings{Enabled: true, ArchetypesDir: "missing"},
+		}
+
+		_, err := midas.DiscoverModels(site)
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
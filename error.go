@@ -9,6 +9,7 @@ package midas
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -17,11 +18,36 @@ const (
 	ErrInvalid         = "invalid"
 	ErrUnaccepted      = "unaccepted"
 	ErrRegistry        = "registry"
+	ErrNotFound        = "not found"
 	ErrSiteConfig      = "site config"
 	ErrProcessNotFound = "process not found"
 	ErrCancelled       = "process cancelled"
+	// ErrUnchanged signals that the operation was skipped, as it wouldn't change anything. It's not a failure.
+	ErrUnchanged = "unchanged"
+	// ErrBuildWarnings signals that the build succeeded, but its output contains warnings, while the site fails on
+	// them. Building the same content again wouldn't help.
+	ErrBuildWarnings = "build warnings"
+	// ErrLocked signals that the resource is locked by another process, i.e. the destination by another deployment.
+	ErrLocked = "locked"
 )
 
+// exitCodes are the process exit codes of the error codes, following sysexits.h where applicable. The codes are
+// stable, so the scripts can rely on them.
+var exitCodes = map[string]int{
+	ErrInternal:        1,
+	ErrInvalid:         65, // EX_DATAERR
+	ErrUnaccepted:      65, // EX_DATAERR
+	ErrNotFound:        66, // EX_NOINPUT
+	ErrProcessNotFound: 66, // EX_NOINPUT
+	ErrRegistry:        74, // EX_IOERR
+	ErrUnauthorized:    77, // EX_NOPERM
+	ErrSiteConfig:      78, // EX_CONFIG
+	ErrBuildWarnings:   65, // EX_DATAERR
+	ErrLocked:          75, // EX_TEMPFAIL
+	ErrCancelled:       130,
+	ErrUnchanged:       0,
+}
+
 // Error represents an application-specific error. App errors can be
 // unwrapped to extract out the code & message.
 //
@@ -74,3 +100,69 @@ func Errorf(code string, format string, args ...interface{}) *Error {
 		Message: fmt.Sprintf(format, args...),
 	}
 }
+
+// ExitCode returns the process exit code for the error, i.e. for the command line tools: 0 for nil error, and
+// the code of the error kind otherwise. Non-application errors and unknown kinds return the ErrInternal exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if code, ok := exitCodes[ErrorCode(err)]; ok {
+		return code
+	}
+
+	return exitCodes[ErrInternal]
+}
+
+// JoinErrors returns the error wrapping all the non-nil errors, or nil if there are none. Its message holds the
+// messages of the errors on separate lines. errors.Is and errors.As match any of the wrapped errors.
+func JoinErrors(errs ...error) error {
+	joined := joinError{}
+	for _, err := range errs {
+		if err != nil {
+			joined.errs = append(joined.errs, err)
+		}
+	}
+
+	if len(joined.errs) == 0 {
+		return nil
+	}
+
+	return joined
+}
+
+type joinError struct {
+	errs []error
+}
+
+func (e joinError) Error() string {
+	messages := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Is returns true if any of the joined errors matches the target.
+func (e joinError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first of the joined errors matching the target.
+func (e joinError) As(target interface{}) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Success", nil, 0},
+		{"Internal", midas.Errorf(midas.ErrInternal, "failed"), 1},
+		{"Invalid", midas.Errorf(midas.ErrInvalid, "invalid entry"), 65},
+		{"Unaccepted", midas.Errorf(midas.ErrUnaccepted, "model not accepted"), 65},
+		{"Not found", midas.Errorf(midas.ErrNotFound, "entry not found"), 66},
+		{"Process not found", midas.Errorf(midas.ErrProcessNotFound, "no process"), 66},
+		{"Registry", midas.Errorf(midas.ErrRegistry, "registry malformed"), 74},
+		{"Build warnings", midas.Errorf(midas.ErrBuildWarnings, "hugo build produced warnings"), 65},
+		{"Locked", midas.Errorf(midas.ErrLocked, "deployment in progress"), 75},
+		{"Unauthorized", midas.Errorf(midas.ErrUnauthorized, "no api key"), 77},
+		{"Site config", midas.Errorf(midas.ErrSiteConfig, "bad config"), 78},
+		{"Cancelled", midas.Errorf(midas.ErrCancelled, "cancelled"), 130},
+		{"Unchanged", midas.Errorf(midas.ErrUnchanged, "unchanged"), 0},
+		{"Wrapped", fmt.Errorf("deploy: %w", midas.Errorf(midas.ErrSiteConfig, "bad config")), 78},
+		{"Unknown kind", midas.Errorf("custom", "custom"), 1},
+		{"Non-application", os.ErrPermission, 1},
+		{"Plain", errors.New("disk full"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, midas.ExitCode(tt.err), tt.want, "Exit code")
+		})
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	notFound := midas.Errorf(midas.ErrNotFound, "entry doesn't exist")
+	joined := midas.JoinErrors(nil, os.ErrPermission, nil, fmt.Errorf("post: %w", notFound))
+
+	var appErr *midas.Error
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Nil":          {midas.JoinErrors(nil, nil), nil},
+		"Message":      {joined.Error(), os.ErrPermission.Error() + "\npost: " + notFound.Error()},
+		"Is first":     {errors.Is(joined, os.ErrPermission), true},
+		"Is other":     {errors.Is(joined, os.ErrNotExist), false},
+		"As":           {errors.As(joined, &appErr), true},
+		"Error code":   {midas.ErrorCode(joined), midas.ErrNotFound},
+		"Wrapped code": {midas.ErrorCode(fmt.Errorf("deployment failed: %w", joined)), midas.ErrNotFound},
+	})
+}
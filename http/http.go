@@ -18,6 +18,12 @@ func Error(w http.ResponseWriter, r *http.Request, err error) {
 	// Extract error code and message
 	code, message := midas.ErrorCode(err), midas.ErrorMessage(err)
 
+	siteName := ""
+	if site := midas.SiteConfigFromContext(r.Context()); site != nil {
+		siteName = site.SiteName
+	}
+	midas.Metrics.ErrorOccurred(siteName, code)
+
 	// Log internal errors
 	if code == midas.ErrInternal {
 		midas.ReportError(r.Context(), err, r)
@@ -45,6 +51,8 @@ var codes = map[string]int{
 	midas.ErrUnaccepted:   http.StatusBadRequest,
 	midas.ErrInternal:     http.StatusInternalServerError,
 	midas.ErrRegistry:     http.StatusInternalServerError,
+	midas.ErrNotFound:     http.StatusNotFound,
+	midas.ErrLocked:       http.StatusConflict,
 	midas.ErrSiteConfig:   http.StatusInternalServerError,
 }
 
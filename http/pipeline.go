@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package http
+
+import (
+	"context"
+	"github.com/kovansky/midas"
+	"github.com/rs/zerolog"
+)
+
+// runPipeline runs the steps (i.e. the build and the deploys) in order, retrying the step which failed with
+// a retryable error. The completed steps aren't repeated, so a failed draft deploy doesn't deploy the site again.
+func runPipeline(ctx context.Context, settings midas.RetrySettings, log zerolog.Logger, steps ...func() error) error {
+	for i, step := range steps {
+		err := midas.Retry(ctx, settings, func(attempt int) error {
+			if attempt > 1 {
+				log.Warn().Msgf("Retrying step %d of %d (attempt %d of %d)", i+1, len(steps), attempt, settings.Attempts)
+			}
+
+			return step()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
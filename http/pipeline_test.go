@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/mock"
+	"github.com/kovansky/midas/testing_utils"
+	"github.com/rs/zerolog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDeployment fails the deploys with the queued errors, succeeding once they run out.
+type fakeDeployment struct {
+	errs  *[]error
+	calls *int
+}
+
+func (d fakeDeployment) Deploy() error {
+	return d.DeployContext(context.Background())
+}
+
+func (d fakeDeployment) DeployContext(_ context.Context) error {
+	*d.calls++
+	if len(*d.errs) == 0 {
+		return nil
+	}
+
+	err := (*d.errs)[0]
+	*d.errs = (*d.errs)[1:]
+
+	return err
+}
+
+func TestServer_Pipeline_Retry(t *testing.T) {
+	timeout := errors.New("connection reset by peer")
+	retry := midas.RetrySettings{Attempts: 3, Backoff: 0.001}
+
+	tests := []struct {
+		name        string
+		retry       midas.RetrySettings
+		buildErrs   []error
+		deployErrs  []error
+		wantStatus  int
+		wantBuilds  int
+		wantDeploys int
+		emptyOutput bool
+	}{
+		{"Success", retry, nil, nil, http.StatusNoContent, 1, 1, false},
+		{"Build recovered", retry, []error{timeout, midas.Errorf(midas.ErrInternal, "hugo crashed")}, nil, http.StatusNoContent, 3, 1, false},
+		{"Build not retryable", retry, []error{midas.Errorf(midas.ErrSiteConfig, "bad config")}, nil, http.StatusInternalServerError, 1, 0, false},
+		{"Build warnings not retried", retry, []error{midas.Errorf(midas.ErrBuildWarnings, "hugo build produced 1 warning(s)")}, nil, http.StatusInternalServerError, 1, 0, false},
+		{"Build attempts run out", retry, []error{timeout, timeout, timeout}, nil, http.StatusInternalServerError, 3, 0, false},
+		{"Deploy recovered without rebuild", retry, nil, []error{timeout}, http.StatusNoContent, 1, 2, false},
+		{"Deploy not retryable", retry, nil, []error{midas.Errorf(midas.ErrInvalid, "invalid prefix")}, http.StatusBadRequest, 1, 1, false},
+		{"Retries disabled", midas.RetrySettings{}, []error{timeout}, nil, http.StatusInternalServerError, 1, 0, false},
+		{"Empty output not deployed", retry, nil, nil, http.StatusInternalServerError, 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildErrs, deployErrs := append([]error{}, tt.buildErrs...), append([]error{}, tt.deployErrs...)
+			builds, deploys := 0, 0
+
+			rootDir := t.TempDir()
+			if !tt.emptyOutput {
+				if err := os.MkdirAll(filepath.Join(rootDir, "public"), 0775); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(rootDir, "public", "index.html"), []byte("index"), 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			previous := midas.DeploymentTargets
+			midas.DeploymentTargets = map[string]func(site midas.Site, settings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error){
+				"fake": func(_ midas.Site, _ midas.DeploymentSettings, _ bool) (midas.Deployment, error) {
+					return fakeDeployment{errs: &deployErrs, calls: &deploys}, nil
+				},
+			}
+			defer func() {
+				midas.DeploymentTargets = previous
+			}()
+
+			s := MustOpenServer(t, map[string]func(site midas.Site) (midas.SiteService, error){
+				"hugo": func(site midas.Site) (midas.SiteService, error) {
+					siteService := mock.NewSiteService()
+
+					siteService.CreateEntryFn = func(_ midas.Payload) (string, error) {
+						return "", nil
+					}
+					siteService.BuildModelFn = func(_ string, _ bool, _ zerolog.Logger) error {
+						builds++
+						if len(buildErrs) == 0 {
+							return nil
+						}
+
+						err := buildErrs[0]
+						buildErrs = buildErrs[1:]
+
+						return err
+					}
+					siteService.GetRegistryServiceFn = func() (midas.RegistryService, error) {
+						return prepareMockRegistryService(site), nil
+					}
+
+					return siteService, nil
+				},
+			}, midas.Config{
+				Sites: map[string]midas.Site{
+					"test": {
+						SiteName:        "test",
+						RootDir:         rootDir,
+						Service:         "hugo",
+						Registry:        midas.RegistrySettings{Type: "mock"},
+						CollectionTypes: map[string]midas.ModelSettings{"post": {}},
+						Deployment:      midas.DeploymentSettings{Enabled: true, Target: "fake"},
+						Retry:           tt.retry,
+					},
+				},
+			})
+			defer MustCloseServer(t, s)
+
+			payload := `{"event": "entry.create", "createdAt": "2022-01-01T10:10:10.000Z", "model": "post", "entry": {"id": 1, "Title": "Test"}}`
+			resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.Background(), "test", "POST", "/strapi/hugo", strings.NewReader(payload)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Status code": {resp.StatusCode, tt.wantStatus},
+				"Builds":      {builds, tt.wantBuilds},
+				"Deploys":     {deploys, tt.wantDeploys},
+			})
+		})
+	}
+}
+
+// recordingDeployment records which of the deploy methods was called.
+type recordingDeployment struct {
+	calls *[]string
+}
+
+func (d recordingDeployment) Deploy() error {
+	return d.DeployContext(context.Background())
+}
+
+func (d recordingDeployment) DeployContext(_ context.Context) error {
+	*d.calls = append(*d.calls, "DeployContext")
+	return nil
+}
+
+func (d recordingDeployment) DeployFull(_ context.Context) error {
+	*d.calls = append(*d.calls, "DeployFull")
+	return nil
+}
+
+func TestServer_HandleHugoRebuild_Full(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		wantUseCache bool
+		wantCalls    string
+	}{
+		{"Regular", "", true, "DeployContext,DeployContext"},
+		{"Without cache", "?cache=0", false, "DeployContext,DeployContext"},
+		{"Full", "?full=1", false, "DeployFull,DeployFull"},
+		{"Full with cache requested", "?full=true&cache=1", false, "DeployFull,DeployFull"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			var useCaches []bool
+
+			previous := midas.DeploymentTargets
+			midas.DeploymentTargets = map[string]func(site midas.Site, settings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error){
+				"recording": func(_ midas.Site, _ midas.DeploymentSettings, _ bool) (midas.Deployment, error) {
+					return recordingDeployment{calls: &calls}, nil
+				},
+			}
+			defer func() {
+				midas.DeploymentTargets = previous
+			}()
+
+			rootDir := t.TempDir()
+			for _, dir := range []string{"public", "publicDrafts"} {
+				if err := os.MkdirAll(filepath.Join(rootDir, dir), 0775); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(rootDir, dir, "index.html"), []byte("index"), 0664); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := MustOpenServer(t, map[string]func(site midas.Site) (midas.SiteService, error){
+				"hugo": func(site midas.Site) (midas.SiteService, error) {
+					siteService := mock.NewSiteService()
+					siteService.BuildSiteFn = func(useCache bool, _ zerolog.Logger) error {
+						useCaches = append(useCaches, useCache)
+						return nil
+					}
+
+					return siteService, nil
+				},
+			}, midas.Config{
+				Sites: map[string]midas.Site{
+					"test": {
+						SiteName:         "test",
+						RootDir:          rootDir,
+						Service:          "hugo",
+						Registry:         midas.RegistrySettings{Type: "mock"},
+						Deployment:       midas.DeploymentSettings{Enabled: true, Target: "recording"},
+						DraftsDeployment: midas.DeploymentSettings{Enabled: true, Target: "recording"},
+					},
+				},
+			})
+			defer MustCloseServer(t, s)
+
+			resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.Background(), "test", "POST", "/strapi/hugo/rebuild"+tt.query, strings.NewReader("")))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Status code": {resp.StatusCode, http.StatusOK},
+				"Use cache":   {fmt.Sprint(useCaches), fmt.Sprint([]bool{tt.wantUseCache})},
+				"Deploys":     {strings.Join(calls, ","), tt.wantCalls},
+			})
+		})
+	}
+}
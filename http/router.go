@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kovansky/midas"
+	"io"
+	"net/http"
+)
+
+// SiteHeader is the request header selecting the site the request to the router is dispatched to.
+const SiteHeader = "X-Midas-Site"
+
+// route returns the API key of the site the request to the router is dispatched to: the site selected by the
+// SiteHeader, or the site handling the payload model. The request body is restored after the model is read.
+func (s *Server) route(r *http.Request, router midas.RouterSettings) (string, error) {
+	var (
+		apiKey string
+		ok     bool
+	)
+
+	if site := r.Header.Get(SiteHeader); site != "" {
+		if apiKey, ok = router.Sites[site]; !ok {
+			return "", midas.Errorf(midas.ErrNotFound, "no route for site %s", site)
+		}
+	} else {
+		model, err := requestModel(r)
+		if err != nil {
+			return "", err
+		}
+
+		if apiKey, ok = router.Models[model]; !ok {
+			return "", midas.Errorf(midas.ErrNotFound, "no route for model %s", model)
+		}
+	}
+
+	if _, ok = s.Config.Sites[apiKey]; !ok {
+		return "", midas.Errorf(midas.ErrSiteConfig, "route points to the unknown site")
+	}
+
+	return apiKey, nil
+}
+
+// requestModel reads the model of the request payload, leaving the body readable again.
+func requestModel(r *http.Request) (string, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if err = json.Unmarshal(body, &payload); err != nil || payload.Model == "" {
+		return "", midas.Errorf(midas.ErrInvalid, "request has neither %s header nor payload model to route by", SiteHeader)
+	}
+
+	return payload.Model, nil
+}
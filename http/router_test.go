@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kovansky/midas"
+	midashttp "github.com/kovansky/midas/http"
+	"github.com/kovansky/midas/mock"
+	"github.com/kovansky/midas/testing_utils"
+	"github.com/rs/zerolog"
+	"net/http"
+	"testing"
+)
+
+func TestServer_Router(t *testing.T) {
+	var handledBy string
+
+	s := MustOpenServer(t, map[string]func(site midas.Site) (midas.SiteService, error){
+		"hugo": func(site midas.Site) (midas.SiteService, error) {
+			siteService := mock.NewSiteService()
+
+			siteService.CreateEntryFn = func(_ midas.Payload) (string, error) {
+				handledBy = site.SiteName
+
+				return "", nil
+			}
+			siteService.BuildModelFn = func(_ string, _ bool, _ zerolog.Logger) error {
+				return nil
+			}
+			siteService.GetRegistryServiceFn = func() (midas.RegistryService, error) {
+				return prepareMockRegistryService(site), nil
+			}
+
+			return siteService, nil
+		},
+	}, midas.Config{
+		Sites: map[string]midas.Site{
+			"blogKey": {
+				SiteName:        "blog",
+				Service:         "hugo",
+				Registry:        midas.RegistrySettings{Type: "mock"},
+				CollectionTypes: map[string]midas.ModelSettings{"post": {}, "author": {}},
+			},
+			"shopKey": {
+				SiteName:        "shop",
+				Service:         "hugo",
+				Registry:        midas.RegistrySettings{Type: "mock"},
+				CollectionTypes: map[string]midas.ModelSettings{"product": {}, "author": {}},
+			},
+		},
+		Routers: map[string]midas.RouterSettings{
+			"routerKey": {
+				Sites:  map[string]string{"blog": "blogKey", "shop": "shopKey", "broken": "missingKey"},
+				Models: map[string]string{"post": "blogKey", "product": "shopKey"},
+			},
+		},
+	})
+	defer MustCloseServer(t, s)
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		site       string
+		model      string
+		wantStatus int
+		wantSite   string
+	}{
+		{"Site key", "shopKey", "", "author", http.StatusNoContent, "shop"},
+		{"Model route", "routerKey", "", "post", http.StatusNoContent, "blog"},
+		{"Other model route", "routerKey", "", "product", http.StatusNoContent, "shop"},
+		{"Header route", "routerKey", "blog", "author", http.StatusNoContent, "blog"},
+		{"Header takes precedence", "routerKey", "shop", "author", http.StatusNoContent, "shop"},
+		{"Unknown model", "routerKey", "", "author", http.StatusNotFound, ""},
+		{"Unknown site", "routerKey", "docs", "post", http.StatusNotFound, ""},
+		{"Route to unknown site", "routerKey", "broken", "post", http.StatusInternalServerError, ""},
+		{"Invalid key", "otherKey", "", "post", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handledBy = ""
+
+			payload := fmt.Sprintf(`{"event": "entry.create", "createdAt": "2022-01-01T10:10:10.000Z", "model": "%s", "entry": {"id": 1, "Title": "Test"}}`, tt.model)
+			r := s.MustNewRequest(t, context.Background(), tt.apiKey, "POST", "/strapi/hugo", bytes.NewReader([]byte(payload)))
+			if tt.site != "" {
+				r.Header.Set(midashttp.SiteHeader, tt.site)
+			}
+
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Status code": {resp.StatusCode, tt.wantStatus},
+				"Handled by":  {handledBy, tt.wantSite},
+			})
+		})
+	}
+}
@@ -19,10 +19,11 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
-const shutdownTimeout = 1 * time.Second
+const defaultShutdownTimeout = 30 * time.Second
 
 type Server struct {
 	listener net.Listener
@@ -32,9 +33,18 @@ type Server struct {
 	// testing indicates that the server is running for tests.
 	testing bool
 
+	// operations tracks the in-flight webhook operations (entry writes, builds and deploys), drained on shutdown.
+	operations sync.WaitGroup
+	// ctx is the context of the operations, cancelled if the shutdown doesn't drain them in time.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	Config midas.Config
 
 	SiteServices map[string]func(site midas.Site) (midas.SiteService, error)
+	// sites are the site services of the configured sites (by API key), created on Open and shared by all the
+	// requests, so the service synchronizes the concurrent operations on its site.
+	sites map[string]midas.SiteService
 }
 
 func NewServer(logLevel string, testing bool) *Server {
@@ -43,6 +53,7 @@ func NewServer(logLevel string, testing bool) *Server {
 		router:  chi.NewRouter(),
 		testing: testing,
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	logger := httplog.NewLogger("midas", httplog.Options{Concise: true, LogLevel: logLevel})
 
@@ -62,7 +73,7 @@ func NewServer(logLevel string, testing bool) *Server {
 	})
 
 	s.router.Route("/", func(router chi.Router) {
-		router.Use(s.authenticate)
+		router.Use(s.authenticate, s.trackOperation)
 
 		// Register specific routes
 		s.registerStrapiToHugoRoutes(router)
@@ -123,6 +134,10 @@ func ListenAndServeTLSRedirect(domain string) error {
 func (s *Server) Open() error {
 	var err error
 
+	if err = s.openSites(); err != nil {
+		return err
+	}
+
 	// Open a listener on address
 	if s.Config.Domain != "" {
 		s.listener = autocert.NewListener(s.Config.Domain)
@@ -137,12 +152,118 @@ func (s *Server) Open() error {
 	return nil
 }
 
-// Close gracefully shut downs the server
+// Close gracefully shut downs the server, waiting for the in-flight operations up to the configured shutdown timeout.
 func (s *Server) Close() error {
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	timeout := defaultShutdownTimeout
+	if s.Config.ShutdownTimeout > 0 {
+		timeout = time.Duration(s.Config.ShutdownTimeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	return s.server.Shutdown(ctx)
+	return s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting new requests and waits for the in-flight operations to finish, so a deploy isn't left
+// half-done. If the context is done first, the operations are cancelled (together with the running builds of the
+// sites) and the context error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+
+	drained := make(chan struct{})
+	go func() {
+		s.operations.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		s.cancel()
+		s.closeSites()
+
+		return err
+	case <-ctx.Done():
+		s.cancel()
+		s.stopBuilds()
+
+		return ctx.Err()
+	}
+}
+
+// Operations returns the wait group of the in-flight operations. The work outliving the request handler (i.e. run
+// in a goroutine) must be added to it, so the shutdown waits for it as well.
+func (s *Server) Operations() *sync.WaitGroup {
+	return &s.operations
+}
+
+// Context returns the context of the operations, which is cancelled if the shutdown doesn't drain them in time.
+func (s *Server) Context() context.Context {
+	return s.ctx
+}
+
+// trackOperation adds the request to the in-flight operations, so the shutdown waits for it.
+func (s *Server) trackOperation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.operations.Add(1)
+		defer s.operations.Done()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stopBuilds stops the running builds of the configured sites.
+func (s *Server) stopBuilds() {
+	if midas.Concurrents == nil {
+		return
+	}
+
+	for _, site := range s.Config.Sites {
+		if process, err := midas.Concurrents.Get(site.SiteName); err == nil {
+			(*process).Stop()
+		}
+	}
+}
+
+// openSites creates the site service of each configured site with its service available. The site registry
+// is opened once here, and closed with the server.
+func (s *Server) openSites() error {
+	s.sites = make(map[string]midas.SiteService, len(s.Config.Sites))
+
+	for apiKey, cfg := range s.Config.Sites {
+		newSiteService, ok := s.SiteServices[cfg.Service]
+		if !ok {
+			// Rejected by the handlers as the service mismatch
+			continue
+		}
+
+		site, err := newSiteService(cfg)
+		if err != nil {
+			return fmt.Errorf("site %s could not be opened: %w", cfg.SiteName, err)
+		}
+		s.sites[apiKey] = site
+	}
+
+	return nil
+}
+
+// closeSites closes the registries of the site services. It must be called only after the requests are finished.
+func (s *Server) closeSites() {
+	for _, site := range s.sites {
+		if registry, err := site.GetRegistryService(); err == nil && registry != nil {
+			registry.CloseStorage()
+		}
+	}
+}
+
+// siteService returns the shared site service of the site the request is authenticated for.
+func (s *Server) siteService(r *http.Request, service string) (midas.SiteService, error) {
+	site, ok := s.sites[midas.ApiKeyFromContext(r.Context())]
+	if !ok {
+		return nil, midas.Errorf(midas.ErrInternal, "%s service of the site is not available", service)
+	}
+
+	return site, nil
 }
 
 func (s *Server) authenticate(next http.Handler) http.Handler {
@@ -155,8 +276,19 @@ func (s *Server) authenticate(next http.Handler) http.Handler {
 			cfg, ok := s.Config.Sites[apiKey]
 
 			if !ok {
-				Error(w, r, midas.Errorf(midas.ErrUnauthorized, "Invalid API key."))
-				return
+				router, isRouter := s.Config.Routers[apiKey]
+				if !isRouter {
+					Error(w, r, midas.Errorf(midas.ErrUnauthorized, "Invalid API key."))
+					return
+				}
+
+				// Continue as the routed site
+				var err error
+				if apiKey, err = s.route(r, router); err != nil {
+					Error(w, r, err)
+					return
+				}
+				cfg = s.Config.Sites[apiKey]
 			}
 
 			r = r.WithContext(
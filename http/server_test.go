@@ -11,16 +11,20 @@ import (
 	"github.com/kovansky/midas"
 	midashttp "github.com/kovansky/midas/http"
 	"github.com/kovansky/midas/mock"
+	"github.com/kovansky/midas/testing_utils"
 	"github.com/rs/zerolog"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
 	MockSiteCounters = map[string]int{
 		"GetRegistryService": 0,
 		"BuildSite":          0,
+		"BuildModel":         0,
 		"CreateEntry":        0,
 		"UpdateEntry":        0,
 		"DeleteEntry":        0,
@@ -34,6 +38,7 @@ var (
 		"Flush":         0,
 		"CreateEntry":   0,
 		"ReadEntry":     0,
+		"ReadEntries":   0,
 		"UpdateEntry":   0,
 		"DeleteEntry":   0,
 	}
@@ -116,6 +121,11 @@ func SetUp(t *testing.T) *Server {
 
 				return nil
 			}
+			siteService.BuildModelFn = func(_ string, useCache bool, _ zerolog.Logger) error {
+				MockSiteCounters["BuildModel"]++
+
+				return nil
+			}
 			siteService.CreateEntryFn = func(_ midas.Payload) (string, error) {
 				MockSiteCounters["CreateEntry"]++
 
@@ -201,16 +211,21 @@ func prepareMockRegistryService(site midas.Site) midas.RegistryService {
 		MockRegistryCounters["ReadEntry"]++
 
 		if id == "error" {
-			return "", midas.Errorf(midas.ErrRegistry, "entry doesn't exist")
+			return "", midas.Errorf(midas.ErrNotFound, "entry doesn't exist")
 		}
 
 		return id + ".html", nil
 	}
+	registryService.ReadEntriesFn = func() (midas.Registry, error) {
+		MockRegistryCounters["ReadEntries"]++
+
+		return midas.Registry{}, nil
+	}
 	registryService.UpdateEntryFn = func(id, _ string) error {
 		MockRegistryCounters["UpdateEntry"]++
 
 		if id == "error" {
-			return midas.Errorf(midas.ErrRegistry, "entry doesn't exist")
+			return midas.Errorf(midas.ErrNotFound, "entry doesn't exist")
 		}
 
 		return nil
@@ -219,7 +234,7 @@ func prepareMockRegistryService(site midas.Site) midas.RegistryService {
 		MockRegistryCounters["DeleteEntry"]++
 
 		if id == "error" {
-			return midas.Errorf(midas.ErrRegistry, "entry doesn't exist")
+			return midas.Errorf(midas.ErrNotFound, "entry doesn't exist")
 		}
 
 		return nil
@@ -227,3 +242,157 @@ func prepareMockRegistryService(site midas.Site) midas.RegistryService {
 
 	return registryService
 }
+
+func TestServer_SharedSiteService(t *testing.T) {
+	created, closed := 0, 0
+
+	s := MustOpenServer(t, map[string]func(site midas.Site) (midas.SiteService, error){
+		"hugo": func(site midas.Site) (midas.SiteService, error) {
+			created++
+
+			registryService := mock.NewRegistryService(site)
+			registryService.CloseStorageFn = func() {
+				closed++
+			}
+
+			siteService := mock.NewSiteService()
+			siteService.CreateEntryFn = func(_ midas.Payload) (string, error) {
+				return "", nil
+			}
+			siteService.BuildSiteFn = func(_ bool, _ zerolog.Logger) error {
+				return nil
+			}
+			siteService.GetRegistryServiceFn = func() (midas.RegistryService, error) {
+				return registryService, nil
+			}
+
+			return siteService, nil
+		},
+	}, midas.Config{
+		Sites: map[string]midas.Site{
+			"test": {
+				SiteName:        "test",
+				Service:         "hugo",
+				Registry:        midas.RegistrySettings{Type: "mock"},
+				CollectionTypes: map[string]midas.ModelSettings{"post": {}},
+			},
+		},
+	})
+
+	payload := `{"event": "entry.create", "createdAt": "2022-01-01T10:10:10.000Z", "model": "post", "entry": {"id": 1, "Title": "Test"}}`
+	for i := 0; i < 2; i++ {
+		resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.Background(), "test", "POST", "/strapi/hugo", strings.NewReader(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+	createdBeforeClose, closedBeforeClose := created, closed
+
+	MustCloseServer(t, s)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Created":            {createdBeforeClose, 1},
+		"Closed per request": {closedBeforeClose, 0},
+		"Closed on shutdown": {closed, 1},
+	})
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	openServer := func(t *testing.T, started chan<- struct{}, release <-chan struct{}) *Server {
+		return MustOpenServer(t, map[string]func(site midas.Site) (midas.SiteService, error){
+			"hugo": func(site midas.Site) (midas.SiteService, error) {
+				siteService := mock.NewSiteService()
+
+				siteService.CreateEntryFn = func(_ midas.Payload) (string, error) {
+					return "", nil
+				}
+				siteService.BuildModelFn = func(_ string, _ bool, _ zerolog.Logger) error {
+					close(started)
+					<-release
+					return nil
+				}
+				siteService.GetRegistryServiceFn = func() (midas.RegistryService, error) {
+					return prepareMockRegistryService(site), nil
+				}
+
+				return siteService, nil
+			},
+		}, midas.Config{
+			Sites: map[string]midas.Site{
+				"test": {
+					SiteName:        "test",
+					Service:         "hugo",
+					Registry:        midas.RegistrySettings{Type: "mock"},
+					CollectionTypes: map[string]midas.ModelSettings{"post": {}},
+				},
+			},
+		})
+	}
+
+	// startBuild sends the webhook and waits until its build is started. The response status is sent to the channel.
+	startBuild := func(t *testing.T, s *Server, started <-chan struct{}) <-chan int {
+		status := make(chan int, 1)
+
+		payload := `{"event": "entry.create", "createdAt": "2022-01-01T10:10:10.000Z", "model": "post", "entry": {"id": 1, "Title": "Test"}}`
+		r := s.MustNewRequest(t, context.Background(), "test", "POST", "/strapi/hugo", strings.NewReader(payload))
+		go func() {
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				status <- 0
+				return
+			}
+			status <- resp.StatusCode
+		}()
+
+		<-started
+
+		return status
+	}
+
+	t.Run("Waits for build", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		s := openServer(t, started, release)
+		status := startBuild(t, s, started)
+
+		shutdown := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			shutdown <- s.Shutdown(ctx)
+		}()
+
+		select {
+		case err := <-shutdown:
+			t.Fatalf("Shutdown() returned before the build finished, error = %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(release)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Shutdown error":      {<-shutdown, nil},
+			"Status code":         {<-status, http.StatusNoContent},
+			"Operations released": {s.Context().Err(), context.Canceled},
+		})
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		defer close(release)
+
+		s := openServer(t, started, release)
+		startBuild(t, s, started)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := s.Shutdown(ctx)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Shutdown error":       {err, context.DeadlineExceeded},
+			"Operations cancelled": {s.Context().Err(), context.Canceled},
+		})
+	})
+}
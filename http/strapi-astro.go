@@ -7,6 +7,7 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi/v5"
@@ -22,6 +23,8 @@ type StrapiToAstroHandler struct {
 	AstroSite midas.SiteService
 	Payload   midas.Payload
 	log       zerolog.Logger
+	// ctx is cancelled by the server shutdown running out of time, it doesn't end with the request.
+	ctx context.Context
 }
 
 func (s *Server) registerStrapiToAstroRoutes(r chi.Router) {
@@ -70,7 +73,7 @@ func (s *Server) handleStrapiToAstro(w http.ResponseWriter, r *http.Request) {
 		"id":    payload.Entry()["id"],
 	}).Msg("Request data")
 
-	astroSite, err := s.SiteServices["astro"](*cfg)
+	astroSite, err := s.siteService(r, "astro")
 	if err != nil {
 		Error(w, r, err)
 		return
@@ -80,12 +83,8 @@ func (s *Server) handleStrapiToAstro(w http.ResponseWriter, r *http.Request) {
 		AstroSite: astroSite,
 		Payload:   payload,
 		log:       log,
+		ctx:       s.ctx,
 	}
-	defer func() {
-		registry, _ := handler.AstroSite.GetRegistryService()
-		registry.CloseStorage()
-	}()
-
 	handler.Handle(w, r)
 }
 
@@ -106,7 +105,7 @@ func (s *Server) HandleAstroRebuild(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	astroSite, err := s.SiteServices["astro"](*cfg)
+	astroSite, err := s.siteService(r, "astro")
 	if err != nil {
 		Error(w, r, err)
 		return
@@ -116,6 +115,7 @@ func (s *Server) HandleAstroRebuild(w http.ResponseWriter, r *http.Request) {
 		AstroSite: astroSite,
 		Payload:   &strapi.Payload{},
 		log:       log,
+		ctx:       s.ctx,
 	}
 
 	useCache := true
@@ -170,12 +170,14 @@ func (h StrapiToAstroHandler) Handle(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h StrapiToAstroHandler) handleBuild(w http.ResponseWriter, r *http.Request) {
-	if err := h.AstroSite.BuildSite(true, h.log); err != nil {
-		Error(w, r, err)
-		return
-	}
+	cfg := midas.SiteConfigFromContext(r.Context())
 
-	if err := h.runDeploys(r); err != nil {
+	err := runPipeline(h.ctx, cfg.Retry, h.log,
+		func() error { return h.AstroSite.BuildSite(true, h.log) },
+		func() error { return h.deploy(cfg, false) },
+		func() error { return h.deploy(cfg, true) },
+	)
+	if err != nil {
 		Error(w, r, err)
 		return
 	}
@@ -211,10 +213,21 @@ func (h StrapiToAstroHandler) deploy(cfg *midas.Site, draft bool) error {
 		return nil
 	}
 
+	// Guards the live site against the empty build output
+	if err := dplSettings.CheckOutput(*cfg, draft); err != nil {
+		return err
+	}
+
+	hash, err := dplSettings.CheckChanged(*cfg, draft)
+	if midas.ErrorCode(err) == midas.ErrUnchanged {
+		h.log.Info().Msgf("Skipping deployment of %s: %s", cfg.SiteName, midas.ErrorMessage(err))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
 	var deploymentService midas.Deployment
 	if dpl, ok := midas.DeploymentTargets[dplSettings.Target]; ok {
-		var err error
-
 		if deploymentService, err = dpl(*cfg, dplSettings, draft); err != nil {
 			return midas.Errorf(midas.ErrInternal, "could not create deployment %s: %s", dplSettings.Target, err)
 		}
@@ -223,9 +236,9 @@ func (h StrapiToAstroHandler) deploy(cfg *midas.Site, draft bool) error {
 	}
 
 	h.log.Debug().Msgf("Deploying %s to %s", cfg.SiteName, dplSettings.Target)
-	if err := deploymentService.Deploy(); err != nil {
+	if err := deploymentService.DeployContext(h.ctx); err != nil {
 		return err
 	}
 
-	return nil
+	return dplSettings.RecordHash(*cfg, hash)
 }
@@ -7,6 +7,7 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi/v5"
@@ -22,6 +23,10 @@ type StrapiToHugoHandler struct {
 	HugoSite midas.SiteService
 	Payload  midas.Payload
 	log      zerolog.Logger
+	// ctx is the context of the server operations, so the deploys aren't aborted with the webhook request.
+	ctx context.Context
+	// full makes the deploys upload everything from scratch (see midas.FullDeployment).
+	full bool
 }
 
 func (s *Server) registerStrapiToHugoRoutes(r chi.Router) {
@@ -70,7 +75,7 @@ func (s *Server) handleStrapiToHugo(w http.ResponseWriter, r *http.Request) {
 		"id":    payload.Entry()["id"],
 	}).Msg("Request data")
 
-	hugoSite, err := s.SiteServices["hugo"](*cfg)
+	hugoSite, err := s.siteService(r, "hugo")
 	if err != nil {
 		Error(w, r, err)
 		return
@@ -80,12 +85,8 @@ func (s *Server) handleStrapiToHugo(w http.ResponseWriter, r *http.Request) {
 		HugoSite: hugoSite,
 		Payload:  payload,
 		log:      log,
+		ctx:      s.ctx,
 	}
-	defer func() {
-		registry, _ := handler.HugoSite.GetRegistryService()
-		registry.CloseStorage()
-	}()
-
 	handler.Handle(w, r)
 }
 
@@ -106,7 +107,7 @@ func (s *Server) HandleHugoRebuild(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hugoSite, err := s.SiteServices["hugo"](*cfg)
+	hugoSite, err := s.siteService(r, "hugo")
 	if err != nil {
 		Error(w, r, err)
 		return
@@ -116,6 +117,7 @@ func (s *Server) HandleHugoRebuild(w http.ResponseWriter, r *http.Request) {
 		HugoSite: hugoSite,
 		Payload:  &strapi.Payload{},
 		log:      log,
+		ctx:      s.ctx,
 	}
 
 	useCache := true
@@ -126,6 +128,14 @@ func (s *Server) HandleHugoRebuild(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Full deploy rebuilds without cache and redeploys everything, regardless of the target state
+	switch r.URL.Query().Get("full") {
+	case "1", "true", "enable":
+		log.Warn().Msgf("Full deploy of %s requested", cfg.SiteName)
+		useCache = false
+		handler.full = true
+	}
+
 	if err = hugoSite.BuildSite(useCache, log); err != nil {
 		Error(w, r, err)
 		return
@@ -198,12 +208,7 @@ func (h StrapiToHugoHandler) handleCreateSingle(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := h.HugoSite.BuildSite(true, h.log); err != nil {
-		Error(w, r, err)
-		return
-	}
-
-	if err := h.runDeploys(r); err != nil {
+	if err := h.buildAndDeploy(r); err != nil {
 		Error(w, r, err)
 		return
 	}
@@ -212,17 +217,16 @@ func (h StrapiToHugoHandler) handleCreateSingle(w http.ResponseWriter, r *http.R
 }
 
 func (h StrapiToHugoHandler) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
-	if _, err := h.HugoSite.CreateEntry(h.Payload); err != nil {
-		Error(w, r, err)
+	if _, err := h.createEntry(r); midas.ErrorCode(err) == midas.ErrUnchanged {
+		// Nothing changed, so the site is neither built nor deployed
+		w.WriteHeader(http.StatusNoContent)
 		return
-	}
-
-	if err := h.HugoSite.BuildSite(true, h.log); err != nil {
+	} else if err != nil {
 		Error(w, r, err)
 		return
 	}
 
-	if err := h.runDeploys(r); err != nil {
+	if err := h.buildAndDeploy(r); err != nil {
 		Error(w, r, err)
 		return
 	}
@@ -236,12 +240,7 @@ func (h StrapiToHugoHandler) handleUpdateSingle(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := h.HugoSite.BuildSite(true, h.log); err != nil {
-		Error(w, r, err)
-		return
-	}
-
-	if err := h.runDeploys(r); err != nil {
+	if err := h.buildAndDeploy(r); err != nil {
 		Error(w, r, err)
 		return
 	}
@@ -250,17 +249,12 @@ func (h StrapiToHugoHandler) handleUpdateSingle(w http.ResponseWriter, r *http.R
 }
 
 func (h StrapiToHugoHandler) handleUpdateCollection(w http.ResponseWriter, r *http.Request) {
-	if _, err := h.HugoSite.UpdateEntry(h.Payload); err != nil {
+	if _, err := h.updateEntry(r); err != nil {
 		Error(w, r, err)
 		return
 	}
 
-	if err := h.HugoSite.BuildSite(true, h.log); err != nil {
-		Error(w, r, err)
-		return
-	}
-
-	if err := h.runDeploys(r); err != nil {
+	if err := h.buildAndDeploy(r); err != nil {
 		Error(w, r, err)
 		return
 	}
@@ -269,22 +263,78 @@ func (h StrapiToHugoHandler) handleUpdateCollection(w http.ResponseWriter, r *ht
 }
 
 func (h StrapiToHugoHandler) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
-	if _, err := h.HugoSite.DeleteEntry(h.Payload); err != nil {
+	removedPath, err := h.HugoSite.DeleteEntry(h.Payload)
+	if err != nil {
 		Error(w, r, err)
 		return
 	}
+	h.log.Info().Msgf("Removed entry file %s", removedPath)
 
-	if err := h.HugoSite.BuildSite(true, h.log); err != nil {
+	if err := h.buildAndDeploy(r); err != nil {
 		Error(w, r, err)
 		return
 	}
 
-	if err := h.runDeploys(r); err != nil {
-		Error(w, r, err)
-		return
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// buildAndDeploy builds the payload model and executes the deploys, retrying the failed step as configured for
+// the site.
+func (h StrapiToHugoHandler) buildAndDeploy(r *http.Request) error {
+	cfg := midas.SiteConfigFromContext(r.Context())
+	model := h.Payload.Metadata()["model"].(string)
+
+	return runPipeline(h.ctx, cfg.Retry, h.log,
+		func() error { return h.HugoSite.BuildModel(model, true, h.log) },
+		func() error { return h.deploy(cfg, false) },
+		func() error { return h.deploy(cfg, true) },
+	)
+}
+
+// createEntry creates the entry, aborting it (if the site supports it) when either the webhook request or the
+// server operations are cancelled.
+func (h StrapiToHugoHandler) createEntry(r *http.Request) (string, error) {
+	site, ok := h.HugoSite.(midas.ContextSiteService)
+	if !ok {
+		return h.HugoSite.CreateEntry(h.Payload)
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	ctx, cancel := h.entryContext(r)
+	defer cancel()
+
+	return site.CreateEntryContext(ctx, h.Payload)
+}
+
+// updateEntry updates the entry, aborting it (if the site supports it) when either the webhook request or the
+// server operations are cancelled.
+func (h StrapiToHugoHandler) updateEntry(r *http.Request) (string, error) {
+	site, ok := h.HugoSite.(midas.ContextSiteService)
+	if !ok {
+		return h.HugoSite.UpdateEntry(h.Payload)
+	}
+
+	ctx, cancel := h.entryContext(r)
+	defer cancel()
+
+	return site.UpdateEntryContext(ctx, h.Payload)
+}
+
+// entryContext returns the context of the request, cancelled also with the context of the server operations.
+func (h StrapiToHugoHandler) entryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	if h.ctx == nil {
+		return ctx, cancel
+	}
+
+	go func() {
+		select {
+		case <-h.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
 }
 
 // runDeploys executes both final and the draft deploys.
@@ -315,10 +365,24 @@ func (h StrapiToHugoHandler) deploy(cfg *midas.Site, draft bool) error {
 		return nil
 	}
 
+	// Guards the live site against the empty build output
+	if err := dplSettings.CheckOutput(*cfg, draft); err != nil {
+		return err
+	}
+
+	hash, err := dplSettings.CheckChanged(*cfg, draft)
+	if midas.ErrorCode(err) == midas.ErrUnchanged {
+		// The full deployment is forced even if the output is unchanged
+		if !h.full {
+			h.log.Info().Msgf("Skipping deployment of %s: %s", cfg.SiteName, midas.ErrorMessage(err))
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+
 	var deploymentService midas.Deployment
 	if dpl, ok := midas.DeploymentTargets[dplSettings.Target]; ok {
-		var err error
-
 		if deploymentService, err = dpl(*cfg, dplSettings, draft); err != nil {
 			return midas.Errorf(midas.ErrInternal, "could not create deployment %s: %s", dplSettings.Target, err)
 		}
@@ -327,9 +391,13 @@ func (h StrapiToHugoHandler) deploy(cfg *midas.Site, draft bool) error {
 	}
 
 	h.log.Debug().Msgf("Deploying %s to %s", cfg.SiteName, dplSettings.Target)
-	if err := deploymentService.Deploy(); err != nil {
+	if fullDeployment, ok := deploymentService.(midas.FullDeployment); ok && h.full {
+		if err := fullDeployment.DeployFull(h.ctx); err != nil {
+			return err
+		}
+	} else if err := deploymentService.DeployContext(h.ctx); err != nil {
 		return err
 	}
 
-	return nil
+	return dplSettings.RecordHash(*cfg, hash)
 }
@@ -10,8 +10,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"github.com/kovansky/midas"
 	midashttp "github.com/kovansky/midas/http"
+	"github.com/kovansky/midas/mock"
 	"github.com/kovansky/midas/testing_utils"
+	"github.com/rs/zerolog"
 	"io"
 	"net/http"
 	"strings"
@@ -128,7 +131,7 @@ func TestStrapiToHugoHandler_Handle(t *testing.T) {
 			testing_utils.AssertTable(t, map[string][]interface{}{
 				"Status code":       {resp.StatusCode, http.StatusNoContent},
 				"Site.UpdateSingle": {MockSiteCounters["UpdateSingle"], 1},
-				"Site.BuildSite":    {MockSiteCounters["BuildSite"], 1},
+				"Site.BuildModel":   {MockSiteCounters["BuildModel"], 1},
 			})
 		})
 
@@ -157,7 +160,7 @@ func TestStrapiToHugoHandler_Handle(t *testing.T) {
 			testing_utils.AssertTable(t, map[string][]interface{}{
 				"Status code":      {resp.StatusCode, http.StatusNoContent},
 				"Site.CreateEntry": {MockSiteCounters["CreateEntry"], 1},
-				"Site.BuildSite":   {MockSiteCounters["BuildSite"], 1},
+				"Site.BuildModel":  {MockSiteCounters["BuildModel"], 1},
 			})
 		})
 	})
@@ -188,7 +191,7 @@ func TestStrapiToHugoHandler_Handle(t *testing.T) {
 			testing_utils.AssertTable(t, map[string][]interface{}{
 				"Status code":       {resp.StatusCode, http.StatusNoContent},
 				"Site.UpdateSingle": {MockSiteCounters["UpdateSingle"], 1},
-				"Site.BuildSite":    {MockSiteCounters["BuildSite"], 1},
+				"Site.BuildModel":   {MockSiteCounters["BuildModel"], 1},
 			})
 		})
 
@@ -217,7 +220,7 @@ func TestStrapiToHugoHandler_Handle(t *testing.T) {
 			testing_utils.AssertTable(t, map[string][]interface{}{
 				"Status code":      {resp.StatusCode, http.StatusNoContent},
 				"Site.UpdateEntry": {MockSiteCounters["UpdateEntry"], 1},
-				"Site.BuildSite":   {MockSiteCounters["BuildSite"], 1},
+				"Site.BuildModel":  {MockSiteCounters["BuildModel"], 1},
 			})
 		})
 	})
@@ -248,7 +251,7 @@ func TestStrapiToHugoHandler_Handle(t *testing.T) {
 			testing_utils.AssertTable(t, map[string][]interface{}{
 				"Status code":      {resp.StatusCode, http.StatusNoContent},
 				"Site.UpdateEntry": {MockSiteCounters["DeleteEntry"], 1},
-				"Site.BuildSite":   {MockSiteCounters["BuildSite"], 1},
+				"Site.BuildModel":  {MockSiteCounters["BuildModel"], 1},
 			})
 		})
 	})
@@ -338,3 +341,48 @@ func TestServer_HandleHugoRebuild(t *testing.T) {
 
 	resetCounters()
 }
+
+func TestStrapiToHugoHandler_Unchanged(t *testing.T) {
+	built := false
+
+	s := MustOpenServer(t, map[string]func(site midas.Site) (midas.SiteService, error){
+		"hugo": func(site midas.Site) (midas.SiteService, error) {
+			siteService := mock.NewSiteService()
+
+			siteService.CreateEntryFn = func(_ midas.Payload) (string, error) {
+				return "", midas.Errorf(midas.ErrUnchanged, "entry post-1 is unchanged")
+			}
+			siteService.BuildModelFn = func(_ string, _ bool, _ zerolog.Logger) error {
+				built = true
+				return nil
+			}
+			siteService.GetRegistryServiceFn = func() (midas.RegistryService, error) {
+				return prepareMockRegistryService(site), nil
+			}
+
+			return siteService, nil
+		},
+	}, midas.Config{
+		Sites: map[string]midas.Site{
+			"test": {
+				SiteName:        "test",
+				Service:         "hugo",
+				Registry:        midas.RegistrySettings{Type: "mock"},
+				CollectionTypes: map[string]midas.ModelSettings{"post": {}},
+				SkipUnchanged:   true,
+			},
+		},
+	})
+	defer MustCloseServer(t, s)
+
+	payload := `{"event": "entry.create", "createdAt": "2022-01-01T10:10:10.000Z", "model": "post", "entry": {"id": 1, "Title": "Test"}}`
+	resp, err := http.DefaultClient.Do(s.MustNewRequest(t, context.Background(), "test", "POST", "/strapi/hugo", bytes.NewReader([]byte(payload))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Status code": {resp.StatusCode, http.StatusNoContent},
+		"Built":       {built, false},
+	})
+}
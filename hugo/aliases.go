@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"strings"
+)
+
+// aliasesIdSuffix is appended to the entry id to track the previous slugs of the entry in the registry. The slugs
+// are kept as the newline separated list, instead of the path.
+const aliasesIdSuffix = "#aliases"
+
+// isAliasesId returns true if the registry id tracks the previous slugs of an entry, not a file.
+func isAliasesId(id string) bool {
+	return strings.HasSuffix(id, aliasesIdSuffix)
+}
+
+// entryAliases returns the previous slugs of the entry, in the order the entry was renamed. The caller must hold
+// the entry lock.
+func (s SiteService) entryAliases(entryId string) ([]string, error) {
+	slugs, err := s.registry.ReadEntry(entryId + aliasesIdSuffix)
+	if err != nil {
+		if midas.ErrorCode(err) == midas.ErrNotFound {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if slugs == "" {
+		return nil, nil
+	}
+
+	return strings.Split(slugs, "\n"), nil
+}
+
+// renamedAliases returns the previous slugs of the entry renamed from the oldName to the newName: the old name is
+// appended, while the new name is removed, as the entry may be renamed back to its previous slug.
+func renamedAliases(aliases []string, oldName, newName string) []string {
+	renamed := make([]string, 0, len(aliases)+1)
+	for _, alias := range aliases {
+		if alias != oldName && alias != newName {
+			renamed = append(renamed, alias)
+		}
+	}
+
+	if oldName != newName {
+		renamed = append(renamed, oldName)
+	}
+
+	return renamed
+}
+
+// writeEntryAliases tracks the previous slugs of the entry in the registry, removing the registry entry if there are
+// none. The registry isn't flushed. The caller must hold the entry lock.
+func (s SiteService) writeEntryAliases(entryId string, aliases []string) error {
+	aliasesId := entryId + aliasesIdSuffix
+
+	_, err := s.registry.ReadEntry(aliasesId)
+	if err != nil && midas.ErrorCode(err) != midas.ErrNotFound {
+		return err
+	}
+	tracked := err == nil
+
+	switch {
+	case len(aliases) == 0 && tracked:
+		return s.registry.DeleteEntry(aliasesId)
+	case len(aliases) == 0:
+		return nil
+	case tracked:
+		return s.registry.UpdateEntry(aliasesId, strings.Join(aliases, "\n"))
+	default:
+		return s.registry.CreateEntry(aliasesId, strings.Join(aliases, "\n"))
+	}
+}
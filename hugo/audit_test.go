@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSiteService_AuditLog(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }}`,
+	})
+	s.Site.AuditLog = midas.AuditLogSettings{Enabled: true, Path: "logs/audit.log"}
+
+	readRecords := func() []midas.AuditRecord {
+		file, err := os.Open(filepath.Join(s.Site.RootDir, "logs", "audit.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		var records []midas.AuditRecord
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var record midas.AuditRecord
+			if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+
+		return records
+	}
+
+	createdPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+	testing_utils.AssertEquals(t, err, nil, "Create error")
+	testing_utils.AssertEquals(t, len(readRecords()), 1, "Records after create")
+
+	updatedPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`))
+	testing_utils.AssertEquals(t, err, nil, "Update error")
+	testing_utils.AssertEquals(t, len(readRecords()), 2, "Records after update")
+
+	// Failed operations aren't recorded
+	_, err = s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "Renamed"}`))
+	testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Conflicting create error")
+	testing_utils.AssertEquals(t, len(readRecords()), 2, "Records after failed create")
+
+	_, err = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 1, "Title": "Renamed"}`))
+	testing_utils.AssertEquals(t, err, nil, "Delete error")
+
+	records := readRecords()
+	count, verifyErr := midas.VerifyAuditLog(s.Site.AuditLogPath())
+
+	var operations []string
+	for _, record := range records {
+		operations = append(operations, fmt.Sprintf("%s %s %s %s", record.Operation, record.Event, record.EntryId, record.Path))
+	}
+
+	entryId, _ := s.EntryId(mustParsePayload(t, "entry.update", "post", `{"id": 1}`))
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Operations": {fmt.Sprint(operations), fmt.Sprint([]string{
+			fmt.Sprintf("create Create %s %s", entryId, createdPath),
+			fmt.Sprintf("update Update %s %s", entryId, updatedPath),
+			fmt.Sprintf("delete Delete %s %s", entryId, updatedPath),
+		})},
+		"Site":         {records[0].Site, s.Site.SiteName},
+		"Model":        {records[0].Model, "post"},
+		"Timestamp":    {records[0].Time.IsZero(), false},
+		"Chained":      {records[1].PrevHash, records[0].Hash},
+		"Verify error": {verifyErr, nil},
+		"Verified":     {count, 3},
+	})
+}
+
+func TestSiteService_AuditLog_Failed(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }}`,
+	})
+	// The directory in place of the audit log can't be appended to
+	s.Site.AuditLog = midas.AuditLogSettings{Enabled: true, Path: "logs"}
+	if err := os.MkdirAll(filepath.Join(s.Site.RootDir, "logs"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	createdPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+	content, _ := os.ReadFile(createdPath)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error code": {midas.ErrorCode(err), midas.ErrInternal},
+		"Path":       {createdPath, filepath.Join(s.Site.RootDir, "posts", "first.html")},
+		"Content":    {string(content), "First"},
+	})
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	bundleLeaf   = "leaf"   // Hugo leaf bundle, with the index file
+	bundleBranch = "branch" // Hugo branch bundle, with the _index file
+)
+
+// bundleContentExtensions are the extensions of the content formats Hugo reads the bundle index from.
+var bundleContentExtensions = map[string]bool{
+	".html": true, ".htm": true, ".md": true, ".markdown": true, ".adoc": true, ".org": true, ".pdc": true, ".rst": true,
+}
+
+// bundleIndex returns the file name of the bundle index the model entries are written to, or empty if the entries
+// aren't written as bundles. Hugo tells the bundle type by the index name, so the leaf bundle index must be named
+// index, and the branch one _index.
+func bundleIndex(model *midas.ModelSettings) (string, error) {
+	var name string
+	switch model.Bundle {
+	case "":
+		if model.BundleIndex != "" {
+			return "", midas.Errorf(midas.ErrSiteConfig, "bundle index %s requires the bundle type (leaf or branch)", model.BundleIndex)
+		}
+		return "", nil
+	case bundleLeaf:
+		name = "index"
+	case bundleBranch:
+		name = "_index"
+	default:
+		return "", midas.Errorf(midas.ErrSiteConfig, "unknown bundle type %s", model.Bundle)
+	}
+
+	index := model.BundleIndex
+	if index == "" {
+		return name + ".html", nil
+	}
+
+	if strings.ContainsAny(index, `/\`) {
+		return "", midas.Errorf(midas.ErrSiteConfig, "bundle index %s must be a file name", index)
+	}
+
+	extension := filepath.Ext(index)
+	if strings.TrimSuffix(index, extension) != name {
+		return "", midas.Errorf(midas.ErrSiteConfig, "%s bundle index must be named %s, not %s", model.Bundle, name, index)
+	}
+	if !bundleContentExtensions[strings.ToLower(extension)] {
+		return "", midas.Errorf(midas.ErrSiteConfig, "bundle index %s has no hugo content format extension", index)
+	}
+
+	// The section index would be taken for the entry by the reconciliation
+	if index == "_index.md" && model.SectionArchetypePath != "" {
+		return "", midas.Errorf(midas.ErrSiteConfig, "branch bundle index %s can't be used with the section archetype, which writes the same file", index)
+	}
+
+	return index, nil
+}
+
+// pageName returns the name of the entry page: the bundle directory, or the file name without extension (and the
+// language suffix).
+func (s SiteService) pageName(model *midas.ModelSettings, path string) string {
+	if model.Bundle != "" {
+		return filepath.Base(filepath.Dir(path))
+	}
+
+	_, path = s.fileLanguage(path)
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// removePage removes the entry page. The directory of the bundle is removed as well, with its resources (i.e. the
+// downloaded media), unless it holds other pages (the language versions of the entry, or the pages of the branch
+// bundle) or subdirectories. The model may be nil, if it isn't configured anymore.
+func removePage(model *midas.ModelSettings, path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	if model == nil || model.Bundle == "" {
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, file := range files {
+		if file.IsDir() || bundleContentExtensions[strings.ToLower(filepath.Ext(file.Name()))] {
+			return nil
+		}
+	}
+
+	_ = os.RemoveAll(dir)
+
+	return nil
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_bundleIndex(t *testing.T) {
+	tests := []struct {
+		name             string
+		bundle           string
+		index            string
+		sectionArchetype string
+		want             string
+		wantErr          string
+	}{
+		{"No bundle", "", "", "", "", ""},
+		{"Leaf", "leaf", "", "", "index.html", ""},
+		{"Branch", "branch", "", "", "_index.html", ""},
+		{"Leaf markdown", "leaf", "index.md", "", "index.md", ""},
+		{"Branch markdown", "branch", "_index.md", "", "_index.md", ""},
+		{"Index without bundle", "", "index.md", "", "", midas.ErrSiteConfig},
+		{"Unknown bundle", "headless", "", "", "", midas.ErrSiteConfig},
+		{"Leaf with branch index", "leaf", "_index.md", "", "", midas.ErrSiteConfig},
+		{"Branch with leaf index", "branch", "index.html", "", "", midas.ErrSiteConfig},
+		{"Not content format", "leaf", "index.json", "", "", midas.ErrSiteConfig},
+		{"Path", "leaf", "content/index.md", "", "", midas.ErrSiteConfig},
+		{"Branch with section index", "branch", "_index.md", "archetypes/section.md", "", midas.ErrSiteConfig},
+		{"Branch html with section index", "branch", "", "archetypes/section.md", "_index.html", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := bundleIndex(&midas.ModelSettings{Bundle: tt.bundle, BundleIndex: tt.index, SectionArchetypePath: tt.sectionArchetype})
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Index":      {index, tt.want},
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+			})
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_Bundle(t *testing.T) {
+	tests := []struct {
+		name      string
+		bundle    string
+		index     string
+		permalink string
+		wantPath  string
+		wantErr   string
+	}{
+		{"Leaf", "leaf", "", "", "posts/first-post/index.html", ""},
+		{"Leaf markdown", "leaf", "index.md", "", "posts/first-post/index.md", ""},
+		{"Branch", "branch", "", "", "posts/first-post/_index.html", ""},
+		{"Branch markdown", "branch", "_index.md", "", "posts/first-post/_index.md", ""},
+		{"Permalink", "leaf", "", "archive/:slug", "posts/archive/first-post/index.html", ""},
+		{"Invalid combination", "leaf", "_index.md", "", "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Bundle: tt.bundle, BundleIndex: tt.index, Permalink: tt.permalink},
+			}, map[string]string{
+				"archetypes/post.md": `{{ index .Entry "Title" }}`,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First Post"}`))
+
+			var rel string
+			if outputPath != "" {
+				rel, _ = filepath.Rel(s.Site.RootDir, outputPath)
+			}
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Path":       {filepath.ToSlash(rel), tt.wantPath},
+				"Content":    {string(content), map[bool]string{true: "First Post"}[tt.wantErr == ""]},
+			})
+		})
+	}
+}
+
+func TestSiteService_UpdateEntry_Bundle(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Bundle: "leaf", BundleIndex: "index.md", AliasOnRename: true},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }} aliases: {{ .Aliases }}`,
+	})
+
+	oldPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Post"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bundle resource is removed with the old bundle
+	resource := filepath.Join(s.Site.RootDir, "posts", "post", "cover.jpg")
+	if err = os.WriteFile(resource, []byte("image"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	newPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`))
+	rel, _ := filepath.Rel(s.Site.RootDir, newPath)
+	content, _ := os.ReadFile(newPath)
+	_, oldErr := os.Stat(oldPath)
+	_, resourceErr := os.Stat(resource)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":            {err, nil},
+		"Path":             {filepath.ToSlash(rel), "posts/renamed/index.md"},
+		"Alias":            {string(content), `Renamed aliases: ["post"]`},
+		"Old removed":      {os.IsNotExist(oldErr), true},
+		"Resource removed": {os.IsNotExist(resourceErr), true},
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(newPath), "cover.jpg"), []byte("image"), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 1, "Title": "Renamed"}`))
+		_, dirErr := os.Stat(filepath.Dir(newPath))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Bundle removed": {os.IsNotExist(dirErr), true},
+		})
+	})
+
+	t.Run("Other page kept", func(t *testing.T) {
+		outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "Shared"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The language version of the page shares the bundle resources
+		for name, content := range map[string]string{"index.pl.md": "Wspólny", "cover.jpg": "image"} {
+			if err = os.WriteFile(filepath.Join(filepath.Dir(outputPath), name), []byte(content), 0664); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 2, "Title": "Shared"}`))
+		_, pageErr := os.Stat(outputPath)
+		_, resourceErr := os.Stat(filepath.Join(filepath.Dir(outputPath), "cover.jpg"))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":         {err, nil},
+			"Page removed":  {os.IsNotExist(pageErr), true},
+			"Resource kept": {resourceErr, nil},
+		})
+	})
+}
+
+func TestSiteService_ResetRegistry_Bundle(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Bundle: "leaf"},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }}`,
+	})
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Post"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ResetRegistry(true)
+	_, dirErr := os.Stat(filepath.Dir(outputPath))
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":          {err, nil},
+		"Bundle removed": {os.IsNotExist(dirErr), true},
+	})
+}
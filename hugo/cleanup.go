@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"golang.org/x/net/html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	nbspRegex = regexp.MustCompile(`&nbsp;|&#160;|&#[xX][aA]0;|\x{00a0}`)
+
+	// defaultCleanupAttributes are the attributes added by the rich-text editors, removed if the model has none
+	// configured.
+	defaultCleanupAttributes = []string{"data-*", "contenteditable", "spellcheck"}
+)
+
+// cleanupFields returns a copy of the entry with the rich-text editor artifacts removed from the cleaned fields.
+// The entry is returned as is, if the cleanup is disabled.
+func cleanupFields(model *midas.ModelSettings, entry map[string]interface{}) map[string]interface{} {
+	settings := model.Cleanup
+	if !settings.Enabled {
+		return entry
+	}
+
+	fields := settings.Fields
+	if len(fields) == 0 {
+		if model.Fields.HTML != nil {
+			fields = append(fields, *model.Fields.HTML...)
+		}
+		if model.Fields.Body != nil {
+			fields = append(fields, *model.Fields.Body)
+		}
+	}
+
+	cleaned := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		cleaned[key] = value
+	}
+
+	for _, field := range fields {
+		if value, ok := cleaned[field].(string); ok {
+			cleaned[field] = cleanupHTML(settings, value)
+		}
+	}
+
+	return cleaned
+}
+
+// cleanupHTML removes the empty paragraphs, stray non-breaking spaces and editor attributes from the HTML. Tokens
+// which aren't changed are written as they are, so the rest of the content (i.e. Hugo shortcodes) is kept intact.
+// The source is returned unchanged, if it can't be tokenized.
+func cleanupHTML(settings midas.CleanupSettings, source string) string {
+	attributes := settings.Attributes
+	if len(attributes) == 0 {
+		attributes = defaultCleanupAttributes
+	}
+
+	var (
+		output, paragraph strings.Builder
+		inParagraph       bool
+		emptyParagraph    bool
+	)
+
+	write := func(s string) {
+		if inParagraph {
+			paragraph.WriteString(s)
+		} else {
+			output.WriteString(s)
+		}
+	}
+	closeParagraph := func(keep bool) {
+		if keep {
+			output.WriteString(paragraph.String())
+		}
+		paragraph.Reset()
+		inParagraph = false
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return source
+			}
+			break
+		}
+
+		raw := string(tokenizer.Raw())
+
+		switch tokenType {
+		case html.TextToken:
+			if !settings.KeepNonBreakingSpaces {
+				raw = cleanupSpaces(raw)
+			}
+			if strings.TrimSpace(nbspRegex.ReplaceAllString(raw, " ")) != "" {
+				emptyParagraph = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if removeAttributes(&token, attributes) {
+				raw = token.String()
+			}
+
+			if token.Data == "p" && tokenType == html.StartTagToken {
+				// Paragraph can't hold another one, so the previous one is closed implicitly
+				if inParagraph {
+					closeParagraph(!emptyParagraph || settings.KeepEmptyParagraphs)
+				}
+				inParagraph, emptyParagraph = true, true
+			} else if token.Data != "br" {
+				emptyParagraph = false
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "p" && inParagraph {
+				paragraph.WriteString(raw)
+				closeParagraph(!emptyParagraph || settings.KeepEmptyParagraphs)
+				continue
+			}
+			emptyParagraph = false
+		}
+
+		write(raw)
+	}
+
+	if inParagraph {
+		closeParagraph(true)
+	}
+
+	return output.String()
+}
+
+// cleanupSpaces replaces the non-breaking spaces next to other whitespace or at the text boundaries with regular
+// spaces. Non-breaking spaces between other characters are kept.
+func cleanupSpaces(text string) string {
+	matches := nbspRegex.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var builder strings.Builder
+
+	last := 0
+	for i, match := range matches {
+		builder.WriteString(text[last:match[0]])
+
+		previous, _ := utf8.DecodeLastRuneInString(text[:match[0]])
+		next, _ := utf8.DecodeRuneInString(text[match[1]:])
+
+		stray := match[0] == 0 || match[1] == len(text) ||
+			(i > 0 && matches[i-1][1] == match[0]) || (i+1 < len(matches) && matches[i+1][0] == match[1]) ||
+			unicode.IsSpace(previous) || unicode.IsSpace(next)
+		if stray {
+			builder.WriteString(" ")
+		} else {
+			builder.WriteString(text[match[0]:match[1]])
+		}
+
+		last = match[1]
+	}
+	builder.WriteString(text[last:])
+
+	return builder.String()
+}
+
+// removeAttributes removes the token attributes matching any of the names. Returns true if any was removed.
+func removeAttributes(token *html.Token, names []string) bool {
+	kept := token.Attr[:0]
+	for _, attribute := range token.Attr {
+		if !matchesAttribute(attribute.Key, names) {
+			kept = append(kept, attribute)
+		}
+	}
+
+	removed := len(kept) != len(token.Attr)
+	token.Attr = kept
+
+	return removed
+}
+
+// matchesAttribute returns true if the attribute name equals any of the names, or starts with the name ending with *.
+func matchesAttribute(key string, names []string) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if prefix := strings.TrimSuffix(name, "*"); prefix != name {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"io"
+	"testing"
+)
+
+func Test_cleanupHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings midas.CleanupSettings
+		source   string
+		expected string
+	}{
+		{"Clean", midas.CleanupSettings{}, `<p>Hello <strong>world</strong></p>`, `<p>Hello <strong>world</strong></p>`},
+		{"Empty paragraphs", midas.CleanupSettings{},
+			`<p></p><p>Text</p><p> &nbsp; </p><p><br></p><p><br/>&#160;</p>`, `<p>Text</p>`},
+		{"Paragraph with image kept", midas.CleanupSettings{}, `<p><img src="a.png"></p>`, `<p><img src="a.png"></p>`},
+		{"Empty paragraphs kept", midas.CleanupSettings{KeepEmptyParagraphs: true}, `<p></p><p>Text</p>`, `<p></p><p>Text</p>`},
+		{"Unclosed paragraphs", midas.CleanupSettings{}, `<p>One<p>&nbsp;<p>Two`, `<p>One<p>Two`},
+		{"Stray spaces", midas.CleanupSettings{},
+			`<p>&nbsp;Hello&nbsp; world&nbsp;&nbsp;again&nbsp;</p>`, `<p> Hello  world  again </p>`},
+		{"Spaces between words kept", midas.CleanupSettings{}, `<p>10&nbsp;km, 5&#160;kg</p>`, `<p>10&nbsp;km, 5&#160;kg</p>`},
+		{"Spaces kept", midas.CleanupSettings{KeepNonBreakingSpaces: true}, `<p>Hello&nbsp; world</p>`, `<p>Hello&nbsp; world</p>`},
+		{"Default attributes", midas.CleanupSettings{},
+			`<p data-block-key="x1" class="lead" contenteditable="true" spellcheck="false">Text</p>`, `<p class="lead">Text</p>`},
+		{"Configured attributes", midas.CleanupSettings{Attributes: []string{"style", "ARIA-*"}},
+			`<span style="color: red" aria-label="x" data-id="1">Text</span>`, `<span data-id="1">Text</span>`},
+		{"Shortcodes kept", midas.CleanupSettings{}, `<p>{{< figure src="a.png" >}}</p><p></p>`, `<p>{{< figure src="a.png" >}}</p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, cleanupHTML(tt.settings, tt.source), tt.expected, "Cleaned HTML")
+		})
+	}
+}
+
+func TestSiteService_Cleanup(t *testing.T) {
+	body, html := "Content", "Lead"
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			Archetype:   `{{ .Body }}|{{ index .Entry "Lead" }}|{{ index .Entry "Note" }}`,
+			OutputDir:   "posts",
+			TrustedBody: true,
+			Cleanup:     midas.CleanupSettings{Enabled: true},
+		},
+		"raw": {
+			Archetype:   `{{ .Body }}`,
+			OutputDir:   "raw",
+			TrustedBody: true,
+		},
+	}, nil)
+	for name, model := range s.Site.CollectionTypes {
+		model.Fields.Body = &body
+		model.Fields.HTML = &[]string{html}
+		s.Site.CollectionTypes[name] = model
+	}
+
+	entry := `{"id": 1, "Title": "First", "Content": "<p></p><p data-id=\"1\">Hi&nbsp;</p>", "Lead": "<p>Lead</p><p>&nbsp;</p>", "Note": "<p></p>"}`
+
+	render := func(model string) string {
+		output, _, err := s.RenderEntry(mustParsePayload(t, "entry.create", model, entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(output)
+
+		return string(content)
+	}
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Cleaned":     {render("post"), `<p>Hi </p>|<p>Lead</p>|&lt;p&gt;&lt;/p&gt;`},
+		"Not enabled": {render("raw"), `<p></p><p data-id="1">Hi&nbsp;</p>`},
+	})
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/kovansky/midas"
+	"os"
+	"path/filepath"
+)
+
+// dataIdSuffix is appended to the entry id to track the entry data file in the registry.
+const dataIdSuffix = "#data"
+
+// withEntryData writes the entry data file after the page, if the model has the data directory configured. Returns
+// the page path, or the data file path if the model has no page output. If the data file fails, the previous one is
+// kept, and the error reports the page written already.
+func (s SiteService) withEntryData(payload midas.Payload, pagePath string) (string, []byte, error) {
+	model, _ := s.getModel(payload.Metadata()["model"].(string))
+	if model.DataDir == "" {
+		return pagePath, nil, nil
+	}
+
+	dataPath, err := s.writeEntryData(model, payload)
+	if err != nil {
+		if pagePath != "" {
+			err = midas.Errorf(midas.ErrorCode(err), "entry page %s is written, but its data file is not: %s", pagePath, err)
+		}
+		return pagePath, nil, err
+	}
+
+	if pagePath == "" {
+		return dataPath, nil, nil
+	}
+
+	return pagePath, nil, nil
+}
+
+// writeEntryData writes the sanitized entry as JSON to the model data directory and tracks it in the registry.
+// The previous data file is removed once the new one is written, if the entry is renamed; the failed write leaves
+// it in place. The caller must hold the entry lock.
+func (s SiteService) writeEntryData(model *midas.ModelSettings, payload midas.Payload) (string, error) {
+	dataDir := model.DataDir
+	if !filepath.IsAbs(dataDir) {
+		dataDir = filepath.Join(s.Site.RootDir, dataDir)
+	}
+
+	slug, err := s.entrySlug(model, payload.Entry())
+	if err != nil {
+		return "", err
+	}
+	suffix, err := s.languageSuffix(payload.Entry())
+	if err != nil {
+		return "", err
+	}
+	dataPath := filepath.Join(dataDir, slug+suffix+".json")
+
+	entryId, err := s.EntryId(payload)
+	if err != nil {
+		return "", err
+	}
+	dataId := entryId + dataIdSuffix
+	oldPath, err := s.registry.ReadEntry(dataId)
+	if err != nil && midas.ErrorCode(err) != midas.ErrNotFound {
+		return "", err
+	}
+	tracked := err == nil
+
+	if existingPath := s.existingPath(dataPath); existingPath != "" && existingPath != oldPath {
+		return "", midas.Errorf(midas.ErrInvalid, "data file %s already exists", filepath.Base(dataPath))
+	}
+
+	asJson, err := json.Marshal(sanitizeHtmlInMap(payload.Entry()))
+	if err != nil {
+		return "", err
+	}
+
+	if maxSize := s.maxEntrySize(); maxSize >= 0 && int64(len(asJson)) > maxSize {
+		return "", midas.Errorf(midas.ErrInvalid, "entry exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	if err = os.MkdirAll(dataDir, 0775); err != nil {
+		return "", err
+	}
+
+	if err = s.writePage(model, dataPath, bytes.NewReader(asJson)); err != nil {
+		return "", err
+	}
+
+	if oldPath != "" && oldPath != dataPath && !sameFile(oldPath, dataPath) {
+		_ = os.Remove(oldPath)
+	}
+
+	if tracked {
+		err = s.registry.UpdateEntry(dataId, dataPath)
+	} else {
+		err = s.registry.CreateEntry(dataId, dataPath)
+	}
+	if err != nil {
+		return dataPath, err
+	}
+	if err = s.registry.Flush(); err != nil {
+		return dataPath, err
+	}
+
+	return dataPath, nil
+}
+
+// removeEntryData removes the entry data file and its registry entry. Returns empty path if the entry has
+// no data file tracked. The caller must hold the entry lock.
+func (s SiteService) removeEntryData(entryId string) (string, error) {
+	dataId := entryId + dataIdSuffix
+
+	dataPath, err := s.registry.ReadEntry(dataId)
+	if err != nil {
+		if midas.ErrorCode(err) == midas.ErrNotFound {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	if err = os.Remove(dataPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	if err = s.registry.DeleteEntry(dataId); err != nil {
+		return dataPath, err
+	}
+	if err = s.registry.Flush(); err != nil {
+		return dataPath, err
+	}
+
+	return dataPath, nil
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// scriptSanitizer removes the script elements.
+type scriptSanitizer struct{}
+
+func (scriptSanitizer) Sanitize(html string) string {
+	return regexp.MustCompile(`<script>.*?</script>`).ReplaceAllString(html, "")
+}
+
+func TestSiteService_EntryData(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DataDir: "data/posts"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+	midas.Sanitizer = scriptSanitizer{}
+
+	pagePath := func(slug string) string { return filepath.Join(s.Site.RootDir, "posts", slug+".html") }
+	dataPath := func(slug string) string { return filepath.Join(s.Site.RootDir, "data", "posts", slug+".json") }
+	readData := func(slug string) map[string]interface{} {
+		var data map[string]interface{}
+		content, err := os.ReadFile(dataPath(slug))
+		if err == nil {
+			err = json.Unmarshal(content, &data)
+		}
+		if err != nil {
+			t.Fatalf("data file %s can't be read: %s", slug, err)
+		}
+
+		return data
+	}
+
+	// Created
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First", "Content": "<p>Hi</p><script>x()</script>"}`))
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Create error":    {err, nil},
+		"Create path":     {outputPath, pagePath("first")},
+		"Page created":    {fileExists(pagePath("first")), true},
+		"Data title":      {readData("first")["Title"], "First"},
+		"Data sanitized":  {readData("first")["Content"], "<p>Hi</p>"},
+		"Data registered": {registryPath(t, s, "post-1#data"), dataPath("first")},
+	})
+
+	// Updated with new title, both files renamed
+	outputPath, err = s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`))
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Update error":      {err, nil},
+		"Update path":       {outputPath, pagePath("renamed")},
+		"Old page removed":  {fileExists(pagePath("first")), false},
+		"Old data removed":  {fileExists(dataPath("first")), false},
+		"Data updated":      {readData("renamed")["Title"], "Renamed"},
+		"Data reregistered": {registryPath(t, s, "post-1#data"), dataPath("renamed")},
+	})
+
+	// Deleted together
+	outputPath, err = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 1}`))
+	entries, _ := s.registry.ReadEntries()
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Delete error":     {err, nil},
+		"Delete path":      {outputPath, pagePath("renamed")},
+		"Page removed":     {fileExists(pagePath("renamed")), false},
+		"Data removed":     {fileExists(dataPath("renamed")), false},
+		"Registry emptied": {len(entries), 0},
+	})
+}
+
+func TestSiteService_EntryData_Failed(t *testing.T) {
+	previous := midas.PostWriteHooks
+	midas.PostWriteHooks = map[string]midas.PostWriteHook{
+		"noData": func(_ midas.Site, path string) error {
+			if filepath.Ext(path) == ".json" {
+				return errors.New("data rejected")
+			}
+			return nil
+		},
+	}
+	t.Cleanup(func() {
+		midas.PostWriteHooks = previous
+	})
+
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DataDir: "data/posts"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+	dataPath := func(slug string) string { return filepath.Join(s.Site.RootDir, "data", "posts", slug+".json") }
+
+	if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The data file of the renamed entry fails, the previous one is kept
+	model := s.Site.CollectionTypes["post"]
+	model.PostWrite.Hook = "noData"
+	s.Site.CollectionTypes["post"] = model
+
+	outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`))
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error code":      {midas.ErrorCode(err), midas.ErrInternal},
+		"Page reported":   {strings.Contains(err.Error(), "renamed.html is written"), true},
+		"Page path":       {outputPath, filepath.Join(s.Site.RootDir, "posts", "renamed.html")},
+		"Old data kept":   {fileExists(dataPath("first")), true},
+		"No new data":     {fileExists(dataPath("renamed")), false},
+		"Data registered": {registryPath(t, s, "post-1#data"), dataPath("first")},
+	})
+}
+
+func TestSiteService_EntryData_Toggle(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"data": {OutputDir: "false", DataDir: "data"},
+		"page": {ArchetypePath: "archetypes/page.md", OutputDir: "pages"},
+	}, map[string]string{
+		"archetypes/page.md": `title: {{ index .Entry "Title" }}`,
+	})
+	dataPath := filepath.Join(s.Site.RootDir, "data", "only-data.json")
+
+	// Data only
+	createdPath, createErr := s.CreateEntry(mustParsePayload(t, "entry.create", "data", `{"id": 1, "Title": "Only data"}`))
+	updatedPath, updateErr := s.UpdateEntry(mustParsePayload(t, "entry.update", "data", `{"id": 1, "Title": "Only data"}`))
+	dataExisted := fileExists(dataPath)
+	deletedPath, deleteErr := s.DeleteEntry(mustParsePayload(t, "entry.delete", "data", `{"id": 1}`))
+
+	// Page only
+	pagePath, pageErr := s.CreateEntry(mustParsePayload(t, "entry.create", "page", `{"id": 1, "Title": "Only page"}`))
+	entries, _ := s.registry.ReadEntries()
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Create error":       {createErr, nil},
+		"Created data path":  {createdPath, dataPath},
+		"Update error":       {updateErr, nil},
+		"Updated data path":  {updatedPath, dataPath},
+		"Data written":       {dataExisted, true},
+		"Delete error":       {deleteErr, nil},
+		"Deleted data path":  {deletedPath, dataPath},
+		"Data removed":       {fileExists(dataPath), false},
+		"No pages directory": {fileExists(filepath.Join(s.Site.RootDir, "false")), false},
+		"Page error":         {pageErr, nil},
+		"Page written":       {fileExists(pagePath), true},
+		"No page data":       {fileExists(filepath.Join(s.Site.RootDir, "data", "only-page.json")), false},
+		"Registry":           {len(entries), 1},
+	})
+}
+
+// registryPath returns the path tracked in the site registry for the id.
+func registryPath(t *testing.T, s SiteService, id string) string {
+	path, err := s.registry.ReadEntry(id)
+	if err != nil {
+		t.Fatalf("registry entry %s: %s", id, err)
+	}
+
+	return path
+}
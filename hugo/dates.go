@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"html/template"
+	"strconv"
+	"time"
+	_ "time/tzdata" // Embedded time zone database, in case the system one is missing
+)
+
+const (
+	defaultDateField    = "createdAt"
+	defaultLastmodField = "updatedAt"
+)
+
+// dateLayouts are the layouts accepted for the string dates, in order of trial.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// dates generates the front matter dates configured in the model, formatted as RFC3339 in the site time zone.
+// Missing (or null) fields result in empty string. Dates are marked as safe HTML, as html/template would escape
+// the time zone offset sign.
+func (s SiteService) dates(model *midas.ModelSettings, entry map[string]interface{}) (map[string]template.HTML, error) {
+	return s.formatDates(model.Dates, entry)
+}
+
+// timestamps generates the date and lastmod from the entry timestamps, if enabled in the model. Missing (or null)
+// timestamps result in empty string.
+func (s SiteService) timestamps(model *midas.ModelSettings, entry map[string]interface{}) (map[string]template.HTML, error) {
+	if !model.Timestamps.Enabled {
+		return make(map[string]template.HTML), nil
+	}
+
+	fields := map[string]string{"date": defaultDateField, "lastmod": defaultLastmodField}
+	if model.Timestamps.Date != "" {
+		fields["date"] = model.Timestamps.Date
+	}
+	if model.Timestamps.Lastmod != "" {
+		fields["lastmod"] = model.Timestamps.Lastmod
+	}
+
+	return s.formatDates(fields, entry)
+}
+
+// frontMatterDates returns the configured dates merged with the timestamps (the dates take precedence), and the
+// timestamps alone, which are injected into the rendered front matter.
+func (s SiteService) frontMatterDates(model *midas.ModelSettings, entry map[string]interface{}) (map[string]template.HTML, map[string]template.HTML, error) {
+	dates, err := s.dates(model, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timestamps, err := s.timestamps(model, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range timestamps {
+		if _, ok := dates[key]; !ok {
+			dates[key] = value
+		}
+	}
+
+	return dates, timestamps, nil
+}
+
+// formatDates reads the dates from the entry fields ([key] => field) and formats them as RFC3339 in the site
+// time zone.
+func (s SiteService) formatDates(fields map[string]string, entry map[string]interface{}) (map[string]template.HTML, error) {
+	output := make(map[string]template.HTML)
+	if len(fields) == 0 {
+		return output, nil
+	}
+
+	location, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+
+	for key, field := range fields {
+		date, err := parseDate(entry[field])
+		if err != nil {
+			return nil, midas.Errorf(midas.ErrInvalid, "date field %s is malformed: %s", field, err)
+		}
+
+		if date.IsZero() {
+			output[key] = ""
+		} else {
+			output[key] = template.HTML(date.In(location).Format(time.RFC3339))
+		}
+	}
+
+	return output, nil
+}
+
+// location returns the configured site time zone.
+func (s SiteService) location() (*time.Location, error) {
+	if s.Site.TimeZone == "" {
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(s.Site.TimeZone)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "time zone %s is invalid", s.Site.TimeZone)
+	}
+
+	return location, nil
+}
+
+// parseDate reads the date from ISO 8601 string or Unix epoch (in seconds or milliseconds, as a number or string).
+// Nil value results in zero time.
+func parseDate(value interface{}) (time.Time, error) {
+	switch value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case float64:
+		return fromEpoch(value.(float64)), nil
+	case time.Time:
+		return value.(time.Time), nil
+	case string:
+		stringed := value.(string)
+		if stringed == "" {
+			return time.Time{}, nil
+		}
+
+		if epoch, err := strconv.ParseFloat(stringed, 64); err == nil {
+			return fromEpoch(epoch), nil
+		}
+
+		for _, layout := range dateLayouts {
+			if date, err := time.Parse(layout, stringed); err == nil {
+				return date, nil
+			}
+		}
+
+		return time.Time{}, midas.Errorf(midas.ErrInvalid, "unknown date format: %s", stringed)
+	default:
+		return time.Time{}, midas.Errorf(midas.ErrInvalid, "unsupported date type: %T", value)
+	}
+}
+
+// fromEpoch converts Unix epoch to time. Values too big to be seconds are treated as milliseconds.
+func fromEpoch(epoch float64) time.Time {
+	if epoch > 1e11 {
+		return time.UnixMilli(int64(epoch)).UTC()
+	}
+
+	return time.Unix(int64(epoch), 0).UTC()
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"html/template"
+	"os"
+	"testing"
+)
+
+func TestSiteService_dates(t *testing.T) {
+	model := &midas.ModelSettings{Dates: map[string]string{"date": "publishedAt"}}
+
+	tests := []struct {
+		name     string
+		timeZone string
+		value    interface{}
+		want     string
+		wantCode string
+	}{
+		{"StrapiISO", "", "2022-01-01T10:10:10.000Z", "2022-01-01T10:10:10Z", ""},
+		{"StrapiISOInTimeZone", "Europe/Warsaw", "2022-01-01T10:10:10.000Z", "2022-01-01T11:10:10+01:00", ""},
+		{"SummerTime", "Europe/Warsaw", "2022-07-01T10:10:10.000Z", "2022-07-01T12:10:10+02:00", ""},
+		{"Offset", "UTC", "2022-01-01T10:10:10+02:00", "2022-01-01T08:10:10Z", ""},
+		{"DateOnly", "", "2022-01-01", "2022-01-01T00:00:00Z", ""},
+		{"EpochSeconds", "", 1641031810.0, "2022-01-01T10:10:10Z", ""},
+		{"EpochMilliseconds", "", 1641031810000.0, "2022-01-01T10:10:10Z", ""},
+		{"EpochString", "America/New_York", "1641031810", "2022-01-01T05:10:10-05:00", ""},
+		{"Null", "", nil, "", ""},
+		{"Malformed", "", "yesterday", "", midas.ErrInvalid},
+		{"UnsupportedType", "", true, "", midas.ErrInvalid},
+		{"InvalidTimeZone", "Mars/Olympus", "2022-01-01T10:10:10.000Z", "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SiteService{Site: midas.Site{TimeZone: tt.timeZone}}
+
+			got, err := s.dates(model, map[string]interface{}{"publishedAt": tt.value})
+
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+			if tt.wantCode == "" {
+				testing_utils.AssertEquals(t, string(got["date"]), tt.want, "Date")
+			}
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_Dates(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath: "archetypes/post.md",
+			OutputDir:     "posts",
+			Dates:         map[string]string{"date": "publishedAt", "lastmod": "updatedAt"},
+		},
+	}, map[string]string{
+		"archetypes/post.md": `date: {{ index .Dates "date" }}, lastmod: {{ index .Dates "lastmod" }}`,
+	})
+	s.Site.TimeZone = "Europe/Warsaw"
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post",
+		`{"id": 1, "Title": "Test", "publishedAt": "2022-01-01T10:10:10.000Z", "updatedAt": "2022-01-02T10:10:10.000Z"}`))
+	testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+	content, err := os.ReadFile(outputPath)
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Read output error": {err, nil},
+		"Output content":    {string(content), "date: 2022-01-01T11:10:10+01:00, lastmod: 2022-01-02T11:10:10+01:00"},
+	})
+}
+
+func TestSiteService_CreateEntry_Timestamps(t *testing.T) {
+	tests := []struct {
+		name       string
+		timestamps midas.TimestampSettings
+		archetype  string
+		entry      string
+		expected   string
+	}{
+		{"Present", midas.TimestampSettings{Enabled: true}, "---\ntitle: Test\n---\nContent",
+			`{"id": 1, "Title": "Test", "createdAt": "2022-01-01T10:10:10.000Z", "updatedAt": "2022-01-02T10:10:10.000Z"}`,
+			"---\ntitle: Test\ndate: 2022-01-01T10:10:10Z\nlastmod: 2022-01-02T10:10:10Z\n---\nContent"},
+		{"Absent", midas.TimestampSettings{Enabled: true}, "---\ntitle: Test\n---\nContent",
+			`{"id": 1, "Title": "Test", "updatedAt": null}`,
+			"---\ntitle: Test\n---\nContent"},
+		{"Partial", midas.TimestampSettings{Enabled: true}, "---\ntitle: Test\n---\nContent",
+			`{"id": 1, "Title": "Test", "updatedAt": "2022-01-02T10:10:10.000Z"}`,
+			"---\ntitle: Test\nlastmod: 2022-01-02T10:10:10Z\n---\nContent"},
+		{"Custom fields", midas.TimestampSettings{Enabled: true, Date: "publishedAt", Lastmod: "editedAt"}, "---\ntitle: Test\n---\n",
+			`{"id": 1, "Title": "Test", "publishedAt": 1641031810, "editedAt": "2022-01-02", "createdAt": "2020-01-01T00:00:00Z"}`,
+			"---\ntitle: Test\ndate: 2022-01-01T10:10:10Z\nlastmod: 2022-01-02T00:00:00Z\n---\n"},
+		{"Set by archetype", midas.TimestampSettings{Enabled: true}, "---\ndate: {{ index .Dates \"date\" }}\n---\n",
+			`{"id": 1, "Title": "Test", "createdAt": "2022-01-01T10:10:10.000Z", "updatedAt": "2022-01-02T10:10:10.000Z"}`,
+			"---\ndate: 2022-01-01T10:10:10Z\nlastmod: 2022-01-02T10:10:10Z\n---\n"},
+		{"TOML", midas.TimestampSettings{Enabled: true}, "+++\ntitle = \"Test\"\n+++\n",
+			`{"id": 1, "Title": "Test", "createdAt": "2022-01-01T10:10:10.000Z", "updatedAt": "2022-01-02T10:10:10.000Z"}`,
+			"+++\ntitle = \"Test\"\ndate = 2022-01-01T10:10:10Z\nlastmod = 2022-01-02T10:10:10Z\n+++\n"},
+		{"Disabled", midas.TimestampSettings{}, "---\ntitle: Test\n---\n",
+			`{"id": 1, "Title": "Test", "createdAt": "2022-01-01T10:10:10.000Z"}`,
+			"---\ntitle: Test\n---\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Timestamps: tt.timestamps},
+			}, map[string]string{
+				"archetypes/post.md": tt.archetype,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", tt.entry))
+			testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+			content, err := os.ReadFile(outputPath)
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Read output error": {err, nil},
+				"Output content":    {string(content), tt.expected},
+			})
+		})
+	}
+}
+
+func TestInjectFrontMatter(t *testing.T) {
+	values := map[string]template.HTML{"date": "2022-01-01T10:10:10Z", "lastmod": ""}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"YAML", "---\ntitle: Test\n---\nBody", "---\ntitle: Test\ndate: 2022-01-01T10:10:10Z\n---\nBody"},
+		{"YAML quoted key", "---\n\"date\": 2020-01-01\n---\n", "---\n\"date\": 2020-01-01\n---\n"},
+		{"YAML nested key", "---\nparams:\n  date: 2020-01-01\n---\n", "---\nparams:\n  date: 2020-01-01\ndate: 2022-01-01T10:10:10Z\n---\n"},
+		{"CRLF", "---\r\ntitle: Test\r\n---\r\n", "---\r\ntitle: Test\r\ndate: 2022-01-01T10:10:10Z\r\n---\r\n"},
+		{"TOML", "+++\ndate = 2020-01-01\n+++\n", "+++\ndate = 2020-01-01\n+++\n"},
+		{"JSON", "{\"title\": \"Test\"}\n", "{\"title\": \"Test\"}\n"},
+		{"No front matter", "Body", "Body"},
+		{"Unclosed", "---\ntitle: Test\n", "---\ntitle: Test\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, injectFrontMatter(tt.content, values), tt.expected, "Content")
+		})
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultDownloadTimeout = 60 * time.Second
+
+// partSuffix is the suffix of the partially downloaded media file, resumed by the retried download.
+const partSuffix = ".part"
+
+// downloadClient is the HTTP client the media are downloaded with.
+var downloadClient = http.DefaultClient
+
+// downloadEntryMedia downloads the media files of the entry (including their formats) missing locally, if enabled in
+// the model, aborting when the context is cancelled. The media of the bundled page are downloaded into its bundle (the
+// directory of the output path) by their file names; the bundle directory left empty by the failed download is
+// removed. Otherwise, the files are stored in the media directory at the paths of their URLs, so they are resolved as
+// the local media (i.e. by the dimensions). The failed downloads are retried as configured, resuming from the
+// downloaded part; the part is removed if the download fails eventually, so no corrupt file is left.
+func (s SiteService) downloadEntryMedia(ctx context.Context, model *midas.ModelSettings, payload midas.Payload, outputPath string) error {
+	settings := model.Media
+	if !settings.Download {
+		return nil
+	}
+	if settings.Dir == "" && model.Bundle == "" {
+		return midas.Errorf(midas.ErrSiteConfig, "media dir is required to download the media")
+	}
+
+	files, err := mediaFiles(settings, payload.Entry())
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for urlPath := range files {
+		paths = append(paths, urlPath)
+	}
+	sort.Strings(paths)
+
+	if model.Bundle != "" {
+		dir := filepath.Dir(outputPath)
+		if err = downloadBundleMedia(ctx, settings, files, paths, dir); err != nil {
+			// Fails unless the directory is empty
+			_ = os.Remove(dir)
+			return err
+		}
+
+		return nil
+	}
+
+	dir := settings.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.Site.RootDir, dir)
+	}
+
+	for _, urlPath := range paths {
+		if err = downloadFile(ctx, settings, files[urlPath], mediaPath(dir, urlPath)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downloadBundleMedia downloads the files at the (sorted) URL paths into the bundle directory, by their names. The
+// files of the same name at different paths can't be placed in the bundle.
+func downloadBundleMedia(ctx context.Context, settings midas.MediaSettings, files map[string]string, paths []string, dir string) error {
+	names := make(map[string]string, len(paths))
+	for _, urlPath := range paths {
+		name := path.Base(urlPath)
+		if existing, ok := names[name]; ok {
+			return midas.Errorf(midas.ErrInvalid, "media %s and %s have the same name", files[existing], files[urlPath])
+		}
+		names[name] = urlPath
+	}
+
+	for _, urlPath := range paths {
+		if err := downloadFile(ctx, settings, files[urlPath], filepath.Join(dir, path.Base(urlPath))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withMediaResources adds the image media of the entry downloaded into the bundle of the page at the output path to
+// the front matter of the content, as the page resources with their dimensions as the params, if enabled in the model.
+// The resources set by the archetype are kept.
+func (s SiteService) withMediaResources(model *midas.ModelSettings, payload midas.Payload, outputPath string, content *bytes.Buffer) (*bytes.Buffer, error) {
+	if !model.Media.Download || !model.Media.Dimensions || model.Bundle == "" {
+		return content, nil
+	}
+
+	resources, err := bundleResources(model.Media, payload.Entry(), filepath.Dir(outputPath))
+	if err != nil || len(resources) == 0 {
+		return content, err
+	}
+
+	rendered := content.String()
+	formatted := formatResources(resources, strings.HasPrefix(rendered, "+++"))
+
+	return bytes.NewBufferString(injectFrontMatter(rendered, map[string]template.HTML{"resources": template.HTML(formatted)})), nil
+}
+
+// mediaFiles returns the URLs of the media objects in the entry (including their formats), resolved against the
+// base URL, by the paths of the URLs.
+func mediaFiles(settings midas.MediaSettings, entry map[string]interface{}) (map[string]string, error) {
+	var base *url.URL
+	if settings.BaseURL != "" {
+		parsed, err := url.Parse(settings.BaseURL)
+		if err != nil || !parsed.IsAbs() {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "media base url %s is invalid", settings.BaseURL)
+		}
+		base = parsed
+	}
+
+	files := make(map[string]string)
+	if err := mediaFilesIn(base, entry, files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// mediaFilesIn iterates (recursively) through given value and adds the files of media objects found.
+func mediaFilesIn(base *url.URL, value interface{}, files map[string]string) error {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		for _, item := range object {
+			if err := mediaFilesIn(base, item, files); err != nil {
+				return err
+			}
+		}
+
+		if !isMedia(object) {
+			return nil
+		}
+
+		original := object["url"].(string)
+		parsed, err := url.Parse(original)
+		if err != nil {
+			return midas.Errorf(midas.ErrInvalid, "media url %s is invalid", original)
+		}
+
+		urlPath := path.Clean("/" + parsed.Path)
+		if urlPath == "/" {
+			return midas.Errorf(midas.ErrInvalid, "media url %s has no file name", original)
+		}
+
+		if !parsed.IsAbs() {
+			if base == nil {
+				return midas.Errorf(midas.ErrSiteConfig, "media base url is required to download %s", original)
+			}
+			parsed = base.ResolveReference(parsed)
+		}
+
+		if existing, ok := files[urlPath]; ok && existing != parsed.String() {
+			return midas.Errorf(midas.ErrInvalid, "media %s and %s have the same path", existing, parsed.String())
+		}
+		files[urlPath] = parsed.String()
+	case []interface{}:
+		for _, item := range value.([]interface{}) {
+			if err := mediaFilesIn(base, item, files); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// downloadFile downloads the file from the URL to the path (unless it exists), through the part file renamed once
+// complete. Missing directories of the path are created.
+func downloadFile(ctx context.Context, settings midas.MediaSettings, fileURL, filePath string) error {
+	if fileExists(filePath) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0775); err != nil {
+		return err
+	}
+
+	timeout := defaultDownloadTimeout
+	if settings.Timeout > 0 {
+		timeout = time.Duration(settings.Timeout * float64(time.Second))
+	}
+
+	partPath := filePath + partSuffix
+	err := midas.Retry(ctx, settings.Retry, func(_ int) error {
+		requestCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := downloadPart(requestCtx, fileURL, partPath)
+		if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			// Only the request timed out, so it's retried
+			return fmt.Errorf("media %s download timed out after %s", fileURL, timeout)
+		}
+
+		return err
+	})
+	if err != nil {
+		_ = os.Remove(partPath)
+		return err
+	}
+
+	if err = os.Rename(partPath, filePath); err != nil {
+		_ = os.Remove(partPath)
+		return err
+	}
+
+	return nil
+}
+
+// downloadPart appends the rest of the file to the part file, requesting the range after its current size. The part
+// is started over if the server doesn't support the range requests.
+func downloadPart(ctx context.Context, fileURL, partPath string) error {
+	part, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = part.Close()
+	}()
+
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return midas.Errorf(midas.ErrInvalid, "media url %s is invalid", fileURL)
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := downloadClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		var start int64
+		if _, err = fmt.Sscanf(response.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			// The part is started over by the next attempt
+			_ = part.Truncate(0)
+			return fmt.Errorf("media %s responded with unexpected range %s", fileURL, response.Header.Get("Content-Range"))
+		}
+	case response.StatusCode == http.StatusOK:
+		// The range isn't supported, so the whole file is downloaded again
+		if err = part.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = part.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		_ = part.Truncate(0)
+		return fmt.Errorf("media %s range from %d is not satisfiable", fileURL, offset)
+	case response.StatusCode == http.StatusNotFound:
+		return midas.Errorf(midas.ErrNotFound, "media %s not found", fileURL)
+	case response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("media %s responded with status %d", fileURL, response.StatusCode)
+	default:
+		return midas.Errorf(midas.ErrInvalid, "media %s responded with status %d", fileURL, response.StatusCode)
+	}
+
+	written, err := io.Copy(part, response.Body)
+	if err != nil {
+		return err
+	}
+	if response.ContentLength >= 0 && written != response.ContentLength {
+		return io.ErrUnexpectedEOF
+	}
+
+	return part.Sync()
+}
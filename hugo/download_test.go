@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const mediaContent = "0123456789abcdefghij"
+
+// mediaServer serves the media content, failing the requests as the fail function returns (by the request number,
+// starting at 1). The Range headers of the requests are recorded.
+type mediaServer struct {
+	mu     sync.Mutex
+	ranges []string
+	fail   func(request int) string
+}
+
+// Media server failures
+const (
+	failNone     = ""
+	failHalfway  = "halfway"  // Connection dropped after half of the content
+	failSlow     = "slow"     // Response delayed beyond the timeout
+	failNotFound = "notFound" // 404
+	failNoRange  = "noRange"  // Range ignored, whole content sent
+)
+
+// setFail replaces the fail function of the running server.
+func (m *mediaServer) setFail(fail func(request int) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fail = fail
+}
+
+func (m *mediaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.ranges = append(m.ranges, r.Header.Get("Range"))
+	failure := failNone
+	if m.fail != nil {
+		failure = m.fail(len(m.ranges))
+	}
+	m.mu.Unlock()
+
+	switch failure {
+	case failNotFound:
+		http.NotFound(w, r)
+		return
+	case failSlow:
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		return
+	case failHalfway:
+		w.Header().Set("Content-Length", fmt.Sprint(len(mediaContent)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(mediaContent[:len(mediaContent)/2]))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	case failNoRange:
+		_, _ = w.Write([]byte(mediaContent))
+		return
+	}
+
+	var start int
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err == nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(mediaContent)-1, len(mediaContent)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(mediaContent[start:]))
+		return
+	}
+
+	_, _ = w.Write([]byte(mediaContent))
+}
+
+func TestDownloadFile(t *testing.T) {
+	settings := midas.MediaSettings{Timeout: 0.2, Retry: midas.RetrySettings{Attempts: 3, Backoff: 0.001}}
+	halfRange := fmt.Sprintf("bytes=%d-", len(mediaContent)/2)
+
+	tests := []struct {
+		name       string
+		fail       func(request int) string
+		cancelled  bool
+		wantRanges string
+		wantErr    func(err error) bool
+	}{
+		{"Downloaded", nil, false, "", nil},
+		{"Resumed", func(request int) string {
+			if request == 1 {
+				return failHalfway
+			}
+			return failNone
+		}, false, "," + halfRange, nil},
+		{"Range not supported", func(request int) string {
+			if request == 1 {
+				return failHalfway
+			}
+			return failNoRange
+		}, false, "," + halfRange, nil},
+		{"Timed out", func(request int) string {
+			if request == 1 {
+				return failSlow
+			}
+			return failNone
+		}, false, ",", nil},
+		{"Failed", func(int) string { return failHalfway }, false, "," + halfRange + "," + halfRange, func(err error) bool {
+			return err != nil && midas.ErrorCode(err) == midas.ErrInternal
+		}},
+		{"Not found", func(int) string { return failNotFound }, false, "", func(err error) bool {
+			return midas.ErrorCode(err) == midas.ErrNotFound
+		}},
+		{"Cancelled", nil, true, "", func(err error) bool { return errors.Is(err, context.Canceled) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &mediaServer{fail: tt.fail}
+			httpServer := httptest.NewServer(server)
+			defer httpServer.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+
+			filePath := filepath.Join(t.TempDir(), "cover.png")
+			err := downloadFile(ctx, settings, httpServer.URL+"/uploads/cover.png", filePath)
+
+			content, _ := os.ReadFile(filePath)
+			wantContent := mediaContent
+			if tt.wantErr != nil {
+				wantContent = ""
+			}
+
+			server.mu.Lock()
+			ranges := strings.Join(server.ranges, ",")
+			server.mu.Unlock()
+
+			assertions := map[string][]interface{}{
+				"Content":       {string(content), wantContent},
+				"Part removed":  {fileExists(filePath + partSuffix), false},
+				"Requests made": {ranges, tt.wantRanges},
+			}
+			if tt.wantErr == nil {
+				assertions["Error"] = []interface{}{err, nil}
+			} else {
+				assertions["Error"] = []interface{}{tt.wantErr(err), true}
+			}
+			if tt.cancelled {
+				delete(assertions, "Requests made")
+			}
+			testing_utils.AssertTable(t, assertions)
+		})
+	}
+
+	t.Run("Existing", func(t *testing.T) {
+		server := &mediaServer{}
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		filePath := filepath.Join(t.TempDir(), "cover.png")
+		if err := os.WriteFile(filePath, []byte("existing"), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		err := downloadFile(context.Background(), settings, httpServer.URL+"/uploads/cover.png", filePath)
+		content, _ := os.ReadFile(filePath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":    {err, nil},
+			"Content":  {string(content), "existing"},
+			"Requests": {len(server.ranges), 0},
+		})
+	})
+}
+
+func TestMediaFiles(t *testing.T) {
+	entry := map[string]interface{}{
+		"cover": map[string]interface{}{"mime": "image/png", "url": "/uploads/cover.png", "formats": map[string]interface{}{
+			"thumbnail": map[string]interface{}{"mime": "image/png", "url": "/uploads/thumbnail_cover.png"},
+		}},
+		"gallery": []interface{}{map[string]interface{}{"mime": "image/jpeg", "url": "https://cdn.example.com/b.jpg"}},
+		"link":    map[string]interface{}{"url": "/about"},
+	}
+
+	tests := []struct {
+		name    string
+		baseURL string
+		entry   map[string]interface{}
+		want    string
+		wantErr string
+	}{
+		{"Resolved", "https://cms.example.com/", entry,
+			"/b.jpg=https://cdn.example.com/b.jpg,/uploads/cover.png=https://cms.example.com/uploads/cover.png,/uploads/thumbnail_cover.png=https://cms.example.com/uploads/thumbnail_cover.png", ""},
+		{"No base url", "", entry, "", midas.ErrSiteConfig},
+		{"Relative base url", "/cms", entry, "", midas.ErrSiteConfig},
+		{"Same path", "https://cms.example.com", map[string]interface{}{"gallery": []interface{}{
+			map[string]interface{}{"mime": "image/png", "url": "/uploads/cover.png"},
+			map[string]interface{}{"mime": "image/png", "url": "https://cdn.example.com/uploads/cover.png"},
+		}}, "", midas.ErrInvalid},
+		{"No file name", "https://cms.example.com", map[string]interface{}{"cover": map[string]interface{}{"mime": "image/png", "url": "/"}}, "", midas.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := mediaFiles(midas.MediaSettings{BaseURL: tt.baseURL}, tt.entry)
+
+			var got []string
+			for urlPath, fileURL := range files {
+				got = append(got, urlPath+"="+fileURL)
+			}
+			sort.Strings(got)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Files":      {strings.Join(got, ","), tt.want},
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+			})
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_DownloadMedia(t *testing.T) {
+	server := &mediaServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	const entry = `{"id": 1, "Title": "Post", "cover": {"mime": "image/png", "url": "/uploads/cover.png", "formats": {
+		"thumbnail": {"mime": "image/png", "url": "/uploads/thumbnail_cover.png"}}}}`
+
+	newSite := func(t *testing.T, media midas.MediaSettings) SiteService {
+		return newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Media: media},
+		}, map[string]string{
+			"archetypes/post.md": `{{ .Entry.cover.url }} {{ .Entry.cover.formats.thumbnail.url }}`,
+		})
+	}
+	settings := midas.MediaSettings{Download: true, Dir: "static", BaseURL: httpServer.URL}
+
+	s := newSite(t, settings)
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry))
+	content, _ := os.ReadFile(outputPath)
+	cover, _ := os.ReadFile(filepath.Join(s.Site.RootDir, "static", "uploads", "cover.png"))
+	thumbnail, _ := os.ReadFile(filepath.Join(s.Site.RootDir, "static", "uploads", "thumbnail_cover.png"))
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":     {err, nil},
+		"Content":   {string(content), "/uploads/cover.png /uploads/thumbnail_cover.png"},
+		"Cover":     {string(cover), mediaContent},
+		"Thumbnail": {string(thumbnail), mediaContent},
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		server.setFail(func(int) string { return failNotFound })
+		defer server.setFail(nil)
+
+		s := newSite(t, settings)
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry))
+		_, readErr := s.registry.ReadEntry("post-1")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":       {midas.ErrorCode(err), midas.ErrNotFound},
+			"Page not written": {fileExists(filepath.Join(s.Site.RootDir, "posts", "post.html")), false},
+			"No part left":     {fileExists(filepath.Join(s.Site.RootDir, "static", "uploads", "cover.png"+partSuffix)), false},
+			"Entry untracked":  {midas.ErrorCode(readErr), midas.ErrNotFound},
+		})
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		s := newSite(t, settings)
+		_, err := s.CreateEntryContext(ctx, mustParsePayload(t, "entry.create", "post", entry))
+		_, readErr := s.registry.ReadEntry("post-1")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Cancelled":       {errors.Is(err, context.Canceled), true},
+			"Not downloaded":  {fileExists(filepath.Join(s.Site.RootDir, "static", "uploads", "cover.png")), false},
+			"Entry untracked": {midas.ErrorCode(readErr), midas.ErrNotFound},
+		})
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		s := newSite(t, midas.MediaSettings{Download: true, BaseURL: httpServer.URL})
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
@@ -0,0 +1,504 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// injectFrontMatter adds the values to the YAML (---) or TOML (+++) front matter of the content, unless the front
+// matter already sets them. Empty values are skipped. Content without such front matter is returned unchanged.
+func injectFrontMatter(content string, values map[string]template.HTML) string {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) < 2 {
+		return content
+	}
+
+	delimiter := strings.TrimSpace(lines[0])
+	separator := ""
+	switch delimiter {
+	case "---":
+		separator = ": "
+	case "+++":
+		separator = " = "
+	default:
+		return content
+	}
+
+	closing := -1
+	for i := 1; i < len(lines); i++ {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			closing = i
+			break
+		}
+	}
+	if closing == -1 {
+		return content
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	newline := "\n"
+	if strings.HasSuffix(lines[0], "\r\n") {
+		newline = "\r\n"
+	}
+
+	var injected []string
+	for _, key := range keys {
+		if values[key] == "" || frontMatterHasKey(lines[1:closing], key, strings.TrimSpace(separator)) {
+			continue
+		}
+
+		injected = append(injected, fmt.Sprintf("%s%s%s%s", key, separator, values[key], newline))
+	}
+
+	output := append(append(lines[:closing:closing], injected...), lines[closing:]...)
+
+	return strings.Join(output, "")
+}
+
+// frontMatterHasKey returns true if any of the top level front matter lines sets the key.
+func frontMatterHasKey(lines []string, key, separator string) bool {
+	keyRegex := regexp.MustCompile(`^["']?` + regexp.QuoteMeta(key) + `["']?\s*` + regexp.QuoteMeta(separator))
+	for _, line := range lines {
+		if keyRegex.MatchString(line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// frontMatterKeyRegex matches the top level key of the YAML (key: value) or TOML (key = value) front matter line,
+// capturing the key and the value.
+var frontMatterKeyRegex = regexp.MustCompile(`^["']?([\w-]+)["']?\s*[:=]\s*(.*?)\s*$`)
+
+// mergeFrontMatter replaces the values of the top level keys of the YAML (---), TOML (+++) or JSON ({}) front matter
+// with the entry fields of the same name (case-insensitive), so the front matter of the archetype holds the defaults.
+// Only the scalar fields replace the single line values. Content without such front matter is returned unchanged.
+func mergeFrontMatter(content string, entry map[string]interface{}) string {
+	if strings.HasPrefix(content, "{") {
+		return mergeJSONFrontMatter(content, entry)
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) < 2 {
+		return content
+	}
+
+	delimiter := strings.TrimSpace(lines[0])
+	if delimiter != "---" && delimiter != "+++" {
+		return content
+	}
+
+	fields := make(map[string]string, len(entry))
+	for key, value := range entry {
+		if formatted, ok := frontMatterValue(value); ok {
+			fields[strings.ToLower(key)] = formatted
+		}
+	}
+
+	inTable := false
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			return strings.Join(lines, "")
+		}
+		// Keys of the TOML tables aren't top level
+		if delimiter == "+++" && strings.HasPrefix(trimmed, "[") {
+			inTable = true
+		}
+		if inTable {
+			continue
+		}
+		// Nested keys and the continuation lines are indented
+		if line != strings.TrimLeft(line, " \t") {
+			continue
+		}
+
+		match := frontMatterKeyRegex.FindStringSubmatchIndex(line)
+		if match == nil || !singleLineValue(line[match[4]:match[5]]) {
+			continue
+		}
+
+		formatted, ok := fields[strings.ToLower(line[match[2]:match[3]])]
+		if !ok {
+			continue
+		}
+
+		// The line ending is kept
+		lines[i] = line[:match[4]] + formatted + lines[i][match[5]:]
+	}
+
+	// No closing delimiter
+	return content
+}
+
+// singleLineValue returns true if the front matter value doesn't continue on the next lines (YAML block scalars and
+// nested values, TOML multi-line strings and arrays).
+func singleLineValue(value string) bool {
+	if value == "" || strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+		return false
+	}
+	if strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''") {
+		return false
+	}
+	if strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") {
+		return false
+	}
+	if strings.HasPrefix(value, "{") && !strings.HasSuffix(value, "}") {
+		return false
+	}
+
+	return true
+}
+
+// frontMatterValue formats the scalar entry field as the front matter value, valid in YAML, TOML and JSON. Returns
+// false for the other fields.
+func frontMatterValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case template.HTML:
+		return frontMatterValue(string(value))
+	case string, bool, float64, float32, int, int64:
+		var encoded bytes.Buffer
+		encoder := json.NewEncoder(&encoded)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			return "", false
+		}
+
+		return strings.TrimSpace(encoded.String()), true
+	default:
+		return "", false
+	}
+}
+
+// mergeJSONFrontMatter merges the entry into the JSON front matter object like mergeFrontMatter. The merged object
+// is written with sorted keys.
+func mergeJSONFrontMatter(content string, entry map[string]interface{}) string {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var frontMatter map[string]interface{}
+	if err := decoder.Decode(&frontMatter); err != nil {
+		return content
+	}
+	rest := content[decoder.InputOffset():]
+
+	fields := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		if _, ok := frontMatterValue(value); ok {
+			if html, isHTML := value.(template.HTML); isHTML {
+				value = string(html)
+			}
+			fields[strings.ToLower(key)] = value
+		}
+	}
+
+	for key, value := range frontMatter {
+		if _, isMap := value.(map[string]interface{}); isMap {
+			continue
+		}
+		if _, isSlice := value.([]interface{}); isSlice {
+			continue
+		}
+
+		if field, ok := fields[strings.ToLower(key)]; ok {
+			frontMatter[key] = field
+		}
+	}
+
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(frontMatter); err != nil {
+		return content
+	}
+
+	return strings.TrimSuffix(encoded.String(), "\n") + rest
+}
+
+// parseFrontMatter returns the top level single line values of the YAML (---), TOML (+++) or JSON ({}) front matter,
+// and the content after it. The nested and multi-line values are skipped. Content without such front matter is
+// returned whole, with no values.
+func parseFrontMatter(content string) (map[string]interface{}, string) {
+	values := make(map[string]interface{})
+
+	if strings.HasPrefix(content, "{") {
+		decoder := json.NewDecoder(strings.NewReader(content))
+		if err := decoder.Decode(&values); err != nil {
+			return map[string]interface{}{}, content
+		}
+
+		return values, content[decoder.InputOffset():]
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) < 2 {
+		return values, content
+	}
+
+	delimiter := strings.TrimSpace(lines[0])
+	if delimiter != "---" && delimiter != "+++" {
+		return values, content
+	}
+
+	inTable := false
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			return values, strings.Join(lines[i+1:], "")
+		}
+		if delimiter == "+++" && strings.HasPrefix(trimmed, "[") {
+			inTable = true
+		}
+		if inTable || line != strings.TrimLeft(line, " \t") {
+			continue
+		}
+
+		match := frontMatterKeyRegex.FindStringSubmatch(line)
+		if match == nil || !singleLineValue(match[2]) {
+			continue
+		}
+
+		values[match[1]] = scalarValue(match[2])
+	}
+
+	// No closing delimiter
+	return map[string]interface{}{}, content
+}
+
+// scalarValue parses the single line front matter value: quoted strings are unquoted, and booleans and numbers are
+// converted. Other values (i.e. inline arrays) are returned as they are.
+func scalarValue(value string) interface{} {
+	switch {
+	case len(value) > 1 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`):
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+	case len(value) > 1 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'"):
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	case value == "true" || value == "false":
+		return value == "true"
+	}
+
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return number
+	}
+
+	return value
+}
+
+// frontMatterBlock is the top level front matter key with all its lines (including the nested values, continuation
+// lines and comments following it), or the whole TOML table.
+type frontMatterBlock struct {
+	key   string
+	table bool
+	start int // Index of the first line
+	lines []string
+}
+
+// frontMatterBlocks splits the YAML or TOML front matter lines (without the delimiters) into the top level blocks.
+// Lines before the first key are skipped.
+func frontMatterBlocks(lines []string, delimiter string) []frontMatterBlock {
+	var blocks []frontMatterBlock
+
+	inTable := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if delimiter == "+++" && strings.HasPrefix(trimmed, "[") {
+			inTable = true
+			blocks = append(blocks, frontMatterBlock{key: trimmed, table: true, start: i})
+		} else if match := frontMatterKeyRegex.FindStringSubmatch(line); match != nil && !inTable && line == strings.TrimLeft(line, " \t") {
+			blocks = append(blocks, frontMatterBlock{key: strings.ToLower(match[1]), start: i})
+		}
+
+		if len(blocks) > 0 {
+			blocks[len(blocks)-1].lines = append(blocks[len(blocks)-1].lines, line)
+		}
+	}
+
+	return blocks
+}
+
+// frontMatterKeys returns the sorted top level keys (and TOML tables) of the YAML, TOML or JSON front matter of the
+// content, lowercased like the keys compared by preserveFrontMatter.
+func frontMatterKeys(content string) []string {
+	var keys []string
+
+	if strings.HasPrefix(content, "{") {
+		var frontMatter map[string]interface{}
+		if err := json.NewDecoder(strings.NewReader(content)).Decode(&frontMatter); err != nil {
+			return nil
+		}
+		for key := range frontMatter {
+			keys = append(keys, strings.ToLower(key))
+		}
+	} else {
+		lines := strings.SplitAfter(content, "\n")
+		delimiter := strings.TrimSpace(lines[0])
+		if delimiter != "---" && delimiter != "+++" {
+			return nil
+		}
+
+		closing := frontMatterClosing(lines, delimiter)
+		if closing == -1 {
+			return nil
+		}
+		for _, block := range frontMatterBlocks(lines[1:closing], delimiter) {
+			keys = append(keys, block.key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// preserveFrontMatter adds the top level keys (and TOML tables) of the existing file front matter missing in the
+// rendered one, so the fields added to the file manually survive the update. The keys generated by the previous
+// rendering (lowercased) aren't preserved, as the rendering dropped them; all the missing keys are, if generated is
+// nil. The rendered values take precedence for the keys in both. Content is returned unchanged, if the front matter
+// formats differ.
+func preserveFrontMatter(rendered, existing string, generated map[string]bool) string {
+	if strings.HasPrefix(rendered, "{") && strings.HasPrefix(existing, "{") {
+		return preserveJSONFrontMatter(rendered, existing, generated)
+	}
+
+	lines := strings.SplitAfter(rendered, "\n")
+	existingLines := strings.SplitAfter(existing, "\n")
+	if len(lines) < 2 || len(existingLines) < 2 {
+		return rendered
+	}
+
+	delimiter := strings.TrimSpace(lines[0])
+	if (delimiter != "---" && delimiter != "+++") || strings.TrimSpace(existingLines[0]) != delimiter {
+		return rendered
+	}
+
+	closing, existingClosing := frontMatterClosing(lines, delimiter), frontMatterClosing(existingLines, delimiter)
+	if closing == -1 || existingClosing == -1 {
+		return rendered
+	}
+
+	// The top level keys are inserted before the first table, so they aren't read as the table keys
+	firstTable := closing
+	keys := make(map[string]bool)
+	for _, block := range frontMatterBlocks(lines[1:closing], delimiter) {
+		keys[block.key] = true
+		if block.table && firstTable == closing {
+			firstTable = 1 + block.start
+		}
+	}
+
+	newline := "\n"
+	if strings.HasSuffix(lines[0], "\r\n") {
+		newline = "\r\n"
+	}
+
+	var preservedKeys, preservedTables []string
+	for _, block := range frontMatterBlocks(existingLines[1:existingClosing], delimiter) {
+		if keys[block.key] || generated[block.key] {
+			continue
+		}
+
+		blockLines := append([]string(nil), block.lines...)
+		if last := len(blockLines) - 1; !strings.HasSuffix(blockLines[last], "\n") {
+			blockLines[last] += newline
+		}
+
+		if block.table {
+			preservedTables = append(preservedTables, blockLines...)
+		} else {
+			preservedKeys = append(preservedKeys, blockLines...)
+		}
+	}
+
+	if len(preservedKeys) == 0 && len(preservedTables) == 0 {
+		return rendered
+	}
+
+	output := append([]string(nil), lines[:firstTable]...)
+	output = append(output, preservedKeys...)
+	output = append(output, lines[firstTable:closing]...)
+	output = append(output, preservedTables...)
+	output = append(output, lines[closing:]...)
+
+	return strings.Join(output, "")
+}
+
+// frontMatterClosing returns the index of the line closing the front matter, or -1 if it isn't closed.
+func frontMatterClosing(lines []string, delimiter string) int {
+	for i := 1; i < len(lines); i++ {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed == delimiter || (delimiter == "---" && trimmed == "...") {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// preserveJSONFrontMatter adds the keys of the existing JSON front matter missing in the rendered one, like
+// preserveFrontMatter. The merged object is written with sorted keys.
+func preserveJSONFrontMatter(rendered, existing string, generated map[string]bool) string {
+	decoder := json.NewDecoder(strings.NewReader(rendered))
+	decoder.UseNumber()
+
+	var frontMatter map[string]interface{}
+	if err := decoder.Decode(&frontMatter); err != nil {
+		return rendered
+	}
+	rest := rendered[decoder.InputOffset():]
+
+	existingDecoder := json.NewDecoder(strings.NewReader(existing))
+	existingDecoder.UseNumber()
+
+	var existingFrontMatter map[string]interface{}
+	if err := existingDecoder.Decode(&existingFrontMatter); err != nil {
+		return rendered
+	}
+
+	keys := make(map[string]bool, len(frontMatter))
+	for key := range frontMatter {
+		keys[strings.ToLower(key)] = true
+	}
+
+	preserved := false
+	for key, value := range existingFrontMatter {
+		if !keys[strings.ToLower(key)] && !generated[strings.ToLower(key)] {
+			frontMatter[key] = value
+			preserved = true
+		}
+	}
+	if !preserved {
+		return rendered
+	}
+
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(frontMatter); err != nil {
+		return rendered
+	}
+
+	return strings.TrimSuffix(encoded.String(), "\n") + rest
+}
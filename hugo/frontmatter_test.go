@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"html/template"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMergeFrontMatter(t *testing.T) {
+	entry := map[string]interface{}{
+		"Title":   "Entry <title>",
+		"author":  "Jane",
+		"weight":  float64(3),
+		"draft":   true,
+		"summary": template.HTML("<p>Summary</p>"),
+		"tags":    []interface{}{"go"},
+		"params":  map[string]interface{}{"color": "red"},
+		"empty":   nil,
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"YAML", "---\ntitle: Default\nauthor: Staff # default author\nlayout: post\nweight: 10\ndraft: false\n---\nBody",
+			"---\ntitle: \"Entry <title>\"\nauthor: \"Jane\"\nlayout: post\nweight: 3\ndraft: true\n---\nBody"},
+		{"YAML quoted key", "---\n\"author\": Staff\n---\n", "---\n\"author\": \"Jane\"\n---\n"},
+		{"YAML nested and block values", "---\nparams:\n  author: Staff\ntags:\n  - hugo\nsummary: |\n  Default\nempty: Default\n---\n",
+			"---\nparams:\n  author: Staff\ntags:\n  - hugo\nsummary: |\n  Default\nempty: Default\n---\n"},
+		{"YAML HTML", "---\nsummary: Default\n---\n", "---\nsummary: \"<p>Summary</p>\"\n---\n"},
+		{"CRLF", "---\r\nauthor: Staff  \r\n---\r\n", "---\r\nauthor: \"Jane\"  \r\n---\r\n"},
+		{"TOML", "+++\ntitle = \"Default\"\ntags = [\"hugo\"]\n[params]\nauthor = \"Staff\"\n+++\n",
+			"+++\ntitle = \"Entry <title>\"\ntags = [\"hugo\"]\n[params]\nauthor = \"Staff\"\n+++\n"},
+		{"TOML multi-line", "+++\nauthor = \"\"\"\nStaff\"\"\"\n+++\n", "+++\nauthor = \"\"\"\nStaff\"\"\"\n+++\n"},
+		{"JSON", "{\n  \"title\": \"Default\",\n  \"layout\": \"post\",\n  \"params\": {\"author\": \"Staff\"}\n}\nBody",
+			"{\n  \"layout\": \"post\",\n  \"params\": {\n    \"author\": \"Staff\"\n  },\n  \"title\": \"Entry <title>\"\n}\nBody"},
+		{"No front matter", "author: Staff", "author: Staff"},
+		{"Unclosed", "---\nauthor: Staff\n", "---\nauthor: Staff\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, mergeFrontMatter(tt.content, entry), tt.expected, "Content")
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantKeys string
+		wantBody string
+	}{
+		{"YAML", "---\ntitle: \"A \\\"quoted\\\" title\"\nsummary: 'It''s'\ndraft: true\nweight: 2\ntags:\n  - go\n---\nbody", `map[draft:true summary:It's title:A "quoted" title weight:2]`, "body"},
+		{"TOML", "+++\ntitle = \"Title\"\n[params]\nnested = 1\n+++\nbody", "map[title:Title]", "body"},
+		{"JSON", "{\"title\": \"Title\", \"draft\": false}\nbody", "map[draft:false title:Title]", "\nbody"},
+		{"None", "<p>body</p>", "map[]", "<p>body</p>"},
+		{"Not closed", "---\ntitle: Title\nbody", "map[]", "---\ntitle: Title\nbody"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, body := parseFrontMatter(tt.content)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Values": {fmt.Sprint(values), tt.wantKeys},
+				"Body":   {body, tt.wantBody},
+			})
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_ArchetypeDefaults(t *testing.T) {
+	archetype := "---\ntitle: {{ index .Entry \"Title\" }}\nauthor: Staff\nlayout: post\n---\n{{ index .Entry \"Content\" }}\n"
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		entry    string
+		expected string
+	}{
+		{"Disabled", false, `{"id": 1, "Title": "First", "Author": "Jane", "Content": "Body"}`, "---\ntitle: First\nauthor: Staff\nlayout: post\n---\nBody\n"},
+		{"Entry wins", true, `{"id": 2, "Title": "Second", "Author": "Jane", "Content": "Body"}`, "---\ntitle: \"Second\"\nauthor: \"Jane\"\nlayout: post\n---\nBody\n"},
+		{"Default kept", true, `{"id": 3, "Title": "Third", "Content": "Body"}`, "---\ntitle: \"Third\"\nauthor: Staff\nlayout: post\n---\nBody\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", ArchetypeDefaults: tt.enabled},
+			}, map[string]string{
+				"archetypes/post.md": archetype,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", tt.entry))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(outputPath)
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Read error": {err, nil},
+				"Content":    {string(content), tt.expected},
+			})
+		})
+	}
+}
+
+func TestPreserveFrontMatter(t *testing.T) {
+	tests := []struct {
+		name      string
+		rendered  string
+		existing  string
+		generated map[string]bool
+		want      string
+	}{
+		{
+			"YAML manual fields",
+			"---\ntitle: New\ndraft: false\n---\nNew body\n",
+			"---\ntitle: Old\nweight: 3\ndraft: true\nresources:\n  - src: cover.jpg\n    title: Cover\n# Manual note\n---\nOld body\n",
+			nil,
+			"---\ntitle: New\ndraft: false\nweight: 3\nresources:\n  - src: cover.jpg\n    title: Cover\n# Manual note\n---\nNew body\n",
+		},
+		{
+			"Case-insensitive keys",
+			"---\nTitle: New\n---\n",
+			"---\ntitle: Old\n---\n",
+			nil,
+			"---\nTitle: New\n---\n",
+		},
+		{
+			"TOML keys before tables",
+			"+++\ntitle = \"New\"\n[params]\nlead = \"New lead\"\n+++\n",
+			"+++\ntitle = \"Old\"\nweight = 3\n[params]\nlead = \"Old lead\"\n[[menu.main]]\nname = \"Blog\"\n+++\n",
+			nil,
+			"+++\ntitle = \"New\"\nweight = 3\n[params]\nlead = \"New lead\"\n[[menu.main]]\nname = \"Blog\"\n+++\n",
+		},
+		{
+			"JSON",
+			"{\"title\": \"New\"}\nbody",
+			"{\"title\": \"Old\", \"weight\": 3}\nold",
+			nil,
+			"{\n  \"title\": \"New\",\n  \"weight\": 3\n}\nbody",
+		},
+		{
+			"Nothing to preserve",
+			"---\ntitle: New\n---\n",
+			"---\ntitle: Old\n---\n",
+			nil,
+			"---\ntitle: New\n---\n",
+		},
+		{
+			"Different formats",
+			"---\ntitle: New\n---\n",
+			"+++\nweight = 3\n+++\n",
+			nil,
+			"---\ntitle: New\n---\n",
+		},
+		{
+			"Generated keys dropped",
+			"---\ntitle: New\n---\n",
+			"---\ntitle: Old\ncover: old.jpg\nweight: 3\n---\n",
+			map[string]bool{"title": true, "cover": true},
+			"---\ntitle: New\nweight: 3\n---\n",
+		},
+		{
+			"JSON generated keys dropped",
+			"{\"title\": \"New\"}\nbody",
+			"{\"title\": \"Old\", \"Cover\": \"old.jpg\", \"weight\": 3}\nold",
+			map[string]bool{"title": true, "cover": true},
+			"{\n  \"title\": \"New\",\n  \"weight\": 3\n}\nbody",
+		},
+		{
+			"No front matter",
+			"<p>New</p>",
+			"---\nweight: 3\n---\n",
+			nil,
+			"<p>New</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, preserveFrontMatter(tt.rendered, tt.existing, tt.generated), tt.want, "Content")
+		})
+	}
+}
+
+func TestFrontMatterKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"YAML", "---\nTitle: Post\nresources:\n  - src: cover.jpg\ndraft: true\n---\nbody", "draft,resources,title"},
+		{"TOML", "+++\ntitle = \"Post\"\n[params]\nlead = \"Lead\"\n+++\n", "[params],title"},
+		{"JSON", "{\"Title\": \"Post\", \"weight\": 3}\nbody", "title,weight"},
+		{"Not closed", "---\ntitle: Post\n", ""},
+		{"No front matter", "<p>Post</p>", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, strings.Join(frontMatterKeys(tt.content), ","), tt.want, "Keys")
+		})
+	}
+}
+
+func TestSiteService_UpdateEntry_PreserveFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		preserve bool
+		want     string
+	}{
+		{"Enabled", true, "---\ntitle: Renamed\nweight: 5\n---\n"},
+		{"Disabled", false, "---\ntitle: Renamed\n---\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", PreserveFrontMatter: tt.preserve},
+			}, map[string]string{
+				"archetypes/post.md": "---\ntitle: {{ index .Entry \"Title\" }}\n{{ with index .Entry \"Cover\" }}cover: {{ . }}\n{{ end }}---\n",
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Post", "Cover": "cover.jpg"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Added by hand; the cover is dropped by the update, as it was rendered
+			if err = os.WriteFile(outputPath, []byte("---\ntitle: Post\ncover: cover.jpg\nweight: 5\n---\n"), 0664); err != nil {
+				t.Fatal(err)
+			}
+
+			outputPath, err = s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`))
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":   {err, nil},
+				"Content": {string(content), tt.want},
+			})
+		})
+	}
+}
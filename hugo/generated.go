@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"strings"
+)
+
+// generatedIdSuffix is appended to the entry id to track the front matter keys of the last rendered entry page in
+// the registry, so the preserved front matter doesn't bring back the keys the rendering stopped generating. The
+// keys are kept as the newline separated list, instead of the path.
+const generatedIdSuffix = "#generated"
+
+// isMetadataId returns true if the registry id tracks the metadata of an entry (its previous slugs or generated
+// front matter keys), not a file.
+func isMetadataId(id string) bool {
+	return isAliasesId(id) || strings.HasSuffix(id, generatedIdSuffix)
+}
+
+// entryGeneratedKeys returns the front matter keys of the last rendered entry page, or nil if they aren't tracked
+// (i.e. the entry was rendered before the front matter was preserved). The caller must hold the entry lock.
+func (s SiteService) entryGeneratedKeys(entryId string) (map[string]bool, error) {
+	keys, err := s.registry.ReadEntry(entryId + generatedIdSuffix)
+	if err != nil {
+		if midas.ErrorCode(err) == midas.ErrNotFound {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	generated := make(map[string]bool)
+	for _, key := range strings.Split(keys, "\n") {
+		if key != "" {
+			generated[key] = true
+		}
+	}
+
+	return generated, nil
+}
+
+// writeEntryGeneratedKeys tracks the front matter keys of the rendered entry page in the registry, removing the
+// registry entry if there are none. The registry isn't flushed. The caller must hold the entry lock.
+func (s SiteService) writeEntryGeneratedKeys(entryId string, keys []string) error {
+	generatedId := entryId + generatedIdSuffix
+
+	_, err := s.registry.ReadEntry(generatedId)
+	if err != nil && midas.ErrorCode(err) != midas.ErrNotFound {
+		return err
+	}
+	tracked := err == nil
+
+	switch {
+	case len(keys) == 0 && tracked:
+		return s.registry.DeleteEntry(generatedId)
+	case len(keys) == 0:
+		return nil
+	case tracked:
+		return s.registry.UpdateEntry(generatedId, strings.Join(keys, "\n"))
+	default:
+		return s.registry.CreateEntry(generatedId, strings.Join(keys, "\n"))
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// defaultSinglePageDir is the directory of the home page (or other single type page), if the model has no output
+	// directory configured.
+	defaultSinglePageDir = "content"
+	homePageFilename     = "_index.md"
+)
+
+// updateSinglePage renders the single type with its archetype to the file of given name in the model output
+// directory, i.e. as the site home page (_index.md). The page is not tracked in the registry and is always
+// overwritten, as the single type has only one entry.
+func (s SiteService) updateSinglePage(model *midas.ModelSettings, modelName string, payload midas.Payload, filename string) (string, error) {
+	if filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) {
+		return "", midas.Errorf(midas.ErrSiteConfig, "output file %s of model %s must be a file name", filename, modelName)
+	}
+
+	outputDir := model.OutputDir
+	if outputDir == "" {
+		outputDir = defaultSinglePageDir
+	}
+	if !filepath.IsAbs(outputDir) {
+		outputDir = filepath.Join(s.Site.RootDir, outputDir)
+	}
+
+	// Render before opening the file, so the current page is kept if rendering fails
+	content, err := s.renderPage(model, modelName, payload, nil)
+	if err != nil {
+		return "", err
+	}
+	outputPath := filepath.Join(outputDir, filename)
+
+	if err = os.MkdirAll(outputDir, 0775); err != nil {
+		return "", err
+	}
+
+	// The current page is restored, if the post-write hook fails
+	if err = s.writePage(model, outputPath, content); err != nil {
+		return "", err
+	}
+
+	return outputPath, nil
+}
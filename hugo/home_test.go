@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSiteService_UpdateSingle_HomePage(t *testing.T) {
+	s := newTestSite(t, nil, map[string]string{
+		"archetypes/homepage.md": `---
+title: {{ index .Entry "Headline" }}
+---
+{{ .Body }}`,
+	})
+
+	bodyField := "Content"
+	homepage := midas.ModelSettings{ArchetypePath: "archetypes/homepage.md", HomePage: true}
+	homepage.Fields.Body = &bodyField
+	s.Site.SingleTypes = map[string]midas.ModelSettings{
+		"homepage": homepage,
+		"landing":  {Archetype: `title: {{ index .Entry "Headline" }}`, OutputDir: "content/landing", HomePage: true},
+		"settings": {OutputDir: "data"},
+	}
+
+	homePath := filepath.Join(s.Site.RootDir, "content", "_index.md")
+
+	tests := []struct {
+		name     string
+		entry    string
+		expected string
+	}{
+		{"Created", `{"id": 1, "Headline": "Welcome", "Content": "Hello"}`, "---\ntitle: Welcome\n---\nHello"},
+		{"Overwritten", `{"id": 1, "Headline": "Welcome back", "Content": "Hi"}`, "---\ntitle: Welcome back\n---\nHi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "homepage", tt.entry))
+			content, _ := os.ReadFile(homePath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":       {err, nil},
+				"Output path": {outputPath, homePath},
+				"Content":     {string(content), tt.expected},
+			})
+		})
+	}
+
+	t.Run("Configured directory", func(t *testing.T) {
+		outputPath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "landing", `{"id": 1, "Headline": "Landing"}`))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":       {err, nil},
+			"Output path": {outputPath, filepath.Join(s.Site.RootDir, "content", "landing", "_index.md")},
+			"Content":     {string(content), "title: Landing"},
+		})
+	})
+
+	t.Run("Failed render keeps home page", func(t *testing.T) {
+		invalid := homepage
+		invalid.Archetype = `title: {{ index .Entry "Headline" "x" }}`
+		s.Site.SingleTypes["homepage"] = invalid
+
+		_, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "homepage", `{"id": 1, "Headline": "Broken"}`))
+		content, _ := os.ReadFile(homePath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Failed":  {err != nil, true},
+			"Content": {string(content), "---\ntitle: Welcome back\n---\nHi"},
+		})
+	})
+
+	t.Run("Data single type", func(t *testing.T) {
+		outputPath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "settings", `{"id": 1, "Headline": "Data"}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":       {err, nil},
+			"Output path": {outputPath, filepath.Join(s.Site.RootDir, "data", "settings.json")},
+		})
+	})
+}
+
+func TestSiteService_UpdateSingle_OutputFile(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {Archetype: `title: {{ index .Entry "Title" }}`, OutputDir: "content"},
+	}, nil)
+	s.Site.SingleTypes = map[string]midas.ModelSettings{
+		"about":   {Archetype: `title: {{ index .Entry "Headline" }}`, OutputFile: "about.md"},
+		"nested":  {Archetype: `title: {{ index .Entry "Headline" }}`, OutputFile: "../about.md"},
+		"contact": {Archetype: `title: {{ index .Entry "Headline" }}`, OutputDir: "content/contact", OutputFile: "index.md"},
+	}
+
+	aboutPath := filepath.Join(s.Site.RootDir, "content", "about.md")
+	if err := os.MkdirAll(filepath.Dir(aboutPath), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(aboutPath, []byte("untracked"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		entry    string
+		expected string
+	}{
+		{"Existing file overwritten", `{"id": 1, "Headline": "About us"}`, "title: About us"},
+		{"Overwritten again", `{"id": 1, "Headline": "About"}`, "title: About"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "about", tt.entry))
+			content, _ := os.ReadFile(aboutPath)
+			entries, _ := os.ReadDir(filepath.Dir(aboutPath))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":       {err, nil},
+				"Output path": {outputPath, aboutPath},
+				"Content":     {string(content), tt.expected},
+				"Files":       {len(entries), 1},
+			})
+		})
+	}
+
+	t.Run("Configured directory", func(t *testing.T) {
+		outputPath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "contact", `{"id": 1, "Headline": "Contact"}`))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":       {err, nil},
+			"Output path": {outputPath, filepath.Join(s.Site.RootDir, "content", "contact", "index.md")},
+			"Content":     {string(content), "title: Contact"},
+		})
+	})
+
+	t.Run("Path rejected", func(t *testing.T) {
+		_, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "nested", `{"id": 1, "Headline": "Nested"}`))
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+
+	t.Run("Collection doesn't overwrite", func(t *testing.T) {
+		_, createErr := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "About"}`))
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "About"}`))
+		content, _ := os.ReadFile(filepath.Join(s.Site.RootDir, "content", "about.html"))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Create error": {createErr, nil},
+			"Error code":   {midas.ErrorCode(err), midas.ErrInvalid},
+			"Content":      {string(content), "title: About"},
+		})
+	})
+}
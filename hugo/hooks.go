@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"os/exec"
+	"strings"
+)
+
+// transformPayload applies the transformers of the payload model to the payload entry, in order. The entry passed to
+// the first transformer is a copy, so the original entry map isn't modified.
+func (s SiteService) transformPayload(payload midas.Payload) error {
+	modelName, _ := payload.Metadata()["model"].(string)
+	model, _ := s.getModel(modelName)
+	if model == nil || len(model.Transformers) == 0 {
+		return nil
+	}
+
+	entry := make(map[string]interface{}, len(payload.Entry()))
+	for key, value := range payload.Entry() {
+		entry[key] = value
+	}
+
+	for _, name := range model.Transformers {
+		transformer, ok := midas.PayloadTransformers[name]
+		if !ok {
+			return midas.Errorf(midas.ErrSiteConfig, "payload transformer %s is not registered", name)
+		}
+
+		transformed, err := transformer(entry)
+		if err != nil {
+			return midas.Errorf(midas.ErrInternal, "payload transformer %s failed: %s", name, err)
+		}
+		if transformed == nil {
+			return midas.Errorf(midas.ErrInternal, "payload transformer %s returned no entry", name)
+		}
+
+		entry = transformed
+	}
+
+	payload.SetEntry(entry)
+	return nil
+}
+
+// postWrite runs the post-write hook and command of the model on the written file. The command output
+// is included in the returned error.
+func (s SiteService) postWrite(model *midas.ModelSettings, path string) error {
+	settings := model.PostWrite
+
+	if settings.Hook != "" {
+		hook, ok := midas.PostWriteHooks[settings.Hook]
+		if !ok {
+			return midas.Errorf(midas.ErrSiteConfig, "post-write hook %s is not registered", settings.Hook)
+		}
+
+		if err := hook(s.Site, path); err != nil {
+			return midas.Errorf(midas.ErrInternal, "post-write hook %s failed: %s", settings.Hook, err)
+		}
+	}
+
+	if len(settings.Command) > 0 {
+		arg := append(append([]string{}, settings.Command[1:]...), path)
+
+		cmd := exec.Command(settings.Command[0], arg...)
+		cmd.Dir = s.Site.RootDir
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return midas.Errorf(midas.ErrInternal, "post-write command %s failed: %s\ncommand output: %s", strings.Join(settings.Command, " "), err, out)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSiteService_PostWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("post-write commands use sh")
+	}
+
+	previous := midas.PostWriteHooks
+	midas.PostWriteHooks = map[string]midas.PostWriteHook{
+		"banner": func(_ midas.Site, path string) error {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			return os.WriteFile(path, append([]byte("<!-- generated -->\n"), content...), 0664)
+		},
+		"broken": func(_ midas.Site, _ string) error {
+			return errors.New("hook broke")
+		},
+	}
+	t.Cleanup(func() {
+		midas.PostWriteHooks = previous
+	})
+
+	appendFooter := []string{"sh", "-c", `echo "<!-- footer -->" >> "$0"`}
+
+	tests := []struct {
+		name        string
+		settings    midas.PostWriteSettings
+		wantContent string
+		wantErr     string
+	}{
+		{"Hook", midas.PostWriteSettings{Hook: "banner"}, "<!-- generated -->\ntitle: First", ""},
+		{"Command", midas.PostWriteSettings{Command: appendFooter}, "title: First<!-- footer -->\n", ""},
+		{"Hook and command", midas.PostWriteSettings{Hook: "banner", Command: appendFooter}, "<!-- generated -->\ntitle: First<!-- footer -->\n", ""},
+		{"Failing command", midas.PostWriteSettings{Command: []string{"sh", "-c", "echo prettier failed; exit 2"}}, "", "prettier failed"},
+		{"Failing hook", midas.PostWriteSettings{Hook: "broken"}, "", "hook broke"},
+		{"Unregistered hook", midas.PostWriteSettings{Hook: "missing"}, "", "not registered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", PostWrite: tt.settings},
+			}, map[string]string{
+				"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+			if tt.wantErr != "" {
+				_, statErr := os.Stat(outputPath)
+				entries, _ := s.registry.ReadEntries()
+
+				testing_utils.AssertTable(t, map[string][]interface{}{
+					"Error":        {err != nil && strings.Contains(err.Error(), tt.wantErr), true},
+					"File removed": {outputPath == "" || errors.Is(statErr, os.ErrNotExist), true},
+					"Registered":   {len(entries), 0},
+				})
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CreateEntry() error = %v", err)
+			}
+
+			content, _ := os.ReadFile(outputPath)
+			testing_utils.AssertEquals(t, string(content), tt.wantContent, "Content")
+		})
+	}
+
+	t.Run("Update and single", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", PostWrite: midas.PostWriteSettings{Hook: "banner"}},
+		}, map[string]string{
+			"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+		})
+		s.Site.SingleTypes = map[string]midas.ModelSettings{
+			"settings": {OutputDir: "data", PostWrite: midas.PostWriteSettings{Hook: "banner"}},
+		}
+
+		updatedPath, updateErr := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Updated"}`))
+		singlePath, singleErr := s.UpdateSingle(mustParsePayload(t, "entry.update", "settings", `{"id": 1}`))
+
+		updated, _ := os.ReadFile(updatedPath)
+		single, _ := os.ReadFile(singlePath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Update error":  {updateErr, nil},
+			"Single error":  {singleErr, nil},
+			"Update banner": {strings.HasPrefix(string(updated), "<!-- generated -->\n"), true},
+			"Single banner": {strings.HasPrefix(string(single), "<!-- generated -->\n"), true},
+		})
+	})
+
+	t.Run("Failing update", func(t *testing.T) {
+		for name, title := range map[string]string{"Same file": "First", "Renamed": "Renamed"} {
+			t.Run(name, func(t *testing.T) {
+				s := newTestSite(t, map[string]midas.ModelSettings{
+					"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+				}, map[string]string{
+					"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+				})
+
+				oldPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				model := s.Site.CollectionTypes["post"]
+				model.PostWrite = midas.PostWriteSettings{Hook: "broken"}
+				s.Site.CollectionTypes["post"] = model
+
+				_, err = s.UpdateEntry(mustParsePayload(t, "entry.update", "post", fmt.Sprintf(`{"id": 1, "Title": "%s", "Body": "changed"}`, title)))
+
+				content, _ := os.ReadFile(oldPath)
+				_, newErr := os.Stat(filepath.Join(filepath.Dir(oldPath), "renamed.html"))
+				registered, _ := s.registry.ReadEntry("post-1")
+
+				testing_utils.AssertTable(t, map[string][]interface{}{
+					"Error":       {err != nil && strings.Contains(err.Error(), "hook broke"), true},
+					"Old kept":    {string(content), "title: First"},
+					"New removed": {errors.Is(newErr, os.ErrNotExist), true},
+					"Registered":  {registered, oldPath},
+				})
+			})
+		}
+	})
+
+	t.Run("Failing overwrite", func(t *testing.T) {
+		s := newTestSite(t, nil, map[string]string{
+			"archetypes/home.md": `title: {{ index .Entry "Title" }}`,
+		})
+		s.Site.SingleTypes = map[string]midas.ModelSettings{
+			"home":     {ArchetypePath: "archetypes/home.md", OutputDir: "content", HomePage: true},
+			"settings": {OutputDir: "data"},
+		}
+
+		homePath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "home", `{"id": 1, "Title": "Home"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		singlePath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "settings", `{"id": 1, "Title": "Settings"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		written, _ := os.ReadFile(singlePath)
+
+		for name, model := range s.Site.SingleTypes {
+			model.PostWrite = midas.PostWriteSettings{Hook: "broken"}
+			s.Site.SingleTypes[name] = model
+		}
+
+		_, homeErr := s.UpdateSingle(mustParsePayload(t, "entry.update", "home", `{"id": 1, "Title": "Changed"}`))
+		_, singleErr := s.UpdateSingle(mustParsePayload(t, "entry.update", "settings", `{"id": 1, "Title": "Changed"}`))
+
+		home, _ := os.ReadFile(homePath)
+		single, _ := os.ReadFile(singlePath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Home error":   {homeErr != nil && strings.Contains(homeErr.Error(), "hook broke"), true},
+			"Single error": {singleErr != nil && strings.Contains(singleErr.Error(), "hook broke"), true},
+			"Home kept":    {string(home), "title: Home"},
+			"Single kept":  {string(single), string(written)},
+		})
+	})
+}
+
+func TestSiteService_TransformPayload(t *testing.T) {
+	previous := midas.PayloadTransformers
+	midas.PayloadTransformers = map[string]midas.PayloadTransformer{
+		"readingTime": func(entry map[string]interface{}) (map[string]interface{}, error) {
+			content, _ := entry["Content"].(string)
+			entry["ReadingTime"] = fmt.Sprintf("%d min", len(strings.Fields(content))/2+1)
+			return entry, nil
+		},
+		"shout": func(entry map[string]interface{}) (map[string]interface{}, error) {
+			title, _ := entry["Title"].(string)
+			transformed := map[string]interface{}{}
+			for key, value := range entry {
+				transformed[key] = value
+			}
+			transformed["Title"] = strings.ToUpper(title)
+			return transformed, nil
+		},
+		"broken": func(_ map[string]interface{}) (map[string]interface{}, error) {
+			return nil, errors.New("transformer broke")
+		},
+	}
+	t.Cleanup(func() {
+		midas.PayloadTransformers = previous
+	})
+
+	archetype := `{{ index .Entry "Title" }} ({{ index .Entry "ReadingTime" }})`
+
+	tests := []struct {
+		name         string
+		transformers []string
+		wantPath     string
+		wantContent  string
+		wantCode     string
+	}{
+		{"None", nil, "first-post.html", "First post ()", ""},
+		{"Computed field", []string{"readingTime"}, "first-post.html", "First post (3 min)", ""},
+		{"Chained", []string{"readingTime", "shout"}, "first-post.html", "FIRST POST (3 min)", ""},
+		{"Failing", []string{"readingTime", "broken"}, "", "", midas.ErrInternal},
+		{"Unregistered", []string{"missing"}, "", "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Transformers: tt.transformers},
+			}, map[string]string{
+				"archetypes/post.md": archetype,
+			})
+
+			payload := mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First post", "Content": "one two three four five"}`)
+			original := payload.Entry()
+
+			outputPath, err := s.CreateEntry(payload)
+			if tt.wantCode != "" {
+				testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, _ := os.ReadFile(outputPath)
+			_, modified := original["ReadingTime"]
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"File":              {filepath.Base(outputPath), tt.wantPath},
+				"Content":           {string(content), tt.wantContent},
+				"Original modified": {modified, false},
+			})
+		})
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Transformers: []string{"readingTime"}},
+		}, map[string]string{
+			"archetypes/post.md": archetype,
+		})
+
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Updated", "Content": "one"}`))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Content": {string(content), "Updated (1 min)"},
+		})
+	})
+}
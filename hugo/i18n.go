@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLocaleField = "locale"
+
+// defaultLanguage returns the default content language, or ErrSiteConfig if the languages are misconfigured.
+func (s SiteService) defaultLanguage() (string, error) {
+	settings := s.Site.I18n
+	if len(settings.Languages) == 0 {
+		return "", midas.Errorf(midas.ErrSiteConfig, "i18n of site %s has no languages", s.Site.SiteName)
+	}
+
+	if settings.DefaultLanguage == "" {
+		return settings.Languages[0], nil
+	}
+
+	for _, language := range settings.Languages {
+		if strings.EqualFold(language, settings.DefaultLanguage) {
+			return language, nil
+		}
+	}
+
+	return "", midas.Errorf(midas.ErrSiteConfig, "default language %s is not one of the languages", settings.DefaultLanguage)
+}
+
+// entryLanguage returns the language of the entry matching its locale, and true if it's the default language. The
+// entries without the locale are in the default language. Returns empty language if the i18n isn't enabled.
+func (s SiteService) entryLanguage(entry map[string]interface{}) (string, bool, error) {
+	settings := s.Site.I18n
+	if !settings.Enabled {
+		return "", true, nil
+	}
+
+	defaultLanguage, err := s.defaultLanguage()
+	if err != nil {
+		return "", false, err
+	}
+
+	field := settings.LocaleField
+	if field == "" {
+		field = defaultLocaleField
+	}
+
+	locale := ""
+	if entry[field] != nil {
+		locale = fmt.Sprintf("%v", entry[field])
+	}
+	if locale == "" {
+		return defaultLanguage, true, nil
+	}
+
+	for _, language := range settings.Languages {
+		if strings.EqualFold(language, locale) {
+			return language, language == defaultLanguage, nil
+		}
+	}
+
+	return "", false, midas.Errorf(midas.ErrInvalid, "locale %s is not one of the site languages", locale)
+}
+
+// languageSuffix returns the language suffix of the entry files (i.e. ".fr"), or empty for the entries in the default
+// language.
+func (s SiteService) languageSuffix(entry map[string]interface{}) (string, error) {
+	language, isDefault, err := s.entryLanguage(entry)
+	if err != nil || isDefault {
+		return "", err
+	}
+
+	return "." + language, nil
+}
+
+// pageLanguageSuffix returns the language suffix of the entry page file name, empty if the languages are written to
+// their directories.
+func (s SiteService) pageLanguageSuffix(entry map[string]interface{}) (string, error) {
+	if s.Site.I18n.ByDirectory {
+		// The locale is still validated
+		_, _, err := s.entryLanguage(entry)
+		return "", err
+	}
+
+	return s.languageSuffix(entry)
+}
+
+// withLanguageSuffix inserts the language suffix before the extension of the file name.
+func withLanguageSuffix(name, suffix string) string {
+	extension := filepath.Ext(name)
+	return strings.TrimSuffix(name, extension) + suffix + extension
+}
+
+// i18nContentDir returns the absolute content directory holding the language content directories.
+func (s SiteService) i18nContentDir() string {
+	contentDir := s.Site.I18n.ContentDir
+	if contentDir == "" {
+		contentDir = defaultContentDir
+	}
+	if !filepath.IsAbs(contentDir) {
+		contentDir = filepath.Join(s.Site.RootDir, contentDir)
+	}
+
+	return filepath.Clean(contentDir)
+}
+
+// languageDir returns the absolute content directory of the language.
+func (s SiteService) languageDir(language string) string {
+	for configured, dir := range s.Site.I18n.ContentDirs {
+		if !strings.EqualFold(configured, language) {
+			continue
+		}
+
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(s.Site.RootDir, dir)
+		}
+		return filepath.Clean(dir)
+	}
+
+	return filepath.Join(s.i18nContentDir(), language)
+}
+
+// localizedDir returns the (absolute) output directory placed in the content directory of the language, if the
+// languages are written to their directories. The directories outside the content directory are kept.
+func (s SiteService) localizedDir(dir, language string) string {
+	if !s.Site.I18n.Enabled || !s.Site.I18n.ByDirectory || language == "" {
+		return dir
+	}
+
+	rel, err := filepath.Rel(s.i18nContentDir(), dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return dir
+	}
+
+	return filepath.Join(s.languageDir(language), rel)
+}
+
+// entryLocalizedDir returns the output directory placed in the content directory of the entry language, like
+// localizedDir. The directory is kept for the entry with the unknown locale, which is rejected when its path is
+// resolved.
+func (s SiteService) entryLocalizedDir(dir string, entry map[string]interface{}) string {
+	language, _, err := s.entryLanguage(entry)
+	if err != nil {
+		return dir
+	}
+
+	return s.localizedDir(dir, language)
+}
+
+// localizedDirs returns the (absolute) output directory placed in the content directories of all the languages, or
+// the directory itself if the languages aren't written to their directories.
+func (s SiteService) localizedDirs(dir string) []string {
+	if !s.Site.I18n.Enabled || !s.Site.I18n.ByDirectory {
+		return []string{dir}
+	}
+
+	dirs := make([]string, 0, len(s.Site.I18n.Languages))
+	for _, language := range s.Site.I18n.Languages {
+		dirs = append(dirs, s.localizedDir(dir, language))
+	}
+
+	return dirs
+}
+
+// fileLanguage returns the language of the entry file, and the path of the file in the default language (without
+// the language suffix, or placed in the content directory instead of the language directory). Returns empty
+// language if the i18n isn't enabled.
+func (s SiteService) fileLanguage(path string) (string, string) {
+	if !s.Site.I18n.Enabled {
+		return "", path
+	}
+
+	defaultLanguage, err := s.defaultLanguage()
+	if err != nil {
+		return "", path
+	}
+
+	if s.Site.I18n.ByDirectory {
+		for _, language := range s.Site.I18n.Languages {
+			rel, err := filepath.Rel(s.languageDir(language), path)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return language, filepath.Join(s.i18nContentDir(), rel)
+			}
+		}
+
+		return defaultLanguage, path
+	}
+
+	extension := filepath.Ext(path)
+	for _, language := range s.Site.I18n.Languages {
+		if suffix := "." + language + extension; strings.HasSuffix(strings.ToLower(path), strings.ToLower(suffix)) {
+			return language, path[:len(path)-len(suffix)] + extension
+		}
+	}
+
+	return defaultLanguage, path
+}
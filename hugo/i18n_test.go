@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newI18nTestSite returns the test site with the posts localized to en (default), fr and de.
+func newI18nTestSite(t *testing.T, byDirectory bool, model midas.ModelSettings) SiteService {
+	t.Helper()
+
+	model.ArchetypePath = "archetypes/post.md"
+	s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }} aliases: {{ .Aliases }}`,
+	})
+	s.Site.EntryIdPath = "documentId"
+	s.Site.I18n = midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr", "de"}, ByDirectory: byDirectory}
+
+	return s
+}
+
+// localizedEntry returns the entry of the document in the locale.
+func localizedEntry(title, locale string) string {
+	if locale == "" {
+		return fmt.Sprintf(`{"id": 1, "documentId": "abc", "Title": "%s"}`, title)
+	}
+
+	return fmt.Sprintf(`{"id": 1, "documentId": "abc", "Title": "%s", "locale": "%s"}`, title, locale)
+}
+
+func TestSiteService_entryLanguage(t *testing.T) {
+	tests := []struct {
+		name        string
+		settings    midas.I18nSettings
+		entry       map[string]interface{}
+		want        string
+		wantDefault bool
+		wantErr     string
+	}{
+		{"Disabled", midas.I18nSettings{Languages: []string{"en", "fr"}}, map[string]interface{}{"locale": "fr"}, "", true, ""},
+		{"No locale", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}}, map[string]interface{}{}, "en", true, ""},
+		{"Default", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}}, map[string]interface{}{"locale": "en"}, "en", true, ""},
+		{"Other", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}}, map[string]interface{}{"locale": "fr"}, "fr", false, ""},
+		{"Case insensitive", midas.I18nSettings{Enabled: true, Languages: []string{"en", "pt-br"}}, map[string]interface{}{"locale": "pt-BR"}, "pt-br", false, ""},
+		{"Default language", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}, DefaultLanguage: "fr"}, map[string]interface{}{}, "fr", true, ""},
+		{"Locale field", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}, LocaleField: "lang"}, map[string]interface{}{"locale": "en", "lang": "fr"}, "fr", false, ""},
+		{"Unknown locale", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}}, map[string]interface{}{"locale": "it"}, "", false, midas.ErrInvalid},
+		{"No languages", midas.I18nSettings{Enabled: true}, map[string]interface{}{}, "", false, midas.ErrSiteConfig},
+		{"Unknown default language", midas.I18nSettings{Enabled: true, Languages: []string{"en", "fr"}, DefaultLanguage: "de"}, map[string]interface{}{}, "", false, midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, nil, nil)
+			s.Site.I18n = tt.settings
+
+			language, isDefault, err := s.entryLanguage(tt.entry)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Language":   {language, tt.want},
+				"Default":    {isDefault, tt.wantDefault},
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+			})
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_I18n(t *testing.T) {
+	tests := []struct {
+		name        string
+		byDirectory bool
+		model       midas.ModelSettings
+		wantPaths   map[string]string
+	}{
+		{"Suffix", false, midas.ModelSettings{OutputDir: "content/posts"}, map[string]string{
+			"": "content/posts/post.html", "en": "content/posts/post.html", "fr": "content/posts/post.fr.html", "de": "content/posts/post.de.html",
+		}},
+		{"Suffix bundle", false, midas.ModelSettings{OutputDir: "content/posts", Bundle: "leaf", BundleIndex: "index.md"}, map[string]string{
+			"": "content/posts/post/index.md", "fr": "content/posts/post/index.fr.md", "de": "content/posts/post/index.de.md",
+		}},
+		{"Directory", true, midas.ModelSettings{OutputDir: "content/posts"}, map[string]string{
+			"": "content/en/posts/post.html", "en": "content/en/posts/post.html", "fr": "content/fr/posts/post.html", "de": "content/de/posts/post.html",
+		}},
+		{"Directory permalink", true, midas.ModelSettings{OutputDir: "content/posts", Permalink: "archive/:slug"}, map[string]string{
+			"fr": "content/fr/posts/archive/post.html",
+		}},
+		{"Directory outside content", true, midas.ModelSettings{OutputDir: "pages"}, map[string]string{
+			"fr": "pages/post.html",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for locale, wantPath := range tt.wantPaths {
+				t.Run(locale, func(t *testing.T) {
+					s := newI18nTestSite(t, tt.byDirectory, tt.model)
+
+					outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", localizedEntry("Post", locale)))
+					rel, _ := filepath.Rel(s.Site.RootDir, outputPath)
+
+					testing_utils.AssertTable(t, map[string][]interface{}{
+						"Error": {err, nil},
+						"Path":  {filepath.ToSlash(rel), wantPath},
+					})
+				})
+			}
+		})
+	}
+}
+
+func TestSiteService_EntryId_I18n(t *testing.T) {
+	s := newI18nTestSite(t, false, midas.ModelSettings{OutputDir: "posts"})
+
+	for locale, want := range map[string]string{"": "post-abc", "en": "post-abc", "fr": "post-abc@fr", "de": "post-abc@de"} {
+		t.Run(locale, func(t *testing.T) {
+			entryId, err := s.EntryId(mustParsePayload(t, "entry.create", "post", localizedEntry("Post", locale)))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":    {err, nil},
+				"Entry id": {entryId, want},
+			})
+		})
+	}
+
+	t.Run("Unknown locale", func(t *testing.T) {
+		_, err := s.EntryId(mustParsePayload(t, "entry.create", "post", localizedEntry("Post", "it")))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Error code")
+	})
+}
+
+func TestSiteService_UpdateEntry_I18n(t *testing.T) {
+	for _, byDirectory := range []bool{false, true} {
+		t.Run(fmt.Sprintf("By directory %v", byDirectory), func(t *testing.T) {
+			s := newI18nTestSite(t, byDirectory, midas.ModelSettings{OutputDir: "content/posts", DataDir: "data/posts", AliasOnRename: true})
+
+			paths := map[string]string{}
+			for _, locale := range []string{"en", "fr", "de"} {
+				path, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", localizedEntry("Post", locale)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				paths[locale] = path
+			}
+
+			frPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", localizedEntry("Article", "fr")))
+			frContent, _ := os.ReadFile(frPath)
+			enContent, _ := os.ReadFile(paths["en"])
+			_, oldFrErr := os.Stat(paths["fr"])
+			_, frDataErr := os.Stat(filepath.Join(s.Site.RootDir, "data", "posts", "article.fr.json"))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":           {err, nil},
+				"French content":  {string(frContent), `Article aliases: ["post"]`},
+				"Old French":      {os.IsNotExist(oldFrErr), true},
+				"French data":     {frDataErr, nil},
+				"English content": {string(enContent), `Post aliases: []`},
+			})
+
+			t.Run("Deleted", func(t *testing.T) {
+				_, err := s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", localizedEntry("Article", "fr")))
+				_, frErr := os.Stat(frPath)
+				_, enErr := os.Stat(paths["en"])
+				_, deErr := os.Stat(paths["de"])
+				_, enDataErr := os.Stat(filepath.Join(s.Site.RootDir, "data", "posts", "post.json"))
+
+				testing_utils.AssertTable(t, map[string][]interface{}{
+					"Error":        {err, nil},
+					"French":       {os.IsNotExist(frErr), true},
+					"English kept": {enErr, nil},
+					"German kept":  {deErr, nil},
+					"English data": {enDataErr, nil},
+				})
+			})
+		})
+	}
+}
+
+func TestSiteService_entryURL_I18n(t *testing.T) {
+	tests := []struct {
+		name        string
+		byDirectory bool
+		path        string
+		want        string
+	}{
+		{"Suffix default", false, "content/posts/post.html", "/posts/post/"},
+		{"Suffix", false, "content/posts/post.fr.html", "/fr/posts/post/"},
+		{"Suffix bundle", false, "content/posts/post/index.de.md", "/de/posts/post/"},
+		{"Directory default", true, "content/en/posts/post.html", "/posts/post/"},
+		{"Directory", true, "content/fr/posts/post.html", "/fr/posts/post/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newI18nTestSite(t, tt.byDirectory, midas.ModelSettings{})
+			testing_utils.AssertEquals(t, s.entryURL(filepath.Join(s.Site.RootDir, tt.path)), tt.want, "URL")
+		})
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"sync"
+)
+
+// entryLocks serializes the operations on the site entries. By default, all operations on the site are serialized;
+// with per-entry locking enabled, only operations on the same entry are serialized.
+type entryLocks struct {
+	perEntry bool
+
+	site    sync.Mutex
+	all     sync.RWMutex
+	mu      sync.Mutex
+	entries map[string]*entryLock
+}
+
+type entryLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newEntryLocks(perEntry bool) *entryLocks {
+	return &entryLocks{
+		perEntry: perEntry,
+		entries:  make(map[string]*entryLock),
+	}
+}
+
+// lock acquires the lock for the entry with given id and returns a function releasing it.
+func (l *entryLocks) lock(id string) (unlock func()) {
+	if !l.perEntry {
+		l.site.Lock()
+		return l.site.Unlock
+	}
+
+	l.all.RLock()
+
+	l.mu.Lock()
+	lock, ok := l.entries[id]
+	if !ok {
+		lock = &entryLock{}
+		l.entries[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.entries, id)
+		}
+		l.mu.Unlock()
+
+		l.all.RUnlock()
+	}
+}
+
+// lockAll acquires the lock for all the entries (i.e. for the operations on whole registry) and returns a function
+// releasing it.
+func (l *entryLocks) lockAll() (unlock func()) {
+	if !l.perEntry {
+		l.site.Lock()
+		return l.site.Unlock
+	}
+
+	l.all.Lock()
+	return l.all.Unlock
+}
+
+var _ midas.RegistryService = (*lockedRegistry)(nil)
+
+// lockedRegistry wraps a registry service, so it can be safely used by multiple goroutines.
+type lockedRegistry struct {
+	mu       sync.Mutex
+	registry midas.RegistryService
+}
+
+func (r *lockedRegistry) OpenStorage() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.OpenStorage()
+}
+
+func (r *lockedRegistry) CloseStorage() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registry.CloseStorage()
+}
+
+func (r *lockedRegistry) CreateStorage() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.CreateStorage()
+}
+
+func (r *lockedRegistry) RemoveStorage() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.RemoveStorage()
+}
+
+func (r *lockedRegistry) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.Flush()
+}
+
+func (r *lockedRegistry) CreateEntry(id, filename string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.CreateEntry(id, filename)
+}
+
+func (r *lockedRegistry) ReadEntry(id string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.ReadEntry(id)
+}
+
+func (r *lockedRegistry) ReadEntries() (midas.Registry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.ReadEntries()
+}
+
+func (r *lockedRegistry) UpdateEntry(id, newFilename string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.UpdateEntry(id, newFilename)
+}
+
+func (r *lockedRegistry) DeleteEntry(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.registry.DeleteEntry(id)
+}
@@ -0,0 +1,389 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	whitespaceRegex    = regexp.MustCompile(`\s+`)
+	shortcodeRegex     = regexp.MustCompile(`\{\{[<%].*?[>%]\}\}`)
+	orderedMarkerRegex = regexp.MustCompile(`^(\d+)\. `)
+
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`,
+		"&", "&amp;", "<", "&lt;", ">", "&gt;",
+	)
+
+	// blockElements are rendered as separate Markdown blocks. Not listed elements are treated as inline.
+	blockElements = map[string]bool{
+		"address": true, "article": true, "aside": true, "blockquote": true, "details": true, "dl": true, "div": true,
+		"fieldset": true, "figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+		"h5": true, "h6": true, "header": true, "hr": true, "iframe": true, "nav": true, "ol": true, "p": true,
+		"pre": true, "section": true, "table": true, "ul": true, "video": true, "audio": true,
+	}
+)
+
+// htmlToMarkdown converts the HTML to Markdown. Elements without Markdown equivalent (i.e. tables, iframes or
+// elements with attributes other than links and images) are kept as raw HTML, so nothing is lost in the conversion.
+// Hugo shortcodes in the text are kept as they are.
+func htmlToMarkdown(source string) string {
+	document, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return source
+	}
+
+	body := findElement(document, "body")
+	if body == nil {
+		return source
+	}
+
+	return strings.Join(markdownBlocks(body), "\n\n")
+}
+
+// findElement returns the first element of given name in the tree, or nil if there is none.
+func findElement(node *html.Node, name string) *html.Node {
+	if node.Type == html.ElementNode && node.Data == name {
+		return node
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, name); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// markdownBlocks converts the children of the node to Markdown blocks. Consecutive inline children are joined
+// into a paragraph.
+func markdownBlocks(node *html.Node) []string {
+	var (
+		blocks    []string
+		paragraph strings.Builder
+	)
+
+	flushParagraph := func() {
+		if text := strings.TrimSpace(paragraph.String()); text != "" {
+			blocks = append(blocks, escapeBlockStart(text))
+		}
+		paragraph.Reset()
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && blockElements[child.Data] {
+			flushParagraph()
+			if block := markdownBlock(child); block != "" {
+				blocks = append(blocks, block)
+			}
+			continue
+		}
+
+		paragraph.WriteString(markdownInline(child))
+	}
+	flushParagraph()
+
+	return blocks
+}
+
+// markdownBlock converts the block element to Markdown.
+func markdownBlock(node *html.Node) string {
+	// Ordered list start is handled by the list conversion
+	if len(node.Attr) > 0 && node.Data != "ol" {
+		return renderRaw(node)
+	}
+
+	switch node.Data {
+	case "p":
+		return escapeBlockStart(strings.TrimSpace(markdownChildren(node)))
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(node.Data[1:])
+		return strings.Repeat("#", level) + " " + strings.TrimSpace(markdownChildren(node))
+	case "div":
+		return strings.Join(markdownBlocks(node), "\n\n")
+	case "hr":
+		return "---"
+	case "blockquote":
+		return prefixLines(strings.Join(markdownBlocks(node), "\n\n"), "> ", "> ")
+	case "ul", "ol":
+		return markdownList(node)
+	case "pre":
+		return markdownCodeBlock(node)
+	}
+
+	return renderRaw(node)
+}
+
+// markdownList converts the list (ordered or not) to Markdown. Elements other than list items are kept as raw HTML.
+func markdownList(node *html.Node) string {
+	if node.Data == "ol" {
+		for _, attr := range node.Attr {
+			if attr.Key != "start" {
+				return renderRaw(node)
+			}
+		}
+	}
+
+	number := 1
+	if start, err := strconv.Atoi(attribute(node, "start")); err == nil {
+		number = start
+	}
+
+	var items []string
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode && strings.TrimSpace(child.Data) == "" {
+			continue
+		}
+		if child.Type != html.ElementNode || child.Data != "li" || len(child.Attr) > 0 {
+			return renderRaw(node)
+		}
+
+		marker := "- "
+		if node.Data == "ol" {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		items = append(items, prefixLines(strings.Join(markdownBlocks(child), "\n\n"), marker, strings.Repeat(" ", len(marker))))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+// markdownCodeBlock converts the preformatted text to the fenced code block. The language is taken from the
+// language-* (or lang-*) class of the code element.
+func markdownCodeBlock(node *html.Node) string {
+	content := node
+	if child := node.FirstChild; child != nil && child.NextSibling == nil && child.Type == html.ElementNode && child.Data == "code" {
+		content = child
+	}
+
+	if len(node.Attr) > 0 || (content != node && !onlyAttributes(content, "class")) {
+		return renderRaw(node)
+	}
+
+	language := ""
+	for _, class := range strings.Fields(attribute(content, "class")) {
+		if strings.HasPrefix(class, "language-") {
+			language = strings.TrimPrefix(class, "language-")
+		} else if strings.HasPrefix(class, "lang-") {
+			language = strings.TrimPrefix(class, "lang-")
+		}
+	}
+
+	code := strings.TrimSuffix(textContent(content), "\n")
+
+	fence := "```"
+	if strings.Contains(code, fence) {
+		fence = "~~~"
+	}
+
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+// markdownChildren converts the children of the node to inline Markdown.
+func markdownChildren(node *html.Node) string {
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(markdownInline(child))
+	}
+
+	return builder.String()
+}
+
+// markdownInline converts the inline node to Markdown.
+func markdownInline(node *html.Node) string {
+	switch node.Type {
+	case html.TextNode:
+		return escapeText(whitespaceRegex.ReplaceAllString(node.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch node.Data {
+	case "a":
+		if !onlyAttributes(node, "href", "title") || attribute(node, "href") == "" {
+			break
+		}
+		return "[" + markdownChildren(node) + "](" + markdownDestination(node) + ")"
+	case "img":
+		if !onlyAttributes(node, "src", "alt", "title") || attribute(node, "src") == "" {
+			break
+		}
+		return "![" + escapeText(attribute(node, "alt")) + "](" + markdownDestination(node) + ")"
+	}
+
+	if len(node.Attr) > 0 {
+		return renderRaw(node)
+	}
+
+	switch node.Data {
+	case "strong", "b":
+		return wrapInline(markdownChildren(node), "**")
+	case "em", "i":
+		return wrapInline(markdownChildren(node), "*")
+	case "del", "s":
+		return wrapInline(markdownChildren(node), "~~")
+	case "code":
+		return markdownCodeSpan(textContent(node))
+	case "br":
+		return "\\\n"
+	case "span":
+		return markdownChildren(node)
+	}
+
+	return renderRaw(node)
+}
+
+// markdownDestination returns the link destination (with title, if set) of the link or image.
+func markdownDestination(node *html.Node) string {
+	destination := attribute(node, "href")
+	if node.Data == "img" {
+		destination = attribute(node, "src")
+	}
+
+	destination = "<" + strings.NewReplacer("<", "%3C", ">", "%3E", " ", "%20").Replace(destination) + ">"
+	if title := attribute(node, "title"); title != "" {
+		destination += " " + strconv.Quote(title)
+	}
+
+	return destination
+}
+
+// markdownCodeSpan wraps the code into backticks, using the longer delimiter if the code contains backticks.
+func markdownCodeSpan(code string) string {
+	if code == "" {
+		return ""
+	}
+
+	if strings.Contains(code, "`") {
+		return "`` " + code + " ``"
+	}
+
+	return "`" + code + "`"
+}
+
+// wrapInline wraps the content into the Markdown delimiter. Surrounding whitespace is moved outside the delimiters,
+// as Markdown doesn't allow it inside.
+func wrapInline(content, delimiter string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return content
+	}
+
+	leading := content[:strings.Index(content, trimmed)]
+	trailing := content[len(leading)+len(trimmed):]
+
+	return leading + delimiter + trimmed + delimiter + trailing
+}
+
+// escapeText escapes Markdown and HTML special characters in the text, except for Hugo shortcodes.
+func escapeText(text string) string {
+	var builder strings.Builder
+
+	last := 0
+	for _, match := range shortcodeRegex.FindAllStringIndex(text, -1) {
+		builder.WriteString(markdownEscaper.Replace(text[last:match[0]]))
+		builder.WriteString(text[match[0]:match[1]])
+		last = match[1]
+	}
+	builder.WriteString(markdownEscaper.Replace(text[last:]))
+
+	return builder.String()
+}
+
+// escapeBlockStart escapes the beginning of the paragraph, which would otherwise be parsed as a heading,
+// a list or a thematic break.
+func escapeBlockStart(text string) string {
+	if text == "" {
+		return text
+	}
+
+	if strings.ContainsAny(text[:1], "#-+=") {
+		return `\` + text
+	}
+
+	return orderedMarkerRegex.ReplaceAllString(text, `$1\. `)
+}
+
+// prefixLines prefixes the first line of the text with the first prefix, and the following non-empty lines
+// with the other one.
+func prefixLines(text, first, other string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line != "":
+			lines[i] = other + line
+		case strings.TrimSpace(other) != "":
+			lines[i] = strings.TrimSpace(other)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// textContent returns the text of the node and all its descendants.
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		builder.WriteString(textContent(child))
+	}
+
+	return builder.String()
+}
+
+// attribute returns the value of the node attribute, or empty string if it isn't set.
+func attribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
+
+// onlyAttributes returns true if the node has no other attributes than the allowed ones.
+func onlyAttributes(node *html.Node, allowed ...string) bool {
+	for _, attr := range node.Attr {
+		isAllowed := false
+		for _, key := range allowed {
+			if attr.Key == key {
+				isAllowed = true
+			}
+		}
+
+		if !isAllowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// renderRaw renders the node as HTML, used for the elements which can't be converted to Markdown.
+func renderRaw(node *html.Node) string {
+	var builder strings.Builder
+	if err := html.Render(&builder, node); err != nil {
+		return ""
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas/testing_utils"
+	"testing"
+)
+
+func TestHtmlToMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{"Paragraphs", "<p>First paragraph.</p>\n<p>Second\n  paragraph.</p>", "First paragraph.\n\nSecond paragraph."},
+		{"Headings", "<h1>Title</h1><h3>Section</h3>", "# Title\n\n### Section"},
+		{"Emphasis", "<p><strong>Bold</strong>, <em>italic</em>, <b>b</b> <i>i</i> and <del>gone</del></p>",
+			"**Bold**, *italic*, **b** *i* and ~~gone~~"},
+		{"Emphasis whitespace", "<p>A<strong> bold </strong>word</p>", "A **bold** word"},
+		{"Link", `<p>See <a href="https://example.com/a b" title="Example">the site</a>.</p>`,
+			`See [the site](<https://example.com/a%20b> "Example").`},
+		{"Image", `<p><img src="/uploads/cat.jpg" alt="A cat"></p>`, "![A cat](</uploads/cat.jpg>)"},
+		{"Line break", "<p>First line<br>Second line</p>", "First line\\\nSecond line"},
+		{"Inline code", "<p>Run <code>go test</code> or <code>a`b</code></p>", "Run `go test` or `` a`b ``"},
+		{"Code block", "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"&lt;hi&gt;\")\n}\n</code></pre>",
+			"```go\nfunc main() {\n\tfmt.Println(\"<hi>\")\n}\n```"},
+		{"Unordered list", "<ul><li>One</li><li>Two <em>too</em></li></ul>", "- One\n- Two *too*"},
+		{"Ordered list", `<ol start="3"><li>Three</li><li>Four</li></ol>`, "3. Three\n4. Four"},
+		{"Nested list", "<ul><li>Parent<ul><li>Child</li></ul></li></ul>", "- Parent\n\n  - Child"},
+		{"Blockquote", "<blockquote><p>Quote</p><p>More</p></blockquote>", "> Quote\n>\n> More"},
+		{"Thematic break", "<p>Above</p><hr><p>Below</p>", "Above\n\n---\n\nBelow"},
+		{"Escaping", "<p>2 * 3 = 6 &amp; a_b &lt;script&gt; [x]</p>", `2 \* 3 = 6 &amp; a\_b &lt;script&gt; \[x\]`},
+		{"Block start escaping", "<p># Not a heading</p><p>1. Not a list</p>", "\\# Not a heading\n\n1\\. Not a list"},
+		{"Shortcode", `<p>{{&lt; youtube id="w7Ft2ymGmfc" &gt;}} and {{% note %}}</p>`, `{{< youtube id="w7Ft2ymGmfc" >}} and {{% note %}}`},
+		{"Loose inline content", "Text <strong>only</strong>", "Text **only**"},
+		{"Table fallback", "<table><tbody><tr><td>Cell</td></tr></tbody></table>", "<table><tbody><tr><td>Cell</td></tr></tbody></table>"},
+		{"Attributes fallback", `<p class="lead">Lead</p><p>Text <span class="red">red</span></p>`,
+			`<p class="lead">Lead</p>` + "\n\nText " + `<span class="red">red</span>`},
+		{"Iframe fallback", `<p>Video:</p><iframe src="https://www.youtube.com/embed/x"></iframe>`,
+			"Video:\n\n" + `<iframe src="https://www.youtube.com/embed/x"></iframe>`},
+		{"Comment dropped", "<p>Visible<!-- hidden --></p>", "Visible"},
+		{"Empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, htmlToMarkdown(tt.html), tt.expected, "Markdown")
+		})
+	}
+}
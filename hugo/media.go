@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// mediaURL is the data passed to the media URL template.
+type mediaURL struct {
+	URL  string
+	Path string
+	Name string
+}
+
+// rewriteMedia rewrites URLs of all the media objects in the entry (including their formats) using
+// the model's URL template. The entry itself is not modified, a rewritten copy is returned.
+func rewriteMedia(settings midas.MediaSettings, entry map[string]interface{}) (map[string]interface{}, error) {
+	if !settings.Rewrite {
+		return entry, nil
+	}
+
+	tmpl, err := template.New("media").Parse(settings.URLTemplate)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "media url template is invalid: %s", err)
+	}
+
+	rewritten, err := rewriteMediaIn(tmpl, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return rewritten.(map[string]interface{}), nil
+}
+
+// rewriteMediaIn iterates (recursively) through given value and rewrites the URLs of media objects found.
+func rewriteMediaIn(tmpl *template.Template, value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		output := make(map[string]interface{}, len(object))
+
+		for key, item := range object {
+			rewritten, err := rewriteMediaIn(tmpl, item)
+			if err != nil {
+				return nil, err
+			}
+			output[key] = rewritten
+		}
+
+		if isMedia(object) {
+			rewritten, err := rewriteURL(tmpl, object["url"].(string))
+			if err != nil {
+				return nil, err
+			}
+			output["url"] = rewritten
+		}
+
+		return output, nil
+	case []interface{}:
+		slice := value.([]interface{})
+		output := make([]interface{}, len(slice))
+
+		for i, item := range slice {
+			rewritten, err := rewriteMediaIn(tmpl, item)
+			if err != nil {
+				return nil, err
+			}
+			output[i] = rewritten
+		}
+
+		return output, nil
+	default:
+		return value, nil
+	}
+}
+
+// isMedia returns true if the object looks like a Strapi media (or its format) - it has url and mime fields.
+func isMedia(object map[string]interface{}) bool {
+	_, hasUrl := object["url"].(string)
+	_, hasMime := object["mime"]
+
+	return hasUrl && hasMime
+}
+
+// rewriteURL generates the new media URL from the template.
+func rewriteURL(tmpl *template.Template, original string) (string, error) {
+	data := mediaURL{URL: original, Path: original}
+
+	if parsed, err := url.Parse(original); err == nil {
+		data.Path = parsed.Path
+	}
+	data.Name = path.Base(data.Path)
+
+	var output strings.Builder
+	if err := tmpl.Execute(&output, data); err != nil {
+		return "", midas.Errorf(midas.ErrSiteConfig, "media url template could not be executed: %s", err)
+	}
+
+	return output.String(), nil
+}
+
+// mediaDimensions sets the width and height of the image media objects in the entry (including their formats) which
+// don't have them, reading the media files from the media directory. Non-image media and media without the local file
+// are left as they are. The entry itself is not modified, a copy is returned. The dimensions of the media downloaded
+// into the page bundle are set as the resource params instead (see bundleResources).
+func mediaDimensions(settings midas.MediaSettings, rootDir string, entry map[string]interface{}) (map[string]interface{}, error) {
+	if !settings.Dimensions {
+		return entry, nil
+	}
+
+	if settings.Dir == "" {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "media dir is required to read the media dimensions")
+	}
+
+	dir := settings.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(rootDir, dir)
+	}
+
+	return dimensionsIn(dir, entry).(map[string]interface{}), nil
+}
+
+// dimensionsIn iterates (recursively) through given value and sets the dimensions of media objects found.
+func dimensionsIn(dir string, value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		output := make(map[string]interface{}, len(object))
+
+		for key, item := range object {
+			output[key] = dimensionsIn(dir, item)
+		}
+
+		_, hasWidth := object["width"].(float64)
+		_, hasHeight := object["height"].(float64)
+		if isMedia(object) && !(hasWidth && hasHeight) {
+			if width, height, ok := imageDimensions(mediaPath(dir, object["url"].(string))); ok {
+				output["width"] = width
+				output["height"] = height
+			}
+		}
+
+		return output
+	case []interface{}:
+		slice := value.([]interface{})
+		output := make([]interface{}, len(slice))
+
+		for i, item := range slice {
+			output[i] = dimensionsIn(dir, item)
+		}
+
+		return output
+	default:
+		return value
+	}
+}
+
+// mediaPath returns the path of the media file in the media directory. The path can't point outside the directory.
+func mediaPath(dir, mediaURL string) string {
+	urlPath := mediaURL
+	if parsed, err := url.Parse(mediaURL); err == nil {
+		urlPath = parsed.Path
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+urlPath)))
+}
+
+// imageDimensions returns the width and height of the image file. Ok is false if the file doesn't exist
+// or is not an image in one of the supported formats (PNG, JPEG, GIF).
+func imageDimensions(filePath string) (width, height int, ok bool) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return config.Width, config.Height, true
+}
+
+// mediaResource is the image downloaded into the page bundle, described as the Hugo page resource with its dimensions
+// as the params.
+type mediaResource struct {
+	Src    string
+	Width  int
+	Height int
+}
+
+// bundleResources returns the image media of the entry (including their formats) downloaded into the bundle
+// directory, with the dimensions read from the files. Non-image media and the files missing in the directory are
+// skipped.
+func bundleResources(settings midas.MediaSettings, entry map[string]interface{}, dir string) ([]mediaResource, error) {
+	files, err := mediaFiles(settings, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for urlPath := range files {
+		names = append(names, path.Base(urlPath))
+	}
+	sort.Strings(names)
+
+	var resources []mediaResource
+	for _, name := range names {
+		if width, height, ok := imageDimensions(filepath.Join(dir, name)); ok {
+			resources = append(resources, mediaResource{Src: name, Width: width, Height: height})
+		}
+	}
+
+	return resources, nil
+}
+
+// formatResources formats the resources as the single line front matter value: the YAML flow sequence, or the TOML
+// array of inline tables.
+func formatResources(resources []mediaResource, toml bool) string {
+	format := `{"src": %q, "params": {"width": %d, "height": %d}}`
+	if toml {
+		format = `{src = %q, params = {width = %d, height = %d}}`
+	}
+
+	items := make([]string, len(resources))
+	for i, resource := range resources {
+		items[i] = fmt.Sprintf(format, resource.Src, resource.Width, resource.Height)
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
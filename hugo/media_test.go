@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"encoding/json"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteMedia(t *testing.T) {
+	settings := midas.MediaSettings{Rewrite: true, URLTemplate: "https://cdn.example.com{{ .Path }}"}
+
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{"Single",
+			`{"cover": {"id": 1, "mime": "image/png", "url": "/uploads/cover.png"}}`,
+			`{"cover":{"id":1,"mime":"image/png","url":"https://cdn.example.com/uploads/cover.png"}}`},
+		{"Multiple",
+			`{"gallery": [{"mime": "image/png", "url": "/uploads/a.png"}, {"mime": "image/jpeg", "url": "https://bucket.s3.amazonaws.com/uploads/b.jpg"}]}`,
+			`{"gallery":[{"mime":"image/png","url":"https://cdn.example.com/uploads/a.png"},{"mime":"image/jpeg","url":"https://cdn.example.com/uploads/b.jpg"}]}`},
+		{"Formats",
+			`{"cover": {"mime": "image/png", "url": "/uploads/c.png", "formats": {"thumbnail": {"mime": "image/png", "url": "/uploads/thumbnail_c.png"}}}}`,
+			`{"cover":{"formats":{"thumbnail":{"mime":"image/png","url":"https://cdn.example.com/uploads/thumbnail_c.png"}},"mime":"image/png","url":"https://cdn.example.com/uploads/c.png"}}`},
+		{"Component",
+			`{"seo": {"title": "SEO", "image": {"mime": "image/png", "url": "/uploads/seo.png"}}}`,
+			`{"seo":{"image":{"mime":"image/png","url":"https://cdn.example.com/uploads/seo.png"},"title":"SEO"}}`},
+		{"NotMedia",
+			`{"link": {"url": "/about"}, "cover": null}`,
+			`{"cover":null,"link":{"url":"/about"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.entry), &entry); err != nil {
+				t.Fatal(err)
+			}
+			original, _ := json.Marshal(entry)
+
+			got, err := rewriteMedia(settings, entry)
+			testing_utils.AssertEquals(t, err, nil, "Error")
+
+			gotJson, _ := json.Marshal(got)
+			afterJson, _ := json.Marshal(entry)
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Rewritten":      {string(gotJson), tt.want},
+				"Original entry": {string(afterJson), string(original)},
+			})
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		entry := map[string]interface{}{"cover": map[string]interface{}{"mime": "image/png", "url": "/uploads/cover.png"}}
+
+		got, err := rewriteMedia(midas.MediaSettings{URLTemplate: settings.URLTemplate}, entry)
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {err, nil},
+			"URL":   {got["cover"].(map[string]interface{})["url"], "/uploads/cover.png"},
+		})
+	})
+
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		_, err := rewriteMedia(midas.MediaSettings{Rewrite: true, URLTemplate: "{{ .Path"}, map[string]interface{}{})
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
+
+func TestSiteService_CreateEntry_Media(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath: "archetypes/post.md",
+			OutputDir:     "posts",
+			Media:         midas.MediaSettings{Rewrite: true, URLTemplate: "https://cdn.example.com/{{ .Name }}"},
+		},
+	}, map[string]string{
+		"archetypes/post.md": `image: {{ (index .Entry "cover").url }}`,
+	})
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post",
+		`{"id": 1, "Title": "Test", "cover": {"mime": "image/png", "url": "/uploads/cover.png"}}`))
+	testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+	content, err := os.ReadFile(outputPath)
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Read output error": {err, nil},
+		"Output content":    {string(content), "image: https://cdn.example.com/cover.png"},
+	})
+}
+
+// writeSampleImages writes sample PNG (40x30) and JPEG (16x9) images, and a text file to the uploads directory.
+func writeSampleImages(t *testing.T, dir string) {
+	uploads := filepath.Join(dir, "uploads")
+	if err := os.MkdirAll(uploads, 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, encode := range map[string]func(file *os.File) error{
+		"cover.png": func(file *os.File) error { return png.Encode(file, image.NewRGBA(image.Rect(0, 0, 40, 30))) },
+		"photo.jpg": func(file *os.File) error { return jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, 16, 9)), nil) },
+		"notes.pdf": func(file *os.File) error { _, err := file.WriteString("%PDF-1.4"); return err },
+	} {
+		file, err := os.Create(filepath.Join(uploads, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = encode(file); err != nil {
+			t.Fatal(err)
+		}
+		_ = file.Close()
+	}
+}
+
+func TestMediaDimensions(t *testing.T) {
+	root := t.TempDir()
+	writeSampleImages(t, filepath.Join(root, "strapi", "public"))
+
+	settings := midas.MediaSettings{Dimensions: true, Dir: "strapi/public"}
+
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{"PNG",
+			`{"cover": {"mime": "image/png", "url": "/uploads/cover.png"}}`,
+			`{"cover":{"height":30,"mime":"image/png","url":"/uploads/cover.png","width":40}}`},
+		{"JPEG with absolute URL",
+			`{"cover": {"mime": "image/jpeg", "url": "https://cms.example.com/uploads/photo.jpg?v=2"}}`,
+			`{"cover":{"height":9,"mime":"image/jpeg","url":"https://cms.example.com/uploads/photo.jpg?v=2","width":16}}`},
+		{"Formats",
+			`{"cover": {"mime": "image/jpeg", "url": "/uploads/photo.jpg", "formats": {"small": {"mime": "image/png", "url": "/uploads/cover.png"}}}}`,
+			`{"cover":{"formats":{"small":{"height":30,"mime":"image/png","url":"/uploads/cover.png","width":40}},"height":9,"mime":"image/jpeg","url":"/uploads/photo.jpg","width":16}}`},
+		{"Dimensions kept",
+			`{"cover": {"mime": "image/png", "url": "/uploads/cover.png", "width": 400, "height": 300}}`,
+			`{"cover":{"height":300,"mime":"image/png","url":"/uploads/cover.png","width":400}}`},
+		{"Not an image",
+			`{"file": {"mime": "application/pdf", "url": "/uploads/notes.pdf"}}`,
+			`{"file":{"mime":"application/pdf","url":"/uploads/notes.pdf"}}`},
+		{"Missing file",
+			`{"gallery": [{"mime": "image/png", "url": "/uploads/missing.png"}]}`,
+			`{"gallery":[{"mime":"image/png","url":"/uploads/missing.png"}]}`},
+		{"Outside media dir",
+			`{"cover": {"mime": "image/png", "url": "/../public/uploads/cover.png"}}`,
+			`{"cover":{"mime":"image/png","url":"/../public/uploads/cover.png"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.entry), &entry); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := mediaDimensions(settings, root, entry)
+			gotJson, _ := json.Marshal(got)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":  {err, nil},
+				"Result": {string(gotJson), tt.want},
+			})
+		})
+	}
+
+	t.Run("Missing dir", func(t *testing.T) {
+		_, err := mediaDimensions(midas.MediaSettings{Dimensions: true}, root, map[string]interface{}{})
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
+
+func TestSiteService_CreateEntry_MediaDimensions(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath: "archetypes/post.md",
+			OutputDir:     "posts",
+			Media: midas.MediaSettings{
+				Dimensions: true, Dir: "static",
+				Rewrite: true, URLTemplate: "https://cdn.example.com/{{ .Name }}",
+			},
+		},
+	}, map[string]string{
+		"archetypes/post.md": `{{ with index .Entry "cover" }}image: {{ .url }}
+width: {{ .width }}
+height: {{ .height }}{{ end }}`,
+	})
+	writeSampleImages(t, filepath.Join(s.Site.RootDir, "static"))
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post",
+		`{"id": 1, "Title": "Test", "cover": {"mime": "image/png", "url": "/uploads/cover.png"}}`))
+	testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+	content, _ := os.ReadFile(outputPath)
+	testing_utils.AssertEquals(t, string(content), "image: https://cdn.example.com/cover.png\nwidth: 40\nheight: 30", "Output content")
+}
+
+func TestSiteService_CreateEntry_BundleResources(t *testing.T) {
+	public := t.TempDir()
+	writeSampleImages(t, public)
+	server := httptest.NewServer(http.FileServer(http.Dir(public)))
+	defer server.Close()
+
+	const entry = `{"id": 1, "Title": "Post", "cover": {"mime": "image/png", "url": "/uploads/cover.png", "width": 400,
+		"formats": {"small": {"mime": "image/jpeg", "url": "/uploads/photo.jpg"}}},
+		"file": {"mime": "application/pdf", "url": "/uploads/notes.pdf"}}`
+
+	tests := []struct {
+		name      string
+		archetype string
+		want      string
+	}{
+		{"YAML",
+			"---\ntitle: {{ index .Entry \"Title\" }}\nwidth: {{ .Entry.cover.width }}\n---\n",
+			"---\ntitle: Post\nwidth: 400\n" +
+				`resources: [{"src": "cover.png", "params": {"width": 40, "height": 30}}, {"src": "photo.jpg", "params": {"width": 16, "height": 9}}]` +
+				"\n---\n"},
+		{"TOML",
+			"+++\ntitle = \"{{ index .Entry \"Title\" }}\"\n+++\n",
+			"+++\ntitle = \"Post\"\n" +
+				`resources = [{src = "cover.png", params = {width = 40, height = 30}}, {src = "photo.jpg", params = {width = 16, height = 9}}]` +
+				"\n+++\n"},
+		{"Archetype resources",
+			"---\nresources: []\n---\n",
+			"---\nresources: []\n---\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {
+					ArchetypePath: "archetypes/post.md", OutputDir: "posts", Bundle: bundleLeaf,
+					Media: midas.MediaSettings{Download: true, Dimensions: true, BaseURL: server.URL},
+				},
+			}, map[string]string{
+				"archetypes/post.md": tt.archetype,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry))
+			content, _ := os.ReadFile(outputPath)
+			_, pdfErr := os.Stat(filepath.Join(filepath.Dir(outputPath), "notes.pdf"))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":            {err, nil},
+				"Content":          {string(content), tt.want},
+				"Other downloaded": {pdfErr, nil},
+			})
+		})
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics counts the reported metrics.
+type recordingMetrics struct {
+	midas.NopMetrics
+
+	mu        sync.Mutex
+	entries   map[string]int // Indexed by model/operation
+	builds    int
+	failed    int
+	durations []time.Duration
+}
+
+func (m *recordingMetrics) EntryProcessed(site, model, operation string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[site+"/"+model+"/"+operation]++
+}
+
+func (m *recordingMetrics) SiteBuilt(_ string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.builds++
+	if err != nil {
+		m.failed++
+	}
+	m.durations = append(m.durations, duration)
+}
+
+// useMetrics replaces the metrics service for the test.
+func useMetrics(t *testing.T) *recordingMetrics {
+	metrics := &recordingMetrics{entries: make(map[string]int)}
+
+	previous := midas.Metrics
+	midas.Metrics = metrics
+	t.Cleanup(func() {
+		midas.Metrics = previous
+	})
+
+	return metrics
+}
+
+func TestSiteService_Metrics_Entries(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post":   {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+		"hidden": {ArchetypePath: "archetypes/post.md", OutputDir: "false"},
+		"broken": {ArchetypePath: "archetypes/missing.md", OutputDir: "broken"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+	s.Site.SingleTypes = map[string]midas.ModelSettings{"settings": {OutputDir: "data"}}
+
+	metrics := useMetrics(t)
+
+	_, _ = s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+	_, _ = s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "Second"}`))
+	_, _ = s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`))
+	_, _ = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 2}`))
+	_, _ = s.UpdateSingle(mustParsePayload(t, "entry.update", "settings", `{"id": 1}`))
+
+	// Not counted: failed operation and model without output
+	_, failedErr := s.CreateEntry(mustParsePayload(t, "entry.create", "broken", `{"id": 1, "Title": "Broken"}`))
+	_, _ = s.CreateEntry(mustParsePayload(t, "entry.create", "hidden", `{"id": 1, "Title": "Hidden"}`))
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Failed operation": {failedErr != nil, true},
+		"Created":          {metrics.entries["test/post/create"], 2},
+		"Updated":          {metrics.entries["test/post/update"], 1},
+		"Deleted":          {metrics.entries["test/post/delete"], 1},
+		"Single":           {metrics.entries["test/settings/single"], 1},
+		"Hidden":           {metrics.entries["test/hidden/create"], 0},
+		"Failed":           {metrics.entries["test/broken/create"], 0},
+	})
+}
+
+func TestSiteService_Metrics_Build(t *testing.T) {
+	// Fails for the drafts build
+	useFakeHugo(t, "for arg in \"$@\"; do [ \"$arg\" = \"-D\" ] && exit 1; done\nexit 0")
+
+	s := newTestSite(t, nil, nil)
+	metrics := useMetrics(t)
+
+	buildErr := s.build(true, nil)
+
+	s.Site.BuildDrafts = true
+	failedErr := s.build(true, nil)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Build error":        {buildErr, nil},
+		"Failed build error": {failedErr != nil, true},
+		"Builds":             {metrics.builds, 2},
+		"Failed builds":      {metrics.failed, 1},
+		"Duration observed":  {metrics.durations[0] > 0, true},
+	})
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"html/template"
+	"strings"
+	"text/template/parse"
+)
+
+const (
+	missingFieldsEmpty   = "empty"   // Missing fields are rendered empty
+	missingFieldsDefault = "default" // Missing fields output by the archetype are rendered as the configured default
+	missingFieldsError   = "error"   // Entry missing any field used by the archetype is rejected
+)
+
+// entryWithMissingFields applies the site missing fields mode to the (sanitized) entry the archetype is executed
+// with. In the default mode, a copy of the entry is returned, with the missing (or null) fields output by the
+// archetype set to the default. In the error mode, ErrInvalid is returned if any entry field used by the archetype
+// is missing.
+func (s SiteService) entryWithMissingFields(tmpl *template.Template, entry map[string]interface{}) (map[string]interface{}, error) {
+	settings := s.Site.MissingFields
+
+	switch settings.Mode {
+	case "", missingFieldsEmpty:
+		return entry, nil
+	case missingFieldsDefault:
+		for _, field := range archetypeEntryFields(tmpl, true) {
+			entry = withDefaultField(entry, field, settings.Default)
+		}
+
+		return entry, nil
+	case missingFieldsError:
+		var missing []string
+		for _, field := range archetypeEntryFields(tmpl, false) {
+			if depth := missingFieldDepth(entry, field); depth >= 0 {
+				missing = append(missing, strings.Join(field[:depth+1], "."))
+			}
+		}
+
+		if len(missing) > 0 {
+			return nil, midas.Errorf(midas.ErrInvalid, "entry is missing the archetype fields: %s", strings.Join(missing, ", "))
+		}
+
+		return entry, nil
+	default:
+		return nil, midas.Errorf(midas.ErrSiteConfig, "missing fields mode %s is invalid", settings.Mode)
+	}
+}
+
+// archetypeEntryFields returns the entry fields (without the leading Entry) used in the archetype and the templates
+// it defines. If output is true, only the fields output by the actions are returned; the fields used in the
+// conditions (if, with and range) are skipped, so they still see the missing fields as empty.
+func archetypeEntryFields(tmpl *template.Template, output bool) [][]string {
+	var used, conditions [][]string
+	for _, associated := range tmpl.Templates() {
+		if associated.Tree == nil {
+			continue
+		}
+
+		if output {
+			actions, branches := outputFields(associated.Tree.Root)
+			used, conditions = append(used, actions...), append(conditions, branches...)
+		} else {
+			used = append(used, templateFields(associated.Tree.Root)...)
+		}
+	}
+
+	skipped := map[string]bool{}
+	for _, field := range conditions {
+		skipped[strings.Join(field, ".")] = true
+	}
+
+	var fields [][]string
+	for _, field := range used {
+		key := strings.Join(field, ".")
+		if len(field) < 2 || field[0] != "Entry" || skipped[key] {
+			continue
+		}
+
+		skipped[key] = true
+		fields = append(fields, field[1:])
+	}
+
+	return fields
+}
+
+// outputFields returns the fields used in the actions of the template node, and separately the ones used in the
+// pipelines of the if, with and range nodes.
+func outputFields(node parse.Node) ([][]string, [][]string) {
+	var actions, conditions [][]string
+	appendFields := func(nodes ...parse.Node) {
+		for _, child := range nodes {
+			childActions, childConditions := outputFields(child)
+			actions, conditions = append(actions, childActions...), append(conditions, childConditions...)
+		}
+	}
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil, nil
+		}
+		appendFields(node.Nodes...)
+	case *parse.ActionNode:
+		actions = templateFields(node.Pipe)
+	case *parse.IfNode:
+		conditions = templateFields(node.Pipe)
+		appendFields(node.List, node.ElseList)
+	case *parse.WithNode:
+		conditions = templateFields(node.Pipe)
+		appendFields(node.List, node.ElseList)
+	case *parse.RangeNode:
+		conditions = templateFields(node.Pipe)
+		appendFields(node.List, node.ElseList)
+	}
+
+	return actions, conditions
+}
+
+// missingFieldDepth returns the index of the first missing (or null) element of the field path in the entry, or -1 if
+// the field is set.
+func missingFieldDepth(entry map[string]interface{}, field []string) int {
+	object := entry
+	for i, key := range field {
+		if object[key] == nil {
+			return i
+		}
+		if i == len(field)-1 {
+			break
+		}
+
+		nested, ok := object[key].(map[string]interface{})
+		if !ok {
+			// Not an object (i.e. the list), so it isn't looked up further
+			return -1
+		}
+		object = nested
+	}
+
+	return -1
+}
+
+// withDefaultField returns the entry with the missing (or null) field set to the value. The nested objects are
+// copied, so the original entry isn't modified. The field of the missing object isn't set, as the object itself isn't
+// output.
+func withDefaultField(entry map[string]interface{}, field []string, value string) map[string]interface{} {
+	if missingFieldDepth(entry, field) != len(field)-1 {
+		return entry
+	}
+
+	copied := make(map[string]interface{}, len(entry)+1)
+	for key, item := range entry {
+		copied[key] = item
+	}
+
+	if len(field) == 1 {
+		copied[field[0]] = value
+	} else {
+		copied[field[0]] = withDefaultField(entry[field[0]].(map[string]interface{}), field[1:], value)
+	}
+
+	return copied
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"html/template"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSiteService_CreateEntry_MissingFields(t *testing.T) {
+	const archetype = `title: {{ .Entry.Title }}
+subtitle: {{ .Entry.Subtitle }}
+summary: {{ index .Entry "Summary" }}
+author: {{ .Entry.Author.Name }}
+{{ if .Entry.Category }}category: {{ .Entry.Category }}{{ end }}
+{{ define "footer" }}{{ $.Entry.Footer }}{{ end }}{{ template "footer" . }}`
+
+	tests := []struct {
+		name     string
+		settings midas.MissingFieldsSettings
+		entry    string
+		want     string
+		wantErr  string
+	}{
+		{"Empty", midas.MissingFieldsSettings{}, `{"id": 1, "Title": "Post", "Summary": null, "Author": {}}`,
+			"title: Post\nsubtitle: \nsummary: \nauthor: \n\n", ""},
+		{"Empty explicitly", midas.MissingFieldsSettings{Mode: "empty", Default: "n/a"}, `{"id": 1, "Title": "Post", "Author": {}}`,
+			"title: Post\nsubtitle: \nsummary: \nauthor: \n\n", ""},
+		{"Default", midas.MissingFieldsSettings{Mode: "default", Default: "n/a"}, `{"id": 1, "Title": "Post", "Summary": null, "Author": {}}`,
+			"title: Post\nsubtitle: n/a\nsummary: n/a\nauthor: n/a\n\nn/a", ""},
+		{"Default set fields", midas.MissingFieldsSettings{Mode: "default", Default: "n/a"},
+			`{"id": 1, "Title": "Post", "Subtitle": "Sub", "Summary": "Sum", "Author": {"Name": "Jane"}, "Category": "News", "Footer": "End"}`,
+			"title: Post\nsubtitle: Sub\nsummary: Sum\nauthor: Jane\ncategory: News\nEnd", ""},
+		{"Default escaped", midas.MissingFieldsSettings{Mode: "default", Default: "<none>"}, `{"id": 1, "Title": "Post", "Author": {}}`,
+			"title: Post\nsubtitle: &lt;none&gt;\nsummary: &lt;none&gt;\nauthor: &lt;none&gt;\n\n&lt;none&gt;", ""},
+		{"Error", midas.MissingFieldsSettings{Mode: "error"}, `{"id": 1, "Title": "Post", "Author": {}}`, "", midas.ErrInvalid},
+		{"Error set fields", midas.MissingFieldsSettings{Mode: "error"},
+			`{"id": 1, "Title": "Post", "Subtitle": "Sub", "Summary": "Sum", "Author": {"Name": "Jane"}, "Category": "News", "Footer": "End"}`,
+			"title: Post\nsubtitle: Sub\nsummary: Sum\nauthor: Jane\ncategory: News\nEnd", ""},
+		{"Unknown mode", midas.MissingFieldsSettings{Mode: "zero"}, `{"id": 1, "Title": "Post", "Author": {}}`, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+			}, map[string]string{
+				"archetypes/post.md": archetype,
+			})
+			s.Site.MissingFields = tt.settings
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", tt.entry))
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Content":    {string(content), tt.want},
+				"No value":   {strings.Contains(string(content), "no value"), false},
+			})
+		})
+	}
+}
+
+func TestSiteService_entryWithMissingFields(t *testing.T) {
+	s := newTestSite(t, nil, nil)
+	s.Site.MissingFields = midas.MissingFieldsSettings{Mode: "default", Default: "n/a"}
+
+	tmpl, err := parseInlineArchetype(template.New("archetype"), `{{ .Entry.Author.Name }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	author := map[string]interface{}{}
+	entry := map[string]interface{}{"Author": author}
+	result, err := s.entryWithMissingFields(tmpl, entry)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":      {err, nil},
+		"Default":    {result["Author"].(map[string]interface{})["Name"], "n/a"},
+		"Entry kept": {len(author), 0},
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		s.Site.MissingFields.Mode = "error"
+
+		_, err := s.entryWithMissingFields(tmpl, entry)
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code": {midas.ErrorCode(err), midas.ErrInvalid},
+			"Message":    {midas.ErrorMessage(err), "entry is missing the archetype fields: Author.Name"},
+		})
+	})
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// entryPath returns the path of the entry page in the output directory: the slug file, or the path generated from
+// the model permalink pattern. The page of the bundle is the index file in the directory of that name. The page of
+// the localized entry has the language suffix (unless the languages are written to their directories).
+func (s SiteService) entryPath(model *midas.ModelSettings, entry map[string]interface{}, outputDir, slug string) (string, error) {
+	index, err := bundleIndex(model)
+	if err != nil {
+		return "", err
+	}
+
+	suffix, err := s.pageLanguageSuffix(entry)
+	if err != nil {
+		return "", err
+	}
+
+	path := slug
+	if model.Permalink != "" {
+		if path, err = s.permalinkPath(model, entry, slug); err != nil {
+			return "", err
+		}
+	}
+
+	if index != "" {
+		return filepath.Join(outputDir, path, withLanguageSuffix(index, suffix)), nil
+	}
+
+	return filepath.Join(outputDir, path+suffix+".html"), nil
+}
+
+// permalinkPath evaluates the permalink pattern of the model. The segments are separated by slashes; each of them
+// is either a literal, or a token: :slug, :title, :section (the entry output dir field), :year, :month, :monthname
+// and :day. Each segment is slugified, so the entry can't be placed outside the output directory, and the empty
+// ones are skipped.
+func (s SiteService) permalinkPath(model *midas.ModelSettings, entry map[string]interface{}, slug string) (string, error) {
+	var date time.Time
+
+	var segments []string
+	for _, segment := range strings.FieldsFunc(model.Permalink, func(r rune) bool { return r == '/' || r == '\\' }) {
+		var value string
+
+		switch segment {
+		case ":slug":
+			segments = append(segments, slug)
+			continue
+		case ":title":
+			titleField := "Title"
+			if model.Fields.Title != nil {
+				titleField = *model.Fields.Title
+			}
+			if entry[titleField] != nil {
+				value = fmt.Sprintf("%v", entry[titleField])
+			}
+		case ":section":
+			if model.Fields.OutputDir != nil && entry[*model.Fields.OutputDir] != nil {
+				// The section may be nested
+				if section := s.entrySection(model, entry); section != "" {
+					segments = append(segments, filepath.ToSlash(section))
+				}
+				continue
+			}
+		case ":year", ":month", ":monthname", ":day":
+			if date.IsZero() {
+				var err error
+				if date, err = s.permalinkDate(model, entry); err != nil {
+					return "", err
+				}
+			}
+
+			value = map[string]string{
+				":year":      date.Format("2006"),
+				":month":     date.Format("01"),
+				":monthname": date.Format("January"),
+				":day":       date.Format("02"),
+			}[segment]
+		default:
+			if strings.HasPrefix(segment, ":") {
+				return "", midas.Errorf(midas.ErrSiteConfig, "permalink token %s is not supported", segment)
+			}
+			value = segment
+		}
+
+		if value, err := s.slug(value); err == nil && value != "" {
+			segments = append(segments, value)
+		}
+	}
+
+	if len(segments) == 0 {
+		return "", midas.Errorf(midas.ErrInvalid, "permalink %s results in empty path", model.Permalink)
+	}
+
+	return filepath.FromSlash(strings.Join(segments, "/")), nil
+}
+
+// permalinkDate returns the entry date used by the permalink, in the site time zone.
+func (s SiteService) permalinkDate(model *midas.ModelSettings, entry map[string]interface{}) (time.Time, error) {
+	field := defaultDateField
+	if model.Timestamps.Date != "" {
+		field = model.Timestamps.Date
+	}
+
+	date, err := parseDate(entry[field])
+	if err != nil {
+		return time.Time{}, midas.Errorf(midas.ErrInvalid, "date field %s is malformed: %s", field, err)
+	}
+	if date.IsZero() {
+		return time.Time{}, midas.Errorf(midas.ErrInvalid, "permalink %s requires the date field %s", model.Permalink, field)
+	}
+
+	location, err := s.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return date.In(location), nil
+}
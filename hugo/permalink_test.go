@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSiteService_CreateEntry_Permalink(t *testing.T) {
+	entry := `{"id": 1, "Title": "First Post", "Category": "News/Local", "createdAt": "2022-03-05T23:30:00.000Z", "publishedAt": "2022-03-06T10:00:00.000Z"}`
+
+	tests := []struct {
+		name      string
+		permalink string
+		date      string
+		timeZone  string
+		entry     string
+		wantPath  string
+		wantErr   string
+	}{
+		{"Slug only", ":slug", "", "", entry, "posts/first-post.html", ""},
+		{"Year and slug", ":year/:slug", "", "", entry, "posts/2022/first-post.html", ""},
+		{"Full date", ":year/:month/:day/:slug", "", "", entry, "posts/2022/03/05/first-post.html", ""},
+		{"Date in time zone", ":year/:month/:day/:slug", "", "Europe/Warsaw", entry, "posts/2022/03/06/first-post.html", ""},
+		{"Month name", ":year/:monthname/:slug", "", "", entry, "posts/2022/march/first-post.html", ""},
+		{"Date field", ":year/:month/:day/:slug", "publishedAt", "", entry, "posts/2022/03/06/first-post.html", ""},
+		{"Section", ":section/:year/:slug", "", "", entry, "posts/news/local/2022/first-post.html", ""},
+		{"Missing section", ":section/:slug", "", "", `{"id": 1, "Title": "First Post"}`, "posts/first-post.html", ""},
+		{"Literal and title", "Archive/:title", "", "", entry, "posts/archive/first-post.html", ""},
+		{"Sanitized", "../:year/:slug", "", "", entry, "posts/2022/first-post.html", ""},
+		{"Missing date", ":year/:slug", "", "", `{"id": 1, "Title": "First Post"}`, "", midas.ErrInvalid},
+		{"Unknown token", ":weekday/:slug", "", "", entry, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := "Category"
+			model := midas.ModelSettings{ArchetypePath: "archetypes/post.md", OutputDir: "posts", Permalink: tt.permalink}
+			model.Fields.OutputDir = &section
+			model.Timestamps.Date = tt.date
+
+			s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+				"archetypes/post.md": `{{ index .Entry "Title" }}`,
+			})
+			s.Site.TimeZone = tt.timeZone
+
+			_, rendered, renderErr := s.RenderEntry(mustParsePayload(t, "entry.create", "post", tt.entry))
+			var renderedRel string
+			if renderErr == nil {
+				renderedRel = filepath.Join(model.OutputDir, rendered.Filename)
+			}
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", tt.entry))
+
+			var rel string
+			if outputPath != "" {
+				rel, _ = filepath.Rel(s.Site.RootDir, outputPath)
+			}
+			_, statErr := os.Stat(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":  {midas.ErrorCode(err), tt.wantErr},
+				"Path":        {filepath.ToSlash(rel), tt.wantPath},
+				"Written":     {statErr == nil, tt.wantErr == ""},
+				"Render code": {midas.ErrorCode(renderErr), tt.wantErr},
+				"Rendered":    {filepath.ToSlash(renderedRel), tt.wantPath},
+			})
+		})
+	}
+}
+
+func TestSiteService_UpdateEntry_Permalink(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Permalink: ":year/:slug"},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }}`,
+	})
+
+	oldPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Post", "createdAt": "2021-12-31T10:00:00.000Z"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed", "createdAt": "2022-01-01T10:00:00.000Z"}`))
+	_, oldErr := os.Stat(oldPath)
+	rel, _ := filepath.Rel(s.Site.RootDir, newPath)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":       {err, nil},
+		"Path":        {filepath.ToSlash(rel), "posts/2022/renamed.html"},
+		"Old removed": {os.IsNotExist(oldErr), true},
+	})
+}
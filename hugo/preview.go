@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPreviewTimeout = 30 * time.Second
+
+// previewPollInterval is the delay between the requests to the preview server which isn't listening yet.
+var previewPollInterval = 100 * time.Millisecond
+
+// RenderPreview renders the site in memory and returns the page of given path (relative to the site root, i.e.
+// /posts/first/), without writing the build destination. If the model is given, only its build segments are
+// rendered (see BuildModel).
+//
+// Hugo renders to memory only in the server mode, so a Hugo server is started on a free local port for each
+// preview, and stopped after the page is read. The server renders the whole site (or segments) on start, so the
+// preview takes about as long as the build.
+func (s SiteService) RenderPreview(ctx context.Context, model, path string) ([]byte, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrInternal, "no free port for hugo preview server: %s", err)
+	}
+
+	var segments []string
+	if model != "" {
+		segments = s.buildSegments(model)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.previewTimeout())
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := s.buildCommand(ctx, s.constructPreviewArgs(port, segments...))
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err = cmd.Start(); err != nil {
+		return nil, midas.Errorf(midas.ErrInternal, "hugo preview server couldn't be started: %s", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/%s", port, strings.TrimPrefix(path, "/"))
+	content, err := waitPreview(ctx, url, exited)
+
+	// The output is complete only after the server exits
+	cancel()
+	if !errors.Is(err, errPreviewExited) {
+		<-exited
+	}
+
+	if errors.Is(err, errPreviewExited) {
+		return nil, midas.Errorf(midas.ErrInternal, "hugo preview server exited before rendering %s\ncommand output: %s", path, out.String())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, midas.Errorf(midas.ErrInternal, "hugo preview of %s timed out after %s\ncommand output: %s", path, s.previewTimeout(), out.String())
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil, midas.Errorf(midas.ErrCancelled, "preview of %s cancelled", path)
+	}
+
+	return content, err
+}
+
+// errPreviewExited is returned by waitPreview if the server exits before responding.
+var errPreviewExited = errors.New("preview server exited")
+
+// waitPreview requests the page from the preview server until it's listening, and returns the page content.
+func waitPreview(ctx context.Context, url string, exited <-chan error) ([]byte, error) {
+	for {
+		content, status, err := getPreview(ctx, url)
+		if err == nil {
+			switch status {
+			case http.StatusOK:
+				return content, nil
+			case http.StatusNotFound:
+				return nil, midas.Errorf(midas.ErrNotFound, "preview page %s not found", url)
+			default:
+				return nil, midas.Errorf(midas.ErrInternal, "preview page %s responded with status %d", url, status)
+			}
+		}
+
+		select {
+		case <-exited:
+			return nil, errPreviewExited
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(previewPollInterval):
+		}
+	}
+}
+
+// getPreview requests the page from the preview server, and returns its content and status.
+func getPreview(ctx context.Context, url string) ([]byte, int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return content, response.StatusCode, nil
+}
+
+// constructPreviewArgs generates hugo server arguments rendering the site in memory on given port. The drafts
+// preview uses the draft environment and flags like the drafts build. If segments are provided, only these are
+// rendered.
+func (s SiteService) constructPreviewArgs(port int, segments ...string) []string {
+	arg := []string{
+		"server",
+		"--renderToMemory",
+		"--bind", "127.0.0.1",
+		"--port", strconv.Itoa(port),
+		"--baseURL", "http://127.0.0.1/",
+		"--disableLiveReload",
+		"--watch=false",
+		"--ignoreCache",
+	}
+
+	// Hugo server defaults to the development environment
+	arg = append(arg, "-e")
+	if s.Site.Preview.Drafts {
+		if s.Site.OutputSettings.DraftEnvironment != "" {
+			arg = append(arg, s.Site.OutputSettings.DraftEnvironment)
+		} else {
+			arg = append(arg, "development")
+		}
+
+		arg = append(arg, "-D", "-E", "-F")
+	} else {
+		arg = append(arg, "production")
+	}
+
+	if len(segments) > 0 {
+		arg = append(arg, "--renderSegments", strings.Join(segments, ","))
+	}
+
+	return arg
+}
+
+// previewTimeout returns the duration the preview waits for the rendered page.
+func (s SiteService) previewTimeout() time.Duration {
+	if timeout := s.Site.Preview.Timeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+
+	return defaultPreviewTimeout
+}
+
+// freePort returns a local port which is free at the moment.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
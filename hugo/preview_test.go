@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"context"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// previewServerEnv makes the test binary act as the fake hugo preview server (see TestPreviewServerProcess).
+const previewServerEnv = "MIDAS_TEST_PREVIEW_SERVER"
+
+// TestPreviewServerProcess isn't a real test: it serves the fake preview pages, when the test binary is run as the
+// hugo server by the fake hugo script.
+func TestPreviewServerProcess(t *testing.T) {
+	if os.Getenv(previewServerEnv) == "" {
+		return
+	}
+
+	var port string
+	for i, arg := range os.Args {
+		if arg == "--port" && i+1 < len(os.Args) {
+			port = os.Args[i+1]
+		}
+	}
+
+	err := http.ListenAndServe("127.0.0.1:"+port, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/posts/first/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "<h1>First</h1><!-- %s -->", strings.Join(os.Args[3:], " "))
+	}))
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// useFakePreviewServer replaces the hugo binary with the test binary serving the fake preview pages.
+func useFakePreviewServer(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(previewServerEnv, "1")
+	useFakeHugo(t, fmt.Sprintf("exec '%s' -test.run=TestPreviewServerProcess -- \"$@\"", executable))
+}
+
+func TestSiteService_constructPreviewArgs(t *testing.T) {
+	s := newTestSite(t, nil, nil)
+	s.Site.OutputSettings.DraftEnvironment = "staging"
+
+	server := []string{"server", "--renderToMemory", "--bind", "127.0.0.1", "--port", "1313", "--baseURL",
+		"http://127.0.0.1/", "--disableLiveReload", "--watch=false", "--ignoreCache"}
+
+	drafts := s
+	drafts.Site.Preview.Drafts = true
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Site": {fmt.Sprint(s.constructPreviewArgs(1313)), fmt.Sprint(append(server, "-e", "production"))},
+		"Segments": {fmt.Sprint(s.constructPreviewArgs(1313, "posts", "home")),
+			fmt.Sprint(append(server, "-e", "production", "--renderSegments", "posts,home"))},
+		"Drafts": {fmt.Sprint(drafts.constructPreviewArgs(1313)),
+			fmt.Sprint(append(server, "-e", "staging", "-D", "-E", "-F"))},
+	})
+}
+
+func TestSiteService_RenderPreview(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{"post": {BuildSegments: []string{"posts"}}}, nil)
+	s.Site.SelectiveBuild = true
+
+	t.Run("Rendered", func(t *testing.T) {
+		useFakePreviewServer(t)
+
+		content, err := s.RenderPreview(context.Background(), "post", "/posts/first/")
+
+		_, statErr := os.Stat(s.Site.PublicPath(false))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Content":        {strings.HasPrefix(string(content), "<h1>First</h1>"), true},
+			"Render flags":   {strings.Contains(string(content), "server --renderToMemory --bind 127.0.0.1"), true},
+			"Segments":       {strings.Contains(string(content), "--renderSegments posts"), true},
+			"No destination": {os.IsNotExist(statErr), true},
+		})
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		useFakePreviewServer(t)
+
+		_, err := s.RenderPreview(context.Background(), "", "/posts/missing/")
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrNotFound, "Error code")
+	})
+
+	t.Run("Server failed", func(t *testing.T) {
+		useFakeHugo(t, "echo 'Error: module \"theme\" not found' >&2\nexit 1")
+
+		_, err := s.RenderPreview(context.Background(), "", "/posts/first/")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":     {midas.ErrorCode(err), midas.ErrInternal},
+			"Output capture": {strings.Contains(midas.ErrorMessage(err), `module "theme" not found`), true},
+		})
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		useFakeHugo(t, "exec /bin/sleep 10")
+		s.Site.Preview.Timeout = 1
+
+		_, err := s.RenderPreview(context.Background(), "", "/posts/first/")
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInternal, "Error code")
+	})
+}
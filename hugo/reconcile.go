@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Discrepancies is the difference between the registry and the files in the output directories.
+type Discrepancies struct {
+	Missing   map[string]string // Registry entries (id => path) whose files don't exist
+	Untracked []string          // Entry files (sorted) not tracked in the registry
+	Fixed     bool              // Missing entries were removed from the registry
+}
+
+// Empty returns true if the registry matches the files.
+func (d Discrepancies) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Untracked) == 0
+}
+
+// Reconcile compares the registry with the entry files (pages and data files) in the output directories of
+// the collection types, i.e. to recover after the failed flush. If fix is true, the entries whose files are missing
+// are removed from the registry. The untracked files are only reported, as they may be written by hand.
+func (s SiteService) Reconcile(fix bool) (Discrepancies, error) {
+	defer s.locks.lockAll()()
+
+	discrepancies := Discrepancies{Missing: map[string]string{}}
+
+	entries, err := s.registry.ReadEntries()
+	if err != nil {
+		return discrepancies, err
+	}
+
+	tracked := make(map[string]bool, len(entries))
+	for id, path := range entries {
+		// Entries created by the update of untracked entry have no path, the previous slugs aren't files
+		if path == "" || isMetadataId(id) {
+			continue
+		}
+		tracked[filepath.Clean(path)] = true
+
+		if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			discrepancies.Missing[id] = path
+		} else if err != nil {
+			return discrepancies, err
+		}
+	}
+
+	files, err := s.entryFiles()
+	if err != nil {
+		return discrepancies, err
+	}
+	for _, path := range files {
+		if !tracked[path] {
+			discrepancies.Untracked = append(discrepancies.Untracked, path)
+		}
+	}
+
+	if !fix || len(discrepancies.Missing) == 0 {
+		return discrepancies, nil
+	}
+
+	for id := range discrepancies.Missing {
+		if err = s.registry.DeleteEntry(id); err != nil {
+			return discrepancies, err
+		}
+	}
+	if err = s.registry.Flush(); err != nil {
+		return discrepancies, err
+	}
+	discrepancies.Fixed = true
+
+	return discrepancies, nil
+}
+
+// entryFiles returns the (sorted) paths of the pages in the output directories and the data files in the data
+// directories of the collection types.
+func (s SiteService) entryFiles() ([]string, error) {
+	type entryDir struct {
+		path      string
+		extension string // Extension of the entry files
+		name      string // Name of the entry files (the bundle index), matched instead of the extension
+	}
+
+	dirs := map[entryDir]bool{}
+	addDir := func(dir, extension, name string) {
+		if dir == "" || dir == "false" {
+			return
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(s.Site.RootDir, dir)
+		}
+
+		for _, localized := range s.localizedDirs(filepath.Clean(dir)) {
+			dirs[entryDir{path: localized, extension: extension, name: name}] = true
+		}
+	}
+
+	for _, model := range s.Site.CollectionTypes {
+		index, err := bundleIndex(&model)
+		if err != nil {
+			return nil, err
+		}
+
+		addDir(model.OutputDir, ".html", index)
+		addDir(model.DraftOutputDir, ".html", index)
+		addDir(model.DataDir, ".json", "")
+	}
+
+	found := map[string]bool{}
+	for dir := range dirs {
+		err := filepath.WalkDir(dir.path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			// The bundle index of the localized entry has the language suffix
+			_, name := s.fileLanguage(entry.Name())
+			if (dir.name == "" && filepath.Ext(path) == dir.extension) || (dir.name != "" && name == dir.name) {
+				found[path] = true
+			}
+
+			return nil
+		})
+		// Directory is created with the first entry
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	files := make([]string, 0, len(found))
+	for path := range found {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSiteService_Reconcile(t *testing.T) {
+	newSite := func(t *testing.T) SiteService {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DataDir: "data/posts"},
+		}, map[string]string{
+			"archetypes/post.md":          `{{ index .Entry "Title" }}`,
+			"posts/_index.md":             "section",
+			"posts/notes.md":              "not an entry file",
+			"posts/manual.html":           "written by hand",
+			"posts/section/nested.html":   "written by hand",
+			"data/posts/orphan.json":      "{}",
+			"content/elsewhere/page.html": "not in an output directory",
+		})
+
+		for _, entry := range []string{`{"id": 1, "Title": "Kept"}`, `{"id": 2, "Title": "Removed"}`, `{"id": 3, "Title": "Unflushed"}`} {
+			if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Drift: the file removed by hand, the entry lost by the failed flush, and the entry without the path
+		if err := os.Remove(filepath.Join(s.Site.RootDir, "posts", "removed.html")); err != nil {
+			t.Fatal(err)
+		}
+		_ = s.registry.DeleteEntry("post-3")
+		_ = s.registry.CreateEntry("post-4", "")
+
+		return s
+	}
+
+	rel := func(s SiteService, paths []string) string {
+		for i, path := range paths {
+			paths[i], _ = filepath.Rel(s.Site.RootDir, path)
+		}
+
+		return filepath.ToSlash(strings.Join(paths, ","))
+	}
+
+	t.Run("Report", func(t *testing.T) {
+		s := newSite(t)
+
+		discrepancies, err := s.Reconcile(false)
+		entries, _ := s.registry.ReadEntries()
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":     {err, nil},
+			"Missing":   {len(discrepancies.Missing), 1},
+			"Removed":   {discrepancies.Missing["post-2"], filepath.Join(s.Site.RootDir, "posts", "removed.html")},
+			"Untracked": {rel(s, discrepancies.Untracked), "data/posts/orphan.json,posts/manual.html,posts/section/nested.html,posts/unflushed.html"},
+			"Fixed":     {discrepancies.Fixed, false},
+			"Empty":     {discrepancies.Empty(), false},
+			"Entries":   {len(entries), 6},
+		})
+	})
+
+	t.Run("Fix", func(t *testing.T) {
+		s := newSite(t)
+
+		discrepancies, err := s.Reconcile(true)
+		_, removedErr := s.registry.ReadEntry("post-2")
+		_, removedDataErr := s.registry.ReadEntry("post-2" + dataIdSuffix)
+		again, againErr := s.Reconcile(false)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":                {err, nil},
+			"Missing":              {len(discrepancies.Missing), 1},
+			"Fixed":                {discrepancies.Fixed, true},
+			"Entry removed":        {midas.ErrorCode(removedErr), midas.ErrNotFound},
+			"Data entry kept":      {removedDataErr, nil},
+			"Untracked files kept": {fileExists(filepath.Join(s.Site.RootDir, "posts", "manual.html")), true},
+			"Again error":          {againErr, nil},
+			"Again missing":        {len(again.Missing), 0},
+			"Again untracked":      {len(again.Untracked), 4},
+		})
+	})
+
+	t.Run("In sync", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DataDir: "data/posts"},
+			"page": {ArchetypePath: "archetypes/post.md", OutputDir: "false"},
+		}, map[string]string{
+			"archetypes/post.md": `{{ index .Entry "Title" }}`,
+		})
+
+		emptyDiscrepancies, emptyErr := s.Reconcile(true)
+
+		_, _ = s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Synced"}`))
+		discrepancies, err := s.Reconcile(true)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"No directories error": {emptyErr, nil},
+			"No directories empty": {emptyDiscrepancies.Empty(), true},
+			"Error":                {err, nil},
+			"Empty":                {discrepancies.Empty(), true},
+			"Fixed":                {discrepancies.Fixed, false},
+		})
+	})
+}
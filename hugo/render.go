@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"errors"
+	"github.com/kovansky/midas"
+	"io"
+	"os"
+)
+
+// RenderedEntry describes the entry rendered by RenderEntry.
+type RenderedEntry struct {
+	Model    string
+	Slug     string
+	Filename string // Filename of the entry page, relative to its output directory
+}
+
+// RenderEntry renders the entry archetype into memory and returns the generated content, which may be
+// copied to any io.Writer. It doesn't write to the disk (the archetype files are only read) nor to the registry.
+//
+// CreateEntry and UpdateEntry are built on top of the rendering: they resolve the output path, write the
+// rendered content to it and track it in the registry.
+func (s SiteService) RenderEntry(payload midas.Payload) (io.Reader, RenderedEntry, error) {
+	content, rendered, err := s.renderEntry(payload, nil)
+	if err != nil {
+		return nil, RenderedEntry{}, err
+	}
+
+	return content, rendered, nil
+}
+
+// renderEntry implements RenderEntry, with the aliases added to the front matter (i.e. the previous slug of the
+// renamed entry).
+func (s SiteService) renderEntry(payload midas.Payload, aliases []string) (*bytes.Buffer, RenderedEntry, error) {
+	modelName, _ := payload.Metadata()["model"].(string)
+	model, _ := s.getModel(modelName)
+	if model == nil {
+		return nil, RenderedEntry{}, midas.Errorf(midas.ErrUnaccepted, "model %s is not accepted", modelName)
+	}
+
+	if model.OutputDir == "false" {
+		return nil, RenderedEntry{}, midas.Errorf(midas.ErrInvalid, "model %s has no page output", modelName)
+	}
+
+	slug, err := s.entrySlug(model, payload.Entry())
+	if err != nil {
+		return nil, RenderedEntry{}, err
+	}
+
+	// Resolved like the output path, without the output directory
+	filename, err := s.entryPath(model, payload.Entry(), "", slug)
+	if err != nil {
+		return nil, RenderedEntry{}, err
+	}
+
+	content, err := s.renderPage(model, modelName, payload, aliases)
+	if err != nil {
+		return nil, RenderedEntry{}, err
+	}
+
+	return content, RenderedEntry{Model: modelName, Slug: slug, Filename: filename}, nil
+}
+
+// renderPage renders the entry page into memory: with the model renderer, if configured, or by executing the model
+// archetype otherwise.
+func (s SiteService) renderPage(model *midas.ModelSettings, modelName string, payload midas.Payload, aliases []string) (*bytes.Buffer, error) {
+	r, name, err := renderer(model)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return s.renderWith(r, name, model, modelName, payload, aliases)
+	}
+
+	archetypePath, err := s.archetypePath(model, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := s.parseArchetype(model, archetypePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var content bytes.Buffer
+	if err = s.executeTemplate(tmpl, &content, payload, aliases); err != nil {
+		return nil, err
+	}
+
+	return &content, nil
+}
+
+// preserveManualFields adds the front matter keys of the existing entry file missing in the rendered content,
+// except for the ones generated by the previous rendering of the entry. The file removed in the meantime is skipped.
+// The caller must hold the entry lock.
+func (s SiteService) preserveManualFields(entryId, path string, content *bytes.Buffer) (*bytes.Buffer, error) {
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return content, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	generated, err := s.entryGeneratedKeys(entryId)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewBufferString(preserveFrontMatter(content.String(), string(existing), generated)), nil
+}
+
+// writePage writes the rendered content to the output path and runs the post-write actions on it. If any of them
+// fails, the overwritten file is restored, or the new one removed.
+func (s SiteService) writePage(model *midas.ModelSettings, outputPath string, content io.Reader) error {
+	previous, err := os.ReadFile(outputPath)
+	overwritten := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(output, content)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.postWrite(model, outputPath)
+	}
+	if err != nil {
+		if overwritten {
+			_ = os.WriteFile(outputPath, previous, 0664)
+		} else {
+			_ = os.Remove(outputPath)
+		}
+		return err
+	}
+
+	return nil
+}
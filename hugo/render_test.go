@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSiteService_RenderEntry(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post":   {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DataDir: "data/posts"},
+		"hidden": {Archetype: `{{ index .Entry "Title" }}`, OutputDir: "false"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+
+	rootBefore, _ := os.ReadDir(s.Site.RootDir)
+
+	output, rendered, err := s.RenderEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First Post"}`))
+	var content []byte
+	if err == nil {
+		content, err = io.ReadAll(output)
+	}
+
+	rootAfter, _ := os.ReadDir(s.Site.RootDir)
+	entries, _ := s.registry.ReadEntries()
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Render error":       {err, nil},
+		"Rendered content":   {string(content), "title: First Post"},
+		"Rendered model":     {rendered.Model, "post"},
+		"Rendered slug":      {rendered.Slug, "first-post"},
+		"Rendered filename":  {rendered.Filename, "first-post.html"},
+		"Output dir skipped": {fileExists(filepath.Join(s.Site.RootDir, "posts")), false},
+		"Data dir skipped":   {fileExists(filepath.Join(s.Site.RootDir, "data")), false},
+		"Root untouched":     {len(rootAfter), len(rootBefore)},
+		"Registry untouched": {len(entries), 0},
+	})
+
+	_, _, err = s.RenderEntry(mustParsePayload(t, "entry.create", "unknown", `{"id": 1, "Title": "First Post"}`))
+	testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrUnaccepted, "Unknown model")
+
+	_, _, err = s.RenderEntry(mustParsePayload(t, "entry.create", "hidden", `{"id": 1, "Title": "First Post"}`))
+	testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Model without pages")
+}
+
+func TestSiteService_RenderEntry_Written(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", AliasOnRename: true},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }} aliases: {{ .Aliases }}`,
+	})
+
+	rendered := func(payload midas.Payload) string {
+		output, _, err := s.RenderEntry(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(output)
+
+		return string(content)
+	}
+
+	created := mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`)
+	createdPath, err := s.CreateEntry(created)
+	createdContent, _ := os.ReadFile(createdPath)
+
+	updated := mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Renamed"}`)
+	updatedPath, updateErr := s.UpdateEntry(updated)
+	updatedContent, _ := os.ReadFile(updatedPath)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Create error":    {err, nil},
+		"Created content": {string(createdContent), rendered(created)},
+		"Update error":    {updateErr, nil},
+		// The alias of the previous slug is only known to the update
+		"Updated content": {string(updatedContent), `title: Renamed aliases: ["first"]`},
+		"Rendered update": {rendered(updated), `title: Renamed aliases: []`},
+	})
+}
+
+func TestSiteService_RenderEntry_Meta(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			Archetype: `{{ .Meta.Event }}|{{ .Meta.Model }}|{{ .Meta.CreatedAt.Format "2006-01-02" }}|{{ .Meta.Published }}|` +
+				`{{ index .Metadata "event" }}|{{ index .Entry "Title" }}`,
+			OutputDir: "posts",
+		},
+	}, nil)
+
+	tests := []struct {
+		name     string
+		event    string
+		entry    string
+		expected string
+	}{
+		{"Created", "entry.create", `{"id": 1, "Title": "First"}`, "Create|post|2022-01-01|false|Create|First"},
+		{"Published", "entry.publish", `{"id": 1, "Title": "First", "publishedAt": "2022-01-02T10:00:00.000Z"}`,
+			"Publish|post|2022-01-01|true|Publish|First"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, _, err := s.RenderEntry(mustParsePayload(t, tt.event, "post", tt.entry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(output)
+
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Rendered content")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"github.com/kovansky/midas"
+	"html/template"
+)
+
+// renderer returns the renderer configured for the model (and its name), or nil if the archetype is used.
+func renderer(model *midas.ModelSettings) (midas.Renderer, string, error) {
+	if model.Renderer == "" {
+		return nil, "", nil
+	}
+
+	r, ok := midas.Renderers[model.Renderer]
+	if !ok {
+		return nil, model.Renderer, midas.Errorf(midas.ErrSiteConfig, "renderer %s is not registered", model.Renderer)
+	}
+
+	return r, model.Renderer, nil
+}
+
+// renderWith renders the entry page with the custom renderer. The sanitized HTML fields are passed as strings, and
+// the entry is enriched with the front matter the archetype gets: the configured dates and timestamps (under their
+// front matter keys) and the aliases. The timestamps are injected into the rendered front matter, unless the renderer
+// sets them, and the content is limited to the maximum entry size.
+func (s SiteService) renderWith(r midas.Renderer, name string, model *midas.ModelSettings, modelName string, payload midas.Payload, aliases []string) (*bytes.Buffer, error) {
+	_, sanitized, err := s.sanitizedEntry(model, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	dates, timestamps, err := s.frontMatterDates(model, sanitized)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := make(map[string]interface{}, len(sanitized)+len(dates)+1)
+	for key, value := range sanitized {
+		if html, ok := value.(template.HTML); ok {
+			value = string(html)
+		}
+		entry[key] = value
+	}
+	for key, value := range dates {
+		if value != "" {
+			entry[key] = string(value)
+		}
+	}
+	if len(aliases) > 0 {
+		entry["aliases"] = append([]string{}, aliases...)
+	}
+
+	content, err := r.Render(modelName, entry)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrInternal, "renderer %s failed: %s", name, err)
+	}
+	if len(timestamps) > 0 {
+		content = []byte(injectFrontMatter(string(content), timestamps))
+	}
+
+	if maxSize := s.maxEntrySize(); maxSize >= 0 && int64(len(content)) > maxSize {
+		return nil, midas.Errorf(midas.ErrInvalid, "entry exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	return bytes.NewBuffer(content), nil
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// markdownRenderer maps the entry fields to the YAML front matter, with the Content field as the body.
+var markdownRenderer = midas.RendererFunc(func(model string, entry map[string]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		if key != "Content" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	builder.WriteString("---\nmodel: " + model + "\n")
+	for _, key := range keys {
+		builder.WriteString(fmt.Sprintf("%s: %v\n", key, entry[key]))
+	}
+	builder.WriteString(fmt.Sprintf("---\n%v\n", entry["Content"]))
+
+	return []byte(builder.String()), nil
+})
+
+func TestSiteService_Renderer(t *testing.T) {
+	previous := midas.Renderers
+	midas.Renderers = map[string]midas.Renderer{
+		"markdown": markdownRenderer,
+		"broken": midas.RendererFunc(func(_ string, _ map[string]interface{}) ([]byte, error) {
+			return nil, errors.New("renderer broke")
+		}),
+	}
+	t.Cleanup(func() {
+		midas.Renderers = previous
+	})
+
+	html := []string{"Content"}
+	allowed := []string{"Title", "Content"}
+
+	tests := []struct {
+		name        string
+		renderer    string
+		maxSize     int64
+		wantContent string
+		wantCode    string
+	}{
+		{"Archetype", "", 0, "Archetype: First post", ""},
+		{"Custom", "markdown", 0, "---\nmodel: post\nTitle: First post\n---\n<p>Hello</p>\n", ""},
+		{"Too large", "markdown", 10, "", midas.ErrInvalid},
+		{"Failing", "broken", 0, "", midas.ErrInternal},
+		{"Unregistered", "missing", 0, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := midas.ModelSettings{ArchetypePath: "archetypes/post.md", OutputDir: "posts", Renderer: tt.renderer}
+			model.Fields.HTML = &html
+			model.Fields.Allowed = &allowed
+
+			s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+				"archetypes/post.md": `Archetype: {{ index .Entry "Title" }}`,
+			})
+			s.Site.MaxEntrySize = tt.maxSize
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First post", "Content": "<p>Hello</p>", "secret": "token"}`))
+			if tt.wantCode != "" {
+				testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+				return
+			}
+
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":   {err, nil},
+				"File":    {filepath.Base(outputPath), "first-post.html"},
+				"Content": {string(content), tt.wantContent},
+			})
+		})
+	}
+
+	t.Run("Front matter", func(t *testing.T) {
+		midas.Renderers["title"] = midas.RendererFunc(func(_ string, entry map[string]interface{}) ([]byte, error) {
+			return []byte(fmt.Sprintf("---\ntitle: %v\npublishDate: %v\naliases: %v\n---\n", entry["Title"], entry["publishDate"], entry["aliases"])), nil
+		})
+
+		model := midas.ModelSettings{OutputDir: "posts", Renderer: "title", AliasOnRename: true, Dates: map[string]string{"publishDate": "publishedAt"}}
+		model.Timestamps.Enabled = true
+		s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, nil)
+
+		const entry = `{"id": 1, "Title": "%s", "createdAt": "2022-01-01T10:10:10.000Z", "updatedAt": "2022-01-02T10:10:10.000Z", "publishedAt": "2022-01-03"}`
+		if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", fmt.Sprintf(entry, "First"))); err != nil {
+			t.Fatal(err)
+		}
+
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", fmt.Sprintf(entry, "Renamed")))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {err, nil},
+			"Content": {string(content), "---\ntitle: Renamed\npublishDate: 2022-01-03T00:00:00Z\naliases: [first]\n" +
+				"date: 2022-01-01T10:10:10Z\nlastmod: 2022-01-02T10:10:10Z\n---\n"},
+		})
+	})
+
+	t.Run("Single page", func(t *testing.T) {
+		s := newTestSite(t, nil, nil)
+		s.Site.SingleTypes = map[string]midas.ModelSettings{
+			"about": {OutputFile: "about.md", Renderer: "markdown"},
+		}
+
+		outputPath, err := s.UpdateSingle(mustParsePayload(t, "entry.update", "about", `{"id": 1, "Title": "About", "Content": "Text"}`))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Content": {string(content), "---\nmodel: about\nTitle: About\nid: 1\n---\nText\n"},
+		})
+	})
+}
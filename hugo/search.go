@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kovansky/midas"
+	"golang.org/x/net/html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultSearchIndexPath = "search-index.json"
+	defaultContentDir      = "content"
+)
+
+// writeSearchIndex writes the search index of the tracked entries to the build destination, if it's enabled. The
+// drafts index also includes the unpublished entries.
+func (s SiteService) writeSearchIndex(isDraft bool) error {
+	settings := s.Site.SearchIndex
+	if !settings.Enabled {
+		return nil
+	}
+
+	index, err := s.searchIndex(isDraft)
+	if err != nil {
+		return err
+	}
+
+	path := settings.Path
+	if path == "" {
+		path = defaultSearchIndexPath
+	}
+	path = filepath.Join(s.Site.PublicPath(isDraft), path)
+
+	if err = os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, index, 0664)
+}
+
+// searchIndex returns the JSON search index of the tracked entries, sorted by the url. The entries are read from
+// their rendered files: the configured fields from the front matter, and the text from the content.
+func (s SiteService) searchIndex(isDraft bool) ([]byte, error) {
+	settings := s.Site.SearchIndex
+	if settings.Format != "" && settings.Format != "array" && settings.Format != "object" {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "unknown search index format %s", settings.Format)
+	}
+
+	entries, err := s.registry.ReadEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(entries))
+	for id, path := range entries {
+		// Tracked entries without the page (i.e. data only), and the previous slugs
+		if path == "" || isMetadataId(id) {
+			continue
+		}
+		if !isDraft && s.isDraftOutput(path) {
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	records := make([]map[string]interface{}, 0, len(paths))
+	byURL := make(map[string]map[string]interface{}, len(paths))
+	for _, path := range paths {
+		record, ok, err := s.searchRecord(path, isDraft)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		records = append(records, record)
+		if url, ok := record["url"].(string); ok {
+			byURL[url] = record
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		url, _ := records[i]["url"].(string)
+		otherURL, _ := records[j]["url"].(string)
+		return url < otherURL
+	})
+
+	var index interface{} = records
+	if settings.Format == "object" {
+		index = byURL
+	}
+
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(index); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(encoded.Bytes(), []byte("\n")), nil
+}
+
+// searchRecord returns the search index record of the entry file. Returns false for the drafts (marked in the front
+// matter) outside the drafts index, and for the files removed in the meantime.
+func (s SiteService) searchRecord(path string, isDraft bool) (map[string]interface{}, bool, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	settings := s.Site.SearchIndex
+	frontMatter, body := parseFrontMatter(string(content))
+	if draft, _ := frontMatter["draft"].(bool); draft && !isDraft {
+		return nil, false, nil
+	}
+
+	fields := settings.Fields
+	if len(fields) == 0 {
+		fields = []string{"title"}
+	}
+
+	record := make(map[string]interface{}, len(fields)+2)
+	for _, field := range fields {
+		if value, ok := frontMatter[field]; ok {
+			record[field] = value
+		}
+	}
+
+	if url := s.entryURL(path); url != "" {
+		record["url"] = url
+	}
+
+	if settings.Content {
+		record["content"] = searchText(body, settings.ContentLength)
+	}
+
+	return record, true, nil
+}
+
+// entryURL returns the url of the entry page, as it's served by Hugo (without the base url), or empty if the file
+// is outside the content directory. The page of the localized entry is served under its language, unless it's the
+// default one.
+func (s SiteService) entryURL(path string) string {
+	language, path := s.fileLanguage(path)
+	defaultLanguage, _ := s.defaultLanguage()
+
+	contentDir := s.Site.SearchIndex.ContentDir
+	if contentDir == "" {
+		contentDir = defaultContentDir
+	}
+	if !filepath.IsAbs(contentDir) {
+		contentDir = filepath.Join(s.Site.RootDir, contentDir)
+	}
+
+	rel, err := filepath.Rel(contentDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	// The bundle is served at its directory
+	if name := filepath.Base(rel); name == "index" || name == "_index" {
+		rel = filepath.Dir(rel)
+	}
+
+	prefix := ""
+	if language != "" && language != defaultLanguage {
+		prefix = "/" + language
+	}
+	if rel == "." {
+		return prefix + "/"
+	}
+
+	return prefix + "/" + filepath.ToSlash(rel) + "/"
+}
+
+// isDraftOutput returns true if the file is written to the draft output directory of any model (in any language).
+func (s SiteService) isDraftOutput(path string) bool {
+	for _, models := range []map[string]midas.ModelSettings{s.Site.CollectionTypes, s.Site.SingleTypes} {
+		for _, model := range models {
+			if model.DraftOutputDir == "" {
+				continue
+			}
+
+			dir := model.DraftOutputDir
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(s.Site.RootDir, dir)
+			}
+
+			for _, dir := range s.localizedDirs(filepath.Clean(dir)) {
+				if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// searchText returns the text of the HTML content with the whitespace collapsed, truncated to given number of
+// characters (if positive).
+func searchText(content string, length int) string {
+	text := content
+	if document, err := html.Parse(strings.NewReader(content)); err == nil {
+		text = textContent(document)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	if runes := []rune(text); length > 0 && len(runes) > length {
+		return string(runes[:length])
+	}
+
+	return text
+}
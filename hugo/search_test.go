@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSiteService_searchIndex(t *testing.T) {
+	archetype := "---\ntitle: {{ index .Entry \"Title\" }}\nsummary: '{{ index .Entry \"Summary\" }}'\ndraft: {{ index .Entry \"Draft\" }}\n---\n{{ .Body }}\n"
+
+	newSite := func(t *testing.T, settings midas.SearchIndexSettings) SiteService {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "content/posts", DraftOutputDir: "drafts/posts"},
+			"page": {ArchetypePath: "archetypes/post.md", OutputDir: "pages"},
+		}, map[string]string{
+			"archetypes/post.md": archetype,
+		})
+		body := "Content"
+		for name, model := range s.Site.CollectionTypes {
+			model.Fields.Body, model.TrustedBody = &body, true
+			s.Site.CollectionTypes[name] = model
+		}
+		s.Site.SearchIndex = settings
+
+		entries := []midas.Payload{
+			mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Second post", "Summary": "Second", "Draft": false, "Content": "<p>Lorem <b>ipsum</b></p>\n<p>dolor   sit</p>", "publishedAt": "2022-05-01T10:00:00.000Z"}`),
+			mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "First post", "Summary": "First", "Draft": false, "Content": "<p>Amet</p>", "publishedAt": "2022-05-01T10:00:00.000Z"}`),
+			mustParsePayload(t, "entry.create", "post", `{"id": 3, "Title": "Unpublished", "Summary": "Draft", "Draft": false, "Content": "<p>Draft</p>"}`),
+			mustParsePayload(t, "entry.create", "post", `{"id": 4, "Title": "Marked", "Summary": "Draft", "Draft": true, "Content": "<p>Draft</p>", "publishedAt": "2022-05-01T10:00:00.000Z"}`),
+			mustParsePayload(t, "entry.create", "page", `{"id": 1, "Title": "About", "Summary": "Outside", "Draft": false, "Content": "<p>About</p>"}`),
+		}
+		for _, payload := range entries {
+			if _, err := s.CreateEntry(payload); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		settings midas.SearchIndexSettings
+		isDraft  bool
+		want     string
+		wantErr  string
+	}{
+		{
+			"Default fields",
+			midas.SearchIndexSettings{Enabled: true},
+			false,
+			`[{"title":"About"},{"title":"First post","url":"/posts/first-post/"},{"title":"Second post","url":"/posts/second-post/"}]`,
+			"",
+		},
+		{
+			"Fields and content",
+			midas.SearchIndexSettings{Enabled: true, Fields: []string{"title", "summary", "missing"}, Content: true, ContentLength: 15},
+			false,
+			`[{"content":"About","summary":"Outside","title":"About"},{"content":"Amet","summary":"First","title":"First post","url":"/posts/first-post/"},{"content":"Lorem ipsum dol","summary":"Second","title":"Second post","url":"/posts/second-post/"}]`,
+			"",
+		},
+		{
+			"Object",
+			midas.SearchIndexSettings{Enabled: true, Format: "object"},
+			false,
+			`{"/posts/first-post/":{"title":"First post","url":"/posts/first-post/"},"/posts/second-post/":{"title":"Second post","url":"/posts/second-post/"}}`,
+			"",
+		},
+		{
+			"Drafts",
+			midas.SearchIndexSettings{Enabled: true, ContentDir: "."},
+			true,
+			`[{"title":"First post","url":"/content/posts/first-post/"},{"title":"Marked","url":"/content/posts/marked/"},{"title":"Second post","url":"/content/posts/second-post/"},{"title":"Unpublished","url":"/drafts/posts/unpublished/"},{"title":"About","url":"/pages/about/"}]`,
+			"",
+		},
+		{
+			"Unknown format",
+			midas.SearchIndexSettings{Enabled: true, Format: "lunr"},
+			false,
+			"",
+			midas.ErrSiteConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := newSite(t, tt.settings).searchIndex(tt.isDraft)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Index":      {string(index), tt.want},
+			})
+		})
+	}
+
+	t.Run("Written to build destination", func(t *testing.T) {
+		s := newSite(t, midas.SearchIndexSettings{Enabled: true, Path: "search/index.json"})
+
+		err := s.writeSearchIndex(false)
+		index, _ := os.ReadFile(filepath.Join(s.Site.RootDir, "public", "search", "index.json"))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {err, nil},
+			"Index": {string(index), `[{"title":"About"},{"title":"First post","url":"/posts/first-post/"},{"title":"Second post","url":"/posts/second-post/"}]`},
+		})
+	})
+
+	t.Run("Bundle urls", func(t *testing.T) {
+		s := newTestSite(t, nil, nil)
+		content := filepath.Join(s.Site.RootDir, "content")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Page":          {s.entryURL(filepath.Join(content, "posts", "first.html")), "/posts/first/"},
+			"Leaf bundle":   {s.entryURL(filepath.Join(content, "posts", "first", "index.md")), "/posts/first/"},
+			"Branch bundle": {s.entryURL(filepath.Join(content, "posts", "first", "_index.html")), "/posts/first/"},
+			"Home":          {s.entryURL(filepath.Join(content, "_index.md")), "/"},
+		})
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := newSite(t, midas.SearchIndexSettings{})
+
+		err := s.writeSearchIndex(false)
+		_, statErr := os.Stat(filepath.Join(s.Site.RootDir, "public", defaultSearchIndexPath))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Written": {os.IsNotExist(statErr), true},
+		})
+	})
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"sort"
+	"strings"
+)
+
+var _ midas.RegistryService = (*shardedRegistry)(nil)
+
+// shardedRegistry keeps the entries of each model in a separate registry (see midas.RegistrySettings.ShardByModel),
+// routing the entries by the model prefix of their id. Only the shards changed since the last flush are written.
+// It is not synchronized, as the SiteService wraps it in the lockedRegistry.
+type shardedRegistry struct {
+	shards map[string]midas.RegistryService // [model] => registry
+	models []string                         // Longest first, so the model whose name is a prefix of other isn't matched
+	dirty  map[string]bool
+
+	requireExisting bool // Whether the shards which can't be opened are created
+}
+
+// newShardedRegistry creates the registry shard for each collection and single type of the site.
+func newShardedRegistry(site midas.Site, newRegistry func(site midas.Site) midas.RegistryService) *shardedRegistry {
+	r := &shardedRegistry{
+		shards:          map[string]midas.RegistryService{},
+		dirty:           map[string]bool{},
+		requireExisting: site.Registry.RequireExisting,
+	}
+
+	for _, models := range []map[string]midas.ModelSettings{site.CollectionTypes, site.SingleTypes} {
+		for model := range models {
+			shardSite := site
+			shardSite.Registry.Location = site.Registry.ShardLocation(model)
+
+			r.shards[model] = newRegistry(shardSite)
+			r.models = append(r.models, model)
+		}
+	}
+
+	sort.Slice(r.models, func(i, j int) bool {
+		if len(r.models[i]) != len(r.models[j]) {
+			return len(r.models[i]) > len(r.models[j])
+		}
+		return r.models[i] < r.models[j]
+	})
+
+	return r
+}
+
+// shard returns the model and the registry shard of the entry (<model>-<id>, optionally with a suffix).
+func (r *shardedRegistry) shard(id string) (string, midas.RegistryService, bool) {
+	for _, model := range r.models {
+		if strings.HasPrefix(id, model+"-") {
+			return model, r.shards[model], true
+		}
+	}
+
+	return "", nil, false
+}
+
+// OpenStorage opens each shard, creating the ones which can't be opened (unless the existing registry is required).
+func (r *shardedRegistry) OpenStorage() error {
+	for _, model := range r.models {
+		if err := r.shards[model].OpenStorage(); err != nil {
+			if r.requireExisting {
+				return err
+			}
+			if err = r.shards[model].CreateStorage(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *shardedRegistry) CloseStorage() {
+	for _, model := range r.models {
+		r.shards[model].CloseStorage()
+	}
+}
+
+func (r *shardedRegistry) CreateStorage() error {
+	for _, model := range r.models {
+		if err := r.shards[model].CreateStorage(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *shardedRegistry) RemoveStorage() error {
+	for _, model := range r.models {
+		if err := r.shards[model].RemoveStorage(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush writes the shards changed since the last flush. Shards which fail to flush stay dirty, so they are written
+// by the next flush; the first error is returned after all the shards are attempted.
+func (r *shardedRegistry) Flush() error {
+	var firstErr error
+	for _, model := range r.models {
+		if !r.dirty[model] {
+			continue
+		}
+
+		if err := r.shards[model].Flush(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(r.dirty, model)
+	}
+
+	return firstErr
+}
+
+func (r *shardedRegistry) CreateEntry(id, filename string) error {
+	model, shard, ok := r.shard(id)
+	if !ok {
+		return midas.Errorf(midas.ErrRegistry, "no registry shard for entry %s", id)
+	}
+
+	if err := shard.CreateEntry(id, filename); err != nil {
+		return err
+	}
+	r.dirty[model] = true
+
+	return nil
+}
+
+func (r *shardedRegistry) ReadEntry(id string) (string, error) {
+	_, shard, ok := r.shard(id)
+	if !ok {
+		return "", midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
+	}
+
+	return shard.ReadEntry(id)
+}
+
+// ReadEntries returns the entries of all the shards.
+func (r *shardedRegistry) ReadEntries() (midas.Registry, error) {
+	entries := make(midas.Registry)
+	for _, model := range r.models {
+		shardEntries, err := r.shards[model].ReadEntries()
+		if err != nil {
+			return nil, err
+		}
+
+		for id, filename := range shardEntries {
+			entries[id] = filename
+		}
+	}
+
+	return entries, nil
+}
+
+func (r *shardedRegistry) UpdateEntry(id, newFilename string) error {
+	model, shard, ok := r.shard(id)
+	if !ok {
+		return midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
+	}
+
+	if err := shard.UpdateEntry(id, newFilename); err != nil {
+		return err
+	}
+	r.dirty[model] = true
+
+	return nil
+}
+
+func (r *shardedRegistry) DeleteEntry(id string) error {
+	model, shard, ok := r.shard(id)
+	if !ok {
+		return midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
+	}
+
+	if err := shard.DeleteEntry(id); err != nil {
+		return err
+	}
+	r.dirty[model] = true
+
+	return nil
+}
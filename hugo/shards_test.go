@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/jsonfile"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNewSiteService_ShardByModel(t *testing.T) {
+	previous := midas.RegistryServices
+	midas.RegistryServices = map[string]func(site midas.Site) midas.RegistryService{"jsonfile": jsonfile.NewRegistryService}
+	defer func() {
+		midas.RegistryServices = previous
+	}()
+
+	rootDir := t.TempDir()
+	archetype := filepath.Join(rootDir, "archetypes", "post.md")
+	if err := os.MkdirAll(filepath.Dir(archetype), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(archetype, []byte(`{{ index .Entry "Title" }}`), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := NewSiteService(midas.Site{
+		SiteName: "test",
+		RootDir:  rootDir,
+		Registry: midas.RegistrySettings{Type: "jsonfile", Location: "registry.json", ShardByModel: true},
+		CollectionTypes: map[string]midas.ModelSettings{
+			"post":      {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+			"blog-post": {ArchetypePath: "archetypes/post.md", OutputDir: "blog"},
+		},
+		SingleTypes: map[string]midas.ModelSettings{"settings": {OutputDir: "data"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := service.(SiteService)
+
+	for _, payload := range []midas.Payload{
+		mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Post"}`),
+		mustParsePayload(t, "entry.create", "blog-post", `{"id": 1, "Title": "Blog post"}`),
+		mustParsePayload(t, "entry.create", "blog-post", `{"id": 2, "Title": "Other blog post"}`),
+	} {
+		if _, err = s.CreateEntry(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// shardIds returns the ids of the entries stored in the shard file
+	shardIds := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(rootDir, name))
+		if err != nil {
+			return err.Error()
+		}
+
+		var stored struct {
+			Entries midas.Registry `json:"entries"`
+		}
+		if err = json.Unmarshal(content, &stored); err != nil {
+			return err.Error()
+		}
+
+		var ids []string
+		for id := range stored.Entries {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		return strings.Join(ids, ",")
+	}
+
+	entries, entriesErr := s.registry.ReadEntries()
+	blogPath, readErr := s.registry.ReadEntry("blog-post-1")
+	unknownErr := s.registry.CreateEntry("page-1", "page.html")
+	_, unknownReadErr := s.registry.ReadEntry("page-1")
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Post shard":       {shardIds("registry.post.json"), "post-1"},
+		"Blog post shard":  {shardIds("registry.blog-post.json"), "blog-post-1,blog-post-2"},
+		"Single shard":     {fileExists(filepath.Join(rootDir, "registry.settings.json")), true},
+		"Unsharded":        {fileExists(filepath.Join(rootDir, "registry.json")), false},
+		"Entries error":    {entriesErr, nil},
+		"Entries":          {len(entries), 3},
+		"Read error":       {readErr, nil},
+		"Read path":        {blogPath, filepath.Join(rootDir, "blog", "blog-post.html")},
+		"Unknown model":    {midas.ErrorCode(unknownErr), midas.ErrRegistry},
+		"Unknown model id": {midas.ErrorCode(unknownReadErr), midas.ErrNotFound},
+	})
+}
+
+func TestShardedRegistry_Flush(t *testing.T) {
+	flushes := map[string]int{}
+	var flushErr error
+
+	r := newShardedRegistry(midas.Site{
+		Registry:        midas.RegistrySettings{Location: "registry.json"},
+		CollectionTypes: map[string]midas.ModelSettings{"post": {}, "page": {}, "author": {}},
+	}, func(site midas.Site) midas.RegistryService {
+		registry := newMemoryRegistry(site)
+		registry.FlushFn = func() error {
+			if flushErr != nil && site.Registry.Location == "registry.page.json" {
+				return flushErr
+			}
+			flushes[site.Registry.Location]++
+			return nil
+		}
+
+		return registry
+	})
+
+	_ = r.CreateEntry("post-1", "post.html")
+	_ = r.CreateEntry("page-1", "page.html")
+	firstErr := r.Flush()
+	first := len(flushes)
+
+	_ = r.UpdateEntry("post-1", "renamed.html")
+	flushErr = errors.New("disk full")
+	_ = r.DeleteEntry("page-1")
+	failedErr := r.Flush()
+
+	flushErr = nil
+	retriedErr := r.Flush()
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"First error":          {firstErr, nil},
+		"First flushed shards": {first, 2},
+		"Post flushes":         {flushes["registry.post.json"], 2},
+		"Failed error":         {fmt.Sprint(failedErr), "disk full"},
+		"Retried error":        {retriedErr, nil},
+		"Page flushes":         {flushes["registry.page.json"], 2},
+		"Clean shard skipped":  {flushes["registry.author.json"], 0},
+	})
+}
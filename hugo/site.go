@@ -7,6 +7,8 @@
 package hugo
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -14,31 +16,84 @@ import (
 	"github.com/kovansky/midas/concurrent"
 	"github.com/rs/zerolog"
 	"html/template"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 )
 
 var _ midas.SiteService = (*SiteService)(nil)
+var _ midas.ContextSiteService = (*SiteService)(nil)
 
+const defaultMaxEntrySize = 10 << 20 // 10 MiB
+
+var errEntryTooLarge = errors.New("entry too large")
+
+var defaultWarningPatterns = []string{`^\s*WARN\b`}
+
+// archetypeExtensions are the extensions of the archetypes resolved in the archetypes directory, in order of precedence:
+// the extension of the written entries, then the Hugo default.
+var archetypeExtensions = []string{".html", ".md"}
+
+// defaultArchetypeSearchPath is the archetype search path used if the site has none configured.
+var defaultArchetypeSearchPath = []string{"themes/*"}
+
+// defaultArchetypeName is the name (without extension) of the archetype used for models without their own one.
+const defaultArchetypeName = "default"
+
+// buildLogName is the name of the file (in the site root directory) the failed build output is written to.
+const buildLogName = "midas-build.log"
+
+// defaultEntryIdPath is the entry field holding the entry id, if the site has no path configured.
+const defaultEntryIdPath = "id"
+
+// SiteService is safe for concurrent use by multiple goroutines. Operations modifying the entries are serialized
+// (either for the whole site, or per entry, see WithEntryLocking), and the registry access is synchronized.
+// Copies of the SiteService share the same locks and registry, so the service should be created once per site
+// and then shared.
 type SiteService struct {
 	Site midas.Site
 
 	registry midas.RegistryService
+	locks    *entryLocks
 }
 
-func NewSiteService(config midas.Site) (midas.SiteService, error) {
+// Option configures the SiteService on creation.
+type Option func(s *SiteService)
+
+// WithEntryLocking enables per-entry locking: operations on the same entry are serialized, while operations on
+// different entries can proceed in parallel. By default, all entry operations on the site are serialized.
+func WithEntryLocking() Option {
+	return func(s *SiteService) {
+		s.locks = newEntryLocks(true)
+	}
+}
+
+func NewSiteService(config midas.Site, options ...Option) (midas.SiteService, error) {
 	if _, ok := midas.RegistryServices[config.Registry.Type]; !ok {
 		return nil, midas.Errorf(midas.ErrSiteConfig, "requested registry type %s does not exit", config.Registry.Type)
 	}
 
-	siteService := SiteService{
-		Site:     config,
-		registry: midas.RegistryServices[config.Registry.Type](config),
+	var registry midas.RegistryService
+	if config.Registry.ShardByModel {
+		registry = newShardedRegistry(config, midas.RegistryServices[config.Registry.Type])
+	} else {
+		registry = midas.RegistryServices[config.Registry.Type](config)
 	}
 
+	siteService := newSiteService(config, registry, options...)
+
 	err := siteService.registry.OpenStorage()
 	if err != nil {
+		if config.Registry.RequireExisting {
+			return nil, midas.Errorf(midas.ErrRegistry, "registry storage can't be opened: %s", err)
+		}
+
 		err = siteService.registry.CreateStorage()
 		if err != nil {
 			return nil, err
@@ -48,20 +103,65 @@ func NewSiteService(config midas.Site) (midas.SiteService, error) {
 	return siteService, nil
 }
 
+// newSiteService creates the SiteService with synchronized registry and applies the options.
+func newSiteService(config midas.Site, registry midas.RegistryService, options ...Option) SiteService {
+	siteService := SiteService{
+		Site:     config,
+		registry: &lockedRegistry{registry: registry},
+		locks:    newEntryLocks(false),
+	}
+
+	for _, option := range options {
+		option(&siteService)
+	}
+
+	return siteService
+}
+
 func (s SiteService) GetRegistryService() (midas.RegistryService, error) {
 	return s.registry, nil
 }
 
 func (s SiteService) BuildSite(useCache bool, _ zerolog.Logger) error {
+	return s.build(useCache, nil)
+}
+
+// BuildModel builds the site rendering only the build segments of the model, if selective builds are enabled and
+// the model has any. Otherwise, the whole site is built.
+func (s SiteService) BuildModel(model string, useCache bool, _ zerolog.Logger) error {
+	return s.build(useCache, s.buildSegments(model))
+}
+
+// buildSegments returns the Hugo segments to be rendered after the model change, or nil if whole site
+// has to be rendered.
+func (s SiteService) buildSegments(modelName string) []string {
+	if !s.Site.SelectiveBuild {
+		return nil
+	}
+
+	model, _ := s.getModel(modelName)
+	if model == nil || len(model.BuildSegments) == 0 {
+		return nil
+	}
+
+	return model.BuildSegments
+}
+
+// build runs hugo for the site (and drafts, if enabled). If segments are provided, only these are rendered.
+func (s SiteService) build(useCache bool, segments []string) (err error) {
+	start := time.Now()
+	defer func() {
+		midas.Metrics.SiteBuilt(s.Site.SiteName, time.Since(start), err)
+	}()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var arg = s.constructBuildArgs(useCache, false)
+	var arg = s.constructBuildArgs(useCache, false, segments...)
 
-	cmd := exec.CommandContext(ctx, "hugo", arg...)
-	cmd.Dir = s.Site.RootDir
+	cmd := s.buildCommand(ctx, arg)
 
-	err := midas.Concurrents.Add(concurrent.New(s.Site, cancel))
+	err = midas.Concurrents.Add(concurrent.New(s.Site, cancel))
 	if err != nil {
 		if midas.ErrorCode(err) != midas.ErrProcessNotFound {
 			return err
@@ -79,11 +179,19 @@ func (s SiteService) BuildSite(useCache bool, _ zerolog.Logger) error {
 	default:
 		midas.Concurrents.Remove(s.Site.SiteName)
 		if err != nil {
-			return midas.Errorf(midas.ErrInternal, "hugo build errored: %s\ncommand output: %s", err, out)
+			return s.buildFailed(midas.Errorf(midas.ErrInternal, "hugo build errored: %s\ncommand output: %s", err, out), out)
+		}
+
+		if err = s.checkWarnings(out); err != nil {
+			return s.buildFailed(err, out)
+		}
+
+		if err = s.writeSearchIndex(false); err != nil {
+			return err
 		}
 
 		if s.Site.BuildDrafts {
-			if err = s.BuildDrafts(); err != nil {
+			if err = s.buildDrafts(segments); err != nil {
 				return err
 			}
 		}
@@ -91,28 +199,47 @@ func (s SiteService) BuildSite(useCache bool, _ zerolog.Logger) error {
 	return nil
 }
 
+// buildCommand returns the hugo command run in the site root directory, with the configured build environment
+// variables added to the inherited environment.
+func (s SiteService) buildCommand(ctx context.Context, arg []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "hugo", arg...)
+	cmd.Dir = s.Site.RootDir
+
+	if len(s.Site.BuildEnv) > 0 {
+		names := make([]string, 0, len(s.Site.BuildEnv))
+		for name := range s.Site.BuildEnv {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// The last value of the duplicated variable is used
+		cmd.Env = os.Environ()
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, name+"="+s.Site.BuildEnv[name])
+		}
+	}
+
+	return cmd
+}
+
 // constructBuildArgs generates hugo build arguments. If `isDraft` is true, the destination is changed
-// to draft destination and draft arguments are added.
-func (s SiteService) constructBuildArgs(useCache, isDraft bool) (arg []string) {
+// to draft destination and draft arguments are added. If segments are provided, only these are rendered.
+func (s SiteService) constructBuildArgs(useCache, isDraft bool, segments ...string) (arg []string) {
 	// In draft we never want to use cache to get the latest changes.
 	if !useCache || isDraft {
 		arg = append(arg, "--ignoreCache")
 	}
 
+	// The destination is always passed, so the publishDir of the Hugo configuration can't make the deployment miss
+	// the build
+	arg = append(arg, "-d", s.Site.BuildDestination(isDraft))
+
 	if !isDraft {
-		if s.Site.OutputSettings.Build != "" {
-			arg = append(arg, "-d", s.Site.OutputSettings.Build)
-		} else {
-			s.Site.OutputSettings.Build = "public"
+		// Override baseUrl, if specified
+		if s.Site.OutputSettings.BaseURL != "" {
+			arg = append(arg, "--baseURL", s.Site.OutputSettings.BaseURL)
 		}
 	} else {
-		arg = append(arg, "-d")
-		if s.Site.OutputSettings.Draft != "" {
-			arg = append(arg, s.Site.OutputSettings.Draft)
-		} else {
-			arg = append(arg, "publicDrafts")
-		}
-
 		arg = append(arg, "-e")
 		if s.Site.OutputSettings.DraftEnvironment != "" {
 			arg = append(arg, s.Site.OutputSettings.DraftEnvironment)
@@ -129,292 +256,1140 @@ func (s SiteService) constructBuildArgs(useCache, isDraft bool) (arg []string) {
 		}
 	}
 
+	if len(segments) > 0 {
+		arg = append(arg, "--renderSegments", strings.Join(segments, ","))
+	}
+
 	return arg
 }
 
 func (s SiteService) BuildDrafts() error {
-	var arg = s.constructBuildArgs(false, true)
+	return s.buildDrafts(nil)
+}
 
-	cmd := exec.Command("hugo", arg...)
-	cmd.Dir = s.Site.RootDir
+// buildDrafts runs hugo for the drafts site. If segments are provided, only these are rendered.
+func (s SiteService) buildDrafts(segments []string) error {
+	var arg = s.constructBuildArgs(false, true, segments...)
 
-	out, err := cmd.Output()
+	cmd := s.buildCommand(context.Background(), arg)
+
+	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return midas.Errorf(midas.ErrInternal, "hugo draft build errored: %s\ncommand output: %s", err, out)
+		return s.buildFailed(midas.Errorf(midas.ErrInternal, "hugo draft build errored: %s\ncommand output: %s", err, out), out)
 	}
 
-	return nil
-}
+	if err = s.checkWarnings(out); err != nil {
+		return s.buildFailed(err, out)
+	}
 
-func (s SiteService) CreateEntry(payload midas.Payload) (string, error) {
-	// Set archetype path and output directory
-	modelName := payload.Metadata()["model"].(string)
-	model, _ := s.getModel(modelName)
-	archetypePath := model.ArchetypePath
-	outputDir := model.OutputDir
+	return s.writeSearchIndex(true)
+}
 
-	if outputDir == "false" {
-		return "", nil
+// buildFailed writes the build output to the build log, if FailedBuildLog is enabled, and returns the build error.
+// If the log can't be written, it's noted in the returned error.
+func (s SiteService) buildFailed(buildErr error, out []byte) error {
+	if !s.Site.FailedBuildLog {
+		return buildErr
 	}
 
-	if !filepath.IsAbs(archetypePath) {
-		archetypePath = filepath.Join(s.Site.RootDir, archetypePath)
+	logPath := filepath.Join(s.Site.RootDir, buildLogName)
+	content := fmt.Sprintf("%s\n%s\n\n%s", time.Now().UTC().Format(time.RFC3339), midas.ErrorMessage(buildErr), out)
+
+	if err := os.WriteFile(logPath, []byte(content), 0664); err != nil {
+		return midas.Errorf(midas.ErrorCode(buildErr), "%s\nbuild log %s couldn't be written: %s", midas.ErrorMessage(buildErr), logPath, err)
 	}
-	if !filepath.IsAbs(outputDir) {
-		outputDir = filepath.Join(s.Site.RootDir, outputDir)
+
+	return buildErr
+}
+
+// checkWarnings returns ErrBuildWarnings error if FailOnWarnings is enabled and the build output contains warnings
+// (lines matching any of the warning patterns), so the build isn't retried.
+func (s SiteService) checkWarnings(out []byte) error {
+	if !s.Site.FailOnWarnings {
+		return nil
 	}
 
-	// Check if archetype exists
-	if !fileExists(archetypePath) {
-		return "", midas.Errorf(midas.ErrSiteConfig, "archetype for model %s does not exist", modelName)
+	patterns := s.Site.WarningPatterns
+	if len(patterns) == 0 {
+		patterns = defaultWarningPatterns
 	}
-	// Check if output dir exists, attempt to create it if it doesn't
-	if !fileExists(outputDir) {
-		err := os.Mkdir(outputDir, 0775)
+
+	var regexps []*regexp.Regexp
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
 		if err != nil {
-			return "", err
+			return midas.Errorf(midas.ErrSiteConfig, "warning pattern %s is invalid: %s", pattern, err)
 		}
+		regexps = append(regexps, compiled)
 	}
 
-	// Format output filename
-	var titleField string
+	var warnings []string
+	for _, line := range strings.Split(string(out), "\n") {
+		for _, compiled := range regexps {
+			if compiled.MatchString(line) {
+				warnings = append(warnings, line)
+				break
+			}
+		}
+	}
 
-	if model.Fields.Title == nil {
-		titleField = "Title"
-	} else {
-		titleField = *model.Fields.Title
+	if len(warnings) > 0 {
+		return midas.Errorf(midas.ErrBuildWarnings, "hugo build produced %d warning(s):\n%s", len(warnings), strings.Join(warnings, "\n"))
 	}
 
-	title := fmt.Sprintf("%v", payload.Entry()[titleField])
-	slug := midas.CreateSlug(title)
-	outputPath := filepath.Join(outputDir, slug+".html")
+	return nil
+}
 
-	// Check if output filename is free
-	if fileExists(outputPath) {
-		return "", midas.Errorf(midas.ErrInvalid, "output file %s already exists", filepath.Base(outputPath))
-	}
+func (s SiteService) CreateEntry(payload midas.Payload) (string, error) {
+	return s.CreateEntryContext(context.Background(), payload)
+}
 
-	// Read archetype file
-	tmpl, err := template.ParseFiles(archetypePath)
-	if err != nil {
-		return "", err
-	}
+// CreateEntryContext works as CreateEntry, but the media downloads are aborted when the context is cancelled.
+func (s SiteService) CreateEntryContext(ctx context.Context, payload midas.Payload) (string, error) {
+	outputPath, _, err := s.createEntry(ctx, payload, false)
+	return outputPath, err
+}
 
-	// Create output file
-	output, err := os.Create(outputPath)
-	defer func(output *os.File) {
-		_ = output.Close()
-	}(output)
+// CreateEntryDryRun works as CreateEntry, but instead of writing the entry to the disk and registry it returns
+// the path where the entry would be written, and the generated content.
+func (s SiteService) CreateEntryDryRun(payload midas.Payload) (string, []byte, error) {
+	return s.createEntry(context.Background(), payload, true)
+}
 
-	if err != nil {
-		return "", err
+func (s SiteService) createEntry(ctx context.Context, payload midas.Payload, dryRun bool) (string, []byte, error) {
+	if err := s.transformPayload(payload); err != nil {
+		return "", nil, err
 	}
 
-	// Parse archetype and write it to output
-	err = s.executeTemplate(tmpl, output, payload)
+	entryId, err := s.EntryId(payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	defer s.locks.lock(entryId)()
 
-	// Add entry to registry
-	entryId := s.EntryId(payload)
-
-	if err = s.registry.CreateEntry(entryId, outputPath); err != nil {
-		return outputPath, err
-	}
-	if err = s.registry.Flush(); err != nil {
-		return outputPath, err
+	outputPath, content, err := s.createPage(ctx, payload, dryRun)
+	if err != nil || dryRun {
+		return outputPath, content, err
 	}
 
-	return outputPath, nil
+	outputPath, content, err = s.withEntryData(payload, outputPath)
+	return outputPath, content, midas.JoinErrors(err, s.entryProcessed(payload, midas.EntryCreated, outputPath, err))
 }
 
-func (s SiteService) UpdateEntry(payload midas.Payload) (string, error) {
-	// Set archetype path
+// createPage renders the entry page. The caller must hold the entry lock.
+func (s SiteService) createPage(ctx context.Context, payload midas.Payload, dryRun bool) (string, []byte, error) {
+	// Set archetype path and output directory
 	modelName := payload.Metadata()["model"].(string)
 	model, _ := s.getModel(modelName)
-	archetypePath := model.ArchetypePath
-	configOutputDir := model.OutputDir
+	outputDir := model.OutputDir
 
-	if configOutputDir == "false" {
-		return "", nil
+	if outputDir == "false" {
+		return "", nil, nil
 	}
 
-	if !filepath.IsAbs(archetypePath) {
-		archetypePath = filepath.Join(s.Site.RootDir, archetypePath)
+	outputDir = s.entryOutputDir(model, payload)
+
+	// Format output filename
+	slug, err := s.entrySlug(model, payload.Entry())
+	if err != nil {
+		return "", nil, err
+	}
+	outputPath, err := s.entryPath(model, payload.Entry(), outputDir, slug)
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Check if archetype exists
-	if !fileExists(archetypePath) {
-		return "", midas.Errorf(midas.ErrSiteConfig, "archetype for model %s does not exist", modelName)
+	// Check if output filename is free. With SkipUnchanged, the existing file is compared with the rendered one
+	// (unless their names differ in the letter case).
+	existingPath := s.existingPath(outputPath)
+	exists := existingPath != ""
+	if exists && (!s.Site.SkipUnchanged || existingPath != outputPath) {
+		return "", nil, midas.Errorf(midas.ErrInvalid, "output file %s already exists", filepath.Base(existingPath))
 	}
 
-	// Get old path
-	entryId := s.EntryId(payload)
-	oldPath, err := s.registry.ReadEntry(entryId)
-	outputDir := filepath.Dir(oldPath)
-	if err != nil {
-		// If entry not in the registry, create empty one, otherwise UpdateEntry later will complain
-		_ = s.registry.CreateEntry(entryId, "")
-		// Read output dir in normal way
-		outputDir = model.OutputDir
-		if !filepath.IsAbs(outputDir) {
-			outputDir = filepath.Join(s.Site.RootDir, outputDir)
+	// Download the missing media, before the page referencing them is rendered (reading their dimensions). The
+	// bundle of the existing page which isn't the entry's own is left untouched.
+	if !dryRun && (!exists || model.Bundle == "" || s.tracksPath(payload, outputPath)) {
+		if err := s.downloadEntryMedia(ctx, model, payload, outputPath); err != nil {
+			return "", nil, err
 		}
 	}
 
-	// Check if output dir exists, attempt to create it if it doesn't
-	if !fileExists(outputDir) {
-		err := os.Mkdir(outputDir, 0775)
-		if err != nil {
-			return "", err
-		}
+	// Render archetype
+	content, _, err := s.renderEntry(payload, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if content, err = s.withMediaResources(model, payload, outputPath, content); err != nil {
+		return "", nil, err
 	}
 
-	// Format new output filename
-	var titleField string
+	if dryRun {
+		return outputPath, content.Bytes(), nil
+	}
 
-	if model.Fields.Title == nil {
-		titleField = "Title"
-	} else {
-		titleField = *model.Fields.Title
+	entryId, err := s.EntryId(payload)
+	if err != nil {
+		return "", nil, err
 	}
 
-	title := fmt.Sprintf("%v", payload.Entry()[titleField])
-	slug := midas.CreateSlug(title)
-	outputPath := filepath.Join(outputDir, slug+".html")
+	tracked := exists && s.tracksPath(payload, outputPath)
+	if exists {
+		existing, err := os.ReadFile(outputPath)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if bytes.Equal(existing, content.Bytes()) {
+			return outputPath, nil, s.unchangedPage(entryId, outputPath, tracked)
+		}
 
-	// Check if output filename is free (excluding situation where name doesn't change)
-	if fileExists(outputPath) && filepath.Base(outputPath) != filepath.Base(oldPath) {
-		return "", midas.Errorf(midas.ErrInvalid, "output file %s already exists", filepath.Base(outputPath))
+		// Only the file of the entry itself is overwritten
+		if !tracked {
+			return "", nil, midas.Errorf(midas.ErrInvalid, "output file %s already exists", filepath.Base(outputPath))
+		}
 	}
 
-	// Remove old entry if exists
-	if oldPath != "" && fileExists(oldPath) {
-		_ = os.Remove(oldPath)
+	// Check if output dir exists, attempt to create it if it doesn't
+	if !fileExists(filepath.Dir(outputPath)) {
+		// Directory may be created in the meantime by the concurrent operation on other entry. The entry section
+		// (or permalink) subdirectories are created together with the output directory.
+		err := os.MkdirAll(filepath.Dir(outputPath), 0775)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return "", nil, err
+		}
 	}
 
-	// Read archetype file
-	tmpl, err := template.ParseFiles(archetypePath)
-	if err != nil {
-		return "", err
+	// Create section index if needed
+	if err := s.ensureSectionIndex(model, outputDir, payload); err != nil {
+		return "", nil, err
 	}
 
-	// Create output file
-	output, err := os.Create(outputPath)
-	defer func(output *os.File) {
-		_ = output.Close()
-	}(output)
+	var generated []string
+	if model.PreserveFrontMatter {
+		generated = frontMatterKeys(content.String())
+	}
 
-	if err != nil {
-		return "", err
+	// Write rendered archetype to output
+	if err = s.writePage(model, outputPath, content); err != nil {
+		return "", nil, err
 	}
 
-	// Parse archetype and write it to output
-	err = s.executeTemplate(tmpl, output, payload)
-	if err != nil {
-		return "", err
+	// Add entry to registry, along with the generated front matter keys preserved by the updates
+	if tracked && !model.PreserveFrontMatter {
+		return outputPath, nil, nil
 	}
 
-	// Update entry in registry
-	if err = s.registry.UpdateEntry(entryId, outputPath); err != nil {
-		return outputPath, err
+	if !tracked {
+		if err = s.registry.CreateEntry(entryId, outputPath); err != nil {
+			return outputPath, nil, err
+		}
+	}
+	if model.PreserveFrontMatter {
+		if err = s.writeEntryGeneratedKeys(entryId, generated); err != nil {
+			return outputPath, nil, err
+		}
 	}
 	if err = s.registry.Flush(); err != nil {
-		return outputPath, err
+		return outputPath, nil, err
 	}
 
-	return outputPath, nil
+	return outputPath, nil, nil
 }
 
-func (s SiteService) DeleteEntry(payload midas.Payload) (string, error) {
-	// Get entry path
-	entryId := s.EntryId(payload)
-	entryPath, err := s.registry.ReadEntry(entryId)
-	if err != nil {
-		return "", err
+// unchangedPage handles the created entry rendered identically to the existing file, which isn't written again.
+// The entry is only added to the registry, if it isn't tracked yet. Returns ErrUnchanged error.
+func (s SiteService) unchangedPage(entryId, outputPath string, tracked bool) error {
+	if !tracked {
+		if err := s.registry.CreateEntry(entryId, outputPath); err != nil {
+			return err
+		}
+		if err := s.registry.Flush(); err != nil {
+			return err
+		}
 	}
 
-	// Remove entry
-	if err = os.Remove(entryPath); err != nil {
-		return "", nil
+	return midas.Errorf(midas.ErrUnchanged, "entry %s is unchanged", entryId)
+}
+
+// UpdateEntry regenerates the entry, renaming the file if the title changed. If the entry is not tracked in
+// the registry, it is created in the model output directory.
+func (s SiteService) UpdateEntry(payload midas.Payload) (string, error) {
+	return s.UpdateEntryContext(context.Background(), payload)
+}
+
+// UpdateEntryContext works as UpdateEntry, but the media downloads are aborted when the context is cancelled.
+func (s SiteService) UpdateEntryContext(ctx context.Context, payload midas.Payload) (string, error) {
+	outputPath, _, err := s.updateEntry(ctx, payload, false)
+	return outputPath, err
+}
+
+// UpdateEntryDryRun works as UpdateEntry, but instead of writing the entry to the disk and registry it returns
+// the path where the entry would be written, and the generated content.
+func (s SiteService) UpdateEntryDryRun(payload midas.Payload) (string, []byte, error) {
+	return s.updateEntry(context.Background(), payload, true)
+}
+
+func (s SiteService) updateEntry(ctx context.Context, payload midas.Payload, dryRun bool) (string, []byte, error) {
+	if err := s.transformPayload(payload); err != nil {
+		return "", nil, err
 	}
 
-	// Remove entry from registry
-	if err = s.registry.DeleteEntry(entryId); err != nil {
-		return entryPath, err
+	entryId, err := s.EntryId(payload)
+	if err != nil {
+		return "", nil, err
 	}
-	if err = s.registry.Flush(); err != nil {
-		return entryPath, err
+	defer s.locks.lock(entryId)()
+
+	outputPath, content, err := s.updatePage(ctx, payload, dryRun)
+	if err != nil || dryRun {
+		return outputPath, content, err
 	}
 
-	return entryPath, nil
+	outputPath, content, err = s.withEntryData(payload, outputPath)
+	return outputPath, content, midas.JoinErrors(err, s.entryProcessed(payload, midas.EntryUpdated, outputPath, err))
 }
 
-func (s SiteService) UpdateSingle(payload midas.Payload) (string, error) {
-	// Set output directory
+// updatePage renders the entry page again. The caller must hold the entry lock.
+func (s SiteService) updatePage(ctx context.Context, payload midas.Payload, dryRun bool) (string, []byte, error) {
+	// Set archetype path
 	modelName := payload.Metadata()["model"].(string)
 	model, _ := s.getModel(modelName)
-	outputDir := model.OutputDir
-	if !filepath.IsAbs(outputDir) {
-		outputDir = filepath.Join(s.Site.RootDir, outputDir)
-	}
+	configOutputDir := model.OutputDir
 
-	// Check if output dir exists, attempt to create it if it doesn't
-	if !fileExists(outputDir) {
-		err := os.Mkdir(outputDir, 0775)
-		if err != nil {
-			return "", err
-		}
+	if configOutputDir == "false" {
+		return "", nil, nil
 	}
 
-	// Format output filename
-	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.json", modelName))
-
-	// Sanitize the entry
-	entry := payload.Entry()
-	entry = sanitizeHtmlInMap(entry)
+	// Get old path. Entry which is not tracked (i.e. created before midas was set up) is created instead. It is
+	// registered only once its page is written.
+	entryId, err := s.EntryId(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	oldPath, err := s.registry.ReadEntry(entryId)
+	tracked := err == nil
+	if err != nil && midas.ErrorCode(err) != midas.ErrNotFound {
+		return "", nil, err
+	}
 
-	payload.SetEntry(entry)
+	// Keep the entry in its current directory. Without known path (entry not tracked, or registry not keeping
+	// the paths), read output dir in normal way - the directory of empty path is the working directory.
+	// With drafts directory configured, the entry is moved between the directories when (un)published.
+	outputDir := filepath.Dir(oldPath)
+	if index, _ := bundleIndex(model); index != "" && filepath.Base(oldPath) == index {
+		// The page is within the bundle directory
+		outputDir = filepath.Dir(outputDir)
+	}
+	if oldPath == "" || model.DraftOutputDir != "" || model.Fields.OutputDir != nil || model.Permalink != "" {
+		outputDir = s.entryOutputDir(model, payload)
+	}
 
-	asJson, err := payload.MarshalJSON()
+	// Format new output filename
+	slug, err := s.entrySlug(model, payload.Entry())
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	outputPath, err := s.entryPath(model, payload.Entry(), outputDir, slug)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Check if output filename is free (excluding situation where name doesn't change, or changes only the letter
+	// case on case-insensitive filesystem)
+	if existingPath := s.existingPath(outputPath); existingPath != "" && existingPath != oldPath && !sameFile(existingPath, oldPath) {
+		return "", nil, midas.Errorf(midas.ErrInvalid, "output file %s already exists", filepath.Base(existingPath))
 	}
 
-	// Open output file
-	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0775)
-	defer func(outout *os.File) {
-		_ = output.Close()
-	}(output)
+	// Alias all the previous slugs, tracked in the registry, including the one of the entry renamed now
+	var aliases []string
+	if model.AliasOnRename {
+		if aliases, err = s.entryAliases(entryId); err != nil {
+			return "", nil, err
+		}
+		if oldPath != "" {
+			aliases = renamedAliases(aliases, s.pageName(model, oldPath), s.pageName(model, outputPath))
+		}
+	}
 
-	if err != nil {
-		return "", err
+	// Download the missing media, before the page referencing them is rendered (reading their dimensions)
+	if !dryRun {
+		if err := s.downloadEntryMedia(ctx, model, payload, outputPath); err != nil {
+			return "", nil, err
+		}
 	}
 
-	// Write the output
-	_, err = output.Write(asJson)
+	// Render archetype, before the old entry file is touched
+	content, _, err := s.renderEntry(payload, aliases)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	if content, err = s.withMediaResources(model, payload, outputPath, content); err != nil {
+		return "", nil, err
 	}
 
-	return outputPath, nil
-}
+	if dryRun {
+		if model.PreserveFrontMatter && oldPath != "" {
+			if content, err = s.preserveManualFields(entryId, oldPath, content); err != nil {
+				return "", nil, err
+			}
+		}
 
-// EntryId generates the entry to be used in registry.
-func (s SiteService) EntryId(payload midas.Payload) string {
-	return fmt.Sprintf("%v-%v", payload.Metadata()["model"], payload.Entry()["id"])
-}
+		return outputPath, content.Bytes(), nil
+	}
 
-// getModel returns a model from any type (collection or single), and true if model is single or false otherwise.
-func (s SiteService) getModel(model string) (*midas.ModelSettings, bool) {
-	if m, ok := s.Site.CollectionTypes[model]; ok {
-		return &m, false
-	} else if m, ok := s.Site.SingleTypes[model]; ok {
-		return &m, true
+	// Check if output dir exists, attempt to create it if it doesn't
+	if !fileExists(filepath.Dir(outputPath)) {
+		// Directory may be created in the meantime by the concurrent operation on other entry. The entry section
+		// (or permalink) subdirectories are created together with the output directory.
+		err := os.MkdirAll(filepath.Dir(outputPath), 0775)
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			return "", nil, err
+		}
 	}
 
-	return nil, true
+	// The keys generated now are tracked, so they aren't preserved by the next update once the rendering drops them
+	var generated []string
+	if model.PreserveFrontMatter {
+		generated = frontMatterKeys(content.String())
+
+		if oldPath != "" {
+			if content, err = s.preserveManualFields(entryId, oldPath, content); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+
+	// Create section index if needed
+	if err := s.ensureSectionIndex(model, outputDir, payload); err != nil {
+		return "", nil, err
+	}
+
+	// The old entry is kept until the new one is written (and passed the post-write hook), so the failed update
+	// leaves it in place. The entry written to the same file (or only changing the letter case) is restored instead.
+	replaced := oldPath != "" && fileExists(oldPath) && (oldPath == outputPath || sameFile(oldPath, outputPath))
+	var previous []byte
+	if replaced {
+		if previous, err = os.ReadFile(oldPath); err != nil {
+			return "", nil, err
+		}
+		if oldPath != outputPath {
+			_ = os.Remove(oldPath)
+		}
+	}
+
+	// Write rendered archetype to output
+	if err = s.writePage(model, outputPath, content); err != nil {
+		if replaced {
+			_ = os.WriteFile(oldPath, previous, 0664)
+		}
+		return "", nil, err
+	}
+
+	// Remove old entry if exists
+	if !replaced && oldPath != "" && fileExists(oldPath) {
+		_ = removePage(model, oldPath)
+	}
+
+	// Update entry in registry
+	if tracked {
+		err = s.registry.UpdateEntry(entryId, outputPath)
+	} else {
+		err = s.registry.CreateEntry(entryId, outputPath)
+	}
+	if err != nil {
+		return outputPath, nil, err
+	}
+	if model.AliasOnRename {
+		if err = s.writeEntryAliases(entryId, aliases); err != nil {
+			return outputPath, nil, err
+		}
+	}
+	if model.PreserveFrontMatter {
+		if err = s.writeEntryGeneratedKeys(entryId, generated); err != nil {
+			return outputPath, nil, err
+		}
+	}
+	if err = s.registry.Flush(); err != nil {
+		return outputPath, nil, err
+	}
+
+	return outputPath, nil, nil
+}
+
+// ResetRegistry removes all the entries from the registry. If removeFiles is true, the tracked files are removed
+// as well - but only if they are placed within the site root directory.
+func (s SiteService) ResetRegistry(removeFiles bool) error {
+	defer s.locks.lockAll()()
+
+	entries, err := s.registry.ReadEntries()
+	if err != nil {
+		return err
+	}
+
+	for id, path := range entries {
+		if removeFiles && !isMetadataId(id) && s.isWithinRoot(path) {
+			// The pages are removed with their bundles, the data files are plain files
+			var model *midas.ModelSettings
+			if !strings.HasSuffix(id, dataIdSuffix) {
+				model = s.entryModel(id)
+			}
+
+			if err = removePage(model, path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+
+		if err = s.registry.DeleteEntry(id); err != nil {
+			return err
+		}
+	}
+
+	return s.registry.Flush()
+}
+
+// isWithinRoot returns true if the path is placed within the site root directory.
+func (s SiteService) isWithinRoot(path string) bool {
+	if path == "" {
+		return false
+	}
+
+	root, err := filepath.Abs(s.Site.RootDir)
+	if err != nil {
+		return false
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, absolute)
+	if err != nil {
+		return false
+	}
+
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s SiteService) DeleteEntry(payload midas.Payload) (string, error) {
+	entryId, err := s.EntryId(payload)
+	if err != nil {
+		return "", err
+	}
+	defer s.locks.lock(entryId)()
+
+	entryPath, err := s.deleteEntry(payload, entryId)
+	return entryPath, midas.JoinErrors(err, s.entryProcessed(payload, midas.EntryDeleted, entryPath, err))
+}
+
+// deleteEntry removes the entry page and data file. The caller must hold the entry lock.
+func (s SiteService) deleteEntry(payload midas.Payload, entryId string) (string, error) {
+	entryPath, pageErr := s.deletePage(payload, entryId)
+	if pageErr != nil && midas.ErrorCode(pageErr) != midas.ErrNotFound {
+		return entryPath, pageErr
+	}
+
+	// The data file is removed even if the model doesn't write it anymore
+	dataPath, err := s.removeEntryData(entryId)
+	if err != nil {
+		return entryPath, err
+	}
+	if entryPath == "" && dataPath != "" {
+		return dataPath, nil
+	}
+
+	return entryPath, pageErr
+}
+
+// deletePage removes the entry page. The registry path is used if the entry is tracked; otherwise (i.e. the registry
+// was lost) the page is looked up in the output paths reconstructed from the payload. The caller must hold
+// the entry lock.
+func (s SiteService) deletePage(payload midas.Payload, entryId string) (string, error) {
+	// Get entry path
+	entryPath, err := s.registry.ReadEntry(entryId)
+	if err != nil {
+		if midas.ErrorCode(err) == midas.ErrNotFound {
+			return s.deleteUntrackedPage(payload, err)
+		}
+
+		return "", err
+	}
+
+	// Remove entry
+	modelName, _ := payload.Metadata()["model"].(string)
+	model, _ := s.getModel(modelName)
+	if err = removePage(model, entryPath); err != nil {
+		return "", nil
+	}
+
+	// Remove entry from registry, along with its previous slugs, which aren't aliased by the recreated entry, and
+	// its generated front matter keys
+	if err = s.registry.DeleteEntry(entryId); err != nil {
+		return entryPath, err
+	}
+	if err = s.writeEntryAliases(entryId, nil); err != nil {
+		return entryPath, err
+	}
+	if err = s.writeEntryGeneratedKeys(entryId, nil); err != nil {
+		return entryPath, err
+	}
+	if err = s.registry.Flush(); err != nil {
+		return entryPath, err
+	}
+
+	return entryPath, nil
+}
+
+// deleteUntrackedPage removes the page of the entry missing in the registry from the paths it would be written to:
+// the model output directory and the drafts directory (if configured). The paths tracked in the registry belong to
+// other entries, and are skipped. The notFound error is returned if none of them exists. The first removed path is
+// returned, so the caller can report it.
+func (s SiteService) deleteUntrackedPage(payload midas.Payload, notFound error) (string, error) {
+	modelName, _ := payload.Metadata()["model"].(string)
+	model, _ := s.getModel(modelName)
+	if model == nil || model.OutputDir == "false" {
+		return "", notFound
+	}
+
+	slug, err := s.entrySlug(model, payload.Entry())
+	if err != nil {
+		return "", notFound
+	}
+
+	entries, err := s.registry.ReadEntries()
+	if err != nil {
+		return "", err
+	}
+	owned := make(map[string]bool, len(entries))
+	for id, path := range entries {
+		if path != "" && !isMetadataId(id) {
+			owned[path] = true
+		}
+	}
+
+	var removed string
+	for _, outputDir := range []string{model.OutputDir, model.DraftOutputDir} {
+		if outputDir == "" {
+			continue
+		}
+		if !filepath.IsAbs(outputDir) {
+			outputDir = filepath.Join(s.Site.RootDir, outputDir)
+		}
+
+		if model.Permalink == "" {
+			outputDir = filepath.Join(outputDir, s.entrySection(model, payload.Entry()))
+		}
+		outputDir = s.entryLocalizedDir(outputDir, payload.Entry())
+
+		candidate, err := s.entryPath(model, payload.Entry(), outputDir, slug)
+		if err != nil {
+			return "", notFound
+		}
+		if owned[candidate] {
+			continue
+		}
+		if err = removePage(model, candidate); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return removed, err
+		}
+
+		if removed == "" {
+			removed = candidate
+		}
+	}
+
+	if removed == "" {
+		return "", notFound
+	}
+
+	return removed, nil
+}
+
+// UpdateSingle writes the single type entry as JSON data (named after the model) to the model output directory,
+// or renders it as the site home page or the configured output file, if the model is configured so.
+func (s SiteService) UpdateSingle(payload midas.Payload) (string, error) {
+	modelName := payload.Metadata()["model"].(string)
+	defer s.locks.lock(modelName)()
+
+	outputPath, err := s.updateSingle(payload, modelName)
+	return outputPath, midas.JoinErrors(err, s.entryProcessed(payload, midas.SingleUpdated, outputPath, err))
+}
+
+// updateSingle writes the single type entry. The caller must hold the model lock.
+func (s SiteService) updateSingle(payload midas.Payload, modelName string) (string, error) {
+	model, isSingle := s.getModel(modelName)
+	if model == nil {
+		return "", midas.Errorf(midas.ErrUnaccepted, "model %s is not accepted", modelName)
+	}
+	if isSingle && model.HomePage {
+		return s.updateSinglePage(model, modelName, payload, homePageFilename)
+	}
+	if isSingle && model.OutputFile != "" {
+		return s.updateSinglePage(model, modelName, payload, model.OutputFile)
+	}
+
+	// Set output directory
+	outputDir := model.OutputDir
+	if !filepath.IsAbs(outputDir) {
+		outputDir = filepath.Join(s.Site.RootDir, outputDir)
+	}
+
+	// Check if output dir exists, attempt to create it if it doesn't
+	if !fileExists(outputDir) {
+		err := os.Mkdir(outputDir, 0775)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Format output filename
+	outputPath := filepath.Join(outputDir, fmt.Sprintf("%s.json", modelName))
+
+	// Sanitize the entry
+	entry := payload.Entry()
+	entry = sanitizeHtmlInMap(entry)
+
+	payload.SetEntry(entry)
+
+	asJson, err := payload.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	if maxSize := s.maxEntrySize(); maxSize >= 0 && int64(len(asJson)) > maxSize {
+		return "", midas.Errorf(midas.ErrInvalid, "entry exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	// Write the output, the current file is restored if the post-write hook fails
+	if err = s.writePage(model, outputPath, bytes.NewReader(asJson)); err != nil {
+		return "", err
+	}
+
+	return outputPath, nil
+}
+
+// entryProcessed reports the successful entry operation to the metrics and the audit log. Operations which didn't
+// write anything (i.e. on models without output) are not reported. The change is already written when the audit
+// record fails, so the error is returned along with the written path. The caller must hold the entry lock (or the
+// single type model lock), so the audit records of the entry follow the order of its changes.
+func (s SiteService) entryProcessed(payload midas.Payload, operation, outputPath string, err error) error {
+	if err != nil || outputPath == "" {
+		return nil
+	}
+
+	model, _ := payload.Metadata()["model"].(string)
+	midas.Metrics.EntryProcessed(s.Site.SiteName, model, operation)
+
+	if !s.Site.AuditLog.Enabled {
+		return nil
+	}
+
+	// The single types may have no id
+	entryId, _ := s.EntryId(payload)
+	record := midas.AuditRecord{
+		Time:      time.Now(),
+		Site:      s.Site.SiteName,
+		Operation: operation,
+		Model:     model,
+		EntryId:   entryId,
+		Path:      outputPath,
+		Event:     payload.Event(),
+	}
+
+	if err = midas.AppendAuditRecord(s.Site.AuditLogPath(), record); err != nil {
+		return midas.Errorf(midas.ErrInternal, "audit record of %s %s couldn't be written: %s", operation, outputPath, err)
+	}
+
+	return nil
+}
+
+// entryOutputDir returns the absolute output directory of the entry: drafts directory for the unpublished entry
+// (if configured) or the model output directory otherwise, with the entry section (unless placed by the permalink).
+// It's placed in the content directory of the entry language, if the languages are written to their directories.
+func (s SiteService) entryOutputDir(model *midas.ModelSettings, payload midas.Payload) string {
+	outputDir := model.OutputDir
+	if published, _ := payload.Metadata()["published"].(bool); !published && model.DraftOutputDir != "" {
+		outputDir = model.DraftOutputDir
+	}
+
+	if !filepath.IsAbs(outputDir) {
+		outputDir = filepath.Join(s.Site.RootDir, outputDir)
+	}
+
+	// The section is placed by the permalink
+	if model.Permalink == "" {
+		outputDir = filepath.Join(outputDir, s.entrySection(model, payload.Entry()))
+	}
+
+	return s.entryLocalizedDir(outputDir, payload.Entry())
+}
+
+// entrySection returns the subdirectory of the model output directory read from the entry output dir field,
+// or empty string if it isn't configured or set. Each segment of the path is slugified, so the entry can't be
+// placed outside the output directory.
+func (s SiteService) entrySection(model *midas.ModelSettings, entry map[string]interface{}) string {
+	if model.Fields.OutputDir == nil || entry[*model.Fields.OutputDir] == nil {
+		return ""
+	}
+
+	value := fmt.Sprintf("%v", entry[*model.Fields.OutputDir])
+
+	var segments []string
+	for _, segment := range strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment, err := s.slug(segment); err == nil && segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return filepath.Join(segments...)
+}
+
+// archetypePath returns the absolute path of the model archetype. If the archetype is missing and the site
+// has the default archetype configured, the default one is used instead. Empty path is returned for the model
+// with inline archetype, as no file is used.
+func (s SiteService) archetypePath(model *midas.ModelSettings, modelName string) (string, error) {
+	if model.Archetype != "" {
+		return "", nil
+	}
+
+	if model.ArchetypePath != "" {
+		candidates, err := s.archetypeCandidates(model.ArchetypePath)
+		if err != nil {
+			return "", err
+		}
+
+		// Directories are resolved together, so the model archetype of any layer takes precedence over the default one
+		var dirs []string
+		for _, candidate := range candidates {
+			if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+				dirs = append(dirs, candidate)
+			} else if len(dirs) == 0 {
+				return candidate, nil
+			}
+		}
+
+		if resolved := resolveArchetype(dirs, modelName); resolved != "" {
+			return resolved, nil
+		}
+	}
+
+	if s.Site.DefaultArchetypePath == "" {
+		return "", midas.Errorf(midas.ErrSiteConfig, "archetype for model %s does not exist", modelName)
+	}
+
+	candidates, err := s.archetypeCandidates(s.Site.DefaultArchetypePath)
+	if err != nil {
+		return "", err
+	}
+
+	if len(candidates) == 0 {
+		return "", midas.Errorf(midas.ErrSiteConfig, "archetype for model %s and default archetype do not exist", modelName)
+	}
+
+	return candidates[0], nil
+}
+
+// archetypeCandidates returns the existing archetype paths (files or directories) for the configured path, in order of
+// precedence: relative to the site root directory, then to each directory of the archetype search path (i.e. themes).
+// Absolute path is only checked as is.
+func (s SiteService) archetypeCandidates(archetypePath string) ([]string, error) {
+	if filepath.IsAbs(archetypePath) {
+		if fileExists(archetypePath) {
+			return []string{archetypePath}, nil
+		}
+
+		return nil, nil
+	}
+
+	var candidates []string
+	if candidate := filepath.Join(s.Site.RootDir, archetypePath); fileExists(candidate) {
+		candidates = append(candidates, candidate)
+	}
+
+	searchPath := s.Site.ArchetypeSearchPath
+	if searchPath == nil {
+		searchPath = defaultArchetypeSearchPath
+	}
+
+	for _, pattern := range searchPath {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(s.Site.RootDir, pattern)
+		}
+
+		dirs, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, midas.Errorf(midas.ErrSiteConfig, "archetype search path %s is invalid: %s", pattern, err)
+		}
+
+		for _, dir := range dirs {
+			if candidate := filepath.Join(dir, archetypePath); fileExists(candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+// resolveArchetype returns the archetype of the model in the archetypes directories, following the Hugo convention:
+// <model> archetype, then the default one, each with the output extension first and .md second. For each of them
+// directories are checked in order. Returns empty string if none exists.
+func resolveArchetype(dirs []string, modelName string) string {
+	for _, name := range []string{modelName, defaultArchetypeName} {
+		for _, dir := range dirs {
+			for _, extension := range archetypeExtensions {
+				archetypePath := filepath.Join(dir, name+extension)
+				if info, err := os.Stat(archetypePath); err == nil && !info.IsDir() {
+					return archetypePath
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// parseArchetype parses the model archetype (inline one, or from the file). If the base archetype is configured,
+// it is parsed first and executed, so the model archetype can override its blocks with define actions (content
+// outside of them is ignored).
+func (s SiteService) parseArchetype(model *midas.ModelSettings, archetypePath string) (*template.Template, error) {
+	if model.BaseArchetypePath == "" {
+		if model.Archetype != "" {
+			return parseInlineArchetype(template.New("archetype"), model.Archetype)
+		}
+
+		return template.ParseFiles(archetypePath)
+	}
+
+	basePath := model.BaseArchetypePath
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(s.Site.RootDir, basePath)
+	}
+
+	if !fileExists(basePath) {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "base archetype %s does not exist", model.BaseArchetypePath)
+	}
+	if model.Archetype != "" {
+		tmpl, err := template.ParseFiles(basePath)
+		if err != nil {
+			return nil, err
+		}
+
+		// The base template is executed, the inline one only replaces its blocks
+		if _, err = parseInlineArchetype(tmpl.New("archetype"), model.Archetype); err != nil {
+			return nil, err
+		}
+
+		return tmpl, nil
+	}
+	if filepath.Base(basePath) == filepath.Base(archetypePath) {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "base archetype and archetype can not have the same file name")
+	}
+
+	// The returned template is the first (base) one; the archetype definitions are parsed later, so they replace
+	// the base blocks of the same name
+	return template.ParseFiles(basePath, archetypePath)
+}
+
+// parseInlineArchetype parses the inline archetype into the template.
+func parseInlineArchetype(tmpl *template.Template, archetype string) (*template.Template, error) {
+	tmpl, err := tmpl.Parse(archetype)
+	if err != nil {
+		return nil, midas.Errorf(midas.ErrSiteConfig, "inline archetype is invalid: %s", err)
+	}
+
+	return tmpl, nil
+}
+
+// ensureSectionIndex creates the section index (_index.md) in the output directory from the section archetype,
+// if one is configured for the model. An existing section index is never overwritten.
+func (s SiteService) ensureSectionIndex(model *midas.ModelSettings, outputDir string, payload midas.Payload) error {
+	if model.SectionArchetypePath == "" {
+		return nil
+	}
+
+	indexPath := filepath.Join(outputDir, "_index.md")
+	if fileExists(indexPath) {
+		return nil
+	}
+
+	archetypePath := model.SectionArchetypePath
+	if !filepath.IsAbs(archetypePath) {
+		archetypePath = filepath.Join(s.Site.RootDir, archetypePath)
+	}
+
+	if !fileExists(archetypePath) {
+		return midas.Errorf(midas.ErrSiteConfig, "section archetype for model %s does not exist", payload.Metadata()["model"])
+	}
+
+	tmpl, err := template.ParseFiles(archetypePath)
+	if err != nil {
+		return err
+	}
+
+	// Section index is generated with the metadata of the entry that caused the section creation
+	// and the name of the section (output directory). It's rendered before the file is created, so the failed
+	// template doesn't leave the truncated index, which would never be generated again.
+	var content bytes.Buffer
+	if err = tmpl.Execute(&content, struct {
+		Metadata map[string]interface{}
+		Meta     templateMeta
+		Section  string
+	}{payload.Metadata(), newTemplateMeta(payload), filepath.Base(outputDir)}); err != nil {
+		return err
+	}
+
+	// Exclusive create, as the index may be created in the meantime by the concurrent operation on other entry
+	output, err := os.OpenFile(indexPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = output.Write(content.Bytes())
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(indexPath)
+		return err
+	}
+
+	return nil
+}
+
+// EntryId generates the entry to be used in registry, from the model name and the entry id read from the site
+// EntryIdPath. The localized entry id has the language appended (i.e. post-1@fr), as the locales of the document share
+// the id. Returns ErrInvalid if the entry has no id there, or its locale isn't one of the site languages.
+func (s SiteService) EntryId(payload midas.Payload) (string, error) {
+	path := s.Site.EntryIdPath
+	if path == "" {
+		path = defaultEntryIdPath
+	}
+
+	var value interface{} = payload.Entry()
+	for _, key := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = fields[key]
+	}
+
+	if value == nil {
+		return "", midas.Errorf(midas.ErrInvalid, "entry of model %v has no id at %s", payload.Metadata()["model"], path)
+	}
+
+	language, isDefault, err := s.entryLanguage(payload.Entry())
+	if err != nil {
+		return "", err
+	}
+	if !isDefault {
+		return fmt.Sprintf("%v-%v@%s", payload.Metadata()["model"], value, language), nil
+	}
+
+	return fmt.Sprintf("%v-%v", payload.Metadata()["model"], value), nil
+}
+
+// getModel returns a model from any type (collection or single), and true if model is single or false otherwise.
+func (s SiteService) getModel(model string) (*midas.ModelSettings, bool) {
+	if m, ok := s.Site.CollectionTypes[model]; ok {
+		return &m, false
+	} else if m, ok := s.Site.SingleTypes[model]; ok {
+		return &m, true
+	}
+
+	return nil, true
+}
+
+// tracksPath returns true if the path is tracked in the registry for the entry.
+func (s SiteService) tracksPath(payload midas.Payload, path string) bool {
+	entryId, err := s.EntryId(payload)
+	if err != nil {
+		return false
+	}
+
+	trackedPath, _ := s.registry.ReadEntry(entryId)
+	return trackedPath == path
+}
+
+// entryModel returns the collection type of the registry entry id (<model>-<id>, optionally with a suffix), or nil
+// if it isn't configured anymore. The longest name is matched, so the model whose name is a prefix of other isn't
+// taken.
+func (s SiteService) entryModel(entryId string) *midas.ModelSettings {
+	var name string
+	for candidate := range s.Site.CollectionTypes {
+		if strings.HasPrefix(entryId, candidate+"-") && len(candidate) > len(name) {
+			name = candidate
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	model, _ := s.getModel(name)
+	return model
+}
+
+// sameFile returns true if both paths exist and point to the same file.
+func sameFile(path, otherPath string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	otherInfo, err := os.Stat(otherPath)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(info, otherInfo)
+}
+
+// caseInsensitivePaths returns true if the file names differing only in the letter case are treated as the same
+// file. Unless configured, it's assumed for the platforms whose default filesystems are case-insensitive.
+func (s SiteService) caseInsensitivePaths() bool {
+	if s.Site.CaseInsensitivePaths != nil {
+		return *s.Site.CaseInsensitivePaths
+	}
+
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
+
+// existingPath returns the path of the existing file the path collides with, or empty string if there's none.
+// With case-insensitive paths, the file whose name differs only in the letter case is returned (with its name
+// as stored in the directory), so the collisions are detected the same way on every filesystem.
+func (s SiteService) existingPath(path string) string {
+	if !s.caseInsensitivePaths() {
+		if fileExists(path) {
+			return path
+		}
+
+		return ""
+	}
+
+	dir, name := filepath.Split(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	existing := ""
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return path
+		}
+		if existing == "" && strings.EqualFold(entry.Name(), name) {
+			existing = filepath.Join(dir, entry.Name())
+		}
+	}
+
+	return existing
 }
 
 // fileExists return true if path exists or false otherwise
@@ -423,28 +1398,219 @@ func fileExists(filename string) bool {
 	return !errors.Is(err, os.ErrNotExist)
 }
 
-// executeTemplate sanitizes the HTML and executes the template to the output file
-func (s SiteService) executeTemplate(tmpl *template.Template, output *os.File, payload midas.Payload) (err error) {
-	modelName := payload.Metadata()["model"].(string)
-	model, _ := s.getModel(modelName)
+// templateMeta is the payload metadata available to the archetypes as Meta, so the fields can be used without
+// the index function, i.e. {{ .Meta.Event }}. Missing fields are zero values.
+type templateMeta struct {
+	Event     string    // Webhook event, i.e. Create
+	Model     string    // Model of the entry
+	CreatedAt time.Time // Time of the webhook event
+	Published bool
+}
+
+// newTemplateMeta reads the template metadata from the payload metadata.
+func newTemplateMeta(payload midas.Payload) templateMeta {
+	metadata := payload.Metadata()
+
+	var meta templateMeta
+	if event, ok := metadata["event"]; ok && event != nil {
+		meta.Event = fmt.Sprintf("%v", event)
+	}
+	meta.Model, _ = metadata["model"].(string)
+	meta.CreatedAt, _ = metadata["createdAt"].(time.Time)
+	meta.Published, _ = metadata["published"].(bool)
+
+	return meta
+}
+
+// sanitizedEntry returns the entry fields exposed to the page (with the cleanup applied), and their copy with the
+// HTML fields sanitized (as safe HTML) and the media rewritten. The payload is left untouched, so it can be rendered
+// again.
+func (s SiteService) sanitizedEntry(model *midas.ModelSettings, payload midas.Payload) (map[string]interface{}, map[string]interface{}, error) {
+	entry := cleanupFields(model, allowedFields(model, payload.Entry()))
+
+	sanitized := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		sanitized[key] = value
+	}
 
-	sanitized := payload.Entry()
 	if model.Fields.HTML != nil && len(*model.Fields.HTML) > 0 {
 		for _, field := range *model.Fields.HTML {
-			sanitized[field] = template.HTML(midas.Sanitizer.Sanitize(sanitized[field].(string)))
+			if html, ok := sanitized[field].(string); ok {
+				sanitized[field] = template.HTML(midas.Sanitizer.Sanitize(html))
+			}
 		}
 	}
 
-	// Parse archetype and write it to output
-	err = tmpl.Execute(output, struct {
-		Metadata map[string]interface{}
-		Entry    map[string]interface{}
-	}{payload.Metadata(), sanitized})
+	// Dimensions are read before the URLs are rewritten. The media downloaded into the bundle get them as the
+	// resource params instead, once downloaded.
+	var err error
+	if !model.Media.Download || model.Bundle == "" {
+		if sanitized, err = mediaDimensions(model.Media, s.Site.RootDir, sanitized); err != nil {
+			return nil, nil, err
+		}
+	}
+	if sanitized, err = rewriteMedia(model.Media, sanitized); err != nil {
+		return nil, nil, err
+	}
+
+	return entry, sanitized, nil
+}
+
+// executeTemplate sanitizes the HTML and executes the template to the output. The output is buffered and limited
+// to the maximum entry size. Aliases (slugs relative to the entry directory) are formatted as a list for the front
+// matter.
+func (s SiteService) executeTemplate(tmpl *template.Template, output io.Writer, payload midas.Payload, aliases []string) (err error) {
+	modelName := payload.Metadata()["model"].(string)
+	model, _ := s.getModel(modelName)
+
+	entry, sanitized, err := s.sanitizedEntry(model, payload)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	dates, timestamps, err := s.frontMatterDates(model, sanitized)
+	if err != nil {
+		return err
+	}
+
+	body := entryBody(model, entry, sanitized)
+
+	templateEntry, err := s.entryWithMissingFields(tmpl, sanitized)
+	if err != nil {
+		return err
+	}
+
+	maxSize := s.maxEntrySize()
+	if maxSize >= 0 {
+		output = &limitedWriter{writer: output, remaining: maxSize}
+	}
+	buffered := bufio.NewWriter(output)
+
+	data := struct {
+		Metadata   map[string]interface{}
+		Meta       templateMeta
+		Entry      map[string]interface{}
+		Taxonomies map[string]template.HTML
+		Dates      map[string]template.HTML
+		Aliases    template.HTML
+		Body       interface{}
+	}{payload.Metadata(), newTemplateMeta(payload), templateEntry, taxonomies(model, sanitized), dates, formatTerms(append([]string{}, aliases...)), body}
+
+	// Parse archetype and write it to output. The timestamps are injected into the rendered front matter,
+	// so the archetype doesn't need to set them. The entry fields replace the archetype front matter defaults.
+	// The rendered content is limited as well, so the huge entry isn't buffered before the limit is checked.
+	if len(timestamps) > 0 || model.ArchetypeDefaults {
+		var rendered strings.Builder
+		var target io.Writer = &rendered
+		if maxSize >= 0 {
+			target = &limitedWriter{writer: &rendered, remaining: maxSize}
+		}
+
+		if err = tmpl.Execute(target, data); err == nil {
+			content := rendered.String()
+			if model.ArchetypeDefaults {
+				content = mergeFrontMatter(content, sanitized)
+			}
+			_, err = buffered.WriteString(injectFrontMatter(content, timestamps))
+		}
+	} else {
+		err = tmpl.Execute(buffered, data)
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+
+	if errors.Is(err, errEntryTooLarge) {
+		return midas.Errorf(midas.ErrInvalid, "entry exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	return err
+}
+
+// slug generates the entry filename (without extension) from title, using configured casing.
+func (s SiteService) slug(title string) (string, error) {
+	switch s.Site.SlugCasing {
+	case "", midas.SlugCasingLower:
+		return midas.CreateSlug(title), nil
+	case midas.SlugCasingPreserve, midas.SlugCasingKebab:
+		return midas.CreateCasedSlug(title, s.Site.SlugCasing), nil
+	default:
+		return "", midas.Errorf(midas.ErrSiteConfig, "slug casing %s is invalid", s.Site.SlugCasing)
+	}
+}
+
+// allowedFields returns the entry with only the fields allowed for the model templates. If the model has no allowed
+// fields configured, the entry is returned as is.
+func allowedFields(model *midas.ModelSettings, entry map[string]interface{}) map[string]interface{} {
+	if model.Fields.Allowed == nil {
+		return entry
+	}
+
+	allowed := make(map[string]interface{}, len(*model.Fields.Allowed))
+	for _, field := range *model.Fields.Allowed {
+		if value, ok := entry[field]; ok {
+			allowed[field] = value
+		}
+	}
+
+	return allowed
+}
+
+// entryBody returns the value of the model body field. Trusted body is returned from the original entry as safe HTML,
+// so it isn't escaped nor sanitized; otherwise the value is escaped (unless it's sanitized as one of HTML fields).
+// If the model has MarkdownBody enabled, the HTML body (trusted or sanitized) is converted to Markdown.
+func entryBody(model *midas.ModelSettings, entry, sanitized map[string]interface{}) interface{} {
+	if model.Fields.Body == nil {
+		return ""
+	}
+
+	if model.MarkdownBody {
+		if body, ok := entry[*model.Fields.Body].(string); ok && model.TrustedBody {
+			return template.HTML(htmlToMarkdown(body))
+		}
+		if body, ok := sanitized[*model.Fields.Body].(template.HTML); ok {
+			return template.HTML(htmlToMarkdown(string(body)))
+		}
+	}
+
+	if model.TrustedBody {
+		if body, ok := entry[*model.Fields.Body].(string); ok {
+			return template.HTML(body)
+		}
+	}
+
+	if body, ok := sanitized[*model.Fields.Body]; ok && body != nil {
+		return body
+	}
+
+	return ""
+}
+
+// maxEntrySize returns the configured maximum entry size, or the default one if not configured.
+// Negative value means there is no limit.
+func (s SiteService) maxEntrySize() int64 {
+	if s.Site.MaxEntrySize == 0 {
+		return defaultMaxEntrySize
+	}
+
+	return s.Site.MaxEntrySize
+}
+
+// limitedWriter is a writer that fails when more than remaining bytes are written to it.
+type limitedWriter struct {
+	writer    io.Writer
+	remaining int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.remaining {
+		return 0, errEntryTooLarge
+	}
+
+	n, err := w.writer.Write(p)
+	w.remaining -= int64(n)
+
+	return n, err
 }
 
 // sanitizeHtmlInMap iterates (recursively) through given map and passes each value through HTML sanitizer.
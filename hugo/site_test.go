@@ -0,0 +1,1745 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"context"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/bluemonday"
+	"github.com/kovansky/midas/concurrent"
+	"github.com/kovansky/midas/mock"
+	"github.com/kovansky/midas/none"
+	"github.com/kovansky/midas/strapi"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestSite creates a SiteService operating in a temporary directory, with an in-memory registry
+// and given collection types. Archetypes are written from the map of relative path => content.
+func newTestSite(t *testing.T, collectionTypes map[string]midas.ModelSettings, archetypes map[string]string) SiteService {
+	t.Helper()
+
+	midas.Sanitizer = bluemonday.NewSanitizerService()
+
+	rootDir := t.TempDir()
+	for path, content := range archetypes {
+		absolute := filepath.Join(rootDir, path)
+		if err := os.MkdirAll(filepath.Dir(absolute), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(absolute, []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	site := midas.Site{
+		SiteName:        "test",
+		Service:         "hugo",
+		RootDir:         rootDir,
+		CollectionTypes: collectionTypes,
+	}
+
+	return newSiteService(site, newMemoryRegistry(site))
+}
+
+// newMemoryRegistry creates a mock registry keeping the entries in a map.
+func newMemoryRegistry(site midas.Site) *mock.RegistryService {
+	registry := make(midas.Registry)
+	r := mock.NewRegistryService(site)
+
+	r.OpenStorageFn = func() error { return nil }
+	r.CloseStorageFn = func() {}
+	r.CreateStorageFn = func() error { return nil }
+	r.RemoveStorageFn = func() error { return nil }
+	r.FlushFn = func() error { return nil }
+	r.CreateEntryFn = func(id, filename string) error {
+		if _, ok := registry[id]; ok {
+			return midas.Errorf(midas.ErrRegistry, "entry %s already exists", id)
+		}
+		registry[id] = filename
+		return nil
+	}
+	r.ReadEntryFn = func(id string) (string, error) {
+		if filename, ok := registry[id]; ok {
+			return filename, nil
+		}
+		return "", midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
+	}
+	r.ReadEntriesFn = func() (midas.Registry, error) {
+		entries := make(midas.Registry, len(registry))
+		for id, filename := range registry {
+			entries[id] = filename
+		}
+		return entries, nil
+	}
+	r.UpdateEntryFn = func(id, newFilename string) error {
+		if _, ok := registry[id]; !ok {
+			return midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
+		}
+		registry[id] = newFilename
+		return nil
+	}
+	r.DeleteEntryFn = func(id string) error {
+		if _, ok := registry[id]; !ok {
+			return midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
+		}
+		delete(registry, id)
+		return nil
+	}
+
+	return r
+}
+
+// mustParsePayload creates a strapi payload for given event, model and entry JSON.
+func mustParsePayload(t *testing.T, event, model, entry string) midas.Payload {
+	t.Helper()
+
+	payload, err := strapi.ParsePayload([]byte(fmt.Sprintf(`{
+    "event": "%s",
+    "createdAt": "2022-01-01T10:10:10.000Z",
+    "model": "%s",
+    "entry": %s
+  }`, event, model, entry)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+func TestSiteService_CreateEntry_SectionIndex(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath:        "archetypes/post.md",
+			OutputDir:            "content/posts",
+			SectionArchetypePath: "archetypes/section.md",
+		},
+	}, map[string]string{
+		"archetypes/post.md":    `{{ index .Entry "Title" }}`,
+		"archetypes/section.md": `title: {{ .Section }}`,
+	})
+	if err := os.MkdirAll(filepath.Join(s.Site.RootDir, "content"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	indexPath := filepath.Join(s.Site.RootDir, "content", "posts", "_index.md")
+
+	t.Run("FirstWrite", func(t *testing.T) {
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+		testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+		content, err := os.ReadFile(indexPath)
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Read index error": {err, nil},
+			"Index content":    {string(content), "title: posts"},
+		})
+	})
+
+	t.Run("ExistingIndex", func(t *testing.T) {
+		if err := os.WriteFile(indexPath, []byte("custom"), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "Second"}`))
+		testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+		content, err := os.ReadFile(indexPath)
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Read index error": {err, nil},
+			"Index content":    {string(content), "custom"},
+		})
+	})
+
+	t.Run("FailedTemplate", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", SectionArchetypePath: "archetypes/section.md"},
+		}, map[string]string{
+			"archetypes/post.md":    `{{ index .Entry "Title" }}`,
+			"archetypes/section.md": `title: {{ .Section }}{{ .Missing }}`,
+		})
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First"}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Failed":        {err != nil, true},
+			"Index written": {fileExists(filepath.Join(s.Site.RootDir, "posts", "_index.md")), false},
+		})
+	})
+}
+
+func TestSiteService_CreateEntry_MaxEntrySize(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Content" }}`,
+	})
+	s.Site.MaxEntrySize = 16
+
+	tests := []struct {
+		name     string
+		entry    string
+		wantCode string
+	}{
+		{"UnderLimit", `{"id": 1, "Title": "Short", "Content": "0123456789"}`, ""},
+		{"AtLimit", `{"id": 2, "Title": "Exact", "Content": "0123456789abcdef"}`, ""},
+		{"OverLimit", `{"id": 3, "Title": "Long", "Content": "0123456789abcdef0"}`, midas.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", tt.entry))
+
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+			if tt.wantCode != "" {
+				_, statErr := os.Stat(filepath.Join(s.Site.RootDir, "posts", "long.html"))
+				testing_utils.AssertEquals(t, os.IsNotExist(statErr), true, "Output removed")
+			} else {
+				testing_utils.AssertEquals(t, fileExists(outputPath), true, "Output exists")
+			}
+		})
+	}
+
+	t.Run("Timestamps", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", Timestamps: midas.TimestampSettings{Enabled: true}},
+		}, map[string]string{
+			"archetypes/post.md": `{{ index .Entry "Content" }}`,
+		})
+		s.Site.MaxEntrySize = 16
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 3, "Title": "Long", "Content": "0123456789abcdef0"}`))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Error code")
+	})
+
+	t.Run("FrontMatterMerged", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", ArchetypeDefaults: true},
+		}, map[string]string{
+			"archetypes/post.md": `{{ index .Entry "Content" }}`,
+		})
+		s.Site.MaxEntrySize = 16
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 3, "Title": "Long", "Content": "0123456789abcdef0"}`))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Error code")
+	})
+}
+
+func TestSiteService_CreateEntry_SkipUnchanged(t *testing.T) {
+	newSite := func(t *testing.T, skipUnchanged bool) (SiteService, *int) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {Archetype: `{{ index .Entry "Content" }}`, OutputDir: "posts"},
+		}, nil)
+		s.Site.SkipUnchanged = skipUnchanged
+
+		registry := s.registry.(*lockedRegistry).registry.(*mock.RegistryService)
+		flushes, flush := new(int), registry.FlushFn
+		registry.FlushFn = func() error {
+			*flushes++
+			return flush()
+		}
+
+		return s, flushes
+	}
+	entry := func(content string) string {
+		return fmt.Sprintf(`{"id": 1, "Title": "First", "Content": "%s"}`, content)
+	}
+
+	t.Run("Identical", func(t *testing.T) {
+		s, flushes := newSite(t, true)
+		outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-time.Hour)
+		if err = os.Chtimes(outputPath, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		*flushes = 0
+
+		_, err = s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello")))
+		info, _ := os.Stat(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":   {midas.ErrorCode(err), midas.ErrUnchanged},
+			"Not written":  {info.ModTime().Equal(modified), true},
+			"Flush counts": {*flushes, 0},
+		})
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		s, _ := newSite(t, true)
+		if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello"))); err != nil {
+			t.Fatal(err)
+		}
+
+		outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Changed")))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Content": {string(content), "Changed"},
+		})
+	})
+
+	t.Run("Untracked identical", func(t *testing.T) {
+		s, flushes := newSite(t, true)
+		outputPath := filepath.Join(s.Site.RootDir, "posts", "first.html")
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(outputPath, []byte("Hello"), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello")))
+		registered, _ := s.registry.ReadEntry("post-1")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":     {midas.ErrorCode(err), midas.ErrUnchanged},
+			"Registry entry": {registered, outputPath},
+			"Flush counts":   {*flushes, 1},
+		})
+	})
+
+	t.Run("Untracked changed", func(t *testing.T) {
+		s, _ := newSite(t, true)
+		outputPath := filepath.Join(s.Site.RootDir, "posts", "first.html")
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(outputPath, []byte("Other"), 0664); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello")))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code": {midas.ErrorCode(err), midas.ErrInvalid},
+			"Content":    {string(content), "Other"},
+		})
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s, _ := newSite(t, false)
+		if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello"))); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", entry("Hello")))
+
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrInvalid, "Error code")
+	})
+}
+
+func TestSiteService_DryRun(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath:        "archetypes/post.md",
+			OutputDir:            "posts",
+			SectionArchetypePath: "archetypes/section.md",
+		},
+	}, map[string]string{
+		"archetypes/post.md":    `title: {{ index .Entry "Title" }}`,
+		"archetypes/section.md": `title: {{ .Section }}`,
+	})
+
+	listFiles := func() []string {
+		var files []string
+		_ = filepath.Walk(s.Site.RootDir, func(path string, _ os.FileInfo, _ error) error {
+			files = append(files, path)
+			return nil
+		})
+		return files
+	}
+	before := listFiles()
+
+	tests := []struct {
+		name string
+		fn   func(payload midas.Payload) (string, []byte, error)
+	}{
+		{"Create", s.CreateEntryDryRun},
+		{"Update", s.UpdateEntryDryRun},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath, content, err := tt.fn(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Dry run"}`))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":       {err, nil},
+				"Output path": {outputPath, filepath.Join(s.Site.RootDir, "posts", "dry-run.html")},
+				"Content":     {string(content), "title: Dry run"},
+			})
+
+			after := listFiles()
+			testing_utils.AssertEquals(t, fmt.Sprint(after), fmt.Sprint(before), "Files")
+
+			_, err = s.registry.ReadEntry("post-1")
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrNotFound, "Registry entry")
+		})
+	}
+}
+
+func TestSiteService_Concurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"SiteLocking", nil},
+		{"EntryLocking", []Option{WithEntryLocking()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+			}, map[string]string{
+				"archetypes/post.md": `{{ index .Entry "Title" }}`,
+			})
+			s = newSiteService(s.Site, newMemoryRegistry(s.Site), tt.options...)
+
+			const count = 20
+			var wg sync.WaitGroup
+			errs := make(chan error, 2*count)
+
+			// Different entries are created in parallel, while the same entry is updated by many requests.
+			for i := 0; i < count; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", fmt.Sprintf(`{"id": %d, "Title": "Post %d"}`, i, i)))
+					errs <- err
+				}(i)
+				go func(i int) {
+					defer wg.Done()
+					_, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", fmt.Sprintf(`{"id": "shared", "Title": "Shared %d"}`, i)))
+					errs <- err
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				testing_utils.AssertEquals(t, err, nil, "Error")
+			}
+
+			for i := 0; i < count; i++ {
+				_, err := s.registry.ReadEntry(fmt.Sprintf("post-%d", i))
+				testing_utils.AssertEquals(t, err, nil, fmt.Sprintf("Registry entry %d", i))
+			}
+
+			// Serialized updates of the same entry should leave only the last version.
+			sharedPath, err := s.registry.ReadEntry("post-shared")
+			testing_utils.AssertEquals(t, err, nil, "Registry shared entry")
+
+			files, _ := filepath.Glob(filepath.Join(s.Site.RootDir, "posts", "shared-*.html"))
+			testing_utils.AssertEquals(t, len(files), 1, "Shared files")
+			testing_utils.AssertEquals(t, files[0], sharedPath, "Shared registry")
+		})
+	}
+}
+
+func TestSiteService_ResetRegistry(t *testing.T) {
+	tests := []struct {
+		name        string
+		removeFiles bool
+	}{
+		{"KeepFiles", false},
+		{"RemoveFiles", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+			}, map[string]string{
+				"archetypes/post.md": `{{ index .Entry "Title" }}`,
+				"posts/untracked.md": `untracked`,
+			})
+
+			trackedPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Tracked"}`))
+			testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+			// Entry tracked outside the site root should never be removed
+			outsidePath := filepath.Join(t.TempDir(), "outside.html")
+			if err = os.WriteFile(outsidePath, []byte("outside"), 0664); err != nil {
+				t.Fatal(err)
+			}
+			_ = s.registry.CreateEntry("post-2", outsidePath)
+
+			err = s.ResetRegistry(tt.removeFiles)
+			entries, _ := s.registry.ReadEntries()
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"ResetRegistry error": {err, nil},
+				"Registry entries":    {len(entries), 0},
+				"Tracked removed":     {!fileExists(trackedPath), tt.removeFiles},
+				"Untracked kept":      {fileExists(filepath.Join(s.Site.RootDir, "posts", "untracked.md")), true},
+				"Outside kept":        {fileExists(outsidePath), true},
+			})
+		})
+	}
+}
+
+func TestSiteService_checkWarnings(t *testing.T) {
+	cleanOutput := `Start building sites … 
+hugo v0.101.0+extended linux/amd64 BuildDate=unknown
+
+                   | EN  
+-------------------+-----
+  Pages            | 10  
+  Static files     |  3  
+
+Total in 52 ms
+`
+	warningOutput := `Start building sites … 
+hugo v0.101.0+extended linux/amd64 BuildDate=unknown
+WARN 2022/07/01 10:10:10 found no layout file for "HTML" for kind "taxonomy"
+WARN 2022/07/01 10:10:10 REF_NOT_FOUND: Ref "missing.md": "/content/posts/post.md:1:1"
+
+Total in 52 ms
+`
+
+	tests := []struct {
+		name           string
+		failOnWarnings bool
+		patterns       []string
+		output         string
+		wantCode       string
+	}{
+		{"Disabled", false, nil, warningOutput, ""},
+		{"Clean", true, nil, cleanOutput, ""},
+		{"Warnings", true, nil, warningOutput, midas.ErrBuildWarnings},
+		{"CustomPatternMatching", true, []string{"REF_NOT_FOUND"}, warningOutput, midas.ErrBuildWarnings},
+		{"CustomPatternNotMatching", true, []string{"^ERROR"}, warningOutput, ""},
+		{"InvalidPattern", true, []string{"[WARN"}, warningOutput, midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SiteService{Site: midas.Site{FailOnWarnings: tt.failOnWarnings, WarningPatterns: tt.patterns}}
+
+			err := s.checkWarnings([]byte(tt.output))
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+		})
+	}
+}
+
+func TestSiteService_SlugCasing(t *testing.T) {
+	tests := []struct {
+		casing      string
+		createTitle string
+		createFile  string
+		updateTitle string
+		updateFile  string
+	}{
+		{"", "MyPost Title", "mypost-title.html", "MYPOST TITLE", "mypost-title.html"},
+		{midas.SlugCasingLower, "MyPost Title", "mypost-title.html", "MYPOST TITLE", "mypost-title.html"},
+		{midas.SlugCasingPreserve, "MyPost Title", "MyPost-Title.html", "Mypost title", "Mypost-title.html"},
+		{midas.SlugCasingKebab, "MyPost Title", "my-post-title.html", "MyPOST Title", "my-post-title.html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.casing, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+			}, map[string]string{
+				"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+			})
+			s.Site.SlugCasing = tt.casing
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", fmt.Sprintf(`{"id": 1, "Title": "%s"}`, tt.createTitle)))
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Create error": {err, nil},
+				"Create file":  {filepath.Base(outputPath), tt.createFile},
+			})
+
+			outputPath, err = s.UpdateEntry(mustParsePayload(t, "entry.update", "post", fmt.Sprintf(`{"id": 1, "Title": "%s"}`, tt.updateTitle)))
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Update error": {err, nil},
+				"Update file":  {filepath.Base(outputPath), tt.updateFile},
+			})
+
+			registered, _ := s.registry.ReadEntry("post-1")
+			testing_utils.AssertEquals(t, registered, outputPath, "Registry entry")
+
+			files, _ := os.ReadDir(filepath.Join(s.Site.RootDir, "posts"))
+			if len(files) != 1 {
+				t.Fatalf("Files: expected 1 file, got %d", len(files))
+			}
+			testing_utils.AssertEquals(t, files[0].Name(), tt.updateFile, "File on disk")
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+		}, map[string]string{
+			"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+		})
+		s.Site.SlugCasing = "camel"
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Title"}`))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
+
+func TestSiteService_CreateEntry_BaseArchetype(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			BaseArchetypePath: "archetypes/base.md",
+			ArchetypePath:     "archetypes/post.md",
+			OutputDir:         "posts",
+		},
+		"page": {
+			BaseArchetypePath: "archetypes/base.md",
+			ArchetypePath:     "archetypes/page.md",
+			OutputDir:         "pages",
+		},
+	}, map[string]string{
+		"archetypes/base.md": `---
+title: {{ index .Entry "Title" }}
+{{ block "params" . }}draft: false{{ end }}
+---
+{{ block "content" . }}Default content{{ end }}`,
+		"archetypes/post.md": `{{ define "params" }}type: post{{ end }}`,
+		"archetypes/page.md": `{{ define "content" }}{{ index .Entry "Body" }}{{ end }}`,
+	})
+
+	tests := []struct {
+		model    string
+		expected string
+	}{
+		{"post", "---\ntitle: Hello\ntype: post\n---\nDefault content"},
+		{"page", "---\ntitle: Hello\ndraft: false\n---\nPage body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", tt.model, `{"id": 1, "Title": "Hello", "Body": "Page body"}`))
+			testing_utils.AssertEquals(t, err, nil, "Error")
+
+			content, _ := os.ReadFile(outputPath)
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Content")
+		})
+	}
+
+	t.Run("missing base", func(t *testing.T) {
+		model := s.Site.CollectionTypes["post"]
+		model.BaseArchetypePath = "archetypes/missing.md"
+		s.Site.CollectionTypes = map[string]midas.ModelSettings{"post": model}
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "Missing"}`))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
+
+func TestSiteService_constructBuildArgs(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {BuildSegments: []string{"posts", "home"}},
+		"page": {},
+	}, nil)
+	s.Site.OutputSettings.Build = "dist"
+	s.Site.DraftsUrl = "https://drafts.example.com"
+
+	tests := []struct {
+		name     string
+		useCache bool
+		isDraft  bool
+		segments []string
+		expected []string
+	}{
+		{"Full", true, false, nil, []string{"-d", "dist"}},
+		{"Full without cache", false, false, nil, []string{"--ignoreCache", "-d", "dist"}},
+		{"Segments", true, false, []string{"posts", "home"}, []string{"-d", "dist", "--renderSegments", "posts,home"}},
+		{"Draft segments", true, true, []string{"posts"}, []string{"--ignoreCache", "-d", "publicDrafts", "-e", "development",
+			"-D", "-E", "-F", "-b", "https://drafts.example.com", "--renderSegments", "posts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg := s.constructBuildArgs(tt.useCache, tt.isDraft, tt.segments...)
+			testing_utils.AssertEquals(t, fmt.Sprint(arg), fmt.Sprint(tt.expected), "Arguments")
+		})
+	}
+
+	t.Run("Base URL", func(t *testing.T) {
+		withBaseURL := s
+		withBaseURL.Site.OutputSettings.BaseURL = "https://preview.example.com"
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Full": {fmt.Sprint(withBaseURL.constructBuildArgs(true, false)),
+				fmt.Sprint([]string{"-d", "dist", "--baseURL", "https://preview.example.com"})},
+			"Segments": {fmt.Sprint(withBaseURL.constructBuildArgs(false, false, "posts")),
+				fmt.Sprint([]string{"--ignoreCache", "-d", "dist", "--baseURL", "https://preview.example.com", "--renderSegments", "posts"})},
+			"Draft keeps drafts URL": {fmt.Sprint(withBaseURL.constructBuildArgs(true, true)),
+				fmt.Sprint([]string{"--ignoreCache", "-d", "publicDrafts", "-e", "development", "-D", "-E", "-F", "-b", "https://drafts.example.com"})},
+		})
+	})
+
+	t.Run("Model segments", func(t *testing.T) {
+		segmentTests := []struct {
+			selective bool
+			model     string
+			expected  []string
+		}{
+			{false, "post", nil},
+			{true, "post", []string{"posts", "home"}},
+			{true, "page", nil},
+			{true, "unknown", nil},
+		}
+
+		for _, tt := range segmentTests {
+			s.Site.SelectiveBuild = tt.selective
+			testing_utils.AssertEquals(t, fmt.Sprint(s.buildSegments(tt.model)), fmt.Sprint(tt.expected),
+				fmt.Sprintf("Segments of %s (selective: %t)", tt.model, tt.selective))
+		}
+	})
+}
+
+func TestSiteService_buildCommand(t *testing.T) {
+	t.Setenv("MIDAS_TEST_INHERITED", "inherited")
+	t.Setenv("HUGO_ENV", "development")
+
+	s := newTestSite(t, nil, nil)
+
+	t.Run("Inherited", func(t *testing.T) {
+		cmd := s.buildCommand(context.Background(), []string{"--ignoreCache"})
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Env":       {len(cmd.Env), 0}, // Inherited by the process as is
+			"Directory": {cmd.Dir, s.Site.RootDir},
+			"Arguments": {fmt.Sprint(cmd.Args[1:]), "[--ignoreCache]"},
+		})
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		s.Site.BuildEnv = map[string]string{"HUGO_ENV": "production", "GOPROXY": "https://proxy.example.com"}
+		cmd := s.buildCommand(context.Background(), nil)
+
+		env := map[string]string{}
+		for _, variable := range cmd.Env {
+			name, value, _ := strings.Cut(variable, "=")
+			env[name] = value // The last value is used by the process
+		}
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Configured": {env["GOPROXY"], "https://proxy.example.com"},
+			"Overridden": {env["HUGO_ENV"], "production"},
+			"Inherited":  {env["MIDAS_TEST_INHERITED"], "inherited"},
+			"Last":       {cmd.Env[len(cmd.Env)-1], "HUGO_ENV=production"},
+		})
+	})
+}
+
+func TestSiteService_UpdateEntry_Untracked(t *testing.T) {
+	newSite := func(t *testing.T) SiteService {
+		return newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+		}, map[string]string{
+			"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+		})
+	}
+
+	t.Run("Created", func(t *testing.T) {
+		s := newSite(t)
+
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 7, "Title": "Unknown"}`))
+		registered, _ := s.registry.ReadEntry("post-7")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Output path":    {outputPath, filepath.Join(s.Site.RootDir, "posts", "unknown.html")},
+			"Registry entry": {registered, outputPath},
+			"File exists":    {fileExists(outputPath), true},
+		})
+	})
+
+	t.Run("Registry error", func(t *testing.T) {
+		s := newSite(t)
+		s.registry.(*lockedRegistry).registry.(*mock.RegistryService).ReadEntryFn = func(_ string) (string, error) {
+			return "", midas.Errorf(midas.ErrInternal, "storage unavailable")
+		}
+
+		_, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 7, "Title": "Unknown"}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":  {midas.ErrorCode(err), midas.ErrInternal},
+			"File exists": {fileExists(filepath.Join(s.Site.RootDir, "posts", "unknown.html")), false},
+		})
+	})
+
+	t.Run("Failed render", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+		}, map[string]string{
+			"archetypes/post.md": `title: {{ .Entry.Title.Missing }}`,
+		})
+
+		_, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 7, "Title": "Unknown"}`))
+		_, readErr := s.registry.ReadEntry("post-7")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err != nil, true},
+			"Registry error": {midas.ErrorCode(readErr), midas.ErrNotFound},
+		})
+	})
+}
+
+func TestSiteService_CaseInsensitivePaths(t *testing.T) {
+	newSite := func(t *testing.T, caseInsensitive bool) SiteService {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {Archetype: `{{ index .Entry "Title" }}`, OutputDir: "posts"},
+		}, nil)
+		s.Site.SlugCasing = midas.SlugCasingPreserve
+		s.Site.CaseInsensitivePaths = &caseInsensitive
+
+		if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Hello"}`)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "World"}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+	pagePath := func(s SiteService, slug string) string { return filepath.Join(s.Site.RootDir, "posts", slug+".html") }
+
+	t.Run("Create", func(t *testing.T) {
+		for _, caseInsensitive := range []bool{true, false} {
+			s := newSite(t, caseInsensitive)
+
+			_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 3, "Title": "hello"}`))
+
+			wantCode := ""
+			if caseInsensitive {
+				wantCode = midas.ErrInvalid
+			}
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), wantCode, fmt.Sprintf("Error code (case-insensitive: %t)", caseInsensitive))
+		}
+	})
+
+	t.Run("Update to other entry", func(t *testing.T) {
+		s := newSite(t, true)
+
+		_, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 2, "Title": "HELLO"}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error code":      {midas.ErrorCode(err), midas.ErrInvalid},
+			"Entry kept":      {fileExists(pagePath(s, "World")), true},
+			"Other untouched": {fileExists(pagePath(s, "Hello")), true},
+		})
+	})
+
+	t.Run("Update letter case", func(t *testing.T) {
+		s := newSite(t, true)
+
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "HELLO"}`))
+		registered, _ := s.registry.ReadEntry("post-1")
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":          {err, nil},
+			"Output path":    {outputPath, pagePath(s, "HELLO")},
+			"Registry entry": {registered, outputPath},
+			"Old removed":    {fileExists(pagePath(s, "Hello")), false},
+		})
+	})
+}
+
+func TestSiteService_existingPath(t *testing.T) {
+	s := newTestSite(t, nil, map[string]string{"posts/Hello.html": "Hello"})
+	pagePath := func(slug string) string { return filepath.Join(s.Site.RootDir, "posts", slug+".html") }
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name            string
+		caseInsensitive *bool
+		path            string
+		expected        string
+	}{
+		{"Exact", nil, pagePath("Hello"), pagePath("Hello")},
+		{"Case differs", &enabled, pagePath("hello"), pagePath("Hello")},
+		{"Case differs, case-sensitive", &disabled, pagePath("hello"), ""},
+		{"Missing", &enabled, pagePath("World"), ""},
+		{"Missing directory", &enabled, filepath.Join(s.Site.RootDir, "pages", "hello.html"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Site.CaseInsensitivePaths = tt.caseInsensitive
+
+			testing_utils.AssertEquals(t, s.existingPath(tt.path), tt.expected, "Existing path")
+		})
+	}
+
+	t.Run("Detected by platform", func(t *testing.T) {
+		s.Site.CaseInsensitivePaths = nil
+
+		testing_utils.AssertEquals(t, s.caseInsensitivePaths(), runtime.GOOS == "darwin" || runtime.GOOS == "windows", "Case-insensitive")
+	})
+}
+
+func TestSiteService_UpdateEntry_EmptyOldPath(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+
+	tests := []struct {
+		name    string
+		service SiteService
+	}{
+		{"Empty registry entry", s},
+		{"Registry without paths", newSiteService(s.Site, none.NewRegistryService(s.Site))},
+	}
+
+	_ = s.registry.CreateEntry("post-8", "")
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title := fmt.Sprintf("Regression %d", i)
+			filename := midas.CreateSlug(title) + ".html"
+
+			outputPath, err := tt.service.UpdateEntry(mustParsePayload(t, "entry.update", "post", fmt.Sprintf(`{"id": 8, "Title": "%s"}`, title)))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":               {err, nil},
+				"Output path":         {outputPath, filepath.Join(s.Site.RootDir, "posts", filename)},
+				"File in output dir":  {fileExists(outputPath), true},
+				"File in working dir": {fileExists(filename), false},
+			})
+		})
+	}
+}
+
+func TestSiteService_UpdateEntry_AliasOnRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		alias    bool
+		titles   []string // Titles of the consecutive updates
+		expected string
+	}{
+		{"Renamed", true, []string{"New title"}, `aliases: ["old-title"]`},
+		{"Renamed twice", true, []string{"New title", "Newest title"}, `aliases: ["old-title","new-title"]`},
+		{"Renamed back", true, []string{"New title", "Old title"}, `aliases: ["new-title"]`},
+		{"Not renamed", true, []string{"Old title"}, `aliases: []`},
+		{"Disabled", false, []string{"New title"}, `aliases: []`},
+	}
+
+	newSite := func(t *testing.T, alias bool) SiteService {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", AliasOnRename: alias},
+		}, map[string]string{
+			"archetypes/post.md": `aliases: {{ .Aliases }}`,
+		})
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Old title"}`))
+		testing_utils.AssertEquals(t, err, nil, "Create error")
+
+		return s
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSite(t, tt.alias)
+
+			var (
+				outputPath string
+				err        error
+			)
+			for _, title := range tt.titles {
+				outputPath, err = s.UpdateEntry(mustParsePayload(t, "entry.update", "post", fmt.Sprintf(`{"id": 1, "Title": "%s"}`, title)))
+				testing_utils.AssertEquals(t, err, nil, "Update error")
+			}
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Content")
+		})
+	}
+
+	t.Run("Recreated", func(t *testing.T) {
+		s := newSite(t, true)
+
+		_, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "New title"}`))
+		testing_utils.AssertEquals(t, err, nil, "Update error")
+		_, err = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 1, "Title": "New title"}`))
+		testing_utils.AssertEquals(t, err, nil, "Delete error")
+		_, err = s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Old title"}`))
+		testing_utils.AssertEquals(t, err, nil, "Create error")
+
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "New title"}`))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Update error": {err, nil},
+			"Content":      {string(content), `aliases: ["old-title"]`},
+		})
+	})
+}
+
+func TestSiteService_CreateEntries_Concurrent(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+	s = newSiteService(s.Site, newMemoryRegistry(s.Site), WithEntryLocking())
+
+	const count = 100
+
+	var payloads []midas.Payload
+	for i := 0; i < count; i++ {
+		payloads = append(payloads, mustParsePayload(t, "entry.create", "post", fmt.Sprintf(`{"id": %d, "Title": "Entry %d"}`, i, i)))
+	}
+
+	report := midas.CreateEntries(s, payloads, 8)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Report error": {report.Err(), nil},
+		"Succeeded":    {report.Succeeded, count},
+	})
+
+	entries, _ := s.registry.ReadEntries()
+	testing_utils.AssertEquals(t, len(entries), count, "Registry entries")
+
+	for i, result := range report.Results {
+		expectedPath := filepath.Join(s.Site.RootDir, "posts", fmt.Sprintf("entry-%d.html", i))
+		content, _ := os.ReadFile(expectedPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			fmt.Sprintf("Path %d", i):           {result.Path, expectedPath},
+			fmt.Sprintf("Registry entry %d", i): {entries[fmt.Sprintf("post-%d", i)], expectedPath},
+			fmt.Sprintf("Content %d", i):        {string(content), fmt.Sprintf("title: Entry %d", i)},
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_Body(t *testing.T) {
+	bodyField := "Content"
+
+	tests := []struct {
+		name     string
+		trusted  bool
+		expected string
+	}{
+		{"Escaped", false, "body: &lt;p&gt;Fish &amp; chips&lt;/p&gt;"},
+		{"Trusted", true, "body: <p>Fish & chips</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := midas.ModelSettings{ArchetypePath: "archetypes/post.md", OutputDir: "posts", TrustedBody: tt.trusted}
+			model.Fields.Body = &bodyField
+
+			s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+				"archetypes/post.md": `body: {{ .Body }}`,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Body", "Content": "<p>Fish & chips</p>"}`))
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":   {err, nil},
+				"Content": {string(content), tt.expected},
+			})
+		})
+	}
+
+	t.Run("Not configured", func(t *testing.T) {
+		s := newTestSite(t, map[string]midas.ModelSettings{
+			"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", TrustedBody: true},
+		}, map[string]string{
+			"archetypes/post.md": `body: {{ .Body }}`,
+		})
+
+		outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Body", "Content": "<p>Hi</p>"}`))
+		content, _ := os.ReadFile(outputPath)
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":   {err, nil},
+			"Content": {string(content), "body: "},
+		})
+	})
+}
+
+func TestSiteService_CreateEntry_MarkdownBody(t *testing.T) {
+	bodyField := "Content"
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		htmlFields []string
+		expected   string
+	}{
+		{"Sanitized", false, []string{"Content"}, "body:\n## Menu\n\nFish &amp; **chips**"},
+		{"Trusted", true, nil, "body:\n## Menu\n\nFish &amp; **chips**"},
+		{"Not HTML", false, nil, "body:\n&lt;h2&gt;Menu&lt;/h2&gt;&lt;p&gt;Fish &amp;amp; &lt;strong&gt;chips&lt;/strong&gt;&lt;/p&gt;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := midas.ModelSettings{ArchetypePath: "archetypes/post.md", OutputDir: "posts", TrustedBody: tt.trusted, MarkdownBody: true}
+			model.Fields.Body = &bodyField
+			if tt.htmlFields != nil {
+				model.Fields.HTML = &tt.htmlFields
+			}
+
+			s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+				"archetypes/post.md": "body:\n{{ .Body }}",
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post",
+				`{"id": 1, "Title": "Body", "Content": "<h2>Menu</h2><p>Fish &amp; <strong>chips</strong></p>"}`))
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":   {err, nil},
+				"Content": {string(content), tt.expected},
+			})
+		})
+	}
+}
+
+func TestSiteService_DefaultArchetype(t *testing.T) {
+	tests := []struct {
+		name             string
+		defaultArchetype string
+		expected         string
+		wantErr          string
+	}{
+		{"Strict", "", "", midas.ErrSiteConfig},
+		{"Fallback", "archetypes/default.md", "default: Hello", ""},
+		{"Fallback missing", "archetypes/missing.md", "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+				"page": {ArchetypePath: "archetypes/page.md", OutputDir: "pages"},
+			}, map[string]string{
+				"archetypes/page.md":    `page: {{ index .Entry "Title" }}`,
+				"archetypes/default.md": `default: {{ index .Entry "Title" }}`,
+			})
+			s.Site.DefaultArchetypePath = tt.defaultArchetype
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Hello"}`))
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantErr, "Error code")
+			if tt.wantErr != "" {
+				return
+			}
+
+			content, _ := os.ReadFile(outputPath)
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Content")
+
+			// The existing model archetype is still used
+			outputPath, err = s.CreateEntry(mustParsePayload(t, "entry.create", "page", `{"id": 1, "Title": "About"}`))
+			content, _ = os.ReadFile(outputPath)
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":        {err, nil},
+				"Page content": {string(content), "page: About"},
+			})
+		})
+	}
+}
+
+func TestSiteService_ArchetypeDirectory(t *testing.T) {
+	tests := []struct {
+		name             string
+		archetypes       map[string]string
+		defaultArchetype string
+		expected         string
+		wantErr          string
+	}{
+		{"Model with output extension", map[string]string{
+			"archetypes/post.html": "post.html", "archetypes/post.md": "post.md", "archetypes/default.html": "default.html",
+		}, "", "post.html", ""},
+		{"Model markdown", map[string]string{
+			"archetypes/post.md": "post.md", "archetypes/default.html": "default.html",
+		}, "", "post.md", ""},
+		{"Default with output extension", map[string]string{
+			"archetypes/page.md": "page.md", "archetypes/default.html": "default.html", "archetypes/default.md": "default.md",
+		}, "", "default.html", ""},
+		{"Default markdown", map[string]string{
+			"archetypes/page.md": "page.md", "archetypes/default.md": "default.md",
+		}, "", "default.md", ""},
+		{"Site default", map[string]string{
+			"archetypes/page.md": "page.md", "fallback.md": "fallback",
+		}, "fallback.md", "fallback", ""},
+		{"Missing", map[string]string{
+			"archetypes/page.md": "page.md",
+		}, "", "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes", OutputDir: "posts"},
+			}, tt.archetypes)
+			s.Site.DefaultArchetypePath = tt.defaultArchetype
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Hello"}`))
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantErr, "Error code")
+			if tt.wantErr != "" {
+				return
+			}
+
+			content, _ := os.ReadFile(outputPath)
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Content")
+		})
+	}
+}
+
+func TestSiteService_AllowedFields(t *testing.T) {
+	archetype := `title: {{ index .Entry "Title" }}
+fields: {{ range $key, $value := .Entry }}{{ $key }} {{ end }}
+body: {{ .Body }}
+secret: {{ index .Entry "apiToken" }}`
+	payload := `{"id": 1, "Title": "Hello", "Content": "Text", "apiToken": "s3cr3t", "createdBy": {"email": "admin@example.com"}}`
+
+	tests := []struct {
+		name     string
+		allowed  *[]string
+		expected string
+	}{
+		{"All fields", nil, "title: Hello\nfields: Content Title apiToken createdBy id \nbody: Text\nsecret: s3cr3t"},
+		{"Allowed", &[]string{"Title", "Content", "missing"}, "title: Hello\nfields: Content Title \nbody: Text\nsecret: "},
+		{"Body not allowed", &[]string{"Title"}, "title: Hello\nfields: Title \nbody: \nsecret: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := midas.ModelSettings{ArchetypePath: "archetypes/post.md", OutputDir: "posts"}
+			model.Fields.Body = &[]string{"Content"}[0]
+			model.Fields.Allowed = tt.allowed
+
+			s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+				"archetypes/post.md": archetype,
+			})
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", payload))
+			content, _ := os.ReadFile(outputPath)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":   {err, nil},
+				"Content": {string(content), tt.expected},
+				"Leaked":  {tt.allowed != nil && strings.Contains(string(content), "s3cr3t"), false},
+				"Slug":    {filepath.Base(outputPath), "hello.html"},
+			})
+		})
+	}
+}
+
+func TestSiteService_ArchetypeSearchPath(t *testing.T) {
+	moduleDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(moduleDir, "archetypes"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(moduleDir, "archetypes", "post.md"), []byte("module"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		archetypePath    string
+		searchPath       []string
+		defaultArchetype string
+		archetypes       map[string]string
+		expected         string
+		wantErr          string
+	}{
+		{"Theme", "archetypes/post.md", nil, "", map[string]string{
+			"themes/blog/archetypes/post.md": "theme",
+		}, "theme", ""},
+		{"Project overrides theme", "archetypes/post.md", nil, "", map[string]string{
+			"archetypes/post.md": "project", "themes/blog/archetypes/post.md": "theme",
+		}, "project", ""},
+		{"Themes in order", "archetypes/post.md", nil, "", map[string]string{
+			"themes/a/archetypes/post.md": "a", "themes/b/archetypes/post.md": "b",
+		}, "a", ""},
+		{"Module", "archetypes/post.md", []string{"themes/*", moduleDir}, "", map[string]string{
+			"themes/blog/archetypes/page.md": "theme",
+		}, "module", ""},
+		{"Directory across layers", "archetypes", nil, "", map[string]string{
+			"archetypes/default.md": "project default", "themes/blog/archetypes/post.md": "theme post",
+		}, "theme post", ""},
+		{"Default in theme", "archetypes/missing.md", nil, "archetypes/default.md", map[string]string{
+			"themes/blog/archetypes/default.md": "theme default",
+		}, "theme default", ""},
+		{"Search disabled", "archetypes/post.md", []string{}, "", map[string]string{
+			"themes/blog/archetypes/post.md": "theme",
+		}, "", midas.ErrSiteConfig},
+		{"Invalid pattern", "archetypes/post.md", []string{"themes/["}, "", map[string]string{}, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: tt.archetypePath, OutputDir: "posts"},
+			}, tt.archetypes)
+			s.Site.ArchetypeSearchPath = tt.searchPath
+			s.Site.DefaultArchetypePath = tt.defaultArchetype
+
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Hello"}`))
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantErr, "Error code")
+			if tt.wantErr != "" {
+				return
+			}
+
+			content, _ := os.ReadFile(outputPath)
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Content")
+		})
+	}
+}
+
+func TestSiteService_DraftOutputDir(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DraftOutputDir: "drafts"},
+		"page": {ArchetypePath: "archetypes/post.md", OutputDir: "pages"},
+	}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+
+	draftPath := filepath.Join(s.Site.RootDir, "drafts", "entry.html")
+	publishedPath := filepath.Join(s.Site.RootDir, "posts", "entry.html")
+
+	steps := []struct {
+		name        string
+		event       string
+		publishedAt string
+		expected    string
+		removed     string
+	}{
+		{"Draft created", "entry.create", "null", draftPath, publishedPath},
+		{"Draft updated", "entry.update", "null", draftPath, publishedPath},
+		{"Published", "entry.update", `"2022-05-01T10:00:00.000Z"`, publishedPath, draftPath},
+		{"Unpublished", "entry.update", "null", draftPath, publishedPath},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			payload := mustParsePayload(t, step.event, "post", fmt.Sprintf(`{"id": 1, "Title": "Entry", "publishedAt": %s}`, step.publishedAt))
+
+			var outputPath string
+			var err error
+			if step.event == "entry.create" {
+				outputPath, err = s.CreateEntry(payload)
+			} else {
+				outputPath, err = s.UpdateEntry(payload)
+			}
+			registered, _ := s.registry.ReadEntry("post-1")
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":          {err, nil},
+				"Output path":    {outputPath, step.expected},
+				"Registry entry": {registered, step.expected},
+				"File exists":    {fileExists(step.expected), true},
+				"Other removed":  {fileExists(step.removed), false},
+			})
+		})
+	}
+
+	t.Run("Not configured", func(t *testing.T) {
+		outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "page", `{"id": 1, "Title": "Page", "publishedAt": null}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":       {err, nil},
+			"Output path": {outputPath, filepath.Join(s.Site.RootDir, "pages", "page.html")},
+		})
+	})
+}
+
+func TestSiteService_EntryOutputDirField(t *testing.T) {
+	model := midas.ModelSettings{ArchetypePath: "archetypes/post.md", OutputDir: "posts"}
+	sectionField := "Section"
+	model.Fields.OutputDir = &sectionField
+
+	s := newTestSite(t, map[string]midas.ModelSettings{"post": model}, map[string]string{
+		"archetypes/post.md": `title: {{ index .Entry "Title" }}`,
+	})
+
+	postsDir := filepath.Join(s.Site.RootDir, "posts")
+
+	tests := []struct {
+		name     string
+		section  string
+		expected string
+	}{
+		{"Not set", `null`, filepath.Join(postsDir, "entry.html")},
+		{"Empty", `""`, filepath.Join(postsDir, "entry.html")},
+		{"Simple", `"News"`, filepath.Join(postsDir, "news", "entry.html")},
+		{"Nested", `"news/World Cup"`, filepath.Join(postsDir, "news", "world-cup", "entry.html")},
+		{"Traversal", `"../../etc"`, filepath.Join(postsDir, "etc", "entry.html")},
+		{"Traversal inside", `"a/../b"`, filepath.Join(postsDir, "a", "b", "entry.html")},
+		{"Backslashes", `"..\\..\\news"`, filepath.Join(postsDir, "news", "entry.html")},
+		{"Absolute", `"/etc"`, filepath.Join(postsDir, "etc", "entry.html")},
+		{"Only separators", `"/../"`, filepath.Join(postsDir, "entry.html")},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := mustParsePayload(t, "entry.create", "post", fmt.Sprintf(`{"id": %d, "Title": "Entry", "Section": %s}`, i+1, tt.section))
+
+			outputPath, err := s.CreateEntry(payload)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error":       {err, nil},
+				"Output path": {outputPath, tt.expected},
+				"File exists": {fileExists(tt.expected), true},
+			})
+
+			_, _ = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", fmt.Sprintf(`{"id": %d}`, i+1)))
+		})
+	}
+
+	t.Run("Moved on update", func(t *testing.T) {
+		oldPath, _ := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 100, "Title": "Moved", "Section": "old"}`))
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 100, "Title": "Moved", "Section": "new"}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":       {err, nil},
+			"Output path": {outputPath, filepath.Join(postsDir, "new", "moved.html")},
+			"File exists": {fileExists(outputPath), true},
+			"Old removed": {fileExists(oldPath), false},
+		})
+	})
+}
+
+func TestSiteService_DeterministicOutput(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath: "archetypes/post.md",
+			OutputDir:     "posts",
+			Timestamps:    midas.TimestampSettings{Enabled: true},
+			Taxonomies: map[string]midas.TaxonomySettings{
+				"categories": {Field: "categories"},
+				"tags":       {Field: "tags"},
+				"authors":    {Field: "author"},
+			},
+		},
+	}, map[string]string{
+		"archetypes/post.md": `---
+title: {{ index .Entry "Title" }}
+{{ range $taxonomy, $terms := .Taxonomies }}{{ $taxonomy }}: {{ $terms }}
+{{ end }}{{ range $key, $value := .Entry }}{{ $key }}: {{ $value }}
+{{ end }}---
+`,
+	})
+
+	entry := `{"id": 1, "Title": "Stable", "author": {"id": 3, "name": "Jane", "roles": {"editor": true, "admin": false}},
+		"categories": [{"id": 1, "name": "Go"}, {"id": 2, "name": "Hugo"}], "tags": ["b", "a"], "zeta": 1, "alpha": 2,
+		"createdAt": "2022-05-01T10:00:00.000Z", "updatedAt": "2022-05-02T10:00:00.000Z"}`
+
+	var outputs []string
+	for i := 0; i < 10; i++ {
+		payload := mustParsePayload(t, "entry.create", "post", entry)
+
+		outputPath, err := s.CreateEntry(payload)
+		if err != nil {
+			t.Fatalf("error creating entry: %s", err)
+		}
+
+		content, _ := os.ReadFile(outputPath)
+		outputs = append(outputs, string(content))
+
+		if _, err = s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 1}`)); err != nil {
+			t.Fatalf("error deleting entry: %s", err)
+		}
+	}
+
+	for i, output := range outputs[1:] {
+		testing_utils.AssertEquals(t, output, outputs[0], fmt.Sprintf("Output %d", i+1))
+	}
+
+	// Front matter keys follow the (sorted) template range order, so the diffs between runs are empty
+	testing_utils.AssertEquals(t, strings.Index(outputs[0], "alpha:") < strings.Index(outputs[0], "zeta:"), true, "Sorted keys")
+}
+
+func TestSiteService_InlineArchetype(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {Archetype: `title: {{ index .Entry "Title" }}`, OutputDir: "posts"},
+		"page": {Archetype: `inline: {{ index .Entry "Title" }}`, ArchetypePath: "archetypes/page.md", OutputDir: "pages"},
+		"news": {Archetype: `{{ define "params" }}type: news{{ end }}`, BaseArchetypePath: "archetypes/base.md", OutputDir: "news"},
+	}, map[string]string{
+		"archetypes/page.md": `file: {{ index .Entry "Title" }}`,
+		"archetypes/base.md": `title: {{ index .Entry "Title" }}
+{{ block "params" . }}draft: false{{ end }}`,
+	})
+
+	tests := []struct {
+		name     string
+		model    string
+		expected string
+	}{
+		{"Inline only", "post", "title: Hello"},
+		{"Inline over file", "page", "inline: Hello"},
+		{"Inline with base", "news", "title: Hello\ntype: news"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", tt.model, `{"id": 1, "Title": "Hello"}`))
+			testing_utils.AssertEquals(t, err, nil, "Error")
+
+			content, _ := os.ReadFile(outputPath)
+			testing_utils.AssertEquals(t, string(content), tt.expected, "Content")
+		})
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		outputPath, err := s.UpdateEntry(mustParsePayload(t, "entry.update", "post", `{"id": 1, "Title": "Updated"}`))
+		testing_utils.AssertEquals(t, err, nil, "Error")
+
+		content, _ := os.ReadFile(outputPath)
+		testing_utils.AssertEquals(t, string(content), "title: Updated", "Content")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		s.Site.CollectionTypes = map[string]midas.ModelSettings{"post": {Archetype: `title: {{ .Entry`, OutputDir: "posts"}}
+
+		_, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 2, "Title": "Invalid"}`))
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
+
+// useFakeHugo replaces the hugo binary for the test with the shell script.
+func useFakeHugo(t *testing.T, script string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake hugo binary is a shell script")
+	}
+
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "hugo"), []byte("#!/bin/sh\n"+script+"\n"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	previous := midas.Concurrents
+	midas.Concurrents = concurrent.NewList()
+	t.Cleanup(func() {
+		midas.Concurrents = previous
+	})
+}
+
+func TestSiteService_FailedBuildLog(t *testing.T) {
+	useFakeHugo(t, "echo 'Start building sites'\necho 'ERROR render of \"page\" failed' >&2\nexit 1")
+
+	tests := []struct {
+		name    string
+		enabled bool
+		wantLog bool
+	}{
+		{"Enabled", true, true},
+		{"Disabled", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, nil, nil)
+			s.Site.FailedBuildLog = tt.enabled
+
+			buildErr := s.build(true, nil)
+
+			log, err := os.ReadFile(filepath.Join(s.Site.RootDir, buildLogName))
+			if tt.wantLog && err != nil {
+				t.Fatalf("build log wasn't written: %s", err)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":     {midas.ErrorCode(buildErr), midas.ErrInternal},
+				"Log written":    {err == nil, tt.wantLog},
+				"Log has output": {strings.Contains(string(log), `ERROR render of "page" failed`), tt.wantLog},
+				"Log has error":  {strings.Contains(string(log), "hugo build errored"), tt.wantLog},
+			})
+		})
+	}
+}
+
+func TestSiteService_EntryId(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		entry   string
+		want    string
+		wantErr string
+	}{
+		{"Flat", "", `{"id": 1, "Title": "First"}`, "post-1", ""},
+		{"Flat configured", "id", `{"id": "abc", "Title": "First"}`, "post-abc", ""},
+		{"Nested", "data.id", `{"data": {"id": 2}, "Title": "First"}`, "post-2", ""},
+		{"Missing", "", `{"Title": "First"}`, "", midas.ErrInvalid},
+		{"Nested missing", "data.id", `{"id": 1, "Title": "First"}`, "", midas.ErrInvalid},
+		{"Nested in non-object", "data.id", `{"data": 3, "Title": "First"}`, "", midas.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSite(t, map[string]midas.ModelSettings{
+				"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts"},
+			}, map[string]string{
+				"archetypes/post.md": `{{ index .Entry "Title" }}`,
+			})
+			s.Site.EntryIdPath = tt.path
+
+			payload := mustParsePayload(t, "entry.create", "post", tt.entry)
+			entryId, err := s.EntryId(payload)
+			_, createErr := s.CreateEntry(payload)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Entry id":          {entryId, tt.want},
+				"Error code":        {midas.ErrorCode(err), tt.wantErr},
+				"Create error code": {midas.ErrorCode(createErr), tt.wantErr},
+			})
+			if tt.wantErr == "" {
+				testing_utils.AssertEquals(t, registryPath(t, s, tt.want), filepath.Join(s.Site.RootDir, "posts", "first.html"), "Registered")
+			}
+		})
+	}
+}
+
+func TestSiteService_DeleteEntry_Untracked(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", DraftOutputDir: "drafts"},
+	}, map[string]string{
+		"archetypes/post.md":    `{{ index .Entry "Title" }}`,
+		"posts/untracked.html":  "untracked",
+		"drafts/untracked.html": "untracked draft",
+		"posts/other.html":      "other",
+	})
+	pagePath := func(dir, slug string) string { return filepath.Join(s.Site.RootDir, dir, slug+".html") }
+
+	// Registry hit, the tracked path is removed even if the payload title differs
+	if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "First", "publishedAt": "2022-01-01T10:10:10.000Z"}`)); err != nil {
+		t.Fatal(err)
+	}
+	hitPath, hitErr := s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 1, "Title": "Other"}`))
+
+	// Registry miss, the page is looked up in both output directories
+	missPath, missErr := s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 2, "Title": "Untracked"}`))
+
+	// Registry miss without the page
+	_, notFoundErr := s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 3, "Title": "Missing"}`))
+
+	// Registry miss, the page of the same title belongs to other entry
+	if _, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 4, "Title": "Owned", "publishedAt": "2022-01-01T10:10:10.000Z"}`)); err != nil {
+		t.Fatal(err)
+	}
+	_, ownedErr := s.DeleteEntry(mustParsePayload(t, "entry.delete", "post", `{"id": 5, "Title": "Owned", "publishedAt": "2022-01-01T10:10:10.000Z"}`))
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Hit error":            {hitErr, nil},
+		"Hit path":             {hitPath, pagePath("posts", "first")},
+		"Hit removed":          {fileExists(pagePath("posts", "first")), false},
+		"Hit kept other":       {fileExists(pagePath("posts", "other")), true},
+		"Miss error":           {missErr, nil},
+		"Miss path":            {missPath, pagePath("posts", "untracked")},
+		"Miss removed":         {fileExists(pagePath("posts", "untracked")), false},
+		"Miss removed draft":   {fileExists(pagePath("drafts", "untracked")), false},
+		"Not found error code": {midas.ErrorCode(notFoundErr), midas.ErrNotFound},
+		"Owned error code":     {midas.ErrorCode(ownedErr), midas.ErrNotFound},
+		"Owned kept":           {fileExists(pagePath("posts", "owned")), true},
+	})
+}
+
+func TestNewSiteService_RequireExistingRegistry(t *testing.T) {
+	tests := []struct {
+		name            string
+		requireExisting bool
+		wantCode        string
+		wantCreated     int
+	}{
+		{"Created", false, "", 1},
+		{"Required", true, midas.ErrRegistry, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := 0
+
+			previous := midas.RegistryServices
+			midas.RegistryServices = map[string]func(site midas.Site) midas.RegistryService{
+				"memory": func(site midas.Site) midas.RegistryService {
+					r := newMemoryRegistry(site)
+					r.OpenStorageFn = func() error {
+						return midas.Errorf(midas.ErrRegistry, "storage unavailable")
+					}
+					r.CreateStorageFn = func() error {
+						created++
+						return nil
+					}
+					return r
+				},
+			}
+			defer func() {
+				midas.RegistryServices = previous
+			}()
+
+			_, err := NewSiteService(midas.Site{
+				SiteName: "test",
+				RootDir:  t.TempDir(),
+				Registry: midas.RegistrySettings{Type: "memory", RequireExisting: tt.requireExisting},
+			})
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code":     {midas.ErrorCode(err), tt.wantCode},
+				"Create storage": {created, tt.wantCreated},
+			})
+		})
+	}
+}
+
+func TestSiteService_BuildDestination_MatchesDeployPath(t *testing.T) {
+	absolute := filepath.Join(t.TempDir(), "www")
+
+	tests := []struct {
+		name   string
+		output midas.OutputSettings
+	}{
+		{"Default", midas.OutputSettings{}},
+		{"Relative", midas.OutputSettings{Build: "dist", Draft: "dist-drafts"}},
+		{"Absolute", midas.OutputSettings{Build: absolute, Draft: absolute + "-drafts"}},
+	}
+
+	for _, tt := range tests {
+		for _, isDraft := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s (draft: %t)", tt.name, isDraft), func(t *testing.T) {
+				s := newTestSite(t, nil, nil)
+				s.Site.OutputSettings = tt.output
+
+				// Hugo runs in the root directory, so the relative destination is resolved against it
+				arg := s.constructBuildArgs(true, isDraft)
+				destination := ""
+				for i := range arg[:len(arg)-1] {
+					if arg[i] == "-d" {
+						destination = arg[i+1]
+					}
+				}
+				if !filepath.IsAbs(destination) {
+					destination = filepath.Join(s.Site.RootDir, destination)
+				}
+
+				if err := os.MkdirAll(destination, 0775); err != nil {
+					t.Fatal(err)
+				}
+
+				deployPath, err := midas.DeploymentSettings{}.DeployPath(s.Site, isDraft)
+				testing_utils.AssertTable(t, map[string][]interface{}{
+					"Error":       {err, nil},
+					"Deploy path": {deployPath, destination},
+				})
+			})
+		}
+	}
+}
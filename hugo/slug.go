@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"fmt"
+	"github.com/kovansky/midas"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// slugFuncs are the functions available in the slug template.
+var slugFuncs = template.FuncMap{
+	// date formats the entry date field with Go layout, i.e. {{ date "2006" .publishedAt }}. Missing date is empty.
+	"date": func(layout string, value interface{}) (string, error) {
+		date, err := parseDate(value)
+		if err != nil || date.IsZero() {
+			return "", err
+		}
+
+		return date.Format(layout), nil
+	},
+}
+
+// entrySlug generates the entry filename (without extension). If the model has the slug template configured,
+// it is executed over the entry fields; otherwise the title field is used. If the template results in empty
+// string (i.e. all the fields are missing), the title is used as well.
+func (s SiteService) entrySlug(model *midas.ModelSettings, entry map[string]interface{}) (string, error) {
+	titleField := "Title"
+	if model.Fields.Title != nil {
+		titleField = *model.Fields.Title
+	}
+
+	source := fmt.Sprintf("%v", entry[titleField])
+
+	if model.SlugTemplate != "" {
+		tmpl, err := template.New("slug").Funcs(slugFuncs).Parse(model.SlugTemplate)
+		if err != nil {
+			return "", midas.Errorf(midas.ErrSiteConfig, "slug template is invalid: %s", err)
+		}
+
+		var output strings.Builder
+		if err = tmpl.Execute(&output, slugData(tmpl, entry)); err != nil {
+			return "", midas.Errorf(midas.ErrInvalid, "slug template failed: %s", err)
+		}
+
+		// Missing nested fields render as "<no value>"
+		if result := strings.ReplaceAll(output.String(), "<no value>", ""); strings.Trim(result, " -_") != "" {
+			source = result
+		}
+	}
+
+	generator, name, err := s.slugGenerator(model)
+	if err != nil {
+		return "", err
+	}
+	if generator == nil {
+		return s.slug(source)
+	}
+
+	slug, err := generator.Slug(source, entry)
+	if err != nil {
+		return "", midas.Errorf(midas.ErrInvalid, "slug generator %s failed: %s", name, err)
+	}
+	if strings.Trim(slug, " -_.") == "" || strings.ContainsAny(slug, `/\`) {
+		return "", midas.Errorf(midas.ErrInvalid, "slug generator %s returned invalid slug %q", name, slug)
+	}
+
+	return slug, nil
+}
+
+// slugGenerator returns the slug generator (and its name) configured for the model, or for the site. Nil generator
+// is returned if none is configured, so the built-in one is used.
+func (s SiteService) slugGenerator(model *midas.ModelSettings) (midas.SlugGenerator, string, error) {
+	name := model.SlugGenerator
+	if name == "" {
+		name = s.Site.SlugGenerator
+	}
+	if name == "" {
+		return nil, "", nil
+	}
+
+	generator, ok := midas.SlugGenerators[name]
+	if !ok {
+		return nil, name, midas.Errorf(midas.ErrSiteConfig, "slug generator %s is not registered", name)
+	}
+
+	return generator, name, nil
+}
+
+// slugData copies the entry for the slug template, setting the missing (or null) fields used by the template
+// to empty values, so the template doesn't fail on them.
+func slugData(tmpl *template.Template, entry map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		data[key] = value
+	}
+
+	for _, field := range templateFields(tmpl.Tree.Root) {
+		if data[field[0]] != nil {
+			continue
+		}
+
+		// Nested fields (.author.name) of the missing object are looked up in the empty one
+		if len(field) > 1 {
+			data[field[0]] = map[string]interface{}{}
+		} else {
+			data[field[0]] = ""
+		}
+	}
+
+	return data
+}
+
+// templateFields returns the fields (.Field, .Object.Field, $.Field or index .Object "Field", as identifier chains)
+// used in the template node.
+func templateFields(node parse.Node) [][]string {
+	var fields [][]string
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			fields = append(fields, templateFields(child)...)
+		}
+	case *parse.ActionNode:
+		fields = templateFields(node.Pipe)
+	case *parse.PipeNode:
+		if node == nil {
+			return nil
+		}
+		for _, command := range node.Cmds {
+			fields = append(fields, templateFields(command)...)
+		}
+	case *parse.CommandNode:
+		if field, ok := indexField(node); ok {
+			fields = append(fields, field)
+		}
+		for _, arg := range node.Args {
+			fields = append(fields, templateFields(arg)...)
+		}
+	case *parse.FieldNode:
+		fields = append(fields, node.Ident)
+	case *parse.VariableNode:
+		if len(node.Ident) > 1 && node.Ident[0] == "$" {
+			fields = append(fields, node.Ident[1:])
+		}
+	case *parse.IfNode:
+		fields = branchFields(&node.BranchNode)
+	case *parse.WithNode:
+		fields = branchFields(&node.BranchNode)
+	case *parse.RangeNode:
+		fields = branchFields(&node.BranchNode)
+	}
+
+	return fields
+}
+
+// indexField returns the field looked up by the index command with the string keys, i.e. index .Object "Field".
+func indexField(node *parse.CommandNode) ([]string, bool) {
+	if len(node.Args) < 3 {
+		return nil, false
+	}
+	if identifier, ok := node.Args[0].(*parse.IdentifierNode); !ok || identifier.Ident != "index" {
+		return nil, false
+	}
+
+	var field []string
+	switch object := node.Args[1].(type) {
+	case *parse.DotNode:
+	case *parse.FieldNode:
+		field = append(field, object.Ident...)
+	case *parse.VariableNode:
+		if object.Ident[0] != "$" {
+			return nil, false
+		}
+		field = append(field, object.Ident[1:]...)
+	default:
+		return nil, false
+	}
+
+	for _, arg := range node.Args[2:] {
+		key, ok := arg.(*parse.StringNode)
+		if !ok {
+			return nil, false
+		}
+		field = append(field, key.Text)
+	}
+
+	return field, true
+}
+
+// branchFields returns the fields used in the if, with or range node.
+func branchFields(node *parse.BranchNode) [][]string {
+	fields := templateFields(node.Pipe)
+	fields = append(fields, templateFields(node.List)...)
+
+	return append(fields, templateFields(node.ElseList)...)
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSiteService_entrySlug(t *testing.T) {
+	entry := map[string]interface{}{
+		"Title":       "My Title",
+		"publishedAt": "2024-03-01T10:00:00.000Z",
+		"author":      map[string]interface{}{"name": "Jane Doe"},
+		"category":    nil,
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  string
+	}{
+		{"No template", "", "my-title", ""},
+		{"Year and title", `{{ date "2006" .publishedAt }}-{{ .Title }}`, "2024-my-title", ""},
+		{"Author and title", `{{ .author.name }}-{{ .Title }}`, "jane-doe-my-title", ""},
+		{"Missing field", `{{ .subtitle }}-{{ .Title }}`, "my-title", ""},
+		{"Null field", `{{ .category }}-{{ .Title }}`, "my-title", ""},
+		{"Missing nested field", `{{ .editor.name }}-{{ .Title }}`, "my-title", ""},
+		{"Missing indexed field", `{{ index . "subtitle" }}-{{ index $.editor "name" }}-{{ .Title }}`, "my-title", ""},
+		{"Missing date", `{{ date "2006" .updatedAt }}-{{ .Title }}`, "my-title", ""},
+		{"Conditional", `{{ if .category }}{{ .category }}{{ else }}misc{{ end }}-{{ .Title }}`, "misc-my-title", ""},
+		{"All missing", `{{ .subtitle }}-{{ .category }}`, "my-title", ""},
+		{"Invalid template", `{{ .Title`, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SiteService{}
+			slug, err := s.entrySlug(&midas.ModelSettings{SlugTemplate: tt.template}, entry)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Slug":       {slug, tt.expected},
+			})
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_SlugTemplate(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", SlugTemplate: `{{ date "2006" .publishedAt }}-{{ .Title }}`},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }}`,
+	})
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post",
+		`{"id": 1, "Title": "Hello World", "publishedAt": "2024-01-15T10:00:00.000Z"}`))
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":       {err, nil},
+		"Output path": {outputPath, filepath.Join(s.Site.RootDir, "posts", "2024-hello-world.html")},
+	})
+
+	outputPath, err = s.UpdateEntry(mustParsePayload(t, "entry.update", "post",
+		`{"id": 1, "Title": "Hello World", "publishedAt": "2025-01-15T10:00:00.000Z"}`))
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Update error":       {err, nil},
+		"Update output path": {outputPath, filepath.Join(s.Site.RootDir, "posts", "2025-hello-world.html")},
+	})
+}
+
+func TestSiteService_entrySlug_Generator(t *testing.T) {
+	previous := midas.SlugGenerators
+	midas.SlugGenerators = map[string]midas.SlugGenerator{
+		// short keeps the default slug, but cuts it to 10 characters at the word boundary
+		"short": midas.SlugGeneratorFunc(func(title string, _ map[string]interface{}) (string, error) {
+			slug := midas.CreateSlug(title)
+			if len(slug) <= 10 {
+				return slug, nil
+			}
+			if cut := strings.LastIndex(slug[:11], "-"); cut > 0 {
+				return slug[:cut], nil
+			}
+
+			return slug[:10], nil
+		}),
+		"upper": midas.SlugGeneratorFunc(func(title string, entry map[string]interface{}) (string, error) {
+			return fmt.Sprintf("%v-%s", entry["id"], strings.ToUpper(title)), nil
+		}),
+		"failing": midas.SlugGeneratorFunc(func(_ string, _ map[string]interface{}) (string, error) {
+			return "", errors.New("no slug")
+		}),
+		"nested": midas.SlugGeneratorFunc(func(title string, _ map[string]interface{}) (string, error) {
+			return "../" + title, nil
+		}),
+	}
+	t.Cleanup(func() {
+		midas.SlugGenerators = previous
+	})
+
+	entry := map[string]interface{}{"id": 1, "Title": "A Very Long Post Title"}
+
+	tests := []struct {
+		name     string
+		site     string
+		model    string
+		expected string
+		wantErr  string
+	}{
+		{"Built-in", "", "", "a-very-long-post-title", ""},
+		{"Site generator", "short", "", "a-very", ""},
+		{"Model overrides site", "short", "upper", "1-A VERY LONG POST TITLE", ""},
+		{"Not registered", "missing", "", "", midas.ErrSiteConfig},
+		{"Failing", "", "failing", "", midas.ErrInvalid},
+		{"Path separator", "", "nested", "", midas.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SiteService{Site: midas.Site{SlugGenerator: tt.site}}
+			slug, err := s.entrySlug(&midas.ModelSettings{SlugGenerator: tt.model}, entry)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+				"Slug":       {slug, tt.expected},
+			})
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_SlugGenerator(t *testing.T) {
+	previous := midas.SlugGenerators
+	midas.SlugGenerators = map[string]midas.SlugGenerator{
+		"max8": midas.SlugGeneratorFunc(func(title string, _ map[string]interface{}) (string, error) {
+			slug := midas.CreateSlug(title)
+			if len(slug) > 8 {
+				slug = strings.TrimRight(slug[:8], "-")
+			}
+
+			return slug, nil
+		}),
+	}
+	t.Cleanup(func() {
+		midas.SlugGenerators = previous
+	})
+
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {ArchetypePath: "archetypes/post.md", OutputDir: "posts", SlugGenerator: "max8"},
+	}, map[string]string{
+		"archetypes/post.md": `{{ index .Entry "Title" }}`,
+	})
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post", `{"id": 1, "Title": "Hello Wonderful World"}`))
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":       {err, nil},
+		"Output path": {outputPath, filepath.Join(s.Site.RootDir, "posts", "hello-wo.html")},
+	})
+}
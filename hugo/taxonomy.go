@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kovansky/midas"
+	"html/template"
+)
+
+const defaultTaxonomyTerm = "name"
+
+// taxonomies generates the front matter values for every taxonomy configured in the model.
+// Each value is a YAML (and JSON) compatible flow sequence, i.e. ["first","second"], so it can be put
+// directly in the archetype: `categories: {{ index .Taxonomies "categories" }}`.
+func taxonomies(model *midas.ModelSettings, entry map[string]interface{}) map[string]template.HTML {
+	output := make(map[string]template.HTML)
+
+	for taxonomy, settings := range model.Taxonomies {
+		term := settings.Term
+		if term == "" {
+			term = defaultTaxonomyTerm
+		}
+
+		output[taxonomy] = formatTerms(taxonomyTerms(entry[settings.Field], term))
+	}
+
+	return output
+}
+
+// taxonomyTerms extracts the terms from the relation value. Both single (object) and multiple (array) relations
+// are supported, as well as plain values. Missing relations result in no terms.
+func taxonomyTerms(relation interface{}, term string) []string {
+	terms := make([]string, 0)
+
+	switch relation.(type) {
+	case nil:
+		break
+	case []interface{}:
+		for _, item := range relation.([]interface{}) {
+			terms = append(terms, taxonomyTerms(item, term)...)
+		}
+	case map[string]interface{}:
+		if value, ok := relation.(map[string]interface{})[term]; ok && value != nil {
+			terms = append(terms, fmt.Sprintf("%v", value))
+		}
+	default:
+		terms = append(terms, fmt.Sprintf("%v", relation))
+	}
+
+	return terms
+}
+
+// formatTerms formats the terms as a flow sequence with quoted items.
+func formatTerms(terms []string) template.HTML {
+	formatted, _ := json.Marshal(terms)
+
+	return template.HTML(formatted)
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package hugo
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"html/template"
+	"os"
+	"testing"
+)
+
+func TestTaxonomies(t *testing.T) {
+	model := &midas.ModelSettings{Taxonomies: map[string]midas.TaxonomySettings{
+		"categories": {Field: "categories"},
+		"series":     {Field: "series", Term: "slug"},
+		"tags":       {Field: "tags"},
+	}}
+
+	tests := []struct {
+		name  string
+		entry map[string]interface{}
+		want  map[string]template.HTML
+	}{
+		{"Multiple", map[string]interface{}{
+			"categories": []interface{}{
+				map[string]interface{}{"id": 1.0, "name": "Go"},
+				map[string]interface{}{"id": 2.0, "name": "Static sites"},
+			},
+			"series": []interface{}{map[string]interface{}{"id": 1.0, "slug": "tutorial"}},
+			"tags":   []interface{}{"first", "second"},
+		}, map[string]template.HTML{
+			"categories": `["Go","Static sites"]`,
+			"series":     `["tutorial"]`,
+			"tags":       `["first","second"]`,
+		}},
+		{"Single", map[string]interface{}{
+			"categories": map[string]interface{}{"id": 1.0, "name": "Go"},
+			"series":     map[string]interface{}{"id": 1.0, "name": "Tutorial"},
+			"tags":       "first",
+		}, map[string]template.HTML{
+			"categories": `["Go"]`,
+			"series":     `[]`,
+			"tags":       `["first"]`,
+		}},
+		{"Missing", map[string]interface{}{
+			"categories": nil,
+		}, map[string]template.HTML{
+			"categories": `[]`,
+			"series":     `[]`,
+			"tags":       `[]`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := taxonomies(model, tt.entry)
+
+			testing_utils.AssertEquals(t, len(got), len(tt.want), "Taxonomies count")
+			for taxonomy, want := range tt.want {
+				testing_utils.AssertEquals(t, got[taxonomy], want, taxonomy)
+			}
+		})
+	}
+}
+
+func TestSiteService_CreateEntry_Taxonomies(t *testing.T) {
+	s := newTestSite(t, map[string]midas.ModelSettings{
+		"post": {
+			ArchetypePath: "archetypes/post.md",
+			OutputDir:     "posts",
+			Taxonomies: map[string]midas.TaxonomySettings{
+				"categories": {Field: "categories"},
+			},
+		},
+	}, map[string]string{
+		"archetypes/post.md": `categories: {{ index .Taxonomies "categories" }}`,
+	})
+
+	outputPath, err := s.CreateEntry(mustParsePayload(t, "entry.create", "post",
+		`{"id": 1, "Title": "Test", "categories": [{"id": 1, "name": "Go"}, {"id": 2, "name": "Hugo"}]}`))
+	testing_utils.AssertEquals(t, err, nil, "CreateEntry error")
+
+	content, err := os.ReadFile(outputPath)
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Read output error": {err, nil},
+		"Output content":    {string(content), `categories: ["Go","Hugo"]`},
+	})
+}
@@ -8,16 +8,45 @@ package jsonfile
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/kovansky/midas"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
+// FormatJSON is the default (and currently the only) format of the registry file.
+const FormatJSON = "json"
+
+// registryVersion is the current version of the registry file format.
+const registryVersion = 3
+
+// registryFile is the shape of the registry file since version 2.
+// Version 1 files are a plain id => filename object, without the version field.
+type registryFile struct {
+	Version int            `json:"version"`
+	Entries midas.Registry `json:"entries"`
+	// Namespaces hold the entries of the sites sharing the file (since version 3), indexed by the namespace.
+	Namespaces map[string]midas.Registry `json:"namespaces,omitempty"`
+}
+
+// migrations upgrade the registry file content from the version (key) to the next one.
+var migrations = map[int]func(data []byte) ([]byte, error){
+	1: migrateV1,
+	2: migrateV2,
+}
+
+// fileLocks serializes the writes to the registry files shared by multiple services, indexed by the file path.
+var fileLocks sync.Map
+
 type RegistryService struct {
-	path     string
-	file     *os.File
-	registry midas.Registry
+	path      string
+	namespace string
+	format    string
+	file      *os.File
+	registry  midas.Registry
+	outdated  bool // Whether the file content is in an older format than the current one
 
 	Site midas.Site
 }
@@ -28,53 +57,157 @@ func NewRegistryService(site midas.Site) midas.RegistryService {
 		filePath = filepath.Join(site.RootDir, site.Registry.Location)
 	}
 
+	format := site.Registry.Format
+	if format == "" {
+		format = FormatJSON
+	}
+
 	return &RegistryService{
-		path: filePath,
-		Site: site,
+		path:      filePath,
+		namespace: site.Registry.Namespace,
+		format:    format,
+		Site:      site,
 	}
 }
 
-// OpenStorage opens the registry file (and creates it if it doesn't exist) and then
-// unmarshals the file content into the registry.
+// fileLock returns the lock of the registry file.
+func (r *RegistryService) fileLock() *sync.Mutex {
+	lock, _ := fileLocks.LoadOrStore(r.path, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// OpenStorage opens the registry file (and creates it if it doesn't exist, unless the existing registry is required)
+// and then unmarshals the file content into the registry. Files in an older format are upgraded
+// to the current version and written back.
 func (r *RegistryService) OpenStorage() error {
-	file, err := os.OpenFile(r.path, os.O_RDWR|os.O_CREATE, 0775)
+	return r.openStorage(!r.Site.Registry.RequireExisting)
+}
+
+// openStorage opens the registry file, creating it if it doesn't exist and create is true.
+func (r *RegistryService) openStorage(create bool) error {
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+
+	file, err := os.OpenFile(r.path, flags, 0775)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return midas.Errorf(midas.ErrRegistry, "registry file %s does not exist", r.path)
+		}
 		return err
 	}
 
 	r.file = file
 
-	if err = r.readStorage(); err != nil {
+	lock := r.fileLock()
+	lock.Lock()
+	content, err := r.readStorage()
+	lock.Unlock()
+	if err != nil {
 		return err
 	}
 
+	r.registry = content.Entries
+	if r.namespace != "" {
+		r.registry = content.Namespaces[r.namespace]
+	}
+	if r.registry == nil {
+		r.registry = make(map[string]string)
+	}
+
+	if r.outdated {
+		return r.Flush()
+	}
+
 	return nil
 }
 
-// readStorage reads the file content and unmarshals it into the registry.
-func (r *RegistryService) readStorage() error {
+// readStorage reads the file content and upgrades it to the current version. The caller must hold the file lock.
+func (r *RegistryService) readStorage() (registryFile, error) {
 	// Move cursor to the beginning of file
 	if _, err := r.file.Seek(0, 0); err != nil {
-		return err
+		return registryFile{}, err
 	}
 
 	data, err := io.ReadAll(r.file)
 	if err != nil {
-		return err
+		return registryFile{}, err
 	}
 
 	if len(data) == 0 {
-		r.registry = make(map[string]string)
-
-		return nil
+		return registryFile{Version: registryVersion}, nil
 	}
 
-	err = json.Unmarshal(data, &r.registry)
+	version, err := fileVersion(data)
 	if err != nil {
-		return err
+		return registryFile{}, midas.Errorf(midas.ErrRegistry, "registry %s is malformed: %s", r.path, err)
 	}
 
-	return nil
+	if version > registryVersion {
+		return registryFile{}, midas.Errorf(midas.ErrRegistry, "registry %s has version %d, newer than supported version %d", r.path, version, registryVersion)
+	}
+
+	r.outdated = version < registryVersion
+	for ; version < registryVersion; version++ {
+		if data, err = migrations[version](data); err != nil {
+			return registryFile{}, midas.Errorf(midas.ErrRegistry, "registry %s migration from version %d failed: %s", r.path, version, err)
+		}
+	}
+
+	var content registryFile
+	if err = json.Unmarshal(data, &content); err != nil {
+		return registryFile{}, err
+	}
+
+	return content, nil
+}
+
+// fileVersion returns the version of the registry file content. Files without the version field are version 1.
+func fileVersion(data []byte) (int, error) {
+	var content map[string]json.RawMessage
+	if err := json.Unmarshal(data, &content); err != nil {
+		return 0, err
+	}
+
+	rawVersion, ok := content["version"]
+	if !ok {
+		return 1, nil
+	}
+
+	var version int
+	if err := json.Unmarshal(rawVersion, &version); err != nil {
+		// Version 1 registry with an entry of "version" id
+		var filename string
+		if json.Unmarshal(rawVersion, &filename) == nil {
+			return 1, nil
+		}
+
+		return 0, fmt.Errorf("invalid version %s", rawVersion)
+	}
+
+	return version, nil
+}
+
+// migrateV1 wraps the plain id => filename object into the version 2 shape.
+func migrateV1(data []byte) ([]byte, error) {
+	var entries midas.Registry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(registryFile{Version: 2, Entries: entries})
+}
+
+// migrateV2 marks the version 2 file as version 3, which only adds the optional namespaces.
+func migrateV2(data []byte) ([]byte, error) {
+	var content registryFile
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+
+	content.Version = 3
+	return json.Marshal(content)
 }
 
 // CloseStorage closes the file handler.
@@ -82,9 +215,26 @@ func (r *RegistryService) CloseStorage() {
 	_ = r.file.Close()
 }
 
-// CreateStorage creates the registry file. Equivalent of calling OpenStorage in this case.
+// CreateStorage validates the registry settings, creates the registry file directory (if it doesn't exist),
+// checks that it's writable and then opens the storage.
 func (r *RegistryService) CreateStorage() error {
-	return r.OpenStorage()
+	if r.format != FormatJSON {
+		return midas.Errorf(midas.ErrSiteConfig, "registry format %s is not supported", r.format)
+	}
+
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return midas.Errorf(midas.ErrSiteConfig, "registry directory %s can't be created: %s", dir, err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".midas-registry-*")
+	if err != nil {
+		return midas.Errorf(midas.ErrSiteConfig, "registry directory %s is not writable: %s", dir, err)
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+
+	return r.openStorage(true)
 }
 
 // RemoveStorage closes file handle and removes the registry file.
@@ -98,10 +248,33 @@ func (r *RegistryService) RemoveStorage() error {
 	return nil
 }
 
-// Flush writes the working changes on registry to the file.
+// Flush writes the working changes on registry to the file. The file is read again before writing, so the entries
+// of other namespaces (written by other services sharing the file) are kept.
 func (r *RegistryService) Flush() error {
+	lock := r.fileLock()
+	lock.Lock()
+	defer lock.Unlock()
+
+	stored, err := r.readStorage()
+	if err != nil {
+		return err
+	}
+
+	stored.Version = registryVersion
+	if r.namespace == "" {
+		stored.Entries = r.registry
+	} else {
+		if stored.Namespaces == nil {
+			stored.Namespaces = make(map[string]midas.Registry)
+		}
+		stored.Namespaces[r.namespace] = r.registry
+	}
+	if stored.Entries == nil {
+		stored.Entries = make(midas.Registry)
+	}
+
 	// Marshal the Registry into JSON
-	content, err := json.MarshalIndent(r.registry, "", "\t")
+	content, err := json.MarshalIndent(stored, "", "\t")
 	if err != nil {
 		return err
 	}
@@ -120,6 +293,8 @@ func (r *RegistryService) Flush() error {
 		return err
 	}
 
+	r.outdated = false
+
 	return nil
 }
 
@@ -136,16 +311,26 @@ func (r *RegistryService) CreateEntry(id, filename string) error {
 // ReadEntry returns filename attached to given id from the registry.
 func (r *RegistryService) ReadEntry(id string) (string, error) {
 	if _, ok := r.registry[id]; !ok {
-		return "", midas.Errorf(midas.ErrRegistry, "entry %s doesn't exist", id)
+		return "", midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
 	}
 
 	return r.registry[id], nil
 }
 
+// ReadEntries returns a copy of all the registry entries.
+func (r *RegistryService) ReadEntries() (midas.Registry, error) {
+	entries := make(midas.Registry, len(r.registry))
+	for id, filename := range r.registry {
+		entries[id] = filename
+	}
+
+	return entries, nil
+}
+
 // UpdateEntry sets a new filename for the id in the registry.
 func (r *RegistryService) UpdateEntry(id, newFilename string) error {
 	if _, err := r.ReadEntry(id); err != nil {
-		return midas.Errorf(midas.ErrRegistry, "entry %s doesn't exist", id)
+		return midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
 	}
 
 	r.registry[id] = newFilename
@@ -155,7 +340,7 @@ func (r *RegistryService) UpdateEntry(id, newFilename string) error {
 // DeleteEntry removes entry with given id from the registry.
 func (r *RegistryService) DeleteEntry(id string) error {
 	if _, err := r.ReadEntry(id); err != nil {
-		return midas.Errorf(midas.ErrRegistry, "entry %s doesn't exist", id)
+		return midas.Errorf(midas.ErrNotFound, "entry %s doesn't exist", id)
 	}
 
 	delete(r.registry, id)
@@ -7,9 +7,13 @@
 package jsonfile
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -87,6 +91,9 @@ func TestRegistryService_ReadEntry(t *testing.T) {
 				t.Errorf("ReadEntry() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.wantErr && midas.ErrorCode(err) != midas.ErrNotFound {
+				t.Errorf("ReadEntry() error code = %v, want %v", midas.ErrorCode(err), midas.ErrNotFound)
+			}
 			if got != tt.want {
 				t.Errorf("ReadEntry() got = %v, want %v", got, tt.want)
 			}
@@ -94,6 +101,22 @@ func TestRegistryService_ReadEntry(t *testing.T) {
 	}
 }
 
+func TestRegistryService_ReadEntries(t *testing.T) {
+	got, err := r.ReadEntries()
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(got) != 2 || got["test-1"] != "test-1.html" || got["test-2"] != "test-2.html" {
+		t.Errorf("ReadEntries() got = %v", got)
+	}
+
+	// Returned registry is a copy
+	got["test-3"] = "test-3.html"
+	if len(r.registry) != 2 {
+		t.Errorf("ReadEntries() modifying result changed the registry")
+	}
+}
+
 func TestRegistryService_UpdateEntry(t *testing.T) {
 	type args struct {
 		id          string
@@ -160,13 +183,13 @@ func TestRegistryService_Flush(t *testing.T) {
 				t.Errorf("Flush() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
-			err := r.readStorage()
+			content, err := r.readStorage()
 			if err != nil {
 				t.Errorf("readStorage() error = %v", err)
 			}
 
-			if len(r.registry) != lenBefore {
-				t.Errorf("Flush() len before flush = %v, after flush = %v", lenBefore, len(r.registry))
+			if len(content.Entries) != lenBefore {
+				t.Errorf("Flush() len before flush = %v, after flush = %v", lenBefore, len(content.Entries))
 			}
 		})
 	}
@@ -191,3 +214,224 @@ func TestRegistryService_RemoveStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryService_Migration(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantEntries midas.Registry
+		wantErr     error
+	}{
+		{"v1", `{"posts-1": "content/posts/first.html", "posts-2": "content/posts/second.html"}`,
+			midas.Registry{"posts-1": "content/posts/first.html", "posts-2": "content/posts/second.html"}, nil},
+		{"v1 with version id", `{"version": "version.html"}`, midas.Registry{"version": "version.html"}, nil},
+		{"v1 empty", `{}`, midas.Registry{}, nil},
+		{"v2", `{"version": 2, "entries": {"posts-1": "content/posts/first.html"}}`,
+			midas.Registry{"posts-1": "content/posts/first.html"}, nil},
+		{"Current", `{"version": 3, "entries": {"posts-1": "content/posts/first.html"}, "namespaces": {"other": {"posts-1": "other.html"}}}`,
+			midas.Registry{"posts-1": "content/posts/first.html"}, nil},
+		{"Newer", `{"version": 4, "entries": {}}`, nil, midas.Errorf(midas.ErrRegistry, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "registry.json"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			registry := NewRegistryService(midas.Site{RootDir: dir, Registry: midas.RegistrySettings{Type: "jsonfile", Location: "registry.json"}})
+			err := registry.OpenStorage()
+			if tt.wantErr != nil {
+				if midas.ErrorCode(err) != midas.ErrorCode(tt.wantErr) {
+					t.Fatalf("OpenStorage() error = %v, want code %s", err, midas.ErrorCode(tt.wantErr))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenStorage() error = %v", err)
+			}
+			defer registry.CloseStorage()
+
+			entries, _ := registry.ReadEntries()
+			if !reflect.DeepEqual(entries, tt.wantEntries) {
+				t.Errorf("ReadEntries() = %v, want %v", entries, tt.wantEntries)
+			}
+
+			// The file is rewritten in the current format
+			data, err := os.ReadFile(filepath.Join(dir, "registry.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var content registryFile
+			if err = json.Unmarshal(data, &content); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if content.Version != registryVersion {
+				t.Errorf("File version = %d, want %d", content.Version, registryVersion)
+			}
+			if !reflect.DeepEqual(content.Entries, tt.wantEntries) {
+				t.Errorf("File entries = %v, want %v", content.Entries, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestRegistryService_Namespace(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "registry.json"), []byte(`{"posts-1": "legacy.html"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(namespace string) midas.RegistryService {
+		registry := NewRegistryService(midas.Site{RootDir: dir, Registry: midas.RegistrySettings{
+			Type: "jsonfile", Location: "registry.json", Namespace: namespace,
+		}})
+		if err := registry.OpenStorage(); err != nil {
+			t.Fatalf("OpenStorage(%q) error = %v", namespace, err)
+		}
+
+		return registry
+	}
+
+	first, second := open("first"), open("second")
+
+	// Both sites write the same id, flushing in turns
+	for _, step := range []struct {
+		registry midas.RegistryService
+		filename string
+	}{{first, "first.html"}, {second, "second.html"}} {
+		if err := step.registry.CreateEntry("posts-1", step.filename); err != nil {
+			t.Fatalf("CreateEntry() error = %v", err)
+		}
+		if err := step.registry.Flush(); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+
+	if err := first.DeleteEntry("posts-1"); err != nil {
+		t.Fatalf("DeleteEntry() error = %v", err)
+	}
+	if err := first.CreateEntry("posts-2", "first-2.html"); err != nil {
+		t.Fatalf("CreateEntry() error = %v", err)
+	}
+	if err := first.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	first.CloseStorage()
+	second.CloseStorage()
+
+	tests := []struct {
+		namespace   string
+		wantEntries midas.Registry
+	}{
+		{"first", midas.Registry{"posts-2": "first-2.html"}},
+		{"second", midas.Registry{"posts-1": "second.html"}},
+		{"", midas.Registry{"posts-1": "legacy.html"}},
+		{"third", midas.Registry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			registry := open(tt.namespace)
+			defer registry.CloseStorage()
+
+			entries, _ := registry.ReadEntries()
+			if !reflect.DeepEqual(entries, tt.wantEntries) {
+				t.Errorf("ReadEntries() = %v, want %v", entries, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestRegistryService_CreateStorage(t *testing.T) {
+	root := t.TempDir()
+	absolute := filepath.Join(t.TempDir(), "volume", "registry.json")
+
+	readOnly := filepath.Join(t.TempDir(), "read-only")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings midas.RegistrySettings
+		wantPath string
+		wantCode string
+	}{
+		{"Relative in new directory", midas.RegistrySettings{Location: "data/midas/registry.json"}, filepath.Join(root, "data", "midas", "registry.json"), ""},
+		{"Absolute", midas.RegistrySettings{Location: absolute, Format: FormatJSON}, absolute, ""},
+		{"Unsupported format", midas.RegistrySettings{Location: "registry.yaml", Format: "yaml"}, "", midas.ErrSiteConfig},
+		{"Not writable", midas.RegistrySettings{Location: filepath.Join(readOnly, "registry.json")}, "", midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "Not writable" && os.Geteuid() == 0 {
+				t.Skip("permissions are not enforced for root")
+			}
+
+			tt.settings.Type = "jsonfile"
+			registry := NewRegistryService(midas.Site{RootDir: root, Registry: tt.settings})
+
+			err := registry.CreateStorage()
+			if code := midas.ErrorCode(err); code != tt.wantCode {
+				t.Fatalf("CreateStorage() error = %v, want code %q", err, tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				return
+			}
+			defer registry.CloseStorage()
+
+			if _, err = os.Stat(tt.wantPath); err != nil {
+				t.Errorf("CreateStorage() registry file wasn't created at %s: %v", tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestRegistryService_OpenStorage_RequireExisting(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "existing.json"), []byte(`{"version":3,"entries":{"post-1":"post-1.html"}}`), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		location        string
+		requireExisting bool
+		wantCode        string
+		wantCreated     bool
+	}{
+		{"Missing created", "missing.json", false, "", true},
+		{"Missing required", "missing.json", true, midas.ErrRegistry, false},
+		{"Existing required", "existing.json", true, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.location == "existing.json" {
+				dir = root
+			}
+
+			registry := NewRegistryService(midas.Site{RootDir: dir, Registry: midas.RegistrySettings{
+				Type:            "jsonfile",
+				Location:        tt.location,
+				RequireExisting: tt.requireExisting,
+			}})
+
+			err := registry.OpenStorage()
+			if err == nil {
+				defer registry.CloseStorage()
+			}
+
+			_, statErr := os.Stat(filepath.Join(dir, tt.location))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantCode},
+				"Exists":     {statErr == nil, tt.wantCreated},
+			})
+		})
+	}
+}
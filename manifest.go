@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DeployManifest lists the files uploaded by the deployment, to be consumed by the downstream tooling.
+type DeployManifest struct {
+	DeployedAt time.Time      `json:"deployedAt"`
+	Target     string         `json:"target"`
+	Files      []ManifestFile `json:"files"`
+	// Hash of the deployed files and settings, recorded if the SkipUnchanged is enabled (see OutputHash).
+	Hash string `json:"hash,omitempty"`
+}
+
+type ManifestFile struct {
+	Key         string `json:"key"` // Object key (or remote path) of the uploaded file
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+}
+
+// NewDeployManifest creates an empty manifest of the deployment starting now.
+func NewDeployManifest(target string) *DeployManifest {
+	return &DeployManifest{DeployedAt: time.Now().UTC(), Target: target, Files: []ManifestFile{}}
+}
+
+// Add records the uploaded file.
+func (m *DeployManifest) Add(key string, size int64, contentType string) {
+	m.Files = append(m.Files, ManifestFile{Key: key, Size: size, ContentType: contentType})
+}
+
+// Size returns the total size of the uploaded files.
+func (m *DeployManifest) Size() (size int64) {
+	for _, file := range m.Files {
+		size += file.Size
+	}
+
+	return size
+}
+
+// AddContent records the uploaded content, reading its size. The content is the one sent, which may differ from
+// the local file (i.e. minified or compressed), as may the content type. The content is rewound afterwards.
+func (m *DeployManifest) AddContent(key string, content io.Seeker, contentType string) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	m.Add(key, size, contentType)
+	return nil
+}
+
+// ReadDeployManifest reads the manifest from the manifest path from the deployment settings. Returns nil if the
+// manifest path is not configured, or the manifest wasn't written yet.
+func ReadDeployManifest(site Site, settings DeploymentSettings) (*DeployManifest, error) {
+	if settings.ManifestPath == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(manifestPath(site, settings))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest DeployManifest
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return nil, Errorf(ErrInternal, "deploy manifest is malformed: %s", err)
+	}
+
+	return &manifest, nil
+}
+
+// Write saves the manifest as JSON to the manifest path from the deployment settings (relative to the site root).
+// Nothing is written if the manifest path is not configured.
+func (m *DeployManifest) Write(site Site, settings DeploymentSettings) error {
+	if settings.ManifestPath == "" {
+		return nil
+	}
+
+	jsoned, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(manifestPath(site, settings), jsoned, 0664)
+}
+
+// manifestPath returns the manifest path, relative to the site root unless absolute.
+func manifestPath(site Site, settings DeploymentSettings) string {
+	if filepath.IsAbs(settings.ManifestPath) {
+		return settings.ManifestPath
+	}
+
+	return filepath.Join(site.RootDir, settings.ManifestPath)
+}
+
+// OutputHash returns the SHA-256 hash (hex encoded) of the deployed files (their paths and contents) and
+// the deployment settings, so the changed settings are deployed even if the build output is the same.
+func (s DeploymentSettings) OutputHash(site Site, isDraft bool) (string, error) {
+	deployPath, err := s.DeployPath(site, isDraft)
+	if err != nil {
+		return "", err
+	}
+
+	filter, err := s.FileFilter()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+
+	settings, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(settings)
+
+	// Walk visits the files in lexical order, so the hash doesn't depend on the file system
+	err = filepath.Walk(deployPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(deployPath, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !filter.Match(rel) {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		fileHash := sha256.New()
+		if _, err = io.Copy(fileHash, file); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(hash, "%s\x00%x\n", rel, fileHash.Sum(nil))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CheckChanged returns ErrUnchanged, if the SkipUnchanged is enabled and the output hash matches the one recorded
+// in the manifest of the last deployment. Otherwise, the output hash is returned, to be recorded with RecordHash
+// after the deployment. The hash is empty if the SkipUnchanged is disabled.
+func (s DeploymentSettings) CheckChanged(site Site, isDraft bool) (string, error) {
+	if !s.SkipUnchanged {
+		return "", nil
+	}
+	if s.ManifestPath == "" {
+		return "", Errorf(ErrSiteConfig, "skipping unchanged deployments requires the manifest path")
+	}
+
+	hash, err := s.OutputHash(site, isDraft)
+	if err != nil {
+		return "", err
+	}
+
+	manifest, err := ReadDeployManifest(site, s)
+	if err != nil {
+		return "", err
+	}
+
+	if manifest != nil && manifest.Hash == hash {
+		return hash, Errorf(ErrUnchanged, "deployment to %s is unchanged since %s", s.Target, manifest.DeployedAt.Format(time.RFC3339))
+	}
+
+	return hash, nil
+}
+
+// RecordHash records the output hash in the manifest written by the deployment. Nothing is recorded if the hash
+// is empty.
+func (s DeploymentSettings) RecordHash(site Site, hash string) error {
+	if hash == "" {
+		return nil
+	}
+
+	manifest, err := ReadDeployManifest(site, s)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		manifest = NewDeployManifest(s.Target)
+	}
+
+	manifest.Hash = hash
+	return manifest.Write(site, s)
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeployManifest_Write(t *testing.T) {
+	site := midas.Site{RootDir: t.TempDir()}
+	settings := midas.DeploymentSettings{Target: "aws", ManifestPath: "deploy-manifest.json"}
+
+	uploaded := []midas.ManifestFile{
+		{Key: "site/index.html", Size: 1024, ContentType: "text/html"},
+		{Key: "site/css/main.css", Size: 512, ContentType: "text/css"},
+		{Key: "site/img/logo.png", Size: 2048, ContentType: "image/png"},
+	}
+
+	before := time.Now().UTC()
+	manifest := midas.NewDeployManifest(settings.Target)
+	for _, file := range uploaded {
+		manifest.Add(file.Key, file.Size, file.ContentType)
+	}
+
+	if err := manifest.Write(site, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(site.RootDir, "deploy-manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written midas.DeployManifest
+	err = json.Unmarshal(content, &written)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Error":       {err, nil},
+		"Target":      {written.Target, "aws"},
+		"Files":       {fmt.Sprint(written.Files), fmt.Sprint(uploaded)},
+		"Deployed at": {!written.DeployedAt.Before(before.Truncate(time.Second)) && !written.DeployedAt.After(time.Now()), true},
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		err := manifest.Write(midas.Site{RootDir: t.TempDir()}, midas.DeploymentSettings{})
+		testing_utils.AssertEquals(t, err, nil, "Error")
+	})
+}
+
+func TestDeploymentSettings_CheckChanged(t *testing.T) {
+	site := midas.Site{RootDir: t.TempDir()}
+	publicPath := filepath.Join(site.RootDir, "public")
+	if err := os.MkdirAll(filepath.Join(publicPath, "posts"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(publicPath, filepath.FromSlash(name)), []byte(content), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("index.html", "<p>Home</p>")
+	writeFile("posts/first.html", "<p>First</p>")
+
+	settings := midas.DeploymentSettings{Target: "aws", ManifestPath: "deploy-manifest.json", SkipUnchanged: true}
+
+	// deploy simulates the deployment writing the manifest, followed by recording the hash
+	deploy := func(settings midas.DeploymentSettings, hash string) {
+		if err := midas.NewDeployManifest(settings.Target).Write(site, settings); err != nil {
+			t.Fatal(err)
+		}
+		if err := settings.RecordHash(site, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash, err := settings.CheckChanged(site, false)
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"First deployment error": {err, nil},
+		"First deployment hash":  {len(hash), 64},
+	})
+	deploy(settings, hash)
+
+	tests := []struct {
+		name     string
+		change   func() midas.DeploymentSettings
+		wantCode string
+	}{
+		{"Unchanged", func() midas.DeploymentSettings { return settings }, midas.ErrUnchanged},
+		{"Changed file", func() midas.DeploymentSettings {
+			writeFile("posts/first.html", "<p>First, edited</p>")
+			return settings
+		}, ""},
+		{"Added file", func() midas.DeploymentSettings {
+			writeFile("posts/second.html", "<p>Second</p>")
+			return settings
+		}, ""},
+		{"Excluded file added", func() midas.DeploymentSettings {
+			settings.Exclude = []string{"*.map"}
+			deployed := settings
+			hash, _ := deployed.CheckChanged(site, false)
+			deploy(deployed, hash)
+
+			writeFile("app.js.map", "{}")
+			return deployed
+		}, midas.ErrUnchanged},
+		{"Changed settings", func() midas.DeploymentSettings {
+			changed := settings
+			changed.Subdir = "posts"
+			return changed
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.change()
+
+			hash, err := current.CheckChanged(site, false)
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+
+			deploy(current, hash)
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		hash, err := midas.DeploymentSettings{Target: "aws", ManifestPath: "deploy-manifest.json"}.CheckChanged(site, false)
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {err, nil},
+			"Hash":  {hash, ""},
+		})
+	})
+
+	t.Run("Without manifest", func(t *testing.T) {
+		_, err := midas.DeploymentSettings{Target: "aws", SkipUnchanged: true}.CheckChanged(site, false)
+		testing_utils.AssertEquals(t, midas.ErrorCode(err), midas.ErrSiteConfig, "Error code")
+	})
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas
+
+import "time"
+
+// Entry operations reported to the MetricsService.
+const (
+	EntryCreated  = "create"
+	EntryUpdated  = "update"
+	EntryDeleted  = "delete"
+	SingleUpdated = "single"
+)
+
+// MetricsService collects the operational metrics, i.e. to expose them to Prometheus. It's implemented outside of
+// midas, so the metrics library isn't a dependency. Implementations must be safe for concurrent use.
+type MetricsService interface {
+	// EntryProcessed counts the successful entry operation (one of Entry* constants or SingleUpdated) of the model.
+	EntryProcessed(site, model, operation string)
+	// SiteBuilt observes the site build duration. Err is nil for successful builds.
+	SiteBuilt(site string, duration time.Duration, err error)
+	// SiteDeployed observes the deployment duration and the number of uploaded bytes. Err is nil for successful
+	// deployments.
+	SiteDeployed(site, target string, bytes int64, duration time.Duration, err error)
+	// ErrorOccurred counts the errors returned to the clients by the error code.
+	ErrorOccurred(site, code string)
+}
+
+var _ MetricsService = NopMetrics{}
+
+// NopMetrics discards all the metrics. It's the default MetricsService.
+type NopMetrics struct{}
+
+func (NopMetrics) EntryProcessed(_, _, _ string) {}
+
+func (NopMetrics) SiteBuilt(_ string, _ time.Duration, _ error) {}
+
+func (NopMetrics) SiteDeployed(_, _ string, _ int64, _ time.Duration, _ error) {}
+
+func (NopMetrics) ErrorOccurred(_, _ string) {}
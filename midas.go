@@ -19,6 +19,16 @@ var (
 	DeploymentTargets map[string]func(site Site, settings DeploymentSettings, isDraft bool) (Deployment, error)
 	Sanitizer         SanitizerService
 	Concurrents       ConcurrentList
+	// PostWriteHooks are the functions available to the models' PostWrite settings, indexed by name.
+	PostWriteHooks map[string]PostWriteHook
+	// PayloadTransformers are the functions available to the models' Transformers settings, indexed by name.
+	PayloadTransformers map[string]PayloadTransformer
+	// SlugGenerators are the generators available to the sites' and models' SlugGenerator settings, indexed by name.
+	SlugGenerators map[string]SlugGenerator
+	// Renderers are the renderers available to the models' Renderer settings, indexed by name.
+	Renderers map[string]Renderer
+	// Metrics receives the operational metrics. Metrics are discarded by default.
+	Metrics MetricsService = NopMetrics{}
 )
 
 // ReportError is used to notify external services of error.
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+// Package minify removes the redundant whitespace (and the CSS comments) from the HTML, CSS and JS content. The
+// minification is conservative: it only drops what can't change the rendering or the behavior of the content.
+package minify
+
+import (
+	"bytes"
+	"errors"
+	"github.com/kovansky/midas"
+	"golang.org/x/net/html"
+	"io"
+	"strings"
+)
+
+// minifiers are the minifying functions by the content type, enabled by their names in the Minify setting.
+var minifiers = map[string]struct {
+	name   string
+	minify func([]byte) []byte
+}{
+	"text/html":              {"html", HTML},
+	"text/css":               {"css", CSS},
+	"application/javascript": {"js", JS},
+	"text/javascript":        {"js", JS},
+}
+
+// Content returns the content of given content type minified, if it's enabled by the names (the deployment Minify
+// setting), along with true. Otherwise, the content is returned rewound, along with false.
+func Content(content io.ReadSeeker, contentType string, enabled []string) (io.ReadSeeker, bool, error) {
+	// The parameters (i.e. charset) don't matter
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	minifier, ok := minifiers[strings.ToLower(contentType)]
+
+	minified := false
+	for _, name := range enabled {
+		if name != "html" && name != "css" && name != "js" {
+			return nil, false, midas.Errorf(midas.ErrSiteConfig, "unknown minified content type %s", name)
+		}
+		minified = minified || (ok && name == minifier.name)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	if !minified {
+		return content, false, nil
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return bytes.NewReader(minifier.minify(data)), true, nil
+}
+
+// rawElements are the elements which content is kept as is.
+var rawElements = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+	"script":   true,
+	"style":    true,
+}
+
+// HTML returns the HTML content with each run of the whitespace in the text collapsed into a single space (or a line
+// break, if the run has one), which the browsers render the same. Tags, comments and the content of pre, textarea,
+// script and style are kept as is. The content the tokenizer can't read is returned unchanged.
+func HTML(content []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(content))
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	rawDepth := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if !errors.Is(tokenizer.Err(), io.EOF) {
+				// Don't risk mangling content the tokenizer doesn't understand
+				return content
+			}
+			break
+		}
+
+		raw := tokenizer.Raw()
+
+		switch tokenType {
+		case html.TextToken:
+			if rawDepth > 0 {
+				out.Write(raw)
+			} else {
+				out.WriteString(collapseSpace(string(raw)))
+			}
+		case html.StartTagToken, html.EndTagToken:
+			out.Write(raw)
+
+			name, _ := tokenizer.TagName()
+			if rawElements[string(name)] {
+				if tokenType == html.StartTagToken {
+					rawDepth++
+				} else if rawDepth > 0 {
+					rawDepth--
+				}
+			}
+		default:
+			out.Write(raw)
+		}
+	}
+
+	return out.Bytes()
+}
+
+// collapseSpace replaces each run of the HTML whitespace with a single space, or a line break if the run has one.
+func collapseSpace(text string) string {
+	var out strings.Builder
+	out.Grow(len(text))
+
+	space, lineBreak := false, false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case ' ', '\t', '\r', '\f':
+			space = true
+		case '\n':
+			space, lineBreak = true, true
+		default:
+			if space {
+				out.WriteByte(spaceByte(lineBreak))
+				space, lineBreak = false, false
+			}
+			out.WriteByte(text[i])
+		}
+	}
+	if space {
+		out.WriteByte(spaceByte(lineBreak))
+	}
+
+	return out.String()
+}
+
+// spaceByte returns the character replacing the collapsed whitespace run.
+func spaceByte(lineBreak bool) byte {
+	if lineBreak {
+		return '\n'
+	}
+
+	return ' '
+}
+
+// CSS returns the CSS content with the comments removed and the whitespace collapsed. The whitespace around the
+// braces, semicolons, commas and child combinators is removed, along with the last semicolon of the block. Strings
+// and unquoted URLs (which may contain the comment markers, i.e. url(/images/*.png)) are kept as is.
+func CSS(content []byte) []byte {
+	out := make([]byte, 0, len(content))
+	pendingSpace := false
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		switch {
+		case c == '"' || c == '\'':
+			end := stringEnd(content, i)
+			out = appendSpace(out, &pendingSpace, c)
+			out = append(out, content[i:end]...)
+			i = end - 1
+		case isURLStart(content, i):
+			end := len(content)
+			if closing := bytes.IndexByte(content[i:], ')'); closing >= 0 {
+				end = i + closing + 1
+			}
+			out = appendSpace(out, &pendingSpace, c)
+			out = append(out, content[i:end]...)
+			i = end - 1
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(content)
+			} else {
+				i += end + 3
+			}
+			// The comment separates the tokens like the whitespace, i.e. a/**/b
+			pendingSpace = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pendingSpace = true
+		default:
+			if c == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+				out = out[:len(out)-1]
+			}
+			out = appendSpace(out, &pendingSpace, c)
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// appendSpace appends the pending whitespace before the character, unless it's redundant.
+func appendSpace(out []byte, pendingSpace *bool, next byte) []byte {
+	if *pendingSpace && len(out) > 0 && !isCSSSeparator(out[len(out)-1]) && !isCSSSeparator(next) {
+		out = append(out, ' ')
+	}
+	*pendingSpace = false
+
+	return out
+}
+
+// isCSSSeparator returns true for the characters which surrounding whitespace is redundant.
+func isCSSSeparator(c byte) bool {
+	switch c {
+	case '{', '}', ';', ',', '>':
+		return true
+	}
+
+	return false
+}
+
+// isURLStart returns true if the unquoted CSS URL (the url( function with the unquoted argument) starts at given
+// index.
+func isURLStart(content []byte, i int) bool {
+	if i+4 > len(content) || !bytes.EqualFold(content[i:i+4], []byte("url(")) {
+		return false
+	}
+	// Part of another function name, i.e. my-url(
+	if i > 0 {
+		if prev := content[i-1]; prev == '-' || prev == '_' || prev >= '0' && prev <= '9' || prev|0x20 >= 'a' && prev|0x20 <= 'z' {
+			return false
+		}
+	}
+
+	argument := bytes.TrimLeft(content[i+4:], " \t\n\r\f")
+	return len(argument) > 0 && argument[0] != '"' && argument[0] != '\''
+}
+
+// stringEnd returns the index after the end of the CSS string starting at given index.
+func stringEnd(content []byte, start int) int {
+	quote := content[start]
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case quote, '\n':
+			return i + 1
+		}
+	}
+
+	return len(content)
+}
+
+// JS returns the JS content with the indentation, trailing whitespace and blank lines removed. The line breaks are
+// kept, as they may terminate the statements. The content with template literals (which may span lines) is kept as
+// is.
+func JS(content []byte) []byte {
+	if bytes.IndexByte(content, '`') >= 0 {
+		return content
+	}
+
+	out := make([]byte, 0, len(content))
+	continued := false
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimRight(line, " \t\r")
+		// The line after the backslash continues a string
+		if !continued {
+			line = bytes.TrimLeft(line, " \t")
+		}
+		if len(line) == 0 && !continued {
+			continue
+		}
+
+		if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, line...)
+		continued = bytes.HasSuffix(line, []byte("\\"))
+	}
+
+	return out
+}
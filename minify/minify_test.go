@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package minify_test
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/minify"
+	"github.com/kovansky/midas/testing_utils"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Block whitespace", "<div>\n  <p>Text</p>\n</div>\n", "<div>\n<p>Text</p>\n</div>\n"},
+		{"Text whitespace", "<p>Some   \t  text</p>", "<p>Some text</p>"},
+		{"Inline whitespace", "<p>Some <em>emphasized</em>  <strong>text</strong> here </p>", "<p>Some <em>emphasized</em> <strong>text</strong> here </p>"},
+		// The whitespace between the elements displayed inline by the styles is rendered
+		{"Whitespace between elements", "<li>One</li>   <li>Two</li>", "<li>One</li> <li>Two</li>"},
+		{"Comments kept", "<p>One <!-- ko if: two -->  three<!-- /ko --></p>", "<p>One <!-- ko if: two --> three<!-- /ko --></p>"},
+		{"Conditional comment", "<head><!--[if IE]><link rel=\"stylesheet\" href=\"ie.css\"><![endif]--></head>", "<head><!--[if IE]><link rel=\"stylesheet\" href=\"ie.css\"><![endif]--></head>"},
+		{"Pre", "<pre>  line\n    indented\n</pre>\n<p> a </p>", "<pre>  line\n    indented\n</pre>\n<p> a </p>"},
+		{"Nested pre", "<pre><code>  a\n  b</code>\n</pre>  <p>  c</p>", "<pre><code>  a\n  b</code>\n</pre> <p> c</p>"},
+		{"Textarea", "<textarea>  a\n\n  <b>  b</b></textarea>", "<textarea>  a\n\n  <b>  b</b></textarea>"},
+		{"Script", "<script>\n  if (a  <  b) { s = '<!--  x -->'; r = /  +/g; }\n</script>", "<script>\n  if (a  <  b) { s = '<!--  x -->'; r = /  +/g; }\n</script>"},
+		{"Style", "<style>\n  a  { content: \"  /* x */  \" }\n</style>", "<style>\n  a  { content: \"  /* x */  \" }\n</style>"},
+		{"Tags kept", "<a href=\"/x\"  class=\"link\">x</a>", "<a href=\"/x\"  class=\"link\">x</a>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, string(minify.HTML([]byte(tt.content))), tt.want, "Minified")
+		})
+	}
+}
+
+func TestCSS(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Rule", "body {\n  color: red;\n  margin: 0 auto;\n}\n", "body{color: red;margin: 0 auto}"},
+		{"Comments", "/* header */\na { color: blue; } /* end */", "a{color: blue}"},
+		{"Selectors", "ul > li,\nol  >  li a:hover {}", "ul>li,ol>li a:hover{}"},
+		{"Strings", "a::before { content: \"  /* x */  \"; }", "a::before{content: \"  /* x */  \"}"},
+		{"Calc", "a { width: calc(100%  -  2px); }", "a{width: calc(100% - 2px)}"},
+		{"Descendant combinator", "a :hover{}", "a :hover{}"},
+		{"Unquoted URL", "a { background: url(/images/*.png)  no-repeat; }", "a{background: url(/images/*.png) no-repeat}"},
+		{"Quoted URL", "a { background: url( \"/*.png\" ); }", "a{background: url( \"/*.png\" )}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, string(minify.CSS([]byte(tt.content))), tt.want, "Minified")
+		})
+	}
+}
+
+func TestJS(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"Indentation", "function a() {\n    return 1;  \n}\n", "function a() {\nreturn 1;\n}"},
+		{"Blank lines", "a();\n\n\n\tb();\n", "a();\nb();"},
+		{"Line continuation", "var s = 'a\\\n    b';\n", "var s = 'a\\\n    b';"},
+		{"Regex literal", "  var r = /\\/\\*  +/g;  \n", "var r = /\\/\\*  +/g;"},
+		{"Comment markers in string", "  s = '//  not a comment /*  ';\n", "s = '//  not a comment /*  ';"},
+		{"Template literal", "var s = `\n    a\n`;\n", "var s = `\n    a\n`;\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, string(minify.JS([]byte(tt.content))), tt.want, "Minified")
+		})
+	}
+}
+
+func TestContent(t *testing.T) {
+	tests := []struct {
+		name         string
+		minify       []string
+		contentType  string
+		content      string
+		wantContent  string
+		wantMinified bool
+		wantErr      string
+	}{
+		{"Disabled", nil, "text/html", "<p>\n  a\n</p>", "<p>\n  a\n</p>", false, ""},
+		{"HTML", []string{"html"}, "text/html", "<p>\n  a\n</p>", "<p>\na\n</p>", true, ""},
+		{"HTML with charset", []string{"html"}, "text/html; charset=utf-8", "<p>\n  a\n</p>", "<p>\na\n</p>", true, ""},
+		{"CSS", []string{"css"}, "text/css", "a {\n  color: red;\n}", "a{color: red}", true, ""},
+		{"JS", []string{"js"}, "application/javascript", "a();\n\n  b();", "a();\nb();", true, ""},
+		{"Other type enabled", []string{"css"}, "text/html", "<p>\n  a\n</p>", "<p>\n  a\n</p>", false, ""},
+		{"Binary", []string{"html", "css", "js"}, "image/png", "\x89PNG  \n\n", "\x89PNG  \n\n", false, ""},
+		{"Unknown", []string{"svg"}, "image/svg+xml", "<svg/>", "", false, midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := strings.NewReader(tt.content)
+			// The content is rewound, even if read before
+			_, _ = io.ReadAll(file)
+
+			var content []byte
+			minified, minifiedOK, err := minify.Content(file, tt.contentType, tt.minify)
+			if err == nil {
+				content, _ = io.ReadAll(minified)
+			}
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Content":    {string(content), tt.wantContent},
+				"Minified":   {minifiedOK, tt.wantMinified},
+				"Error code": {midas.ErrorCode(err), tt.wantErr},
+			})
+		})
+	}
+}
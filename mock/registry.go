@@ -18,6 +18,7 @@ type RegistryService struct {
 	FlushFn         func() error
 	CreateEntryFn   func(id, filename string) error
 	ReadEntryFn     func(id string) (string, error)
+	ReadEntriesFn   func() (midas.Registry, error)
 	UpdateEntryFn   func(id, newFilename string) error
 	DeleteEntryFn   func(id string) error
 
@@ -56,6 +57,10 @@ func (r *RegistryService) ReadEntry(id string) (string, error) {
 	return r.ReadEntryFn(id)
 }
 
+func (r *RegistryService) ReadEntries() (midas.Registry, error) {
+	return r.ReadEntriesFn()
+}
+
 func (r *RegistryService) UpdateEntry(id, newFilename string) error {
 	return r.UpdateEntryFn(id, newFilename)
 }
@@ -17,10 +17,12 @@ type SiteService struct {
 	GetRegistryServiceFn func() (midas.RegistryService, error)
 	CreateRegistryFn     func() (string, error)
 	BuildSiteFn          func(useCache bool, log zerolog.Logger) error
+	BuildModelFn         func(model string, useCache bool, log zerolog.Logger) error
 	CreateEntryFn        func(payload midas.Payload) (string, error)
 	UpdateEntryFn        func(payload midas.Payload) (string, error)
 	DeleteEntryFn        func(payload midas.Payload) (string, error)
 	UpdateSingleFn       func(payload midas.Payload) (string, error)
+	ResetRegistryFn      func(removeFiles bool) error
 }
 
 func NewSiteService() *SiteService {
@@ -35,6 +37,10 @@ func (s *SiteService) BuildSite(useCache bool, log zerolog.Logger) error {
 	return s.BuildSiteFn(useCache, log)
 }
 
+func (s *SiteService) BuildModel(model string, useCache bool, log zerolog.Logger) error {
+	return s.BuildModelFn(model, useCache, log)
+}
+
 func (s *SiteService) CreateEntry(payload midas.Payload) (string, error) {
 	return s.CreateEntryFn(payload)
 }
@@ -50,3 +56,7 @@ func (s *SiteService) DeleteEntry(payload midas.Payload) (string, error) {
 func (s *SiteService) UpdateSingle(payload midas.Payload) (string, error) {
 	return s.UpdateSingleFn(payload)
 }
+
+func (s *SiteService) ResetRegistry(removeFiles bool) error {
+	return s.ResetRegistryFn(removeFiles)
+}
@@ -45,6 +45,10 @@ func (r RegistryService) ReadEntry(_ string) (string, error) {
 	return "", nil
 }
 
+func (r RegistryService) ReadEntries() (midas.Registry, error) {
+	return midas.Registry{}, nil
+}
+
 func (r RegistryService) UpdateEntry(_, _ string) error {
 	return nil
 }
@@ -21,7 +21,10 @@ type RegistryService interface {
 	RemoveStorage() error
 	Flush() error
 	CreateEntry(id, filename string) error
+	// ReadEntry returns the filename of the entry. ErrNotFound is returned if the id is not tracked,
+	// as well as by UpdateEntry and DeleteEntry.
 	ReadEntry(id string) (string, error)
+	ReadEntries() (Registry, error)
 	UpdateEntry(id, newFilename string) error
 	DeleteEntry(id string) error
 }
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultRetryBackoff = time.Second
+
+type RetrySettings struct {
+	// Attempts is the total number of attempts of the failed step. Default: 1 (no retries)
+	Attempts int `json:"attempts,omitempty"`
+	// Backoff is the delay (in seconds) before the first retry, doubled after each one. Default: 1
+	Backoff float64 `json:"backoff,omitempty"`
+}
+
+// Retryable returns true if the operation which failed with the error may succeed when retried, i.e. after a network
+// failure. Errors of the configuration or the input, the build warnings, and the cancellations aren't retryable.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	switch ErrorCode(err) {
+	case ErrSiteConfig, ErrInvalid, ErrUnaccepted, ErrUnauthorized, ErrNotFound, ErrProcessNotFound, ErrCancelled, ErrUnchanged,
+		ErrBuildWarnings:
+		return false
+	}
+
+	return true
+}
+
+// Retry runs the function until it succeeds, fails with an error which isn't retryable, or the attempts run out.
+// The attempt number (starting at 1) is passed to the function. Returns the last error, or the context error if
+// the context is done while waiting for the retry.
+func Retry(ctx context.Context, settings RetrySettings, fn func(attempt int) error) error {
+	backoff := defaultRetryBackoff
+	if settings.Backoff > 0 {
+		backoff = time.Duration(settings.Backoff * float64(time.Second))
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || attempt >= settings.Attempts || !Retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		backoff *= 2
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package midas_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Success", nil, false},
+		{"Plain", errors.New("connection reset by peer"), true},
+		{"Internal", midas.Errorf(midas.ErrInternal, "hugo crashed"), true},
+		{"Registry", midas.Errorf(midas.ErrRegistry, "registry locked"), true},
+		{"Site config", midas.Errorf(midas.ErrSiteConfig, "bad config"), false},
+		{"Invalid", midas.Errorf(midas.ErrInvalid, "invalid entry"), false},
+		{"Unaccepted", midas.Errorf(midas.ErrUnaccepted, "unknown target"), false},
+		{"Wrapped site config", fmt.Errorf("deploy: %w", midas.Errorf(midas.ErrSiteConfig, "bad config")), false},
+		{"Cancelled", midas.Errorf(midas.ErrCancelled, "cancelled"), false},
+		{"Build warnings", midas.Errorf(midas.ErrBuildWarnings, "hugo build produced 1 warning(s)"), false},
+		{"Context cancelled", fmt.Errorf("upload: %w", context.Canceled), false},
+		{"Deadline", context.DeadlineExceeded, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testing_utils.AssertEquals(t, midas.Retryable(tt.err), tt.want, "Retryable")
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	settings := midas.RetrySettings{Attempts: 3, Backoff: 0.001}
+
+	tests := []struct {
+		name         string
+		settings     midas.RetrySettings
+		errs         []error // Returned by the consecutive attempts, nil afterwards
+		wantAttempts int
+		wantCode     string
+	}{
+		{"Success", settings, nil, 1, ""},
+		{"Recovered", settings, []error{errors.New("timeout"), midas.Errorf(midas.ErrInternal, "hugo crashed")}, 3, ""},
+		{"Attempts run out", settings, []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout"), errors.New("timeout")}, 3, midas.ErrInternal},
+		{"Not retryable", settings, []error{midas.Errorf(midas.ErrSiteConfig, "bad config")}, 1, midas.ErrSiteConfig},
+		{"Not retryable after retry", settings, []error{errors.New("timeout"), midas.Errorf(midas.ErrInvalid, "invalid")}, 2, midas.ErrInvalid},
+		{"Disabled", midas.RetrySettings{}, []error{errors.New("timeout")}, 1, midas.ErrInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := midas.Retry(context.Background(), tt.settings, func(attempt int) error {
+				attempts++
+				if attempt != attempts {
+					t.Errorf("attempt = %d, want %d", attempt, attempts)
+				}
+				if attempt <= len(tt.errs) {
+					return tt.errs[attempt-1]
+				}
+
+				return nil
+			})
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error code": {midas.ErrorCode(err), tt.wantCode},
+				"Attempts":   {attempts, tt.wantAttempts},
+			})
+		})
+	}
+
+	t.Run("Backoff", func(t *testing.T) {
+		start := time.Now()
+		_ = midas.Retry(context.Background(), midas.RetrySettings{Attempts: 3, Backoff: 0.02}, func(_ int) error {
+			return errors.New("timeout")
+		})
+
+		// 20ms before the second attempt, 40ms before the third one
+		testing_utils.AssertEquals(t, time.Since(start) >= 60*time.Millisecond, true, "Backoff doubled")
+	})
+
+	t.Run("Cancelled while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		attempts := 0
+		err := midas.Retry(ctx, midas.RetrySettings{Attempts: 3, Backoff: 10}, func(_ int) error {
+			attempts++
+			cancel()
+			return errors.New("timeout")
+		})
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error":    {err, context.Canceled},
+			"Attempts": {attempts, 1},
+		})
+	})
+}
@@ -59,12 +59,12 @@ func (c *Client) Connect() error {
 	if c.sshConfig.User != "" {
 		config.User = c.sshConfig.User
 	}
-	if _, authMethod, err := c.authenticationMethod(); err != nil {
-		panic(err)
-	} else {
-		if authMethod != nil {
-			config.Auth = *authMethod
-		}
+	_, authMethod, err := c.authenticationMethod()
+	if err != nil {
+		return err
+	}
+	if authMethod != nil {
+		config.Auth = *authMethod
 	}
 
 	// Set SFTP sshClient address
@@ -145,8 +145,8 @@ func (c *Client) RemoveEmptyDirs() error {
 	return err
 }
 
-// UploadNewFile creates a source file in the remote server.
-func (c *Client) UploadNewFile(filePath string, file *os.File) error {
+// UploadNewFile creates a source file with given content in the remote server.
+func (c *Client) UploadNewFile(filePath string, file io.Reader) error {
 	absolutePath := filepath.ToSlash(filepath.Clean(filepath.Join(c.rootDir, filePath)))
 	dir := filepath.ToSlash(filepath.Dir(absolutePath))
 
@@ -213,7 +213,7 @@ func (c *Client) authenticationMethod() (*string, *[]ssh.AuthMethod, error) {
 
 func passwordMethod(sshConfig midas.SFTPDeploymentSettings) (*[]ssh.AuthMethod, error) {
 	if sshConfig.Password == "" {
-		return nil, fmt.Errorf("password authentication method requires password")
+		return nil, midas.Errorf(midas.ErrSiteConfig, "password authentication method requires password")
 	}
 
 	return &[]ssh.AuthMethod{ssh.Password(sshConfig.Password)}, nil
@@ -221,12 +221,12 @@ func passwordMethod(sshConfig midas.SFTPDeploymentSettings) (*[]ssh.AuthMethod,
 
 func keyMethod(sshConfig midas.SFTPDeploymentSettings) (*[]ssh.AuthMethod, error) {
 	if sshConfig.Key == "" {
-		return nil, fmt.Errorf("key authentication method requires key file")
+		return nil, midas.Errorf(midas.ErrSiteConfig, "key authentication method requires key file")
 	}
 
 	key, err := os.ReadFile(sshConfig.Key)
 	if err != nil {
-		return nil, err
+		return nil, midas.Errorf(midas.ErrSiteConfig, "could not read key file: %v", err)
 	}
 
 	var signer ssh.Signer
@@ -238,7 +238,7 @@ func keyMethod(sshConfig midas.SFTPDeploymentSettings) (*[]ssh.AuthMethod, error
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("could not parse private key: %v", err)
+		return nil, midas.Errorf(midas.ErrSiteConfig, "could not parse private key: %v", err)
 	}
 
 	return &[]ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package sftp
+
+import (
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/testing_utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClient_authenticationMethod(t *testing.T) {
+	invalidKey := filepath.Join(t.TempDir(), "id_rsa")
+	if err := os.WriteFile(invalidKey, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings midas.SFTPDeploymentSettings
+		wantCode string
+	}{
+		{"Password", midas.SFTPDeploymentSettings{Method: "password", Password: "secret"}, ""},
+		{"Password missing", midas.SFTPDeploymentSettings{Method: "password"}, midas.ErrSiteConfig},
+		{"Key missing", midas.SFTPDeploymentSettings{Method: "key"}, midas.ErrSiteConfig},
+		{"Key file missing", midas.SFTPDeploymentSettings{Method: "key", Key: filepath.Join(t.TempDir(), "missing")}, midas.ErrSiteConfig},
+		{"Key invalid", midas.SFTPDeploymentSettings{Method: "key", Key: invalidKey}, midas.ErrSiteConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(tt.settings)
+			_, _, err := client.authenticationMethod()
+
+			testing_utils.AssertEquals(t, midas.ErrorCode(err), tt.wantCode, "Error code")
+		})
+	}
+}
@@ -7,39 +7,38 @@
 package sftp
 
 import (
+	"context"
 	"fmt"
 	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/minify"
 	"github.com/kovansky/midas/walk"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var _ midas.Deployment = (*Deployment)(nil)
+var _ midas.FullDeployment = (*Deployment)(nil)
 
 type Deployment struct {
 	site               midas.Site
 	deploymentSettings midas.DeploymentSettings
 	publicPath         string
+	filter             walk.Filter
 
 	sftpClient Client
 }
 
 func New(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft bool) (midas.Deployment, error) {
-	// Get build destination directory
-	var publicPath = filepath.Join(site.RootDir, "public")
-
-	if !isDraft && site.OutputSettings.Build != "" {
-		if filepath.IsAbs(site.OutputSettings.Build) {
-			publicPath = site.OutputSettings.Build
-		} else {
-			publicPath = filepath.Join(site.RootDir, site.OutputSettings.Build)
-		}
-	} else if isDraft && site.OutputSettings.Draft != "" {
-		if filepath.IsAbs(site.OutputSettings.Draft) {
-			publicPath = site.OutputSettings.Draft
-		} else {
-			publicPath = filepath.Join(site.RootDir, site.OutputSettings.Draft)
-		}
+	// Get build destination directory (or its deployed subdirectory)
+	publicPath, err := deploymentSettings.DeployPath(site, isDraft)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := deploymentSettings.FileFilter()
+	if err != nil {
+		return nil, err
 	}
 
 	sftpClient := *NewClient(deploymentSettings.SFTP)
@@ -48,6 +47,7 @@ func New(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft b
 		site:               site,
 		deploymentSettings: deploymentSettings,
 		publicPath:         filepath.ToSlash(publicPath),
+		filter:             filter,
 
 		sftpClient: sftpClient,
 	}, nil
@@ -55,23 +55,64 @@ func New(site midas.Site, deploymentSettings midas.DeploymentSettings, isDraft b
 
 // Deploy uploads the built files to the remote SFTP server.
 func (d *Deployment) Deploy() error {
-	// Retrieve local files.
-	walker, err := d.retrieveFiles()
-	if err != nil {
+	return d.DeployContext(context.Background())
+}
+
+// DeployContext uploads the built files to the remote SFTP server, aborting when the context is cancelled.
+// The SFTP operations can't be interrupted, so the cancellation is checked between them.
+func (d *Deployment) DeployContext(ctx context.Context) error {
+	return d.deploy(ctx, false)
+}
+
+// DeployFull uploads all the built files to the remote SFTP server like DeployContext, including the ones not
+// modified since their upload.
+func (d *Deployment) DeployFull(ctx context.Context) error {
+	return d.deploy(ctx, true)
+}
+
+// deploy uploads the new and modified (or, if full, all) built files and removes the remote files missing locally.
+func (d *Deployment) deploy(ctx context.Context, full bool) (err error) {
+	manifest := midas.NewDeployManifest(d.deploymentSettings.Target)
+	defer func() {
+		midas.Metrics.SiteDeployed(d.site.SiteName, d.deploymentSettings.Target, manifest.Size(), time.Since(manifest.DeployedAt), err)
+	}()
+
+	// Stops the walker, if the deployment returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Guards the live site against the empty build output
+	if err = d.deploymentSettings.CheckOutputPath(d.publicPath); err != nil {
 		return err
 	}
 
+	// Retrieve local files.
+	walker, walkErr := d.retrieveFiles(ctx)
+
 	// And get local files as file map
 	fileMap, err := d.getFileMap(walker)
 	if err != nil {
 		return err
 	}
 
+	// The walk is stopped on cancellation, so the file map may be incomplete
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	// As well as on the walk failure, which would remove the remote files missing in the file map
+	if err = <-walkErr; err != nil {
+		return err
+	}
+
 	// Get remote files.
 	remoteFiles, err := d.remoteFiles()
 
 	// Generate diffs
 	diff := fileMap.Diff(remoteFiles)
+	if full {
+		diff = fileMap.FullDiff(remoteFiles)
+	}
 
 	err = d.sftpClient.Connect()
 	if err != nil {
@@ -81,18 +122,26 @@ func (d *Deployment) Deploy() error {
 		_ = sftpClient.Close()
 	}(&d.sftpClient)
 
+	fileErrors := d.deploymentSettings.NewFileErrors()
 	for _, fileOp := range diff {
-		err := d.syncFile(fileOp)
-		if err != nil {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = fileErrors.Add(fileOp.Path, d.syncFile(fileOp, manifest)); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if err = fileErrors.Err(); err != nil {
+		return err
+	}
+
+	return manifest.Write(d.site, d.deploymentSettings)
 }
 
-// syncFile performs a file operation.
-func (d *Deployment) syncFile(operation walk.FileOperation) error {
+// syncFile performs a file operation. Uploaded files are recorded in the manifest.
+func (d *Deployment) syncFile(operation walk.FileOperation, manifest *midas.DeployManifest) error {
 	switch operation.Type {
 	case walk.UploadFile, walk.UpdateFile:
 		absolute := filepath.ToSlash(filepath.Clean(filepath.Join(d.publicPath, operation.Path)))
@@ -105,7 +154,21 @@ func (d *Deployment) syncFile(operation walk.FileOperation) error {
 			_ = handler.Close()
 		}(handler)
 
-		if err = d.sftpClient.UploadNewFile(operation.Path, handler); err != nil {
+		contentType, err := d.deploymentSettings.ContentType(handler, handler.Name())
+		if err != nil {
+			return err
+		}
+
+		content, _, err := minify.Content(handler, contentType, d.deploymentSettings.Minify)
+		if err != nil {
+			return err
+		}
+
+		if err = d.sftpClient.UploadNewFile(operation.Path, content); err != nil {
+			return err
+		}
+
+		if err = manifest.AddContent(operation.Path, content, contentType); err != nil {
 			return err
 		}
 
@@ -142,19 +205,26 @@ func (d *Deployment) remoteFiles() (walk.FileMap, error) {
 	return files, nil
 }
 
-// retrieveFiles walks the public directory and returns a channel of files to be uploaded.
-func (d *Deployment) retrieveFiles() (walk.FileWalk, error) {
+// retrieveFiles walks the public directory and returns a channel of files to be uploaded, along with the channel
+// receiving the walk error (ErrInternal, or nil if the walk succeeded or was cancelled) once the files channel is
+// closed.
+func (d *Deployment) retrieveFiles(ctx context.Context) (walk.FileWalk, <-chan error) {
 	walker := make(walk.FileWalk)
+	walkErr := make(chan error, 1)
 
-	// Gather the files to upload by walking the path recursively.
+	// Gather the files to upload by walking the path recursively, until the context is cancelled.
 	go func() {
 		defer close(walker)
-		if err := filepath.Walk(d.publicPath, walker.Walk); err != nil {
-			panic(err)
+
+		err := filepath.Walk(d.publicPath, walker.WalkFiltered(ctx, d.publicPath, d.filter))
+		if err != nil && ctx.Err() == nil {
+			walkErr <- midas.Errorf(midas.ErrInternal, "walking %s failed: %s", d.publicPath, err)
+			return
 		}
+		walkErr <- nil
 	}()
 
-	return walker, nil
+	return walker, walkErr
 }
 
 // getFileMap returns locally retreived files in form of a fileMap indexed by their relative path.
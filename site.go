@@ -6,7 +6,12 @@
 
 package midas
 
-import "github.com/rs/zerolog"
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"path/filepath"
+	"strings"
+)
 
 type Site struct {
 	SiteName string `json:"siteName"`
@@ -18,39 +23,353 @@ type Site struct {
 	BuildDrafts bool   `json:"buildDrafts,default=false"`
 	DraftsUrl   string `json:"draftsUrl"`
 
+	// MaxEntrySize is the maximum size (in bytes) of the generated entry file. Default: 10 MiB, negative disables.
+	MaxEntrySize int64 `json:"maxEntrySize,omitempty"`
+	// SelectiveBuild enables rendering only the build scope of the changed model (see ModelSettings.BuildSegments).
+	SelectiveBuild bool `json:"selectiveBuild,omitempty"`
+	// TimeZone is the IANA name of the time zone the dates are formatted in. Default: UTC
+	TimeZone string `json:"timeZone,omitempty"`
+	// SlugCasing is the casing of the generated entry filenames. Can be: lower (default), preserve, kebab.
+	SlugCasing string `json:"slugCasing,omitempty"`
+	// SlugGenerator is the name of the generator registered in SlugGenerators, used for the entry filenames instead
+	// of the built-in one (and SlugCasing). Can be overridden by the model.
+	SlugGenerator string `json:"slugGenerator,omitempty"`
+	// DefaultArchetypePath is used for models whose archetype is missing. If empty, missing archetype is an error.
+	DefaultArchetypePath string `json:"defaultArchetypePath,omitempty"`
+	// ArchetypeSearchPath are the directories (i.e. themes or Hugo modules) searched in order for the relative
+	// archetype paths missing in the RootDir. Relative to the RootDir or absolute, glob patterns are allowed.
+	// Default: themes/*
+	ArchetypeSearchPath []string `json:"archetypeSearchPath,omitempty"`
+	// EntryIdPath is the dotted path of the entry field holding the entry id (e.g. data.id). Default: id
+	EntryIdPath string `json:"entryIdPath,omitempty"`
+	// SkipUnchanged makes the entry creation compare the rendered page with the existing file, skipping the write
+	// (and the build) if they are identical.
+	SkipUnchanged bool `json:"skipUnchanged,omitempty"`
+	// CaseInsensitivePaths makes the entry files whose names differ only in the letter case collide, as they do on
+	// the case-insensitive filesystems. Default: enabled on macOS and Windows.
+	CaseInsensitivePaths *bool `json:"caseInsensitivePaths,omitempty"`
+
+	// FailOnWarnings makes the build fail if the generator output contains lines matching any of WarningPatterns
+	// (regular expressions). Default pattern matches lines starting with WARN.
+	FailOnWarnings  bool     `json:"failOnWarnings,omitempty"`
+	WarningPatterns []string `json:"warningPatterns,omitempty"`
+	// FailedBuildLog makes the failed build write the generator output to a log file in the site root directory.
+	// The output directory is never cleaned, so it holds the partial output of the failed build.
+	FailedBuildLog bool `json:"failedBuildLog,omitempty"`
+	// BuildEnv are the environment variables (i.e. HUGO_ENV) set for the build process, in addition to the inherited
+	// environment. They override the inherited variables of the same name.
+	BuildEnv map[string]string `json:"buildEnv,omitempty"`
+
 	Registry        RegistrySettings         `json:"registry"`
 	CollectionTypes map[string]ModelSettings `json:"collectionTypes"`
 	SingleTypes     map[string]ModelSettings `json:"singleTypes"`
 
+	// Discover generates the collection types from the site layout, in addition to the configured ones.
+	Discover DiscoverSettings `json:"discover,omitempty"`
+	// SearchIndex generates the client-side search index from the tracked entries into the build destination, so
+	// it's deployed with the site.
+	SearchIndex SearchIndexSettings `json:"searchIndex,omitempty"`
+	// Preview configures the entry previews rendered by the Hugo server in memory, without writing the build
+	// destination.
+	Preview PreviewSettings `json:"preview,omitempty"`
+	// AuditLog records every entry change to the append-only, hash-chained log file (see AppendAuditRecord).
+	AuditLog AuditLogSettings `json:"auditLog,omitempty"`
+	// I18n writes the localized entries (by their locale field) as the Hugo language variants.
+	I18n I18nSettings `json:"i18n,omitempty"`
+	// MissingFields configures how the entry fields used by the archetypes, but missing in the entry, are rendered.
+	MissingFields MissingFieldsSettings `json:"missingFields,omitempty"`
+
 	Deployment       DeploymentSettings `json:"deployment"`
 	DraftsDeployment DeploymentSettings `json:"draftsDeployment"`
+	// Retry retries the failed build or deploy of the webhook, if the error may be transient.
+	Retry RetrySettings `json:"retry,omitempty"`
+}
+
+type SearchIndexSettings struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Path    string `json:"path,omitempty"` // Relative to the build destination. Default: search-index.json
+	// Fields are the front matter fields of the entries included in the index (the ones missing are skipped).
+	// Default: title
+	Fields        []string `json:"fields,omitempty"`
+	Content       bool     `json:"content,omitempty"`       // Includes the text of the entry, without HTML
+	ContentLength int      `json:"contentLength,omitempty"` // Truncates the text to given number of characters
+	// Format is either "array" of the entries (default), or "object" with the entries keyed by the url.
+	Format string `json:"format,omitempty"`
+	// ContentDir is the Hugo content directory the urls of the entries are resolved from. Default: content
+	ContentDir string `json:"contentDir,omitempty"`
+}
+
+type I18nSettings struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Languages are the Hugo language keys the entry locales are matched with (case-insensitive). The entries of other
+	// locales are rejected.
+	Languages       []string `json:"languages,omitempty"`
+	DefaultLanguage string   `json:"defaultLanguage,omitempty"` // Default: the first of the Languages
+	LocaleField     string   `json:"localeField,omitempty"`     // Default: locale
+	// ByDirectory writes the entries of each language to its content directory, instead of the language suffix of
+	// the file name (<slug>.<language>.html). The output directory of the model (within the ContentDir) is placed in
+	// the language content directory, i.e. content/posts to content/fr/posts.
+	ByDirectory bool   `json:"byDirectory,omitempty"`
+	ContentDir  string `json:"contentDir,omitempty"` // Relative to the RootDir. Default: content
+	// ContentDirs are the content directories of the languages, relative to the RootDir (like the contentDir of the
+	// Hugo languages). Default: <ContentDir>/<language>
+	ContentDirs map[string]string `json:"contentDirs,omitempty"`
+}
+
+type MissingFieldsSettings struct {
+	// Mode can be: empty (default) - the missing (or null) fields are rendered empty; default - the missing fields
+	// output by the archetype are rendered as the Default; error - the entry missing any field used by the archetype
+	// is rejected.
+	Mode    string `json:"mode,omitempty"`
+	Default string `json:"default,omitempty"`
+}
+
+type AuditLogSettings struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Path    string `json:"path,omitempty"` // Relative to the RootDir. Default: midas-audit.log
+}
+
+type PreviewSettings struct {
+	// Drafts renders the drafts, expired and future entries in the draft environment (like the drafts build).
+	// Otherwise, the preview renders the site like the main build.
+	Drafts  bool `json:"drafts,omitempty"`
+	Timeout int  `json:"timeout,omitempty"` // Seconds to wait for the rendered page. Default: 30
 }
 
 type OutputSettings struct {
 	Build            string `json:"build,omitempty"`
 	Draft            string `json:"draft,omitempty"`
 	DraftEnvironment string `json:"draftEnvironment,omitempty"`
+	// BaseURL overrides the base URL of the site configuration in the main build (i.e. for preview deploys to
+	// a temporary URL). The drafts build uses the site DraftsUrl instead.
+	BaseURL string `json:"baseUrl,omitempty"`
 }
 
 type ModelSettings struct {
-	ArchetypePath string `json:"archetypePath,omitempty"`
-	OutputDir     string `json:"outputDir,omitempty"`
-	Fields        struct {
+	ArchetypePath        string `json:"archetypePath,omitempty"`
+	Archetype            string `json:"archetype,omitempty"`         // Inline archetype, takes precedence over ArchetypePath
+	BaseArchetypePath    string `json:"baseArchetypePath,omitempty"` // Parsed before archetype, which can override its blocks
+	OutputDir            string `json:"outputDir,omitempty"`
+	DraftOutputDir       string `json:"draftOutputDir,omitempty"` // Unpublished entries are written here, if set
+	SectionArchetypePath string `json:"sectionArchetypePath,omitempty"`
+	Fields               struct {
 		Title *string   `json:"title,omitempty"`
 		HTML  *[]string `json:"html,omitempty"`
+		Body  *string   `json:"body,omitempty"` // Exposed to the archetype as .Body
+		// OutputDir is the entry field holding the subdirectory of the model output directory for the entry.
+		OutputDir *string `json:"outputDir,omitempty"`
+		// Allowed are the only entry fields exposed to the archetype (including .Body, taxonomies and dates). All
+		// fields are exposed, if not set.
+		Allowed *[]string `json:"allowed,omitempty"`
 	} `json:"fields"`
+	Taxonomies map[string]TaxonomySettings `json:"taxonomies,omitempty"` // [hugo taxonomy] => settings
+	Dates      map[string]string           `json:"dates,omitempty"`      // [front matter key] => entry field
+	Media      MediaSettings               `json:"media,omitempty"`
+	// BuildSegments are the Hugo segments (configured in the Hugo site config) rendered when the model entry changes,
+	// if the site SelectiveBuild is enabled.
+	BuildSegments []string `json:"buildSegments,omitempty"`
+	// AliasOnRename makes the previous slug of the renamed entry available to the archetype as Hugo alias.
+	AliasOnRename bool `json:"aliasOnRename,omitempty"`
+	// TrustedBody makes the body field written as is, without escaping or sanitizing. Use only if the CMS content
+	// is trusted.
+	TrustedBody bool `json:"trustedBody,omitempty"`
+	// MarkdownBody converts the HTML body field to Markdown. Elements without Markdown equivalent are kept as raw HTML.
+	MarkdownBody bool `json:"markdownBody,omitempty"`
+	// Timestamps writes the entry timestamps to the front matter as Hugo date and lastmod.
+	Timestamps TimestampSettings `json:"timestamps,omitempty"`
+	// SlugTemplate is the Go template over the entry fields generating the entry filename, i.e.
+	// {{ date "2006" .publishedAt }}-{{ .Title }}. Default: the title field.
+	SlugTemplate string `json:"slugTemplate,omitempty"`
+	// HomePage renders the single type with the archetype as the site home page (_index.md in the OutputDir,
+	// content by default), instead of writing it as JSON data.
+	HomePage bool `json:"homePage,omitempty"`
+	// PostWrite is run on the file written for the entry, i.e. to format it. The operation fails if it errors.
+	PostWrite PostWriteSettings `json:"postWrite,omitempty"`
+	// DataDir makes the collection entry written also as JSON data file (<slug>.json) to this directory, i.e. for
+	// the client-side scripts. The page can be disabled independently, with OutputDir set to false.
+	DataDir string `json:"dataDir,omitempty"`
+	// Cleanup removes the rich-text editor artifacts from the HTML fields before rendering.
+	Cleanup CleanupSettings `json:"cleanup,omitempty"`
+	// SlugGenerator is the name of the generator registered in SlugGenerators, overriding the site one.
+	SlugGenerator string `json:"slugGenerator,omitempty"`
+	// OutputFile renders the single type with the archetype to this file in the OutputDir (content by default), i.e.
+	// about.md, instead of writing it as JSON data. The file is overwritten on each update.
+	OutputFile string `json:"outputFile,omitempty"`
+	// ArchetypeDefaults treats the front matter of the rendered archetype as the defaults: the top level keys are set
+	// to the entry fields of the same name (case-insensitive), if the entry has them. Only the scalar fields are merged.
+	ArchetypeDefaults bool `json:"archetypeDefaults,omitempty"`
+	// Transformers are the names of the functions registered in PayloadTransformers, applied in order to the entry
+	// before it's created or updated (so the derived fields are available for the slug, id and archetype).
+	Transformers []string `json:"transformers,omitempty"`
+	// Permalink is the Hugo-like pattern of the entry path within the output directory, i.e. ":section/:year/:slug",
+	// so the file location matches the permalinks of the site. The dates are read from the timestamps date field.
+	Permalink string `json:"permalink,omitempty"`
+	// PreserveFrontMatter keeps the front matter keys added to the entry file manually on update: the keys of the
+	// existing file missing in the rendered front matter are added to it, unless they were rendered by the previous
+	// update (tracked in the registry). The rendered values win for the others.
+	PreserveFrontMatter bool `json:"preserveFrontMatter,omitempty"`
+	// Renderer is the name of the renderer registered in Renderers, rendering the entry page instead of the
+	// archetype.
+	Renderer string `json:"renderer,omitempty"`
+	// Bundle writes each entry as a Hugo page bundle (a directory named after the slug, or the permalink) instead of
+	// a single file: "leaf" (index file) or "branch" (_index file).
+	Bundle string `json:"bundle,omitempty"`
+	// BundleIndex is the file name of the bundle index, i.e. "index.md". It must match the bundle type. Default:
+	// index.html for the leaf bundles, _index.html for the branch bundles
+	BundleIndex string `json:"bundleIndex,omitempty"`
+}
+
+type CleanupSettings struct {
+	Enabled bool `json:"enabled"`
+	// Fields are the cleaned entry fields. Default: the HTML fields and the body field.
+	Fields []string `json:"fields,omitempty"`
+	// Attributes are the names of the removed attributes, a trailing * matches any suffix.
+	// Default: data-*, contenteditable, spellcheck
+	Attributes []string `json:"attributes,omitempty"`
+	// KeepEmptyParagraphs keeps the paragraphs holding only whitespace and line breaks.
+	KeepEmptyParagraphs bool `json:"keepEmptyParagraphs,omitempty"`
+	// KeepNonBreakingSpaces keeps the non-breaking spaces next to other whitespace or at the text boundaries, which
+	// are replaced with regular spaces otherwise. Non-breaking spaces between words are always kept.
+	KeepNonBreakingSpaces bool `json:"keepNonBreakingSpaces,omitempty"`
+}
+
+type PostWriteSettings struct {
+	// Hook is the name of the Go function registered in PostWriteHooks. Run before the command.
+	Hook string `json:"hook,omitempty"`
+	// Command is run in the site root directory, with the file path appended as the last argument.
+	Command []string `json:"command,omitempty"`
+}
+
+// PostWriteHook transforms the file written for the entry of the site.
+type PostWriteHook func(site Site, path string) error
+
+// PayloadTransformer returns the entry with the derived fields computed, i.e. the reading time. The entry may be
+// modified in place. It should be idempotent, as the transformed entry may be transformed again.
+type PayloadTransformer func(entry map[string]interface{}) (map[string]interface{}, error)
+
+// Renderer renders the content of the entry page, i.e. with a templating engine other than the archetype Go
+// templates used by default. The entry is filtered, cleaned up and has the HTML fields sanitized, as for the
+// archetype, and holds the front matter dates and aliases under their keys.
+type Renderer interface {
+	Render(model string, entry map[string]interface{}) ([]byte, error)
+}
+
+// RendererFunc allows using the ordinary function as Renderer.
+type RendererFunc func(model string, entry map[string]interface{}) ([]byte, error)
+
+// Render calls f(model, entry).
+func (f RendererFunc) Render(model string, entry map[string]interface{}) ([]byte, error) {
+	return f(model, entry)
+}
+
+type TimestampSettings struct {
+	Enabled bool   `json:"enabled"`
+	Date    string `json:"date,omitempty"`    // Entry field written as date. Default: createdAt
+	Lastmod string `json:"lastmod,omitempty"` // Entry field written as lastmod. Default: updatedAt
+}
+
+type MediaSettings struct {
+	// Rewrite enables rewriting of the media URLs using the URLTemplate.
+	Rewrite bool `json:"rewrite,omitempty"`
+	// URLTemplate is a Go template generating the new media URL. Available fields: .URL (original URL),
+	// .Path (path of the original URL) and .Name (file name).
+	URLTemplate string `json:"urlTemplate,omitempty"`
+	// Dimensions sets the width and height of the image media objects missing them, read from the media files in Dir.
+	// The images downloaded into the page bundle are added to the front matter as the resources instead, with the
+	// width and height params read from the files.
+	Dimensions bool `json:"dimensions,omitempty"`
+	// Dir is the directory the media URL paths are resolved in (i.e. the Strapi public directory). Can be absolute
+	// or relative to the site root directory.
+	Dir string `json:"dir,omitempty"`
+	// Download downloads the media files of the entry (including their formats) missing in Dir, at the paths of
+	// their URLs (i.e. /uploads/cover.png to <Dir>/uploads/cover.png), before the entry is written. Requires Dir,
+	// unless the model writes the page bundles: the media are downloaded into the bundle then, by their file names.
+	Download bool `json:"download,omitempty"`
+	// BaseURL is the URL the relative media URLs (i.e. /uploads/cover.png of the Strapi local uploads) are
+	// downloaded from, i.e. the Strapi URL.
+	BaseURL string `json:"baseUrl,omitempty"`
+	// Timeout is the time (in seconds) each download request may take. Default: 60
+	Timeout float64 `json:"timeout,omitempty"`
+	// Retry retries the failed downloads, resuming them from the downloaded part if the server supports the range
+	// requests.
+	Retry RetrySettings `json:"retry,omitempty"`
+}
+
+type TaxonomySettings struct {
+	// Field is the name of the entry field holding the relation (or array).
+	Field string `json:"field"`
+	// Term is the name of the related item's field used as the taxonomy term. Default: name
+	Term string `json:"term,omitempty"`
 }
 
 type RegistrySettings struct {
 	Type     string `json:"type"`
 	Location string `json:"location"`
+	// Namespace separates the entries of the sites sharing the registry storage, i.e. the site name.
+	Namespace string `json:"namespace,omitempty"`
+	// Format of the registry storage content. Supported formats depend on the registry type. Default: json
+	Format string `json:"format,omitempty"`
+	// ShardByModel keeps the entries of each model in a separate storage, located as returned by ShardLocation.
+	ShardByModel bool `json:"shardByModel,omitempty"`
+	// RequireExisting fails the site setup if the registry storage can't be opened, instead of creating a new, empty
+	// one (which would make all the entries to be re-created).
+	RequireExisting bool `json:"requireExisting,omitempty"`
+}
+
+// ShardLocation returns the location of the model registry shard: the Location with the model name inserted before
+// the extension, i.e. registry.post.json.
+func (r RegistrySettings) ShardLocation(model string) string {
+	extension := filepath.Ext(r.Location)
+	return strings.TrimSuffix(r.Location, extension) + "." + model + extension
 }
 
 type SiteService interface {
 	GetRegistryService() (RegistryService, error)
 	BuildSite(useCache bool, log zerolog.Logger) error
+	// BuildModel builds the site after the entry of the model changed. If selective builds are enabled and the model
+	// has build scope configured, only that scope is rendered; otherwise it works as BuildSite.
+	BuildModel(model string, useCache bool, log zerolog.Logger) error
 	CreateEntry(payload Payload) (string, error)
 	UpdateEntry(payload Payload) (string, error)
 	DeleteEntry(payload Payload) (string, error)
 	UpdateSingle(payload Payload) (string, error)
+	// ResetRegistry removes all the entries from the registry. If removeFiles is true, the tracked files
+	// (only those placed within the site root directory) are removed as well.
+	ResetRegistry(removeFiles bool) error
+}
+
+// ContextSiteService is implemented by the site services whose entry writes can be aborted, i.e. the long media
+// downloads of the entry.
+type ContextSiteService interface {
+	// CreateEntryContext works as CreateEntry, aborting when the context is cancelled.
+	CreateEntryContext(ctx context.Context, payload Payload) (string, error)
+	// UpdateEntryContext works as UpdateEntry, aborting when the context is cancelled.
+	UpdateEntryContext(ctx context.Context, payload Payload) (string, error)
+}
+
+// BuildDestination returns the build destination of the site (or drafts site), as passed to the generator: the
+// configured output directory, or public (publicDrafts for drafts) by default. Relative paths are relative to
+// the RootDir.
+func (s Site) BuildDestination(isDraft bool) string {
+	if isDraft {
+		if s.OutputSettings.Draft != "" {
+			return s.OutputSettings.Draft
+		}
+		return "publicDrafts"
+	}
+
+	if s.OutputSettings.Build != "" {
+		return s.OutputSettings.Build
+	}
+	return "public"
+}
+
+// PublicPath returns the directory where the site (or drafts site) is built, resolved from the BuildDestination.
+func (s Site) PublicPath(isDraft bool) string {
+	destination := s.BuildDestination(isDraft)
+	if filepath.IsAbs(destination) {
+		return destination
+	}
+
+	return filepath.Join(s.RootDir, destination)
 }
@@ -22,6 +22,7 @@ type Payload struct {
 	entry     map[string]interface{}
 }
 
+// ParsePayload parses the Strapi webhook body (the event, model and entry envelope) into the payload.
 func ParsePayload(json []byte) (midas.Payload, error) {
 	payload := Payload{}
 	err := payload.UnmarshalJSON(json)
@@ -30,6 +31,13 @@ func ParsePayload(json []byte) (midas.Payload, error) {
 		return nil, err
 	}
 
+	if payload.Model == "" {
+		return nil, midas.Errorf(midas.ErrInvalid, "payload model is missing")
+	}
+	if payload.entry == nil {
+		return nil, midas.Errorf(midas.ErrInvalid, "payload entry is missing")
+	}
+
 	payload.createMetadataMap()
 
 	return &payload, nil
@@ -62,7 +70,7 @@ func (p Payload) Entry() map[string]interface{} {
 	return p.entry
 }
 
-func (p Payload) SetEntry(entry map[string]interface{}) {
+func (p *Payload) SetEntry(entry map[string]interface{}) {
 	p.entry = entry
 }
 
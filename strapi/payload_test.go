@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package strapi_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/kovansky/midas"
+	"github.com/kovansky/midas/strapi"
+	"github.com/kovansky/midas/testing_utils"
+	"testing"
+	"time"
+)
+
+// Webhook bodies as sent by Strapi v4.
+const (
+	createFixture = `{
+  "event": "entry.create",
+  "createdAt": "2022-05-02T10:21:45.392Z",
+  "model": "post",
+  "entry": {
+    "id": 4,
+    "Title": "Hello world",
+    "Content": "<p>First post</p>",
+    "createdAt": "2022-05-02T10:21:45.377Z",
+    "updatedAt": "2022-05-02T10:21:45.377Z",
+    "publishedAt": null,
+    "author": {"id": 1, "name": "Jane"}
+  }
+}`
+	publishFixture = `{
+  "event": "entry.publish",
+  "createdAt": "2022-05-02T10:25:03.001Z",
+  "model": "post",
+  "entry": {
+    "id": 4,
+    "Title": "Hello world",
+    "createdAt": "2022-05-02T10:21:45.377Z",
+    "updatedAt": "2022-05-02T10:25:02.985Z",
+    "publishedAt": "2022-05-02T10:25:02.981Z"
+  }
+}`
+	singleFixture = `{
+  "event": "entry.update",
+  "createdAt": "2022-05-03T08:00:00.000Z",
+  "model": "homepage",
+  "entry": {
+    "id": 1,
+    "Headline": "Welcome",
+    "createdAt": "2022-04-01T08:00:00.000Z",
+    "updatedAt": "2022-05-03T08:00:00.000Z"
+  }
+}`
+)
+
+func TestParsePayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		event     string
+		model     string
+		createdAt time.Time
+		published bool
+		id        interface{}
+	}{
+		{"Create", createFixture, "Create", "post", time.Date(2022, 5, 2, 10, 21, 45, 392000000, time.UTC), false, float64(4)},
+		{"Publish", publishFixture, "Publish", "post", time.Date(2022, 5, 2, 10, 25, 3, 1000000, time.UTC), true, float64(4)},
+		{"Single type without draft", singleFixture, "Update", "homepage", time.Date(2022, 5, 3, 8, 0, 0, 0, time.UTC), false, float64(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := strapi.ParsePayload([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("error parsing payload: %s", err)
+			}
+
+			metadata := payload.Metadata()
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Event":      {payload.Event(), tt.event},
+				"Model":      {metadata["model"], tt.model},
+				"Created at": {metadata["createdAt"].(time.Time).Equal(tt.createdAt), true},
+				"Published":  {metadata["published"], tt.published},
+				"Entry id":   {payload.Entry()["id"], tt.id},
+			})
+		})
+	}
+
+	t.Run("Nested entry fields", func(t *testing.T) {
+		payload, _ := strapi.ParsePayload([]byte(createFixture))
+		author, ok := payload.Entry()["author"].(map[string]interface{})
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Is map":      {ok, true},
+			"Author name": {author["name"], "Jane"},
+		})
+	})
+
+	t.Run("Unknown event", func(t *testing.T) {
+		payload, err := strapi.ParsePayload([]byte(`{"event": "media.create", "model": "file", "entry": {"id": 1}}`))
+
+		testing_utils.AssertTable(t, map[string][]interface{}{
+			"Error": {err, nil},
+			"Event": {payload.Event(), ""},
+		})
+	})
+}
+
+func TestParsePayload_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{"Missing model", `{"event": "entry.create", "entry": {"id": 1}}`, midas.ErrInvalid},
+		{"Missing entry", `{"event": "entry.create", "model": "post"}`, midas.ErrInvalid},
+		{"Null entry", `{"event": "entry.create", "model": "post", "entry": null}`, midas.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := strapi.ParsePayload([]byte(tt.body))
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Payload":    {payload, nil},
+				"Error code": {midas.ErrorCode(err), tt.code},
+			})
+		})
+	}
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		_, err := strapi.ParsePayload([]byte(`{"event": `))
+
+		var syntaxErr *json.SyntaxError
+		testing_utils.AssertEquals(t, errors.As(err, &syntaxErr), true, "Syntax error")
+	})
+}
+
+func TestPayload_SetEntry(t *testing.T) {
+	payload, _ := strapi.ParsePayload([]byte(createFixture))
+	payload.SetEntry(map[string]interface{}{"id": float64(5), "Title": "Replaced"})
+
+	marshalled, err := payload.MarshalJSON()
+	if err != nil {
+		t.Fatalf("error marshalling payload: %s", err)
+	}
+
+	reparsed, _ := strapi.ParsePayload(marshalled)
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Entry title":   {payload.Entry()["Title"], "Replaced"},
+		"Marshalled":    {reparsed.Entry()["Title"], "Replaced"},
+		"Event kept":    {reparsed.Event(), "Create"},
+		"Model kept":    {reparsed.Metadata()["model"], "post"},
+		"Metadata kept": {reparsed.Metadata()["published"], false},
+	})
+}
@@ -6,9 +6,79 @@
 
 package midas
 
-import "github.com/gosimple/slug"
+import (
+	"github.com/gosimple/slug"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	SlugCasingLower    = "lower"    // Slug is lowercased, e.g. "MyPost Title" -> "mypost-title"
+	SlugCasingPreserve = "preserve" // Slug keeps the case of the title, e.g. "MyPost Title" -> "MyPost-Title"
+	SlugCasingKebab    = "kebab"    // Slug is lowercased with camel case split, e.g. "MyPost Title" -> "my-post-title"
+)
+
+// SlugGenerator generates the entry filename (without extension) from its title (or the result of the model slug
+// template). The entry fields are available for the custom rules, i.e. the date prefixes.
+type SlugGenerator interface {
+	Slug(title string, entry map[string]interface{}) (string, error)
+}
+
+// SlugGeneratorFunc allows using the ordinary function as SlugGenerator.
+type SlugGeneratorFunc func(title string, entry map[string]interface{}) (string, error)
+
+// Slug calls f(title, entry).
+func (f SlugGeneratorFunc) Slug(title string, entry map[string]interface{}) (string, error) {
+	return f(title, entry)
+}
+
+// slugMu guards the global slug package settings.
+var slugMu sync.Mutex
 
 // CreateSlug generates an url-safe string from title (or any other string) to be used as post/page slug.
 func CreateSlug(title string) string {
-	return slug.Make(title)
+	return CreateCasedSlug(title, SlugCasingLower)
+}
+
+// CreateCasedSlug works as CreateSlug, but uses provided casing (one of SlugCasing constants). Unknown casing
+// falls back to lower.
+func CreateCasedSlug(title, casing string) string {
+	slugMu.Lock()
+	defer slugMu.Unlock()
+
+	switch casing {
+	case SlugCasingPreserve:
+		slug.Lowercase = false
+		defer func() {
+			slug.Lowercase = true
+		}()
+
+		return slug.Make(title)
+	case SlugCasingKebab:
+		return slug.Make(splitCamelCase(title))
+	default:
+		return slug.Make(title)
+	}
+}
+
+// splitCamelCase separates the camel case words with spaces, e.g. "HTTPServerName" -> "HTTP Server Name".
+func splitCamelCase(title string) string {
+	runes := []rune(title)
+
+	var builder strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				builder.WriteRune(' ')
+			}
+		}
+
+		builder.WriteRune(r)
+	}
+
+	return builder.String()
 }
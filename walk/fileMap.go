@@ -64,3 +64,32 @@ func (f FileMap) Diff(other FileMap) (diff []FileOperation) {
 
 	return
 }
+
+// FullDiff works like Diff, but all the files of the calling FileMap are uploaded (UpdateFile if they exist in the
+// other FileMap), regardless of their modification time.
+func (f FileMap) FullDiff(other FileMap) (diff []FileOperation) {
+	for name, info := range f {
+		operationType := UploadFile
+		if _, ok := other[name]; ok {
+			operationType = UpdateFile
+		}
+
+		diff = append(diff, FileOperation{
+			Path: name,
+			Info: info,
+			Type: operationType,
+		})
+	}
+
+	for name, info := range other {
+		if _, ok := f[name]; !ok {
+			diff = append(diff, FileOperation{
+				Path: name,
+				Info: info,
+				Type: RemoveFile,
+			})
+		}
+	}
+
+	return
+}
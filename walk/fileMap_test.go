@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package walk_test
+
+import (
+	"fmt"
+	"github.com/kovansky/midas/testing_utils"
+	"github.com/kovansky/midas/walk"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFileInfo is the os.FileInfo with only the modification time.
+type fakeFileInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (f fakeFileInfo) ModTime() time.Time {
+	return f.modTime
+}
+
+// operations formats the operations as sorted "<type> <path>" entries.
+func operations(diff []walk.FileOperation) string {
+	var entries []string
+	for _, operation := range diff {
+		entries = append(entries, fmt.Sprintf("%d %s", operation.Type, operation.Path))
+	}
+	sort.Strings(entries)
+
+	return strings.Join(entries, ",")
+}
+
+func TestFileMap_FullDiff(t *testing.T) {
+	older := fakeFileInfo{modTime: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newer := fakeFileInfo{modTime: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)}
+
+	local := walk.FileMap{
+		"index.html":     newer,
+		"posts/a.html":   older,
+		"posts/new.html": older,
+	}
+	remote := walk.FileMap{
+		"index.html":     older,
+		"posts/a.html":   newer,
+		"posts/old.html": older,
+	}
+
+	testing_utils.AssertTable(t, map[string][]interface{}{
+		"Diff": {operations(local.Diff(remote)), fmt.Sprintf("%d posts/new.html,%d index.html,%d posts/old.html",
+			walk.UploadFile, walk.UpdateFile, walk.RemoveFile)},
+		"Full diff": {operations(local.FullDiff(remote)), fmt.Sprintf("%d posts/new.html,%d index.html,%d posts/a.html,%d posts/old.html",
+			walk.UploadFile, walk.UpdateFile, walk.UpdateFile, walk.RemoveFile)},
+	})
+}
@@ -6,7 +6,11 @@
 
 package walk
 
-import "os"
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
 
 type FileWalk chan string
 
@@ -20,3 +24,33 @@ func (f FileWalk) Walk(path string, info os.FileInfo, err error) error {
 	f <- path
 	return nil
 }
+
+// WalkContext returns the walk function which stops the walk (with the context error) when the context is cancelled,
+// so the walking goroutine doesn't block if the files are no longer received.
+func (f FileWalk) WalkContext(ctx context.Context) filepath.WalkFunc {
+	return f.WalkFiltered(ctx, "", Filter{})
+}
+
+// WalkFiltered returns the walk function like WalkContext, which skips the files (relative to the root) not matching
+// the filter.
+func (f FileWalk) WalkFiltered(ctx context.Context, root string, filter Filter) filepath.WalkFunc {
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return ctx.Err()
+		}
+
+		if rel, err := filepath.Rel(root, path); err == nil && !filter.Match(filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		select {
+		case f <- path:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package walk
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Filter selects the walked files by glob patterns matched against the slash separated path relative to the walked
+// directory. Patterns without a slash match the file name at any depth (i.e. ".DS_Store", "*.map"), other patterns
+// match the whole relative path, where "**" matches any number of directories (i.e. "images/originals/**").
+//
+// If any include patterns are set, only the files matching at least one of them are walked. Exclude patterns take
+// precedence: the file matching any of them is skipped, even if it is included.
+type Filter struct {
+	include []string
+	exclude []string
+}
+
+// NewFilter creates the filter, returning an error if any of the patterns is malformed.
+func NewFilter(include, exclude []string) (Filter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return Filter{}, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return Filter{include: include, exclude: exclude}, nil
+}
+
+// Match returns true if the file (path relative to the walked directory) should be walked.
+func (f Filter) Match(rel string) bool {
+	rel = strings.TrimPrefix(path.Clean(strings.ReplaceAll(rel, "\\", "/")), "/")
+
+	for _, pattern := range f.exclude {
+		if matchPattern(pattern, rel) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+
+	for _, pattern := range f.include {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPattern returns true if the relative path matches the pattern.
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		matched, _ := path.Match(pattern, path.Base(rel))
+		return matched
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches the path segments against the pattern segments, where "**" matches zero or more segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
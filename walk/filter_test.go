@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2022.
+ *
+ * Originally created by F4 Developer (Stanisław Kowański). Released under GNU GPLv3 (see LICENSE)
+ */
+
+package walk_test
+
+import (
+	"context"
+	"github.com/kovansky/midas/testing_utils"
+	"github.com/kovansky/midas/walk"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFilter_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		rel      string
+		expected bool
+	}{
+		{"No patterns", nil, nil, "posts/hello/index.html", true},
+		{"Name at root", nil, []string{".DS_Store"}, ".DS_Store", false},
+		{"Name nested", nil, []string{".DS_Store"}, "images/2022/.DS_Store", false},
+		{"Extension nested", nil, []string{"*.map"}, "js/vendor/app.js.map", false},
+		{"Extension not matching", nil, []string{"*.map"}, "js/vendor/app.js", true},
+		{"Anchored path", nil, []string{"images/originals/**"}, "images/originals/2022/photo.jpg", false},
+		{"Anchored path elsewhere", nil, []string{"images/originals/**"}, "blog/images/originals/photo.jpg", true},
+		{"Double star in the middle", nil, []string{"**/drafts/*.html"}, "blog/2022/drafts/post.html", false},
+		{"Double star matching no directory", nil, []string{"**/drafts/*.html"}, "drafts/post.html", false},
+		{"Single star is one segment", nil, []string{"blog/*/index.html"}, "blog/2022/05/index.html", true},
+		{"Windows separators", nil, []string{"images/originals/**"}, `images\originals\photo.jpg`, false},
+		{"Included", []string{"blog/**"}, nil, "blog/post/index.html", true},
+		{"Not included", []string{"blog/**"}, nil, "shop/index.html", false},
+		{"Excluded takes precedence", []string{"blog/**"}, []string{"*.map"}, "blog/app.js.map", false},
+		{"One of includes", []string{"*.html", "*.css"}, nil, "css/site.css", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := walk.NewFilter(tt.include, tt.exclude)
+
+			testing_utils.AssertTable(t, map[string][]interface{}{
+				"Error": {err, nil},
+				"Match": {filter.Match(tt.rel), tt.expected},
+			})
+		})
+	}
+}
+
+func TestNewFilter_InvalidPattern(t *testing.T) {
+	_, err := walk.NewFilter(nil, []string{"images/[a-"})
+
+	testing_utils.AssertEquals(t, err != nil, true, "Error")
+}
+
+func TestFileWalk_WalkFiltered(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{"index.html", ".DS_Store", "js/app.js", "js/app.js.map", "images/originals/big.png", "images/small.png"} {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := walk.NewFilter(nil, []string{".DS_Store", "*.map", "images/originals/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walker := make(walk.FileWalk)
+	go func() {
+		defer close(walker)
+		_ = filepath.Walk(root, walker.WalkFiltered(context.Background(), root, filter))
+	}()
+
+	var walked []string
+	for path := range walker {
+		rel, _ := filepath.Rel(root, path)
+		walked = append(walked, filepath.ToSlash(rel))
+	}
+	sort.Strings(walked)
+
+	testing_utils.AssertEquals(t, strings.Join(walked, ","), "images/small.png,index.html,js/app.js", "Walked files")
+}